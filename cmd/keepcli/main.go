@@ -12,6 +12,9 @@ func main() {
 	version, commit, date := buildinfo.Info()
 
 	app := cli.NewRootCmd(version, commit, date)
+	if args, ok := cli.DockerCredentialArgs(os.Args[0], os.Args[1:]); ok {
+		app.SetArgs(args)
+	}
 	if err := app.Execute(); err != nil {
 		os.Exit(1)
 	}
@@ -0,0 +1,351 @@
+package agentd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/logging"
+)
+
+const (
+	apiPrefix = "/api"
+
+	// Ответ с этим заголовком клиент превращает обратно в сетевую ошибку.
+	UpstreamErrorHeader = "X-Keepcli-Agent-Upstream-Error"
+	CacheHeader         = "X-Keepcli-Agent-Cache"
+
+	DefaultCacheTTL        = time.Minute
+	DefaultRefreshInterval = 10 * time.Minute
+	maxRequestBody         = 32 << 20
+)
+
+var (
+	minRefreshInterval = 30 * time.Second
+	refreshRetry       = 30 * time.Second
+	flushInterval      = 30 * time.Second
+)
+
+// RefreshFunc возвращает срок жизни access-токена; 0 — сервер его не сообщил.
+type RefreshFunc func(ctx context.Context) (time.Duration, error)
+
+type Options struct {
+	Upstream *http.Client
+	BaseURL  string
+	// Клиенты с другим хранилищем токенов обращаются к серверу напрямую.
+	Identity   string
+	Socket     string
+	CacheTTL   time.Duration
+	Refresh    RefreshFunc
+	Invalidate func()
+	Flush      func(ctx context.Context) error
+	Log        logging.Logger
+}
+
+type Status struct {
+	PID         int       `json:"pid"`
+	BaseURL     string    `json:"base_url"`
+	Identity    string    `json:"identity"`
+	Socket      string    `json:"socket"`
+	StartedAt   time.Time `json:"started_at"`
+	CachedItems int       `json:"cached_items"`
+	LastRefresh time.Time `json:"last_refresh,omitzero"`
+}
+
+type cachedResponse struct {
+	stored time.Time
+	header http.Header
+	body   []byte
+	status int
+}
+
+type Server struct {
+	opts        Options
+	started     time.Time
+	stop        context.CancelFunc
+	cache       map[string]cachedResponse
+	lastRefresh time.Time
+	mu          sync.Mutex
+}
+
+func New(opts Options) *Server {
+	if opts.CacheTTL == 0 {
+		opts.CacheTTL = DefaultCacheTTL
+	}
+	if opts.Upstream == nil {
+		opts.Upstream = http.DefaultClient
+	}
+	opts.BaseURL = strings.TrimRight(opts.BaseURL, "/")
+	return &Server{opts: opts, started: time.Now(), cache: map[string]cachedResponse{}}
+}
+
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.mu.Lock()
+	s.stop = cancel
+	s.mu.Unlock()
+	if s.opts.Refresh != nil {
+		go s.refreshLoop(ctx)
+	}
+	if s.opts.Flush != nil {
+		go s.flushLoop(ctx)
+	}
+	srv := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ConnContext:       withPeer,
+	}
+	go func() {
+		<-ctx.Done()
+		sctx, scancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer scancel()
+		_ = srv.Shutdown(sctx)
+	}()
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /agent/status", s.handleStatus)
+	mux.HandleFunc("POST /agent/reload", s.handleReload)
+	mux.HandleFunc("POST /agent/stop", s.handleStop)
+	mux.HandleFunc(apiPrefix+"/", s.handleProxy)
+	return requireSameUser(mux)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	st := Status{
+		PID:         os.Getpid(),
+		BaseURL:     s.opts.BaseURL,
+		Identity:    s.opts.Identity,
+		Socket:      s.opts.Socket,
+		StartedAt:   s.started,
+		CachedItems: len(s.cache),
+		LastRefresh: s.lastRefresh,
+	}
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(st)
+}
+
+func (s *Server) handleReload(w http.ResponseWriter, _ *http.Request) {
+	s.purge()
+	if s.opts.Invalidate != nil {
+		s.opts.Invalidate()
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleStop(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+	s.mu.Lock()
+	stop := s.stop
+	s.mu.Unlock()
+	if stop != nil {
+		go stop()
+	}
+}
+
+func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.RequestURI()
+	cacheable := r.Method == http.MethodGet && isItemsPath(r.URL.Path)
+	if cacheable {
+		if c, ok := s.cached(key); ok {
+			writeCached(w, c, "hit")
+			return
+		}
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxRequestBody {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	target := s.opts.BaseURL + strings.TrimPrefix(r.URL.Path, apiPrefix)
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	var rd io.Reader
+	if len(body) > 0 {
+		rd = bytes.NewReader(body)
+	}
+	out, err := http.NewRequestWithContext(r.Context(), r.Method, target, rd)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for k, vs := range r.Header {
+		if skipHeader(k) {
+			continue
+		}
+		out.Header[k] = append([]string(nil), vs...)
+	}
+	resp, err := s.opts.Upstream.Do(out)
+	if err != nil {
+		s.logf("agent upstream request failed", err)
+		w.Header().Set(UpstreamErrorHeader, err.Error())
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		s.purge()
+	}
+	if !cacheable || resp.StatusCode != http.StatusOK {
+		copyHeader(w.Header(), resp.Header)
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+		return
+	}
+	rb, err := io.ReadAll(resp.Body)
+	if err != nil {
+		w.Header().Set(UpstreamErrorHeader, err.Error())
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	c := cachedResponse{stored: time.Now(), header: resp.Header.Clone(), body: rb, status: resp.StatusCode}
+	s.mu.Lock()
+	s.cache[key] = c
+	s.mu.Unlock()
+	writeCached(w, c, "miss")
+}
+
+func (s *Server) cached(key string) (cachedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.cache[key]
+	if !ok {
+		return cachedResponse{}, false
+	}
+	if time.Since(c.stored) > s.opts.CacheTTL {
+		delete(s.cache, key)
+		return cachedResponse{}, false
+	}
+	return c, true
+}
+
+func (s *Server) purge() {
+	s.mu.Lock()
+	s.cache = map[string]cachedResponse{}
+	s.mu.Unlock()
+}
+
+func (s *Server) refreshLoop(ctx context.Context) {
+	for {
+		next := refreshRetry
+		lifetime, err := s.opts.Refresh(ctx)
+		if err != nil {
+			s.logf("agent token refresh failed", err)
+		} else {
+			s.mu.Lock()
+			s.lastRefresh = time.Now()
+			s.mu.Unlock()
+			next = DefaultRefreshInterval
+			if lifetime > 0 {
+				next = lifetime * 4 / 5
+			}
+			next = max(next, minRefreshInterval)
+		}
+		t := time.NewTimer(next)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (s *Server) flushLoop(ctx context.Context) {
+	t := time.NewTicker(flushInterval)
+	defer t.Stop()
+	for {
+		if err := s.opts.Flush(ctx); err != nil {
+			s.logf("agent outbox flush failed", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (s *Server) logf(msg string, err error) {
+	if s.opts.Log != nil {
+		s.opts.Log.Warn(msg, zap.Error(err))
+	}
+}
+
+func Listen(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+func isItemsPath(p string) bool {
+	p = strings.TrimPrefix(p, apiPrefix)
+	return p == "/items" || strings.HasPrefix(p, "/items/")
+}
+
+func skipHeader(k string) bool {
+	switch http.CanonicalHeaderKey(k) {
+	case "Authorization", "Connection", "Keep-Alive", "Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade":
+		return true
+	}
+	return false
+}
+
+func copyHeader(dst, src http.Header) {
+	for k, vs := range src {
+		if skipHeader(k) {
+			continue
+		}
+		dst[k] = append([]string(nil), vs...)
+	}
+}
+
+func writeCached(w http.ResponseWriter, c cachedResponse, state string) {
+	copyHeader(w.Header(), c.header)
+	w.Header().Del("Content-Length")
+	w.Header().Set(CacheHeader, state)
+	w.WriteHeader(c.status)
+	_, _ = w.Write(c.body)
+}
@@ -0,0 +1,163 @@
+package agentd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func startAgent(t *testing.T, opts Options) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "kca")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "agent.sock")
+	ln, err := Listen(socket)
+	require.NoError(t, err)
+	fi, err := os.Stat(socket)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+	opts.Socket = socket
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- New(opts).Serve(ctx, ln) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	require.Eventually(t, func() bool { return Running(context.Background(), socket) }, 2*time.Second, 20*time.Millisecond)
+	return socket
+}
+
+func agentGet(t *testing.T, socket, path string, hdr http.Header) (*http.Response, string, error) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, "http://keepcli-agent"+path, nil)
+	require.NoError(t, err)
+	for k, v := range hdr {
+		req.Header[k] = v
+	}
+	resp, err := (&http.Client{Transport: Transport(socket)}).Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	b, _ := io.ReadAll(resp.Body)
+	return resp, string(b), nil
+}
+
+func TestAgent_ProxiesAndCachesItems(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("peer credentials unsupported")
+	}
+	var hits int32
+	var sawAuth atomic.Value
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		sawAuth.Store(r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"path":"` + r.URL.Path + `","q":"` + r.URL.RawQuery + `"}`))
+	}))
+	defer upstream.Close()
+	socket := startAgent(t, Options{Upstream: upstream.Client(), BaseURL: upstream.URL + "/api/v1"})
+
+	resp, body, err := agentGet(t, socket, "/api/items?limit=5", http.Header{"Authorization": {"Bearer forged"}})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.JSONEq(t, `{"path":"/api/v1/items","q":"limit=5"}`, body)
+	require.Equal(t, "miss", resp.Header.Get(CacheHeader))
+	require.Empty(t, sawAuth.Load())
+
+	resp, _, err = agentGet(t, socket, "/api/items?limit=5", nil)
+	require.NoError(t, err)
+	require.Equal(t, "hit", resp.Header.Get(CacheHeader))
+	require.Equal(t, int32(1), atomic.LoadInt32(&hits))
+
+	st, err := GetStatus(context.Background(), socket)
+	require.NoError(t, err)
+	require.Equal(t, os.Getpid(), st.PID)
+	require.Equal(t, 1, st.CachedItems)
+
+	req, _ := http.NewRequest(http.MethodDelete, "http://keepcli-agent/api/items/x", nil)
+	dresp, err := (&http.Client{Transport: Transport(socket)}).Do(req)
+	require.NoError(t, err)
+	_ = dresp.Body.Close()
+	_, _, err = agentGet(t, socket, "/api/items?limit=5", nil)
+	require.NoError(t, err)
+	require.Equal(t, int32(3), atomic.LoadInt32(&hits))
+
+	require.NoError(t, Reload(context.Background(), socket))
+	st, err = GetStatus(context.Background(), socket)
+	require.NoError(t, err)
+	require.Zero(t, st.CachedItems)
+}
+
+func TestAgent_UpstreamDownIsNetworkError(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("peer credentials unsupported")
+	}
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	base := upstream.URL
+	upstream.Close()
+	socket := startAgent(t, Options{BaseURL: base})
+	_, _, err := agentGet(t, socket, "/api/items", nil)
+	var netErr net.Error
+	require.True(t, errors.As(err, &netErr), "got %v", err)
+}
+
+func TestAgent_StopAndRefresh(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("peer credentials unsupported")
+	}
+	oldMin, oldRetry := minRefreshInterval, refreshRetry
+	minRefreshInterval, refreshRetry = 10*time.Millisecond, 10*time.Millisecond
+	defer func() { minRefreshInterval, refreshRetry = oldMin, oldRetry }()
+	var refreshes int32
+	socket := startAgent(t, Options{
+		BaseURL: "http://127.0.0.1:1",
+		Refresh: func(context.Context) (time.Duration, error) {
+			atomic.AddInt32(&refreshes, 1)
+			return 20 * time.Millisecond, nil
+		},
+	})
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&refreshes) >= 3 }, 2*time.Second, 10*time.Millisecond)
+	require.NoError(t, Stop(context.Background(), socket))
+	require.Eventually(t, func() bool { return !Running(context.Background(), socket) }, 2*time.Second, 20*time.Millisecond)
+}
+
+func TestRequireSameUser(t *testing.T) {
+	h := requireSameUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	cases := []struct {
+		ctx  context.Context
+		code int
+	}{
+		{context.Background(), http.StatusForbidden},
+		{context.WithValue(context.Background(), peerKey{}, peer{uid: os.Getuid() + 1}), http.StatusForbidden},
+		{context.WithValue(context.Background(), peerKey{}, peer{uid: os.Getuid(), err: errors.New("x")}), http.StatusForbidden},
+		{context.WithValue(context.Background(), peerKey{}, peer{uid: os.Getuid()}), http.StatusNoContent},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/agent/status", nil).WithContext(c.ctx))
+		require.Equal(t, c.code, rec.Code)
+	}
+}
+
+func TestPeerUIDRejectsNonUnix(t *testing.T) {
+	a, b := net.Pipe()
+	defer func() { _ = a.Close(); _ = b.Close() }()
+	_, err := peerUID(a)
+	require.Error(t, err)
+}
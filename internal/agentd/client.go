@@ -0,0 +1,125 @@
+package agentd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Хост фиктивный: соединение всегда идёт через unix-сокет.
+const BaseURL = "http://keepcli-agent" + apiPrefix
+
+func RuntimePath(name string) string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), fmt.Sprintf("keepcli-%d", os.Getuid()))
+	}
+	return filepath.Join(dir, name)
+}
+
+func DefaultSocket() string {
+	return RuntimePath("keepcli-agent.sock")
+}
+
+// Недоступность сервера за агентом возвращается как сетевая ошибка, чтобы
+// клиент откатился на локальный кеш.
+func Transport(socket string) http.RoundTripper {
+	return &agentTransport{base: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+		MaxIdleConns:    4,
+		IdleConnTimeout: 30 * time.Second,
+	}}
+}
+
+type agentTransport struct {
+	base http.RoundTripper
+}
+
+func (t *agentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if msg := resp.Header.Get(UpstreamErrorHeader); msg != "" {
+		_ = resp.Body.Close()
+		return nil, &net.OpError{Op: "proxy", Net: "unix", Err: errors.New(msg)}
+	}
+	return resp, nil
+}
+
+func client(socket string) *http.Client {
+	return &http.Client{Transport: Transport(socket), Timeout: 2 * time.Second}
+}
+
+func Running(ctx context.Context, socket string) bool {
+	_, ok := Lookup(ctx, socket)
+	return ok
+}
+
+func Lookup(ctx context.Context, socket string) (Status, bool) {
+	if fi, err := os.Stat(socket); err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return Status{}, false
+	}
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	st, err := GetStatus(ctx, socket)
+	return st, err == nil
+}
+
+func (s Status) Serves(baseURL, identity string) bool {
+	return s.BaseURL == strings.TrimRight(baseURL, "/") && s.Identity == identity
+}
+
+func GetStatus(ctx context.Context, socket string) (Status, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://keepcli-agent/agent/status", nil)
+	if err != nil {
+		return Status{}, err
+	}
+	resp, err := client(socket).Do(req)
+	if err != nil {
+		return Status{}, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return Status{}, fmt.Errorf("agent status: %s", resp.Status)
+	}
+	var st Status
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		return Status{}, err
+	}
+	return st, nil
+}
+
+func Stop(ctx context.Context, socket string) error {
+	return post(ctx, socket, "/agent/stop")
+}
+
+func Reload(ctx context.Context, socket string) error {
+	return post(ctx, socket, "/agent/reload")
+}
+
+func post(ctx context.Context, socket, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://keepcli-agent"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client(socket).Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("agent %s: %s", path, resp.Status)
+	}
+	return nil
+}
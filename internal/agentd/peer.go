@@ -0,0 +1,33 @@
+package agentd
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+)
+
+type peerKey struct{}
+
+type peer struct {
+	err error
+	uid int
+}
+
+func withPeer(ctx context.Context, c net.Conn) context.Context {
+	uid, err := peerUID(c)
+	return context.WithValue(ctx, peerKey{}, peer{uid: uid, err: err})
+}
+
+// requireSameUser пропускает только запросы от процессов того же
+// пользователя, что и агент; учётные данные берутся из SO_PEERCRED.
+func requireSameUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := r.Context().Value(peerKey{}).(peer)
+		if !ok || p.err != nil || p.uid != os.Getuid() {
+			http.Error(w, "peer credentials rejected", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package agentd
+
+import (
+	"errors"
+	"net"
+)
+
+func peerUID(net.Conn) (int, error) {
+	return -1, errors.New("peer credentials are not supported on this platform")
+}
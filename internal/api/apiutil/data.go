@@ -0,0 +1,44 @@
+package apiutil
+
+import (
+	"encoding/json"
+	"maps"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+)
+
+// DataType возвращает поле type данных записи в JSON.
+func DataType(raw []byte) apigen.ItemType {
+	var v struct {
+		Type apigen.ItemType `json:"type"`
+	}
+	_ = json.Unmarshal(raw, &v)
+	return v.Type
+}
+
+// MergeData накладывает поля upd на base; пустой base — новые данные.
+func MergeData(base, upd []byte) ([]byte, error) {
+	m := map[string]any{}
+	if len(base) > 0 {
+		if err := json.Unmarshal(base, &m); err != nil {
+			return nil, err
+		}
+	}
+	var u map[string]any
+	if err := json.Unmarshal(upd, &u); err != nil {
+		return nil, err
+	}
+	maps.Copy(m, u)
+	return json.Marshal(m)
+}
+
+func Credential(it apigen.ItemResponse) (apigen.CredentialData, bool) {
+	if it.Data == nil {
+		return apigen.CredentialData{}, false
+	}
+	c, err := it.Data.AsCredentialData()
+	if err != nil || c.Type != apigen.CREDENTIAL {
+		return apigen.CredentialData{}, false
+	}
+	return c, true
+}
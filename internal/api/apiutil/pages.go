@@ -0,0 +1,49 @@
+package apiutil
+
+import (
+	"context"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+)
+
+const PageSize = 100
+
+type ListFunc func(context.Context, *apigen.GetItemsParams) (*apigen.GetItemsResponse, error)
+
+// EachPage запрашивает страницы списка записей, пока они не кончатся или fn
+// не вернёт false. Type и S из params сохраняются, Limit и Offset
+// задаются заново.
+func EachPage(ctx context.Context, list ListFunc, params apigen.GetItemsParams, fn func([]apigen.ItemListResponse) bool) error {
+	limit := PageSize
+	for offset := 0; ; {
+		off := offset
+		params.Limit, params.Offset = &limit, &off
+		resp, err := list(ctx, &params)
+		if err != nil {
+			return err
+		}
+		if resp.JSON200 == nil || resp.JSON200.Items == nil || len(*resp.JSON200.Items) == 0 {
+			return nil
+		}
+		page := *resp.JSON200.Items
+		if !fn(page) {
+			return nil
+		}
+		offset += len(page)
+		if total := resp.JSON200.Total; (total != nil && offset >= *total) || (total == nil && len(page) < limit) {
+			return nil
+		}
+	}
+}
+
+func ListAll(ctx context.Context, list ListFunc, params apigen.GetItemsParams) ([]apigen.ItemListResponse, error) {
+	var out []apigen.ItemListResponse
+	err := EachPage(ctx, list, params, func(page []apigen.ItemListResponse) bool {
+		out = append(out, page...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
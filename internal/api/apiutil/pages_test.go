@@ -0,0 +1,49 @@
+package apiutil
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+)
+
+func fakeList(n int, withTotal bool, calls *int) ListFunc {
+	return func(_ context.Context, p *apigen.GetItemsParams) (*apigen.GetItemsResponse, error) {
+		*calls++
+		var items []apigen.ItemListResponse
+		for i := *p.Offset; i < n && i < *p.Offset+*p.Limit; i++ {
+			title := string(rune('a' + i%26))
+			items = append(items, apigen.ItemListResponse{Title: &title})
+		}
+		body := map[string]any{"items": items}
+		if withTotal {
+			body["total"] = n
+		}
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		resp := &apigen.GetItemsResponse{Body: raw}
+		return resp, json.Unmarshal(raw, &resp.JSON200)
+	}
+}
+
+func TestListAllPages(t *testing.T) {
+	for _, withTotal := range []bool{true, false} {
+		calls := 0
+		all, err := ListAll(context.Background(), fakeList(2*PageSize+5, withTotal, &calls), apigen.GetItemsParams{})
+		require.NoError(t, err)
+		require.Len(t, all, 2*PageSize+5)
+		require.Equal(t, 3, calls)
+	}
+
+	calls := 0
+	err := EachPage(context.Background(), fakeList(3*PageSize, true, &calls), apigen.GetItemsParams{}, func([]apigen.ItemListResponse) bool {
+		return false
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, calls, "fn, вернувшая false, останавливает обход")
+}
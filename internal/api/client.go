@@ -1,8 +1,16 @@
 package api
 
 import (
+	"cmp"
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
 	"github.com/hashicorp/go-retryablehttp"
+	"go.uber.org/zap"
 
+	"github.com/GoLessons/sufir-keeper-client/internal/agentd"
 	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
 	"github.com/GoLessons/sufir-keeper-client/internal/auth"
 	"github.com/GoLessons/sufir-keeper-client/internal/config"
@@ -16,8 +24,48 @@ type Client struct {
 	Auth *auth.Manager
 }
 
+// New использует запущенный агент для запросов API, если он доступен, и
+// работает напрямую с сервером в противном случае. Аутентификация всегда
+// выполняется напрямую.
 func New(cfg config.Config, log logging.Logger, store auth.TokenStore) (*Client, error) {
-	rc, err := httpclient.New(cfg, log)
+	c, err := NewDirect(cfg, log, store)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Agent.Disabled {
+		return c, nil
+	}
+	socket := cfg.Agent.Socket
+	if socket == "" {
+		socket = agentd.DefaultSocket()
+	}
+	st, ok := agentd.Lookup(context.Background(), socket)
+	if !ok {
+		return c, nil
+	}
+	if !st.Serves(cfg.Server.BaseURL, AgentIdentity(cfg)) {
+		log.Debug("keepcli agent serves another server or account, connecting directly",
+			zap.String("socket", socket), zap.String("agent_server", st.BaseURL))
+		return c, nil
+	}
+	hc := &http.Client{Transport: agentd.Transport(socket), Timeout: c.HTTP.HTTPClient.Timeout}
+	viaAgent, err := apigen.NewClientWithResponses(agentd.BaseURL, apigen.WithHTTPClient(hc))
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("using keepcli agent", zap.String("socket", socket))
+	c.API = viaAgent
+	return c, nil
+}
+
+// AgentIdentity — хранилище токенов клиента. Агент с другим хранилищем
+// отправил бы запрос с чужим токеном.
+func AgentIdentity(cfg config.Config) string {
+	return strings.Join([]string{cfg.Auth.Backend, cfg.Auth.TokenStoreService, cfg.Auth.FileDir}, "|")
+}
+
+func NewDirect(cfg config.Config, log logging.Logger, store auth.TokenStore) (*Client, error) {
+	rc, err := httpclient.New(cfg, log, httpOptions(cfg.HTTP)...)
 	if err != nil {
 		return nil, err
 	}
@@ -35,3 +83,23 @@ func New(cfg config.Config, log logging.Logger, store auth.TokenStore) (*Client,
 		Auth: mgr,
 	}, nil
 }
+
+func httpOptions(h config.HTTPConfig) []httpclient.Option {
+	opts := []httpclient.Option{httpclient.WithRetryMax(h.RetryMax)}
+	if h.Timeout > 0 {
+		opts = append(opts, httpclient.WithTimeout(h.Timeout))
+	}
+	if h.RetryWaitMin > 0 || h.RetryWaitMax > 0 {
+		opts = append(opts, httpclient.WithRetryWait(
+			cmp.Or(h.RetryWaitMin, 200*time.Millisecond),
+			cmp.Or(h.RetryWaitMax, 2*time.Second),
+		))
+	}
+	if h.MaxIdleConns > 0 {
+		opts = append(opts, httpclient.WithTransportMaxIdleConns(h.MaxIdleConns))
+	}
+	if h.UserAgent != "" {
+		opts = append(opts, httpclient.WithUserAgent(h.UserAgent))
+	}
+	return opts
+}
@@ -1,13 +1,19 @@
 package api
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path/filepath"
+	"runtime"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/GoLessons/sufir-keeper-client/internal/agentd"
 	"github.com/GoLessons/sufir-keeper-client/internal/auth"
 	"github.com/GoLessons/sufir-keeper-client/internal/config"
 	"github.com/GoLessons/sufir-keeper-client/internal/logging"
@@ -38,3 +44,113 @@ func TestClientWiresHTTPAuthAndAPI(t *testing.T) {
 	_, ok := cl.HTTP.HTTPClient.Transport.(*auth.AuthRoundTripper)
 	require.True(t, ok)
 }
+
+func TestClientAppliesHTTPConfig(t *testing.T) {
+	agent := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agent <- r.UserAgent()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	log, err := logging.NewLogger("error")
+	require.NoError(t, err)
+	cfg := config.Config{
+		Server: config.ServerConfig{BaseURL: srv.URL},
+		Agent:  config.AgentConfig{Disabled: true},
+		HTTP: config.HTTPConfig{
+			Timeout:      5 * time.Second,
+			RetryMax:     1,
+			RetryWaitMin: 10 * time.Millisecond,
+			MaxIdleConns: 7,
+			UserAgent:    "keepcli/test",
+		},
+	}
+	store, err := auth.NewKeyringStore(auth.KeyringOptions{
+		ServiceName:  "sufir-keeper-client",
+		Backend:      "file",
+		FileDir:      filepath.Join(t.TempDir(), "keyring"),
+		FilePassword: "test",
+	})
+	require.NoError(t, err)
+	cl, err := New(cfg, log, store)
+	require.NoError(t, err)
+	require.Equal(t, 5*time.Second, cl.HTTP.HTTPClient.Timeout)
+	require.Equal(t, 1, cl.HTTP.RetryMax)
+	require.Equal(t, 10*time.Millisecond, cl.HTTP.RetryWaitMin)
+	require.Equal(t, 2*time.Second, cl.HTTP.RetryWaitMax, "незаданная пауза остаётся по умолчанию")
+
+	w := NewWrapper(cl)
+	require.Equal(t, 1, w.retryMax)
+	require.Equal(t, 10*time.Millisecond, w.retryWaitMin)
+	require.Equal(t, 2*time.Second, w.retryWaitMax)
+
+	resp, err := cl.HTTP.HTTPClient.Get(srv.URL + "/health")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, "keepcli/test", <-agent)
+}
+
+func TestClientUsesRunningAgent(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("peer credentials unsupported")
+	}
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"items":[],"total":0}`))
+	}))
+	t.Cleanup(srv.Close)
+	dir, err := os.MkdirTemp("", "kca")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "agent.sock")
+	ln, err := agentd.Listen(socket)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	log, err := logging.NewLogger("error")
+	require.NoError(t, err)
+	cfg := config.Config{
+		Server: config.ServerConfig{BaseURL: srv.URL},
+		Auth:   config.AuthConfig{TokenStoreService: "sufir-keeper-client", Backend: "file", FileDir: "/keys"},
+		Agent:  config.AgentConfig{Socket: socket},
+	}
+	go func() {
+		_ = agentd.New(agentd.Options{Upstream: srv.Client(), BaseURL: srv.URL, Identity: AgentIdentity(cfg)}).Serve(ctx, ln)
+	}()
+	require.Eventually(t, func() bool { return agentd.Running(context.Background(), socket) }, 2*time.Second, 20*time.Millisecond)
+
+	store, err := auth.NewKeyringStore(auth.KeyringOptions{
+		ServiceName:  "sufir-keeper-client",
+		Backend:      "file",
+		FileDir:      filepath.Join(t.TempDir(), "keyring"),
+		FilePassword: "test",
+	})
+	require.NoError(t, err)
+	viaAgent := func(cfg config.Config) bool {
+		t.Helper()
+		cl, err := New(cfg, log, store)
+		require.NoError(t, err)
+		resp, err := cl.API.GetItemsWithResponse(context.Background(), nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode())
+		return resp.HTTPResponse.Header.Get(agentd.CacheHeader) != ""
+	}
+	require.True(t, viaAgent(cfg))
+
+	other := cfg
+	other.Auth.TokenStoreService = "sufir-keeper-client-prod"
+	require.False(t, viaAgent(other), "агент с другим хранилищем токенов не используется")
+
+	other = cfg
+	other.Server.BaseURL = "http://127.0.0.1:1"
+	cl, err := New(other, log, store)
+	require.NoError(t, err)
+	_, err = cl.API.GetItemsWithResponse(context.Background(), nil)
+	require.Error(t, err, "агент другого сервера не используется")
+
+	cfg.Agent.Disabled = true
+	require.False(t, viaAgent(cfg))
+	require.Positive(t, atomic.LoadInt32(&requests))
+}
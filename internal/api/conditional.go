@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"net/http"
+)
+
+// Validators — ETag и Last-Modified сохранённого ответа для условных
+// запросов.
+type Validators struct {
+	ETag string `json:"etag,omitempty"`
+	// Сервер сравнивает LastModified побайтно, поэтому он не разбирается.
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+func (v Validators) IsZero() bool {
+	return v.ETag == "" && v.LastModified == ""
+}
+
+func ValidatorsOf(resp *http.Response) Validators {
+	if resp == nil {
+		return Validators{}
+	}
+	return Validators{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+}
+
+type validatorsKey struct{}
+
+func WithValidators(ctx context.Context, v Validators) context.Context {
+	if v.IsZero() {
+		return ctx
+	}
+	return context.WithValue(ctx, validatorsKey{}, v)
+}
+
+func ValidatorsFrom(ctx context.Context) (Validators, bool) {
+	v, ok := ctx.Value(validatorsKey{}).(Validators)
+	return v, ok
+}
+
+// NotModified — ответ 304 на условный запрос.
+func NotModified(resp *http.Response) bool {
+	return resp != nil && resp.StatusCode == http.StatusNotModified
+}
+
+func setValidators(ctx context.Context, req *http.Request) error {
+	v, ok := ValidatorsFrom(ctx)
+	if !ok {
+		return nil
+	}
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
+	return nil
+}
+
+// 304 успешен, только если запрос был условным.
+func success(ctx context.Context, resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return true
+	}
+	_, conditional := ValidatorsFrom(ctx)
+	return conditional && NotModified(resp)
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Precondition — версия записи, поверх которой клиент делает изменение.
+// Передаётся серверу как If-Match (если сервер отдал ETag) и
+// If-Unmodified-Since.
+type Precondition struct {
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+	ETag      string    `json:"etag,omitempty"`
+}
+
+func (p Precondition) IsZero() bool {
+	return p.ETag == "" && p.UpdatedAt.IsZero()
+}
+
+type preconditionKey struct{}
+
+func WithPrecondition(ctx context.Context, p Precondition) context.Context {
+	if p.IsZero() {
+		return ctx
+	}
+	return context.WithValue(ctx, preconditionKey{}, p)
+}
+
+func PreconditionFrom(ctx context.Context) (Precondition, bool) {
+	p, ok := ctx.Value(preconditionKey{}).(Precondition)
+	return p, ok
+}
+
+func setPrecondition(ctx context.Context, req *http.Request) error {
+	p, ok := PreconditionFrom(ctx)
+	if !ok {
+		return nil
+	}
+	if p.ETag != "" {
+		req.Header.Set("If-Match", p.ETag)
+	}
+	if !p.UpdatedAt.IsZero() {
+		req.Header.Set("If-Unmodified-Since", p.UpdatedAt.UTC().Format(http.TimeFormat))
+	}
+	return nil
+}
@@ -22,13 +22,15 @@ type Wrapper struct {
 	retryWaitMax time.Duration
 }
 
+// NewWrapper повторяет запросы с теми же настройками, что и c.HTTP.
 func NewWrapper(c *Client) *Wrapper {
-	return &Wrapper{
-		api:          c.API,
-		retryMax:     3,
-		retryWaitMin: 200 * time.Millisecond,
-		retryWaitMax: 2 * time.Second,
+	w := NewWrapperFromAPI(c.API)
+	if c.HTTP != nil {
+		w.retryMax = c.HTTP.RetryMax
+		w.retryWaitMin = c.HTTP.RetryWaitMin
+		w.retryWaitMax = c.HTTP.RetryWaitMax
 	}
+	return w
 }
 
 func NewWrapperFromAPI(api *apigen.ClientWithResponses) *Wrapper {
@@ -40,9 +42,11 @@ func NewWrapperFromAPI(api *apigen.ClientWithResponses) *Wrapper {
 	}
 }
 
+// GetItems и GetItem с валидаторами из WithValidators выполняют условный
+// запрос; ответ 304 они возвращают без ошибки и без тела.
 func (w *Wrapper) GetItems(ctx context.Context, params *apigen.GetItemsParams) (*apigen.GetItemsResponse, error) {
 	for attempt := 0; ; attempt++ {
-		resp, err := w.api.GetItemsWithResponse(ctx, params)
+		resp, err := w.api.GetItemsWithResponse(ctx, params, setValidators)
 		if err != nil {
 			if w.shouldRetry(nil, err, "GET") && attempt < w.retryMax {
 				w.sleep(nil, attempt)
@@ -54,7 +58,7 @@ func (w *Wrapper) GetItems(ctx context.Context, params *apigen.GetItemsParams) (
 			w.sleep(resp.HTTPResponse, attempt)
 			continue
 		}
-		if resp.StatusCode() >= 200 && resp.StatusCode() < 300 {
+		if success(ctx, resp.HTTPResponse) {
 			return resp, nil
 		}
 		return nil, w.normalizeError(resp.HTTPResponse, resp.Body)
@@ -63,7 +67,7 @@ func (w *Wrapper) GetItems(ctx context.Context, params *apigen.GetItemsParams) (
 
 func (w *Wrapper) GetItem(ctx context.Context, id openapi_types.UUID) (*apigen.GetItemResponse, error) {
 	for attempt := 0; ; attempt++ {
-		resp, err := w.api.GetItemWithResponse(ctx, id)
+		resp, err := w.api.GetItemWithResponse(ctx, id, setValidators)
 		if err != nil {
 			if w.shouldRetry(nil, err, "GET") && attempt < w.retryMax {
 				w.sleep(nil, attempt)
@@ -75,7 +79,7 @@ func (w *Wrapper) GetItem(ctx context.Context, id openapi_types.UUID) (*apigen.G
 			w.sleep(resp.HTTPResponse, attempt)
 			continue
 		}
-		if resp.StatusCode() >= 200 && resp.StatusCode() < 300 {
+		if success(ctx, resp.HTTPResponse) {
 			return resp, nil
 		}
 		return nil, w.normalizeError(resp.HTTPResponse, resp.Body)
@@ -136,7 +140,7 @@ func (w *Wrapper) CreateItem(ctx context.Context, body apigen.CreateItemJSONRequ
 }
 
 func (w *Wrapper) UpdateItem(ctx context.Context, id openapi_types.UUID, body apigen.UpdateItemJSONRequestBody) (*apigen.UpdateItemResponse, error) {
-	resp, err := w.api.UpdateItemWithResponse(ctx, id, body)
+	resp, err := w.api.UpdateItemWithResponse(ctx, id, body, setPrecondition)
 	if err != nil {
 		return nil, err
 	}
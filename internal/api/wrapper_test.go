@@ -482,3 +482,27 @@ func TestWrapper_UploadFileWithBody_204(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, resp)
 }
+
+func TestWrapper_GetItem_NotModified(t *testing.T) {
+	mux := http.NewServeMux()
+	var ifNoneMatch, ifModifiedSince string
+	mux.HandleFunc("/items/", func(w http.ResponseWriter, r *http.Request) {
+		ifNoneMatch, ifModifiedSince = r.Header.Get("If-None-Match"), r.Header.Get("If-Modified-Since")
+		w.WriteHeader(http.StatusNotModified)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	w := NewWrapperFromAPI(newApigen(t, srv))
+	id := openapi_types.UUID{}
+
+	_, err := w.GetItem(context.Background(), id)
+	require.Error(t, err, "304 на безусловный запрос — ошибка")
+
+	v := Validators{ETag: `"v1"`, LastModified: "Mon, 02 Jan 2006 15:04:05 GMT"}
+	resp, err := w.GetItem(WithValidators(context.Background(), v), id)
+	require.NoError(t, err)
+	require.True(t, NotModified(resp.HTTPResponse))
+	require.Nil(t, resp.JSON200)
+	require.Equal(t, v.ETag, ifNoneMatch)
+	require.Equal(t, v.LastModified, ifModifiedSince)
+}
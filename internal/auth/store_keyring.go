@@ -139,3 +139,11 @@ func (s *KeyringStore) HasRefreshToken() bool {
 	_, err := s.ring.Get(s.refreshKey)
 	return err == nil
 }
+
+// Invalidate сбрасывает закешированные в памяти токены, чтобы следующее
+// обращение перечитало их из keyring.
+func (s *KeyringStore) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cached = AuthTokens{}
+}
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"fmt"
+
+	"github.com/99designs/keyring"
+)
+
+type managerKeys struct {
+	m *Manager
+}
+
+func (k managerKeys) Current() (int, []byte, error) {
+	return k.m.currentKey()
+}
+
+func (k managerKeys) Key(id int) ([]byte, error) {
+	return k.m.key(id)
+}
+
+func (m *Manager) use(raw Store) {
+	m.raw = raw
+	m.store = Encrypted(raw, managerKeys{m})
+	m.queue = queueOf(raw)
+	m.index = indexOf(raw)
+	m.blobs = blobsOf(raw)
+	m.versions = versionsOf(raw)
+	m.counters = countersOf(raw)
+	m.lru = lruOf(raw)
+	m.marks = marksOf(raw)
+}
+
+func (m *Manager) openMemory() error {
+	m.use(NewMemoryStore())
+	return m.initKey()
+}
+
+func (m *Manager) openBolt(cfg keyring.Config) error {
+	raw, err := OpenBoltStore(m.path)
+	if err != nil {
+		return err
+	}
+	m.use(raw)
+	if m.ring, err = keyring.Open(cfg); err != nil {
+		_ = raw.Close()
+		return fmt.Errorf("%w: %v", ErrKeyUnavailable, err)
+	}
+	if err := m.initKey(); err != nil {
+		_ = raw.Close()
+		return err
+	}
+	_ = m.maintain()
+	return nil
+}
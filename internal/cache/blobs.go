@@ -0,0 +1,308 @@
+package cache
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrBlobCorrupt — файл блоба не совпал с сохранённым хешем; блоб удаляется,
+// и файл нужно скачать заново.
+var ErrBlobCorrupt = errors.New("файл в кеше повреждён")
+
+// Блоб шифруется своим ключом (dek), а dek — ключом кеша, поэтому смена
+// ключа кеша не перешифровывает файлы.
+
+type blobRow struct {
+	updatedAt  time.Time
+	accessedAt time.Time
+	ns         string
+	fileID     string
+	sum        string
+	dek        []byte
+	size       int64
+	keyID      int
+}
+
+func (m *Manager) blobDir() string {
+	return m.blobRoot
+}
+
+func (m *Manager) blobPath(ns, sum string) string {
+	id := strings.TrimSuffix(strings.TrimPrefix(ns, "ns:"), "/")
+	return filepath.Join(m.blobDir(), id, sum)
+}
+
+// PutBlob сохраняет содержимое файла fileID и возвращает его sha256.
+func (m *Manager) PutBlob(fileID string, data []byte) (string, error) {
+	if m.blobRoot == "" {
+		return "", fmt.Errorf("%w: %s", ErrUnsupported, m.backend)
+	}
+	h := sha256.Sum256(data)
+	sum := hex.EncodeToString(h[:])
+	now := time.Now()
+	rows, err := m.blobs.Blobs(m.prefix)
+	if err != nil {
+		return "", err
+	}
+	var same []blobRow
+	for _, r := range rows {
+		if r.sum == sum {
+			same = append(same, r)
+		}
+	}
+	row := blobRow{ns: m.prefix, fileID: fileID, sum: sum, size: int64(len(data)), updatedAt: now, accessedAt: now}
+	path := m.blobPath(m.prefix, sum)
+	if _, serr := os.Stat(path); len(same) == 0 || serr != nil {
+		dek := make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+			return "", err
+		}
+		if row.keyID, row.dek, err = m.encryptCurrent(dek, aad("blob", m.prefix+sum)); err != nil {
+			return "", err
+		}
+		enc, err := seal(dek, data, aad("blob", sum))
+		if err != nil {
+			return "", err
+		}
+		if err := writeFileAtomic(path, enc); err != nil {
+			return "", err
+		}
+		// Прежние ссылки на этот sha256 указывали на пропавший файл.
+		for _, r := range same {
+			r.dek, r.keyID = row.dek, row.keyID
+			if err := m.blobs.PutBlobRow(r); err != nil {
+				return "", err
+			}
+		}
+	} else {
+		row.dek, row.keyID = same[0].dek, same[0].keyID
+	}
+	old, oerr := m.blobs.Blob(m.prefix, fileID)
+	if oerr != nil && !errors.Is(oerr, ErrNotFound) {
+		return "", oerr
+	}
+	if err := m.blobs.PutBlobRow(row); err != nil {
+		return "", err
+	}
+	if oerr == nil && old.sum != sum {
+		if err := m.removeUnreferenced(m.prefix, old.sum); err != nil {
+			return "", err
+		}
+	}
+	return sum, m.evictBlobs()
+}
+
+// GetBlob читает файл fileID и проверяет его целостность. Повреждённый или
+// пропавший блоб удаляется из кеша.
+func (m *Manager) GetBlob(fileID string) (data []byte, updatedAt time.Time, err error) {
+	r, err := m.blobs.Blob(m.prefix, fileID)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	dek, err := m.decryptWith(r.keyID, r.dek, aad("blob", m.prefix+r.sum))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	enc, err := os.ReadFile(m.blobPath(m.prefix, r.sum))
+	if errors.Is(err, fs.ErrNotExist) {
+		_ = m.DeleteBlob(fileID)
+		return nil, time.Time{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err = openBlob(dek, enc, r.sum)
+	if err != nil {
+		_ = m.dropBlob(m.prefix, r.sum)
+		return nil, time.Time{}, fmt.Errorf("%w: %s", ErrBlobCorrupt, fileID)
+	}
+	if time.Since(r.accessedAt) >= touchInterval {
+		r.accessedAt = time.Now()
+		_ = m.blobs.PutBlobRow(r)
+	}
+	return data, r.updatedAt, nil
+}
+
+func openBlob(dek, enc []byte, sum string) ([]byte, error) {
+	data, err := open(dek, enc, aad("blob", sum))
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(data)
+	if hex.EncodeToString(h[:]) != sum {
+		return nil, ErrBlobCorrupt
+	}
+	return data, nil
+}
+
+func (m *Manager) blobIntact(r blobRow) bool {
+	dek, err := m.decryptWith(r.keyID, r.dek, aad("blob", r.ns+r.sum))
+	if err != nil {
+		return false
+	}
+	enc, err := os.ReadFile(m.blobPath(r.ns, r.sum))
+	if err != nil {
+		return false
+	}
+	_, err = openBlob(dek, enc, r.sum)
+	return err == nil
+}
+
+func (m *Manager) DeleteBlob(fileID string) error {
+	r, err := m.blobs.Blob(m.prefix, fileID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := m.blobs.DeleteBlobRow(m.prefix, fileID); err != nil {
+		return err
+	}
+	return m.removeUnreferenced(m.prefix, r.sum)
+}
+
+func (m *Manager) dropBlob(ns, sum string) error {
+	_, err := m.deleteBlobRows(ns, func(r blobRow) bool { return r.sum == sum })
+	return err
+}
+
+func (m *Manager) removeUnreferenced(ns, sum string) error {
+	rows, err := m.blobs.Blobs(ns)
+	if err != nil {
+		return err
+	}
+	for _, r := range rows {
+		if r.sum == sum {
+			return nil
+		}
+	}
+	if err := os.Remove(m.blobPath(ns, sum)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) sweepBlobs() error {
+	if m.ttlMinutes <= 0 {
+		return nil
+	}
+	cutoff := time.Now().Add(-time.Duration(m.ttlMinutes+max(m.staleMinutes, 0)) * time.Minute)
+	_, err := m.deleteBlobRows("", func(r blobRow) bool { return r.updatedAt.Before(cutoff) })
+	return err
+}
+
+func (m *Manager) purgeBlobsBefore(cutoff int64) (int64, error) {
+	return m.deleteBlobRows(m.prefix, func(r blobRow) bool { return r.updatedAt.Unix() < cutoff })
+}
+
+func (m *Manager) deleteBlobRows(ns string, drop func(blobRow) bool) (int64, error) {
+	rows, err := m.blobs.Blobs(ns)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, r := range rows {
+		if !drop(r) {
+			continue
+		}
+		if err := m.blobs.DeleteBlobRow(r.ns, r.fileID); err != nil {
+			return n, err
+		}
+		if err := m.removeUnreferenced(r.ns, r.sum); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (m *Manager) evictBlobs() error {
+	if m.maxBlobBytes <= 0 {
+		return nil
+	}
+	rows, err := m.blobs.Blobs("")
+	if err != nil {
+		return err
+	}
+	type file struct {
+		at      time.Time
+		ns, sum string
+		size    int64
+	}
+	var files []file
+	seen := map[[2]string]int{}
+	for _, r := range rows {
+		k := [2]string{r.ns, r.sum}
+		i, ok := seen[k]
+		if !ok {
+			seen[k] = len(files)
+			files = append(files, file{ns: r.ns, sum: r.sum, size: r.size, at: r.accessedAt})
+			continue
+		}
+		files[i].size = max(files[i].size, r.size)
+		if r.accessedAt.After(files[i].at) {
+			files[i].at = r.accessedAt
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].at.Equal(files[j].at) {
+			return files[i].at.After(files[j].at)
+		}
+		return files[i].sum < files[j].sum
+	})
+	var total int64
+	for _, f := range files {
+		total += f.size
+		if total > m.maxBlobBytes {
+			if err := m.dropBlob(f.ns, f.sum); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Manager) deleteBlobs() error {
+	if _, err := m.deleteBlobRows(m.prefix, func(blobRow) bool { return true }); err != nil {
+		return err
+	}
+	if m.blobRoot == "" {
+		return nil
+	}
+	return os.RemoveAll(filepath.Dir(m.blobPath(m.prefix, "x")))
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".blob-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func blobFiles(t *testing.T, m *Manager) []string {
+	t.Helper()
+	var out []string
+	err := filepath.WalkDir(m.blobDir(), func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		out = append(out, path)
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	require.NoError(t, err)
+	return out
+}
+
+func TestBlobRoundTripAndDedup(t *testing.T) {
+	m, err := New(testOptions(t.TempDir()))
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+
+	content := []byte("blob-secret-content")
+	sum, err := m.PutBlob("f1", content)
+	require.NoError(t, err)
+	sum2, err := m.PutBlob("f2", content)
+	require.NoError(t, err)
+	require.Equal(t, sum, sum2)
+
+	files := blobFiles(t, m)
+	require.Len(t, files, 1, "одинаковое содержимое хранится один раз")
+	raw, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	require.False(t, bytes.Contains(raw, content))
+
+	data, ts, err := m.GetBlob("f2")
+	require.NoError(t, err)
+	require.Equal(t, content, data)
+	require.True(t, m.IsFresh(ts))
+
+	require.NoError(t, m.DeleteBlob("f1"))
+	require.Len(t, blobFiles(t, m), 1, "файл нужен f2")
+	require.NoError(t, m.DeleteBlob("f2"))
+	require.Empty(t, blobFiles(t, m))
+}
+
+func TestBlobCorruptionDetected(t *testing.T) {
+	m, err := New(testOptions(t.TempDir()))
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+
+	sum, err := m.PutBlob("f1", []byte("content"))
+	require.NoError(t, err)
+	path := m.blobPath(m.prefix, sum)
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	raw[len(raw)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, raw, 0o600))
+
+	rep, err := m.Verify()
+	require.NoError(t, err)
+	require.Equal(t, []string{"blob:f1"}, rep.Corrupt)
+
+	_, _, err = m.GetBlob("f1")
+	require.ErrorIs(t, err, ErrBlobCorrupt)
+	require.Empty(t, blobFiles(t, m), "повреждённый файл удаляется")
+	_, _, err = m.GetBlob("f1")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrBlobCorrupt)
+}
+
+func TestBlobEvictionAndSweep(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.MaxBlobBytes = 10
+	m, err := New(opts)
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+
+	_, err = m.PutBlob("old", []byte("aaaaaa"))
+	require.NoError(t, err)
+	_, err = m.db.Exec(`UPDATE blobs SET accessed_at=? WHERE file_id='old'`, time.Now().Add(-time.Hour).Unix())
+	require.NoError(t, err)
+	_, err = m.PutBlob("new", []byte("bbbbbb"))
+	require.NoError(t, err)
+
+	_, _, err = m.GetBlob("old")
+	require.Error(t, err, "давно не читавшийся файл вытеснен")
+	data, _, err := m.GetBlob("new")
+	require.NoError(t, err)
+	require.Equal(t, "bbbbbb", string(data))
+
+	_, err = m.db.Exec(`UPDATE blobs SET updated_at=?`, time.Now().Add(-24*time.Hour).Unix())
+	require.NoError(t, err)
+	require.NoError(t, m.sweepBlobs())
+	require.Empty(t, blobFiles(t, m))
+}
+
+func TestBlobSurvivesRekeyAndPurge(t *testing.T) {
+	m, err := New(testOptions(t.TempDir()))
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+
+	_, err = m.PutBlob("f1", []byte("content"))
+	require.NoError(t, err)
+	_, err = m.Rekey()
+	require.NoError(t, err)
+	data, _, err := m.GetBlob("f1")
+	require.NoError(t, err)
+	require.Equal(t, "content", string(data))
+
+	st, err := m.Stats()
+	require.NoError(t, err)
+	require.Equal(t, 1, st.Blobs)
+	require.Equal(t, int64(len("content")), st.BlobBytes)
+
+	require.NoError(t, m.Purge())
+	require.Empty(t, blobFiles(t, m))
+}
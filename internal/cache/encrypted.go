@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Keys — ключи шифрования записей по версиям.
+type Keys interface {
+	// Current — версия и ключ для новых записей.
+	Current() (int, []byte, error)
+	Key(id int) ([]byte, error)
+}
+
+type staticKey []byte
+
+func (k staticKey) Current() (int, []byte, error) { return 1, k, nil }
+
+func (k staticKey) Key(id int) ([]byte, error) {
+	if id != 1 {
+		return nil, fmt.Errorf("%w (версия %d)", ErrKeyMissing, id)
+	}
+	return k, nil
+}
+
+// StaticKey — один ключ версии 1, например случайный ключ хранилища в
+// памяти.
+func StaticKey(key []byte) Keys {
+	return staticKey(key)
+}
+
+// RandomKey — StaticKey со случайным ключом.
+func RandomKey() (Keys, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return StaticKey(key), nil
+}
+
+// EncryptedStore шифрует поля записей AES-256-GCM; в additional data входят
+// имя поля и ключ записи, поэтому шифртекст нельзя переставить в другую
+// запись или поле. Время записи и чтения не шифруется.
+type EncryptedStore struct {
+	Store
+	keys Keys
+}
+
+func Encrypted(s Store, keys Keys) *EncryptedStore {
+	return &EncryptedStore{Store: s, keys: keys}
+}
+
+func (e *EncryptedStore) seal(key string, rec Record) (Record, error) {
+	id, k, err := e.keys.Current()
+	if err != nil {
+		return rec, err
+	}
+	out := rec
+	out.KeyID = id
+	for _, f := range []struct {
+		name     string
+		src, dst *[]byte
+	}{
+		{"payload_json", &rec.PayloadJSON, &out.PayloadJSON},
+		{"payload", &rec.Payload, &out.Payload},
+		{"meta", &rec.Meta, &out.Meta},
+	} {
+		if *f.dst, err = seal(k, *f.src, aad(f.name, key)); err != nil {
+			return rec, err
+		}
+	}
+	return out, nil
+}
+
+func (e *EncryptedStore) open(key string, rec Record) (Record, error) {
+	if rec.KeyID == 0 {
+		return rec, errors.New("запись не зашифрована")
+	}
+	k, err := e.keys.Key(rec.KeyID)
+	if err != nil {
+		return rec, err
+	}
+	out := rec
+	for _, f := range []struct {
+		name     string
+		src, dst *[]byte
+	}{
+		{"payload_json", &rec.PayloadJSON, &out.PayloadJSON},
+		{"payload", &rec.Payload, &out.Payload},
+		{"meta", &rec.Meta, &out.Meta},
+	} {
+		if *f.dst, err = open(k, *f.src, aad(f.name, key)); err != nil {
+			return rec, err
+		}
+	}
+	return out, nil
+}
+
+func (e *EncryptedStore) Get(key string) (Record, error) {
+	rec, err := e.Store.Get(key)
+	if err != nil {
+		return rec, err
+	}
+	return e.open(key, rec)
+}
+
+func (e *EncryptedStore) Put(key string, rec Record) error {
+	sealed, err := e.seal(key, rec)
+	if err != nil {
+		return err
+	}
+	return e.Store.Put(key, sealed)
+}
+
+func (e *EncryptedStore) Iterate(prefix string, fn func(string, Record) error) error {
+	return e.Store.Iterate(prefix, func(key string, rec Record) error {
+		plain, err := e.open(key, rec)
+		if err != nil {
+			return fmt.Errorf("запись %s: %w", key, err)
+		}
+		return fn(key, plain)
+	})
+}
@@ -0,0 +1,411 @@
+package cache
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+
+	"github.com/99designs/keyring"
+)
+
+// ErrKeyMissing — ключ, которым зашифрованы записи кеша, отсутствует в
+// keyring. Записи нельзя расшифровать; удалить их можно, открыв кеш с
+// DiscardMissingKey.
+var ErrKeyMissing = errors.New("ключ шифрования кеша не найден в keyring")
+
+var ErrKeyUnavailable = errors.New("keyring недоступен, ключ шифрования кеша не прочитать")
+
+// Версия ключа не меняется, поэтому keyring читается один раз на версию.
+type keyCache struct {
+	byID map[int][]byte
+	mu   sync.Mutex
+}
+
+func newKeyCache() *keyCache {
+	return &keyCache{byID: map[int][]byte{}}
+}
+
+func (c *keyCache) forget(id int) {
+	c.mu.Lock()
+	delete(c.byID, id)
+	c.mu.Unlock()
+}
+
+// Первая версия лежит под прежним именем: так читаются кеши, созданные до
+// версионирования.
+func (m *Manager) keyItem(id int) string {
+	if id <= 1 {
+		return m.keyName
+	}
+	return fmt.Sprintf("%s/v%d", m.keyName, id)
+}
+
+func (m *Manager) key(id int) ([]byte, error) {
+	m.keys.mu.Lock()
+	defer m.keys.mu.Unlock()
+	if k, ok := m.keys.byID[id]; ok {
+		return k, nil
+	}
+	if m.ring == nil {
+		return nil, fmt.Errorf("%w (версия %d)", ErrKeyMissing, id)
+	}
+	it, err := m.ring.Get(m.keyItem(id))
+	switch {
+	case errors.Is(err, keyring.ErrKeyNotFound) || errors.Is(err, fs.ErrNotExist):
+		return nil, fmt.Errorf("%w (версия %d)", ErrKeyMissing, id)
+	case err != nil:
+		return nil, fmt.Errorf("%w: %v", ErrKeyUnavailable, err)
+	case len(it.Data) != 32:
+		return nil, fmt.Errorf("%w (версия %d повреждена)", ErrKeyMissing, id)
+	}
+	m.keys.byID[id] = it.Data
+	return it.Data, nil
+}
+
+func (m *Manager) newKey(id int) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	// Без keyring (хранилище memory) ключ живёт только в памяти.
+	if m.ring != nil {
+		if err := m.ring.Set(keyring.Item{Key: m.keyItem(id), Data: key}); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrKeyUnavailable, err)
+		}
+	}
+	m.keys.mu.Lock()
+	m.keys.byID[id] = key
+	m.keys.mu.Unlock()
+	return key, nil
+}
+
+func (m *Manager) hasData() (bool, error) {
+	found := false
+	err := m.raw.Iterate(m.prefix, func(string, Record) error {
+		found = true
+		return errStop
+	})
+	if err != nil && !errors.Is(err, errStop) {
+		return false, err
+	}
+	if found {
+		return true, nil
+	}
+	ops, err := m.queue.QueueList(m.prefix)
+	return len(ops) > 0, err
+}
+
+var errStop = errors.New("stop")
+
+func (m *Manager) lastKeyVersion() (int, error) {
+	ids, err := m.versions.KeyVersions(m.prefix)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	return ids[len(ids)-1], nil
+}
+
+// Пропавший ключ не заменяется молча: записи выглядели бы повреждёнными.
+func (m *Manager) initKey() error {
+	id, err := m.lastKeyVersion()
+	if err != nil {
+		return err
+	}
+	if id == 0 {
+		data, err := m.hasData()
+		if err != nil {
+			return err
+		}
+		if data {
+			// Кеш создан до версионирования ключей.
+			id = 1
+		}
+	}
+	if id > 0 {
+		_, err := m.key(id)
+		if err == nil {
+			m.keyID = id
+			return m.versions.AddKeyVersion(m.prefix, id)
+		}
+		if !errors.Is(err, ErrKeyMissing) {
+			return err
+		}
+		data, herr := m.hasData()
+		if herr != nil {
+			return herr
+		}
+		if data && !m.discardMissingKey {
+			return err
+		}
+		if err := m.deleteData(); err != nil {
+			return err
+		}
+		if err := m.removeKeys(0); err != nil {
+			return err
+		}
+	}
+	// Версии не переиспользуются: старый ключ может найтись позже.
+	m.keyID = id + 1
+	if _, err := m.newKey(m.keyID); err != nil {
+		return err
+	}
+	return m.versions.AddKeyVersion(m.prefix, m.keyID)
+}
+
+// KeyVersion — версия ключа, которым шифруются новые записи.
+func (m *Manager) KeyVersion() int {
+	m.keys.mu.Lock()
+	defer m.keys.mu.Unlock()
+	return m.keyID
+}
+
+// Другой процесс мог выполнить Rekey и скоро удалит прежний ключ.
+func (m *Manager) currentKey() (int, []byte, error) {
+	id := m.KeyVersion()
+	last, err := m.lastKeyVersion()
+	if err != nil {
+		return 0, nil, err
+	}
+	if last > id {
+		id = last
+		m.keys.mu.Lock()
+		m.keyID = id
+		m.keys.mu.Unlock()
+	}
+	key, err := m.key(id)
+	return id, key, err
+}
+
+func (m *Manager) deleteData() error {
+	if _, err := m.raw.DeletePrefix(m.prefix); err != nil {
+		return err
+	}
+	if err := m.index.PruneIndex(); err != nil {
+		return err
+	}
+	if err := m.deleteBlobs(); err != nil {
+		return err
+	}
+	return m.queue.QueueClear(m.prefix)
+}
+
+func (m *Manager) removeKeys(before int) error {
+	all, err := m.versions.KeyVersions(m.prefix)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for _, id := range all {
+		if before == 0 || id < before {
+			ids = append(ids, id)
+		}
+	}
+	if before == 0 || before > 1 {
+		// Первая версия могла не попасть в список версий.
+		ids = append(ids, 1)
+	}
+	return m.dropKeys(ids)
+}
+
+// removeUnusedKeys оставляет версии, которыми ещё что-то зашифровано.
+func (m *Manager) removeUnusedKeys(before int) error {
+	used := map[int]bool{}
+	err := m.raw.Iterate(m.prefix, func(_ string, rec Record) error {
+		used[rec.KeyID] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	ops, err := m.queue.QueueList(m.prefix)
+	if err != nil {
+		return err
+	}
+	for _, e := range ops {
+		used[e.keyID] = true
+	}
+	blobs, err := m.blobs.Blobs(m.prefix)
+	if err != nil {
+		return err
+	}
+	for _, r := range blobs {
+		used[r.keyID] = true
+	}
+	all, err := m.versions.KeyVersions(m.prefix)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for _, id := range all {
+		if id < before && !used[id] {
+			ids = append(ids, id)
+		}
+	}
+	return m.dropKeys(ids)
+}
+
+func (m *Manager) dropKeys(ids []int) error {
+	for _, id := range ids {
+		if m.ring != nil {
+			if err := m.ring.Remove(m.keyItem(id)); err != nil && !errors.Is(err, keyring.ErrKeyNotFound) && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		m.keys.forget(id)
+		if err := m.versions.DropKeyVersion(m.prefix, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rekey перешифровывает данные пространства имён новой версией ключа.
+func (m *Manager) Rekey() (int, error) {
+	last, err := m.lastKeyVersion()
+	if err != nil {
+		return 0, err
+	}
+	next := max(last, m.KeyVersion()) + 1
+	key, err := m.newKey(next)
+	if err != nil {
+		return 0, err
+	}
+	n, err := m.reencrypt(next, key)
+	if err != nil {
+		if m.ring != nil {
+			_ = m.ring.Remove(m.keyItem(next))
+		}
+		m.keys.forget(next)
+		return 0, err
+	}
+	m.keys.mu.Lock()
+	m.keyID = next
+	m.keys.mu.Unlock()
+	if err := m.removeUnusedKeys(next); err != nil {
+		return n, err
+	}
+	// Старые шифртексты не должны остаться в файле.
+	return n, m.compact()
+}
+
+type rekeyKeys struct {
+	m   *Manager
+	key []byte
+	id  int
+}
+
+func (k rekeyKeys) Current() (int, []byte, error) {
+	return k.id, k.key, nil
+}
+
+func (k rekeyKeys) Key(id int) ([]byte, error) {
+	return k.m.key(id)
+}
+
+// Сначала всё расшифровывается: повреждённая запись не оставит кеш
+// перешифрованным наполовину.
+func (m *Manager) reencrypt(id int, key []byte) (int, error) {
+	n := 0
+	err := m.batch(func(s Store) error {
+		es := Encrypted(s, rekeyKeys{m: m, key: key, id: id})
+		type plainRec struct {
+			key string
+			rec Record
+		}
+		var recs []plainRec
+		err := s.Iterate(m.prefix, func(k string, rec Record) error {
+			plain, err := es.open(k, rec)
+			if err != nil {
+				return fmt.Errorf("запись %s: %w", k[len(m.prefix):], err)
+			}
+			recs = append(recs, plainRec{k, plain})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		queue := queueOf(s)
+		ops, err := queue.QueueList(m.prefix)
+		if err != nil {
+			return err
+		}
+		for i, e := range ops {
+			if ops[i].Payload, err = m.decryptWith(e.keyID, e.Payload, aad("outbox", m.prefix+e.ID)); err != nil {
+				return fmt.Errorf("операция очереди %s: %w", e.ID, err)
+			}
+		}
+		blobs := blobsOf(s)
+		rows, err := blobs.Blobs(m.prefix)
+		if err != nil {
+			return err
+		}
+		for i, r := range rows {
+			// Перешифровывается только ключ блоба, сами файлы не меняются.
+			if rows[i].dek, err = m.decryptWith(r.keyID, r.dek, aad("blob", m.prefix+r.sum)); err != nil {
+				return fmt.Errorf("файл %s: %w", r.fileID, err)
+			}
+		}
+
+		if err := versionsOf(s).AddKeyVersion(m.prefix, id); err != nil {
+			return err
+		}
+		index := indexOf(s)
+		for _, r := range recs {
+			if err := es.Put(r.key, r.rec); err != nil {
+				return err
+			}
+			if strings.HasPrefix(r.key, m.prefix+searchPrefix) {
+				// HMAC слов зависят от ключа.
+				var doc SearchDoc
+				if err := json.Unmarshal(r.rec.PayloadJSON, &doc); err != nil {
+					return err
+				}
+				if err := index.IndexDoc(m.prefix, searchKey(key), doc); err != nil {
+					return err
+				}
+			}
+		}
+		for _, e := range ops {
+			enc, err := seal(key, e.Payload, aad("outbox", m.prefix+e.ID))
+			if err != nil {
+				return err
+			}
+			if err := queue.QueueUpdate(m.prefix, e.ID, enc, id); err != nil {
+				return err
+			}
+		}
+		for _, r := range rows {
+			if r.dek, err = seal(key, r.dek, aad("blob", m.prefix+r.sum)); err != nil {
+				return err
+			}
+			r.keyID = id
+			if err := blobs.PutBlobRow(r); err != nil {
+				return err
+			}
+		}
+		n = len(recs) + len(ops)
+		return nil
+	})
+	return n, err
+}
+
+func (m *Manager) batch(fn func(Store) error) error {
+	if b, ok := m.raw.(batcher); ok {
+		return b.Batch(fn)
+	}
+	return fn(m.raw)
+}
+
+// withKey — копия со старым ключом без версий для миграций.
+func (m *Manager) withKey(name string) *Manager {
+	c := *m
+	c.keyName = name
+	c.keyID = 1
+	c.keys = newKeyCache()
+	return &c
+}
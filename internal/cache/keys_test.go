@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/99designs/keyring"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheDetectsMissingKey(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	m, err := New(opts)
+	require.NoError(t, err)
+	require.Equal(t, 1, m.KeyVersion())
+	require.NoError(t, m.Put("items:get:1", []byte(`{}`), nil, ""))
+	require.NoError(t, m.OutboxAdd("op-1", []byte("x")))
+	require.NoError(t, m.ring.Remove(m.keyItem(1)))
+	require.NoError(t, m.Close())
+
+	_, err = New(opts)
+	require.ErrorIs(t, err, ErrKeyMissing)
+
+	opts.DiscardMissingKey = true
+	m, err = New(opts)
+	require.NoError(t, err)
+	require.Equal(t, 2, m.KeyVersion())
+	keys, err := m.Keys("")
+	require.NoError(t, err)
+	require.Empty(t, keys)
+	ops, err := m.OutboxList()
+	require.NoError(t, err)
+	require.Empty(t, ops)
+	require.NoError(t, m.Put("items:get:1", []byte(`{}`), nil, ""))
+	require.NoError(t, m.Close())
+
+	opts.DiscardMissingKey = false
+	m, err = New(opts)
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+	require.Equal(t, 2, m.KeyVersion())
+	_, _, _, _, err = m.Get("items:get:1")
+	require.NoError(t, err)
+}
+
+func TestCacheMissingKeyWithoutDataIsReplaced(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	m, err := New(opts)
+	require.NoError(t, err)
+	require.NoError(t, m.ring.Remove(m.keyItem(1)))
+	require.NoError(t, m.Close())
+
+	m, err = New(opts)
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+	require.Equal(t, 2, m.KeyVersion())
+}
+
+func TestCacheRekey(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	m, err := New(opts)
+	require.NoError(t, err)
+	require.NoError(t, m.Put("items:get:1", []byte(`{"v":1}`), []byte("p"), "meta"))
+	require.NoError(t, m.Put("replica:item:1", nil, []byte("r"), ""))
+	require.NoError(t, m.OutboxAdd("op-1", []byte("x")))
+	oldItem := m.keyItem(1)
+
+	n, err := m.Rekey()
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	require.Equal(t, 2, m.KeyVersion())
+	_, err = m.ring.Get(oldItem)
+	require.ErrorIs(t, err, keyring.ErrKeyNotFound)
+	var stale int
+	require.NoError(t, m.db.QueryRow(`SELECT COUNT(*) FROM public_cache WHERE key_id<>2`).Scan(&stale))
+	require.Zero(t, stale)
+	require.NoError(t, m.Close())
+
+	m, err = New(opts)
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+	require.Equal(t, 2, m.KeyVersion())
+	pj, payload, _, meta, err := m.Get("items:get:1")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"v":1}`, string(pj))
+	require.Equal(t, []byte("p"), payload)
+	require.Equal(t, "meta", meta)
+	ops, err := m.OutboxList()
+	require.NoError(t, err)
+	require.Equal(t, []byte("x"), ops[0].Payload)
+	rep, err := m.Verify()
+	require.NoError(t, err)
+	require.Empty(t, rep.Corrupt)
+}
+
+func TestCacheRekeyIsAtomic(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	m, err := New(opts)
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+	require.NoError(t, m.Put("items:get:1", []byte(`{}`), nil, ""))
+	require.NoError(t, m.Put("items:get:2", []byte(`{}`), nil, ""))
+	_, err = m.db.Exec(`UPDATE public_cache SET meta=? WHERE key=?`, []byte("garbage-garbage-garbage"), m.prefix+"items:get:2")
+	require.NoError(t, err)
+
+	_, err = m.Rekey()
+	require.ErrorContains(t, err, "items:get:2")
+	require.Equal(t, 1, m.KeyVersion())
+	_, err = m.ring.Get(m.keyItem(2))
+	require.ErrorIs(t, err, keyring.ErrKeyNotFound)
+	_, _, _, _, err = m.Get("items:get:1")
+	require.NoError(t, err)
+}
+
+func TestCacheRekeySwitchesOtherManagers(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	m, err := New(opts)
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+	other, err := New(opts)
+	require.NoError(t, err)
+	defer func() { _ = other.Close() }()
+
+	_, err = m.Rekey()
+	require.NoError(t, err)
+	require.NoError(t, other.Put("items:get:1", []byte(`{"v":1}`), nil, ""))
+	require.NoError(t, other.OutboxAdd("op-1", []byte("x")))
+	require.Equal(t, 2, other.KeyVersion())
+
+	pj, _, _, _, err := m.Get("items:get:1")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"v":1}`, string(pj))
+	ops, err := m.OutboxList()
+	require.NoError(t, err)
+	require.Equal(t, []byte("x"), ops[0].Payload)
+}
+
+func TestCacheKeepsReferencedKeyVersions(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	m, err := New(opts)
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+	require.NoError(t, m.Put("items:get:1", []byte(`{}`), nil, ""))
+	_, err = m.newKey(2)
+	require.NoError(t, err)
+	require.NoError(t, m.versions.AddKeyVersion(m.prefix, 2))
+
+	require.NoError(t, m.removeUnusedKeys(2))
+	_, err = m.ring.Get(m.keyItem(1))
+	require.NoError(t, err, "версией 1 ещё зашифрована запись")
+
+	require.NoError(t, m.Delete("items:get:1"))
+	require.NoError(t, m.removeUnusedKeys(2))
+	_, err = m.ring.Get(m.keyItem(1))
+	require.ErrorIs(t, err, keyring.ErrKeyNotFound)
+}
+
+func TestCacheReportsUnavailableKeyring(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions(dir)
+	blocker := filepath.Join(dir, "not-a-dir")
+	require.NoError(t, os.WriteFile(blocker, nil, 0o600))
+	opts.KeyringConfig.FileDir = filepath.Join(blocker, "keyring")
+
+	_, err := New(opts)
+	require.ErrorIs(t, err, ErrKeyUnavailable)
+	require.NotErrorIs(t, err, ErrKeyMissing)
+}
@@ -0,0 +1,488 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Реализации возможностей поверх любого Store держат данные под служебными
+// префиксами, поэтому такие записи не устаревают, не вытесняются и не
+// попадают в Stats.
+const (
+	kvOutbox   = "outbox:"
+	kvIndex    = "index:"
+	kvBlob     = "blob:"
+	kvKeys     = "keys:"
+	kvCounters = "stats:"
+	kvMarks    = "marks:"
+)
+
+func isKVKey(key string) bool {
+	for _, p := range []string{kvOutbox, kvIndex, kvBlob, kvKeys, kvCounters, kvMarks} {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitNS(rest string) (ns, id string) {
+	i := strings.Index(rest, "/")
+	return rest[:i+1], rest[i+1:]
+}
+
+func queueOf(s Store) queueStore {
+	if q, ok := s.(queueStore); ok {
+		return q
+	}
+	return kvQueue{s}
+}
+
+func indexOf(s Store) searchIndex {
+	if i, ok := s.(searchIndex); ok {
+		return i
+	}
+	return kvSearch{s}
+}
+
+func blobsOf(s Store) blobStore {
+	if b, ok := s.(blobStore); ok {
+		return b
+	}
+	return kvBlobs{s}
+}
+
+func versionsOf(s Store) keyVersions {
+	if v, ok := s.(keyVersions); ok {
+		return v
+	}
+	return kvVersions{s}
+}
+
+func countersOf(s Store) counterStore {
+	if c, ok := s.(counterStore); ok {
+		return c
+	}
+	return kvStats{s}
+}
+
+func marksOf(s Store) markStore {
+	if m, ok := s.(markStore); ok {
+		return m
+	}
+	return kvMarkStore{s}
+}
+
+func lruOf(s Store) lruStore {
+	if l, ok := s.(lruStore); ok {
+		return l
+	}
+	return kvLRU{s}
+}
+
+type kvQueue struct {
+	s Store
+}
+
+type outboxState struct {
+	LastError string `json:"last_error,omitempty"`
+	Seq       int64  `json:"seq"`
+	Attempts  int    `json:"attempts,omitempty"`
+}
+
+func (q kvQueue) put(e OutboxEntry) error {
+	st, err := json.Marshal(outboxState{Seq: e.Seq, Attempts: e.Attempts, LastError: e.LastError})
+	if err != nil {
+		return err
+	}
+	return q.s.Put(kvOutbox+e.ns+e.ID, Record{Payload: e.Payload, Meta: st, KeyID: e.keyID, UpdatedAt: e.CreatedAt, AccessedAt: e.CreatedAt})
+}
+
+func (q kvQueue) QueueList(ns string) ([]OutboxEntry, error) {
+	var out []OutboxEntry
+	err := q.s.Iterate(kvOutbox+ns, func(k string, rec Record) error {
+		var st outboxState
+		if err := json.Unmarshal(rec.Meta, &st); err != nil {
+			return err
+		}
+		e := OutboxEntry{
+			Payload: rec.Payload, CreatedAt: rec.UpdatedAt, keyID: rec.KeyID,
+			Seq: st.Seq, Attempts: st.Attempts, LastError: st.LastError,
+		}
+		e.ns, e.ID = splitNS(strings.TrimPrefix(k, kvOutbox))
+		out = append(out, e)
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Seq < out[j].Seq })
+	return out, err
+}
+
+func (q kvQueue) QueueAdd(e OutboxEntry) error {
+	ops, err := q.QueueList(e.ns)
+	if err != nil {
+		return err
+	}
+	for _, o := range ops {
+		if o.ID == e.ID {
+			return fmt.Errorf("операция %s уже в очереди", e.ID)
+		}
+	}
+	e.Seq = 1
+	if len(ops) > 0 {
+		e.Seq = ops[len(ops)-1].Seq + 1
+	}
+	return q.put(e)
+}
+
+func (q kvQueue) change(ns, id string, fn func(*OutboxEntry)) error {
+	ops, err := q.QueueList(ns)
+	if err != nil {
+		return err
+	}
+	for _, e := range ops {
+		if e.ID == id {
+			fn(&e)
+			return q.put(e)
+		}
+	}
+	return nil
+}
+
+func (q kvQueue) QueueUpdate(ns, id string, payload []byte, keyID int) error {
+	return q.change(ns, id, func(e *OutboxEntry) { e.Payload, e.keyID = payload, keyID })
+}
+
+func (q kvQueue) QueueFail(ns, id, msg string) error {
+	return q.change(ns, id, func(e *OutboxEntry) { e.Attempts, e.LastError = e.Attempts+1, msg })
+}
+
+func (q kvQueue) QueueDelete(ns, id string) error {
+	return q.s.Delete(kvOutbox + ns + id)
+}
+
+func (q kvQueue) QueueClear(ns string) error {
+	_, err := q.s.DeletePrefix(kvOutbox + ns)
+	return err
+}
+
+// Веса как у bm25 в sqlite: заголовок 10, meta 3, поля 1.
+type kvSearch struct {
+	s Store
+}
+
+var searchWeights = [3]float64{10, 3, 1}
+
+func (x kvSearch) IndexDoc(ns string, sk []byte, doc SearchDoc) error {
+	var cols [3]string
+	cols[0], cols[1], cols[2] = docTerms(sk, doc)
+	b, err := json.Marshal(cols)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return x.s.Put(kvIndex+ns+doc.ID, Record{Meta: b, UpdatedAt: now, AccessedAt: now})
+}
+
+func (x kvSearch) UnindexDoc(ns, id string) error {
+	return x.s.Delete(kvIndex + ns + id)
+}
+
+func (x kvSearch) Match(ns string, sk []byte, query []string) ([]match, error) {
+	var out []match
+	err := x.s.Iterate(kvIndex+ns, func(k string, rec Record) error {
+		var cols [3]string
+		if json.Unmarshal(rec.Meta, &cols) != nil {
+			return nil
+		}
+		var score float64
+		for _, q := range query {
+			p, w := queryTerms(sk, q)
+			matched := false
+			for i, c := range cols {
+				for _, t := range strings.Fields(c) {
+					if t == p || t == w {
+						score += searchWeights[i]
+						matched = true
+					}
+				}
+			}
+			if !matched {
+				return nil
+			}
+		}
+		out = append(out, match{id: strings.TrimPrefix(k, kvIndex+ns), rank: -score})
+		return nil
+	})
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].rank != out[j].rank {
+			return out[i].rank < out[j].rank
+		}
+		return out[i].id < out[j].id
+	})
+	return out, err
+}
+
+func (x kvSearch) PruneIndex() error {
+	var drop []string
+	err := x.s.Iterate(kvIndex, func(k string, _ Record) error {
+		ns, id := splitNS(strings.TrimPrefix(k, kvIndex))
+		_, err := x.s.Get(ns + searchPrefix + id)
+		if errors.Is(err, ErrNotFound) {
+			drop = append(drop, k)
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range drop {
+		if err := x.s.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type kvBlobs struct {
+	s Store
+}
+
+type blobMeta struct {
+	Sum  string `json:"sha256"`
+	Size int64  `json:"size"`
+}
+
+func blobFromRecord(k string, rec Record) (blobRow, error) {
+	var bm blobMeta
+	r := blobRow{dek: rec.Payload, keyID: rec.KeyID, updatedAt: rec.UpdatedAt, accessedAt: rec.AccessedAt}
+	r.ns, r.fileID = splitNS(strings.TrimPrefix(k, kvBlob))
+	err := json.Unmarshal(rec.Meta, &bm)
+	r.sum, r.size = bm.Sum, bm.Size
+	return r, err
+}
+
+func (b kvBlobs) Blobs(ns string) ([]blobRow, error) {
+	var out []blobRow
+	err := b.s.Iterate(kvBlob+ns, func(k string, rec Record) error {
+		r, err := blobFromRecord(k, rec)
+		out = append(out, r)
+		return err
+	})
+	return out, err
+}
+
+func (b kvBlobs) Blob(ns, fileID string) (blobRow, error) {
+	rec, err := b.s.Get(kvBlob + ns + fileID)
+	if err != nil {
+		return blobRow{}, err
+	}
+	return blobFromRecord(kvBlob+ns+fileID, rec)
+}
+
+func (b kvBlobs) PutBlobRow(r blobRow) error {
+	meta, err := json.Marshal(blobMeta{Sum: r.sum, Size: r.size})
+	if err != nil {
+		return err
+	}
+	return b.s.Put(kvBlob+r.ns+r.fileID, Record{Payload: r.dek, Meta: meta, KeyID: r.keyID, UpdatedAt: r.updatedAt, AccessedAt: r.accessedAt})
+}
+
+func (b kvBlobs) DeleteBlobRow(ns, fileID string) error {
+	return b.s.Delete(kvBlob + ns + fileID)
+}
+
+type kvVersions struct {
+	s Store
+}
+
+func (v kvVersions) KeyVersions(ns string) ([]int, error) {
+	var ids []int
+	rec, err := v.s.Get(kvKeys + ns)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ids, json.Unmarshal(rec.Meta, &ids)
+}
+
+func (v kvVersions) save(ns string, ids []int) error {
+	if len(ids) == 0 {
+		return v.s.Delete(kvKeys + ns)
+	}
+	sort.Ints(ids)
+	b, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return v.s.Put(kvKeys+ns, Record{Meta: b, UpdatedAt: now, AccessedAt: now})
+}
+
+func (v kvVersions) AddKeyVersion(ns string, id int) error {
+	ids, err := v.KeyVersions(ns)
+	if err != nil {
+		return err
+	}
+	for _, x := range ids {
+		if x == id {
+			return nil
+		}
+	}
+	return v.save(ns, append(ids, id))
+}
+
+func (v kvVersions) DropKeyVersion(ns string, id int) error {
+	ids, err := v.KeyVersions(ns)
+	if err != nil {
+		return err
+	}
+	kept := ids[:0]
+	for _, x := range ids {
+		if x != id {
+			kept = append(kept, x)
+		}
+	}
+	return v.save(ns, kept)
+}
+
+// Счётчики не секретны и хранятся открыто.
+type kvStats struct {
+	s Store
+}
+
+type savedCounters struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+func (c kvStats) Counters(ns string) (hits, misses int64, err error) {
+	var sc savedCounters
+	rec, err := c.s.Get(kvCounters + ns)
+	if errors.Is(err, ErrNotFound) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	err = json.Unmarshal(rec.Meta, &sc)
+	return sc.Hits, sc.Misses, err
+}
+
+func (c kvStats) AddCounters(ns string, hits, misses int64) error {
+	h, ms, err := c.Counters(ns)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(savedCounters{Hits: h + hits, Misses: ms + misses})
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return c.s.Put(kvCounters+ns, Record{Meta: b, UpdatedAt: now, AccessedAt: now})
+}
+
+type kvMarkStore struct {
+	s Store
+}
+
+func (k kvMarkStore) Mark(name string, at time.Time) error {
+	return k.s.Put(kvMarks+name, Record{UpdatedAt: at, AccessedAt: at})
+}
+
+func (k kvMarkStore) MarkedAt(name string) (time.Time, error) {
+	rec, err := k.s.Get(kvMarks + name)
+	if errors.Is(err, ErrNotFound) {
+		return time.Time{}, nil
+	}
+	return rec.UpdatedAt, err
+}
+
+func (k kvMarkStore) Claim(name string, interval time.Duration) (bool, error) {
+	at, err := k.MarkedAt(name)
+	if err != nil || time.Since(at) < interval {
+		return false, err
+	}
+	return true, k.Mark(name, time.Now())
+}
+
+func isEvictable(key string) bool {
+	return !strings.HasPrefix(key, replicaPrefix)
+}
+
+func isExpirable(key string) bool {
+	return isEvictable(key) && !strings.HasPrefix(key, searchPrefix)
+}
+
+type kvLRU struct {
+	s Store
+}
+
+func (l kvLRU) forEntries(fn func(full, key string, rec Record) error) error {
+	return l.s.Iterate("ns:", func(full string, rec Record) error {
+		_, key := splitNS(full)
+		return fn(full, key, rec)
+	})
+}
+
+func (l kvLRU) Sweep(before time.Time) error {
+	var drop []string
+	err := l.forEntries(func(full, key string, rec Record) error {
+		if isExpirable(key) && rec.UpdatedAt.Before(before) {
+			drop = append(drop, full)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range drop {
+		if err := l.s.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l kvLRU) Evict(maxEntries int, maxBytes int64) (int, int64, error) {
+	type entry struct {
+		at   time.Time
+		key  string
+		size int64
+	}
+	var all []entry
+	err := l.forEntries(func(full, key string, rec Record) error {
+		if isEvictable(key) {
+			all = append(all, entry{key: full, at: rec.AccessedAt, size: rec.size(full)})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if !all[i].at.Equal(all[j].at) {
+			return all[i].at.After(all[j].at)
+		}
+		return all[i].key < all[j].key
+	})
+	var total, kept int64
+	n := 0
+	for i, e := range all {
+		total += e.size
+		if (maxEntries > 0 && i >= maxEntries) || (maxBytes > 0 && total > maxBytes) {
+			if err := l.s.Delete(e.key); err != nil {
+				return 0, 0, err
+			}
+			continue
+		}
+		n, kept = n+1, kept+e.size
+	}
+	return n, kept, nil
+}
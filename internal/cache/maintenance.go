@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	vacuumInterval = 7 * 24 * time.Hour
+	// Точность LRU до минуты не нужна, а каждая запись accessed_at —
+	// лишняя блокировка WAL.
+	touchInterval = time.Minute
+	busyTimeout   = 5 * time.Second
+)
+
+func (m *Manager) maintain() error {
+	if err := m.sweep(); err != nil {
+		return err
+	}
+	if err := m.evict(); err != nil {
+		return err
+	}
+	if err := m.index.PruneIndex(); err != nil {
+		return err
+	}
+	if err := m.sweepBlobs(); err != nil {
+		return err
+	}
+	if err := m.evictBlobs(); err != nil {
+		return err
+	}
+	if c, ok := m.raw.(compacter); ok {
+		return c.CompactIfDue(vacuumInterval)
+	}
+	return nil
+}
+
+func (m *Manager) sweep() error {
+	if m.ttlMinutes <= 0 {
+		return nil
+	}
+	return m.lru.Sweep(time.Now().Add(-time.Duration(m.ttlMinutes+max(m.staleMinutes, 0)) * time.Minute))
+}
+
+// usage — приблизительный размер вытесняемой части кеша: перезапись ключей и
+// записи других процессов в нём не учтены, поэтому точный подсчёт делает
+// Evict, когда счётчик выходит за предел.
+type usage struct {
+	entries atomic.Int64
+	bytes   atomic.Int64
+}
+
+func (m *Manager) evict() error {
+	if m.maxEntries <= 0 && m.maxBytes <= 0 {
+		return nil
+	}
+	n, size, err := m.lru.Evict(m.maxEntries, m.maxBytes)
+	if err != nil {
+		return err
+	}
+	m.usage.entries.Store(int64(n))
+	m.usage.bytes.Store(size)
+	return nil
+}
+
+func (m *Manager) evictIfFull(size int64) error {
+	if m.maxEntries <= 0 && m.maxBytes <= 0 {
+		return nil
+	}
+	n, total := m.usage.entries.Add(1), m.usage.bytes.Add(size)
+	if (m.maxEntries > 0 && n > int64(m.maxEntries)) || (m.maxBytes > 0 && total > m.maxBytes) {
+		return m.evict()
+	}
+	return nil
+}
+
+// compact — Compact хранилища, если оно это умеет.
+func (m *Manager) compact() error {
+	if c, ok := m.raw.(compacter); ok {
+		return c.Compact()
+	}
+	return nil
+}
+
+func (m *Manager) touch(key string, rec Record) {
+	now := time.Now()
+	if now.Sub(rec.AccessedAt) < touchInterval {
+		return
+	}
+	if t, ok := m.raw.(toucher); ok {
+		_ = t.Touch(key, now)
+		return
+	}
+	rec.AccessedAt = now
+	_ = m.store.Put(key, rec)
+}
+
+// Mark отмечает, что служебная задача name пространства имён выполнена сейчас.
+func (m *Manager) Mark(name string) error {
+	return m.marks.Mark(m.prefix+name, time.Now())
+}
+
+// MarkedAt — время последней метки Mark; нулевое, если её нет.
+func (m *Manager) MarkedAt(name string) (time.Time, error) {
+	return m.marks.MarkedAt(m.prefix + name)
+}
+
+// Claim ставит метку name, если прошлая старше interval, и сообщает, что
+// задача досталась этому процессу.
+func (m *Manager) Claim(name string, interval time.Duration) (bool, error) {
+	return m.marks.Claim(m.prefix+name, interval)
+}
+
+func busyTimeoutMillis() string {
+	return strconv.FormatInt(busyTimeout.Milliseconds(), 10)
+}
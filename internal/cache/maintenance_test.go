@@ -0,0 +1,207 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func setAccessed(t *testing.T, m *Manager, key string, at int64) {
+	t.Helper()
+	_, err := m.db.Exec(`UPDATE public_cache SET accessed_at=? WHERE key=?`, at, m.prefix+key)
+	require.NoError(t, err)
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.MaxEntries = 3
+	m, err := New(opts)
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+	for i, k := range []string{"items:get:1", "items:get:2", "items:get:3"} {
+		require.NoError(t, m.Put(k, []byte(`{}`), nil, ""))
+		setAccessed(t, m, k, int64(100*(i+1)))
+	}
+	require.NoError(t, m.Put("replica:item:1", nil, []byte("r"), ""))
+	setAccessed(t, m, "replica:item:1", 1)
+
+	// Чтение обновляет accessed_at, поэтому вытесняется items:get:2.
+	_, _, _, _, err = m.Get("items:get:1")
+	require.NoError(t, err)
+	require.NoError(t, m.Put("items:get:4", []byte(`{}`), nil, ""))
+	keys, err := m.Keys("")
+	require.NoError(t, err)
+	require.Equal(t, []string{"items:get:1", "items:get:3", "items:get:4", "replica:item:1"}, keys)
+}
+
+func TestCacheEvictsBySize(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.MaxBytes = 3000
+	m, err := New(opts)
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+	big := []byte(`"` + strings.Repeat("x", 1000) + `"`)
+	for i := 1; i <= 5; i++ {
+		k := fmt.Sprintf("items:get:%d", i)
+		require.NoError(t, m.Put(k, big, nil, ""))
+		setAccessed(t, m, k, int64(i))
+	}
+	keys, err := m.Keys("")
+	require.NoError(t, err)
+	require.Equal(t, []string{"items:get:4", "items:get:5"}, keys)
+}
+
+func TestCacheSweepsExpiredOnOpen(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	m, err := New(opts)
+	require.NoError(t, err)
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, m.PutWithTimestamp("items:get:1", []byte(`{}`), nil, "", old))
+	require.NoError(t, m.PutWithTimestamp("replica:item:1", nil, []byte("r"), "", old))
+	require.NoError(t, m.Put("items:get:2", []byte(`{}`), nil, ""))
+	require.NoError(t, m.Close())
+
+	m, err = New(opts)
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+	keys, err := m.Keys("")
+	require.NoError(t, err)
+	require.Equal(t, []string{"items:get:2", "replica:item:1"}, keys)
+}
+
+func TestCacheKeepsStaleWithinWindow(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.StaleMinutes = 120
+	m, err := New(opts)
+	require.NoError(t, err)
+	stale := time.Now().Add(-time.Hour)
+	require.NoError(t, m.PutWithTimestamp("items:get:1", []byte(`{}`), nil, "", stale))
+	require.NoError(t, m.PutWithTimestamp("items:get:2", []byte(`{}`), nil, "", time.Now().Add(-3*time.Hour)))
+	require.NoError(t, m.Close())
+
+	m, err = New(opts)
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+	keys, err := m.Keys("")
+	require.NoError(t, err)
+	require.Equal(t, []string{"items:get:1"}, keys)
+	require.False(t, m.IsFresh(stale))
+	require.True(t, m.IsUsable(stale))
+}
+
+func TestCacheMaintenanceClaimedOnce(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	a, err := New(opts)
+	require.NoError(t, err)
+	defer func() { _ = a.Close() }()
+	b, err := New(opts)
+	require.NoError(t, err)
+	defer func() { _ = b.Close() }()
+	ok, err := newSQLiteStore(a.db).Claim("vacuum", vacuumInterval)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = newSQLiteStore(b.db).Claim("vacuum", vacuumInterval)
+	require.NoError(t, err)
+	require.False(t, ok)
+	_, err = a.db.Exec(`UPDATE cache_maintenance SET at=at-3600`)
+	require.NoError(t, err)
+	ok, err = newSQLiteStore(b.db).Claim("vacuum", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestCacheSharedBetweenProcesses(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.MaxEntries = 10
+	var ms []*Manager
+	for i := 0; i < 3; i++ {
+		m, err := New(opts)
+		require.NoError(t, err)
+		defer func() { _ = m.Close() }()
+		ms = append(ms, m)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, len(ms))
+	for i, m := range ms {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				k := fmt.Sprintf("items:get:%d-%d", i, j)
+				if err := m.Put(k, []byte(`{}`), nil, ""); err != nil {
+					errs <- err
+					return
+				}
+				if _, _, _, _, err := m.Get(k); err != nil && !errors.Is(err, ErrNotFound) {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	// Каждый процесс считает только свои записи; общий предел восстанавливается
+	// при следующем открытии.
+	m, err := New(opts)
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+	keys, err := m.Keys("")
+	require.NoError(t, err)
+	require.Len(t, keys, 10)
+}
+
+func TestCacheEvictsOnlyWhenCounterCrossesLimit(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.MaxEntries = 3
+	m, err := New(opts)
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+	for i := 1; i <= 3; i++ {
+		k := fmt.Sprintf("items:get:%d", i)
+		require.NoError(t, m.Put(k, []byte(`{}`), nil, ""))
+		setAccessed(t, m, k, int64(i))
+	}
+	// Запись в обход Manager счётчик не видит: вытеснения ещё нет.
+	_, err = m.db.Exec(`INSERT INTO public_cache(key, payload_json, updated_at, accessed_at) VALUES(?, '{}', 0, 0)`, m.prefix+"items:get:0")
+	require.NoError(t, err)
+	keys, err := m.Keys("")
+	require.NoError(t, err)
+	require.Len(t, keys, 4)
+
+	require.NoError(t, m.Put("items:get:4", []byte(`{}`), nil, ""))
+	keys, err = m.Keys("")
+	require.NoError(t, err)
+	require.Equal(t, []string{"items:get:2", "items:get:3", "items:get:4"}, keys)
+}
+
+func TestCacheMarksAreNotEntries(t *testing.T) {
+	for _, backend := range []string{BackendSQLite, BackendBolt, BackendMemory} {
+		opts := testOptions(t.TempDir())
+		opts.Backend = backend
+		m, err := New(opts)
+		require.NoError(t, err)
+		at, err := m.MarkedAt("task")
+		require.NoError(t, err)
+		require.True(t, at.IsZero(), backend)
+		require.NoError(t, m.Mark("task"))
+		at, err = m.MarkedAt("task")
+		require.NoError(t, err)
+		require.WithinDuration(t, time.Now(), at, 2*time.Second, backend)
+		keys, err := m.Keys("")
+		require.NoError(t, err)
+		require.Empty(t, keys, backend)
+		st, err := m.Stats()
+		require.NoError(t, err)
+		require.Zero(t, st.Entries, backend)
+		require.NoError(t, m.Close())
+	}
+}
@@ -4,12 +4,16 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/99designs/keyring"
@@ -17,71 +21,181 @@ import (
 )
 
 type Manager struct {
-	ring       keyring.Keyring
-	db         *sql.DB
-	keyName    string
-	ttlMinutes int
+	ring keyring.Keyring
+	db   *sql.DB
+	// raw хранит записи как есть, store шифрует их поверх raw.
+	raw               Store
+	store             *EncryptedStore
+	queue             queueStore
+	index             searchIndex
+	blobs             blobStore
+	versions          keyVersions
+	counters          counterStore
+	lru               lruStore
+	marks             markStore
+	blobRoot          string
+	backend           string
+	stats             *counters
+	usage             *usage
+	path              string
+	ns                Namespace
+	prefix            string
+	baseKey           string
+	keys              *keyCache
+	keyName           string
+	maxBytes          int64
+	maxBlobBytes      int64
+	ttlMinutes        int
+	maxEntries        int
+	keyID             int
+	staleMinutes      int
+	discardMissingKey bool
 }
 
 type Options struct {
 	KeyringConfig keyring.Config
-	Path          string
-	KeyName       string
-	TTLMinutes    int
+	Namespace     Namespace
+	// Backend — sqlite (по умолчанию), bbolt или memory; memory не нужны ни
+	// Path, ни keyring.
+	Backend string
+	Path    string
+	KeyName string
+	// MaxBytes и MaxEntries ограничивают кеш (без реплики); 0 — без
+	// ограничения. Вытесняются записи, которые дольше всего не читались.
+	MaxBytes int64
+	// MaxBlobBytes ограничивает общий размер скачанных файлов (см.
+	// PutBlob); 0 — без ограничения.
+	MaxBlobBytes int64
+	TTLMinutes   int
+	MaxEntries   int
+	// StaleMinutes — сколько после TTL запись ещё отдают режимы cache-first
+	// и cache-only.
+	StaleMinutes int
+	// DiscardMissingKey: если ключ пространства имён пропал из keyring, его
+	// записи и очередь удаляются и создаётся новый ключ. Без него New
+	// возвращает ErrKeyMissing.
+	DiscardMissingKey bool
+}
+
+// Namespace — владелец записей кеша. Записи разных серверов и
+// пользователей хранятся раздельно и шифруются разными ключами.
+type Namespace struct {
+	Server string
+	UserID string
+}
+
+// ID не раскрывает адрес сервера и пользователя в файле кеша.
+func (n Namespace) ID() string {
+	h := sha256.Sum256([]byte(n.Server + "\x00" + n.UserID))
+	return hex.EncodeToString(h[:8])
 }
 
 func New(opts Options) (*Manager, error) {
+	backend, err := ParseBackend(opts.Backend)
+	if err != nil {
+		return nil, err
+	}
+	keyName := opts.KeyName
+	if keyName == "" {
+		keyName = "cache_key"
+	}
+	id := opts.Namespace.ID()
+	m := &Manager{
+		backend:      backend,
+		stats:        &counters{},
+		usage:        &usage{},
+		ttlMinutes:   opts.TTLMinutes,
+		maxEntries:   opts.MaxEntries,
+		maxBytes:     opts.MaxBytes,
+		maxBlobBytes: opts.MaxBlobBytes,
+		keys:         newKeyCache(),
+
+		staleMinutes: opts.StaleMinutes,
+
+		discardMissingKey: opts.DiscardMissingKey,
+		ns:                opts.Namespace,
+		prefix:            "ns:" + id + "/",
+		baseKey:           keyName,
+		keyName:           keyName + "/" + id,
+	}
+	if backend == BackendMemory {
+		return m, m.openMemory()
+	}
 	if opts.Path == "" {
 		return nil, errors.New("cache path required")
 	}
-	p := opts.Path
-	if p[0] == '~' {
-		home, _ := os.UserHomeDir()
-		p = filepath.Join(home, p[1:])
-	}
-	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+	m.path = expandPath(opts.Path)
+	if err := os.MkdirAll(filepath.Dir(m.path), 0o700); err != nil {
 		return nil, err
 	}
-	db, err := sql.Open("sqlite", p)
+	if backend == BackendBolt {
+		// У bbolt свой ключ: смена хранилища не затрагивает ключ кеша sqlite.
+		m.keyName += "/" + BackendBolt
+		m.blobRoot = m.path + ".blobs"
+		return m, m.openBolt(opts.KeyringConfig)
+	}
+	db, err := sql.Open("sqlite", m.path)
 	if err != nil {
 		return nil, err
 	}
 	db.SetMaxOpenConns(1)
-	if _, err := db.Exec(`PRAGMA journal_mode=WAL; PRAGMA synchronous=NORMAL;`); err != nil {
+	if _, err := db.Exec(`PRAGMA journal_mode=WAL; PRAGMA synchronous=NORMAL; PRAGMA secure_delete=ON; PRAGMA busy_timeout=` + busyTimeoutMillis() + `;`); err != nil {
 		_ = db.Close()
 		return nil, err
 	}
-	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS public_cache (key TEXT PRIMARY KEY, payload_json TEXT, updated_at INTEGER, payload BLOB, meta TEXT)`); err != nil {
+	if m.ring, err = keyring.Open(opts.KeyringConfig); err != nil {
 		_ = db.Close()
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", ErrKeyUnavailable, err)
 	}
-	r, err := keyring.Open(opts.KeyringConfig)
-	if err != nil {
+	m.db = db
+	m.blobRoot = filepath.Join(filepath.Dir(m.path), "blobs")
+	m.use(newSQLiteStore(db))
+	if err := m.migrate(); err != nil {
 		_ = db.Close()
 		return nil, err
 	}
-	keyName := opts.KeyName
-	if keyName == "" {
-		keyName = "cache_key"
-	}
-	m := &Manager{db: db, ttlMinutes: opts.TTLMinutes, ring: r, keyName: keyName}
+	// Ошибка обслуживания не мешает работе: оно повторится при следующем
+	// открытии.
+	_ = m.maintain()
 	return m, nil
 }
 
+func expandPath(p string) string {
+	if strings.HasPrefix(p, "~") {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, p[1:])
+	}
+	return p
+}
+
 func (m *Manager) Close() error {
-	if m.db != nil {
-		return m.db.Close()
+	if m.raw == nil {
+		return nil
 	}
-	return nil
+	return errors.Join(m.flushStats(), m.raw.Close())
+}
+
+// Backend — хранилище, в котором открыт кеш.
+func (m *Manager) Backend() string {
+	return m.backend
+}
+
+// Все столбцы с данными шифруются; в additional data GCM входят имя
+// столбца и ключ записи, поэтому шифртекст нельзя переставить в другую
+// запись или столбец.
+func aad(column, key string) []byte {
+	return []byte(column + ":" + key)
 }
 
 func (m *Manager) put(key string, payloadJSON []byte, payload []byte, meta string, updatedAt time.Time) error {
-	enc, err := m.encrypt(payload)
-	if err != nil {
+	rec := Record{PayloadJSON: payloadJSON, Payload: payload, Meta: []byte(meta), UpdatedAt: updatedAt, AccessedAt: time.Now()}
+	if err := m.store.Put(m.prefix+key, rec); err != nil {
 		return err
 	}
-	_, err = m.db.Exec(`INSERT INTO public_cache(key, payload_json, updated_at, payload, meta) VALUES(?,?,?,?,?) ON CONFLICT(key) DO UPDATE SET payload_json=excluded.payload_json, updated_at=excluded.updated_at, payload=excluded.payload, meta=excluded.meta`, key, string(payloadJSON), updatedAt.Unix(), enc, meta)
-	return err
+	if !isEvictable(key) {
+		return nil
+	}
+	return m.evictIfFull(rec.size(m.prefix + key))
 }
 
 func (m *Manager) Put(key string, payloadJSON []byte, payload []byte, meta string) error {
@@ -93,33 +207,68 @@ func (m *Manager) PutWithTimestamp(key string, payloadJSON []byte, payload []byt
 }
 
 func (m *Manager) Get(key string) (payloadJSON []byte, payload []byte, updatedAt time.Time, meta string, err error) {
-	row := m.db.QueryRow(`SELECT payload_json, updated_at, payload, meta FROM public_cache WHERE key=?`, key)
-	var pj string
-	var ts int64
-	var enc []byte
-	if err = row.Scan(&pj, &ts, &enc, &meta); err != nil {
-		return nil, nil, time.Time{}, "", err
+	payloadJSON, payload, updatedAt, meta, err = m.get(key)
+	m.count(key, err == nil, updatedAt)
+	return payloadJSON, payload, updatedAt, meta, err
+}
+
+// Peek читает запись, не учитывая чтение в статистике попаданий: для
+// служебных чтений, которые не отвечают на запрос пользователя.
+func (m *Manager) Peek(key string) (payloadJSON []byte, updatedAt time.Time, meta string, err error) {
+	payloadJSON, _, updatedAt, meta, err = m.get(key)
+	return payloadJSON, updatedAt, meta, err
+}
+
+// Refresh продлевает срок жизни записи, не перезаписывая данные: сервер
+// подтвердил, что они не изменились.
+func (m *Manager) Refresh(key string) error {
+	rec, err := m.raw.Get(m.prefix + key)
+	if err != nil {
+		return err
 	}
-	dec, derr := m.decrypt(enc)
-	if derr != nil {
-		return nil, nil, time.Time{}, "", derr
+	rec.UpdatedAt, rec.AccessedAt = time.Now(), time.Now()
+	return m.raw.Put(m.prefix+key, rec)
+}
+
+func (m *Manager) get(key string) (payloadJSON []byte, payload []byte, updatedAt time.Time, meta string, err error) {
+	key = m.prefix + key
+	rec, err := m.store.Get(key)
+	if err != nil {
+		return nil, nil, time.Time{}, "", err
 	}
-	return []byte(pj), dec, time.Unix(ts, 0), meta, nil
+	m.touch(key, rec)
+	return rec.PayloadJSON, rec.Payload, rec.UpdatedAt, string(rec.Meta), nil
 }
 
 func (m *Manager) Delete(key string) error {
-	_, err := m.db.Exec(`DELETE FROM public_cache WHERE key=?`, key)
-	return err
+	return m.raw.Delete(m.prefix + key)
 }
 
 func (m *Manager) DeletePrefix(prefix string) error {
 	if prefix == "" {
 		return errors.New("empty prefix")
 	}
-	_, err := m.db.Exec(`DELETE FROM public_cache WHERE key LIKE ?`, prefix+"%")
+	_, err := m.raw.DeletePrefix(m.prefix + prefix)
 	return err
 }
 
+func (m *Manager) Keys(prefix string) ([]string, error) {
+	var keys []string
+	err := m.raw.Iterate(m.prefix+prefix, func(k string, _ Record) error {
+		keys = append(keys, strings.TrimPrefix(k, m.prefix))
+		return nil
+	})
+	return keys, err
+}
+
+// Purge удаляет все записи пространства имён и все версии его ключа.
+func (m *Manager) Purge() error {
+	if err := m.deleteData(); err != nil {
+		return err
+	}
+	return m.removeKeys(0)
+}
+
 func (m *Manager) IsFresh(ts time.Time) bool {
 	if m.ttlMinutes <= 0 {
 		return false
@@ -127,11 +276,45 @@ func (m *Manager) IsFresh(ts time.Time) bool {
 	return time.Since(ts) <= time.Duration(m.ttlMinutes)*time.Minute
 }
 
-func (m *Manager) encrypt(plain []byte) ([]byte, error) {
-	key, err := m.loadOrGenerateKey()
+// IsUsable — запись ещё хранится в кеше: свежая или устаревшая не более
+// чем на StaleMinutes.
+func (m *Manager) IsUsable(ts time.Time) bool {
+	if m.ttlMinutes <= 0 {
+		return false
+	}
+	return time.Since(ts) <= time.Duration(m.ttlMinutes+max(m.staleMinutes, 0))*time.Minute
+}
+
+func (m *Manager) encrypt(plain, additional []byte) ([]byte, error) {
+	key, err := m.key(m.keyID)
+	if err != nil {
+		return nil, err
+	}
+	return seal(key, plain, additional)
+}
+
+func (m *Manager) encryptCurrent(plain, additional []byte) (int, []byte, error) {
+	id, key, err := m.currentKey()
+	if err != nil {
+		return 0, nil, err
+	}
+	enc, err := seal(key, plain, additional)
+	return id, enc, err
+}
+
+func (m *Manager) decrypt(ciphertext, additional []byte) ([]byte, error) {
+	return m.decryptWith(m.keyID, ciphertext, additional)
+}
+
+func (m *Manager) decryptWith(keyID int, ciphertext, additional []byte) ([]byte, error) {
+	key, err := m.key(keyID)
 	if err != nil {
 		return nil, err
 	}
+	return open(key, ciphertext, additional)
+}
+
+func seal(key, plain, additional []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -144,15 +327,11 @@ func (m *Manager) encrypt(plain []byte) ([]byte, error) {
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return nil, err
 	}
-	ciphertext := gcm.Seal(nonce, nonce, plain, nil)
+	ciphertext := gcm.Seal(nonce, nonce, plain, additional)
 	return ciphertext, nil
 }
 
-func (m *Manager) decrypt(ciphertext []byte) ([]byte, error) {
-	key, err := m.loadOrGenerateKey()
-	if err != nil {
-		return nil, err
-	}
+func open(key, ciphertext, additional []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -167,28 +346,13 @@ func (m *Manager) decrypt(ciphertext []byte) ([]byte, error) {
 	}
 	nonce := ciphertext[:ns]
 	data := ciphertext[ns:]
-	plain, err := gcm.Open(nil, nonce, data, nil)
+	plain, err := gcm.Open(nil, nonce, data, additional)
 	if err != nil {
 		return nil, err
 	}
 	return plain, nil
 }
 
-func (m *Manager) loadOrGenerateKey() ([]byte, error) {
-	it, err := m.ring.Get(m.keyName)
-	if err == nil && len(it.Data) == 32 {
-		return it.Data, nil
-	}
-	key := make([]byte, 32)
-	if _, err := io.ReadFull(rand.Reader, key); err != nil {
-		return nil, err
-	}
-	if err := m.ring.Set(keyring.Item{Key: m.keyName, Data: key}); err != nil {
-		return nil, err
-	}
-	return key, nil
-}
-
 func MarshalJSON(v any) ([]byte, error) {
 	return json.Marshal(v)
 }
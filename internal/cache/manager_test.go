@@ -80,3 +80,22 @@ func TestCacheDelete(t *testing.T) {
 	_, _, _, _, err = m.Get("k3")
 	require.Error(t, err)
 }
+
+func TestCacheRefreshAndPeek(t *testing.T) {
+	m, err := New(testOptions(t.TempDir()))
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+
+	require.ErrorIs(t, m.Refresh("missing"), ErrNotFound)
+	require.NoError(t, m.PutWithTimestamp("k", []byte(`{}`), nil, "etag", time.Now().Add(-time.Hour)))
+	require.NoError(t, m.Refresh("k"))
+	pj, ts, meta, err := m.Peek("k")
+	require.NoError(t, err)
+	require.Equal(t, []byte(`{}`), pj)
+	require.Equal(t, "etag", meta)
+	require.True(t, m.IsFresh(ts))
+
+	st, err := m.Stats()
+	require.NoError(t, err)
+	require.Zero(t, st.Hits+st.Misses, "Peek не учитывается в статистике")
+}
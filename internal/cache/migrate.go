@@ -0,0 +1,394 @@
+package cache
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// ErrSchemaTooNew — файл кеша записан более новой версией keepcli.
+var ErrSchemaTooNew = errors.New("кеш создан более новой версией keepcli")
+
+type Migration struct {
+	Name    string
+	Version int
+}
+
+type migration struct {
+	Migration
+	sql string
+}
+
+// dataMigrations возвращают true, если после них файл нужно перестроить.
+var dataMigrations = map[string]func(m *Manager, tx *sql.Tx) (bool, error){
+	"encrypt_columns": (*Manager).encryptColumns,
+}
+
+type SchemaStatus struct {
+	Pending []Migration
+	Current int
+	Latest  int
+}
+
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	var out []migration
+	for _, e := range entries {
+		base := strings.TrimSuffix(e.Name(), ".sql")
+		num, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("некорректное имя миграции %s", e.Name())
+		}
+		v, err := strconv.Atoi(num)
+		if err != nil {
+			return nil, fmt.Errorf("некорректное имя миграции %s", e.Name())
+		}
+		body, err := migrationFiles.ReadFile(path.Join("migrations", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, migration{Migration: Migration{Version: v, Name: name}, sql: string(body)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	for i, mg := range out {
+		if mg.Version != i+1 {
+			return nil, fmt.Errorf("пропущена миграция %d", i+1)
+		}
+	}
+	return out, nil
+}
+
+type querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func tableExists(q querier, name string) (bool, error) {
+	var n int
+	err := q.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name=?`, name).Scan(&n)
+	return n > 0, err
+}
+
+// schemaVersion определяет версию старых файлов без schema_version по
+// устройству базы.
+func schemaVersion(q querier) (int, bool, error) {
+	versioned, err := tableExists(q, "schema_version")
+	if err != nil {
+		return 0, false, err
+	}
+	if versioned {
+		var v sql.NullInt64
+		err := q.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&v)
+		return int(v.Int64), true, err
+	}
+	if ok, err := tableExists(q, "public_cache"); err != nil || !ok {
+		return 0, false, err
+	}
+	var hasNS, userVersion int
+	if err := q.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('outbox') WHERE name='ns'`).Scan(&hasNS); err != nil {
+		return 0, false, err
+	}
+	if hasNS > 0 {
+		return 4, false, nil
+	}
+	if err := q.QueryRow(`PRAGMA user_version`).Scan(&userVersion); err != nil {
+		return 0, false, err
+	}
+	if userVersion >= 1 {
+		return 3, false, nil
+	}
+	return 1, false, nil
+}
+
+func status(q querier) (SchemaStatus, error) {
+	cur, _, err := schemaVersion(q)
+	if err != nil {
+		return SchemaStatus{}, err
+	}
+	return statusAt(cur)
+}
+
+func statusAt(cur int) (SchemaStatus, error) {
+	ms, err := loadMigrations()
+	if err != nil {
+		return SchemaStatus{}, err
+	}
+	st := SchemaStatus{Current: cur, Latest: len(ms)}
+	for _, mg := range ms {
+		if mg.Version > cur {
+			st.Pending = append(st.Pending, mg.Migration)
+		}
+	}
+	if cur > st.Latest {
+		return st, fmt.Errorf("%w (схема %d, поддерживается %d)", ErrSchemaTooNew, cur, st.Latest)
+	}
+	return st, nil
+}
+
+// Inspect сообщает версию схемы файла кеша, не изменяя его и не обращаясь
+// к keyring.
+func Inspect(p string) (SchemaStatus, error) {
+	p = expandPath(p)
+	if _, err := os.Stat(p); errors.Is(err, os.ErrNotExist) {
+		return statusAt(0)
+	}
+	db, err := sql.Open("sqlite", "file:"+p+"?mode=ro")
+	if err != nil {
+		return SchemaStatus{}, err
+	}
+	defer func() { _ = db.Close() }()
+	return status(db)
+}
+
+func (m *Manager) Schema() (SchemaStatus, error) {
+	if m.db == nil {
+		return SchemaStatus{}, fmt.Errorf("%w: %s", ErrUnsupported, m.backend)
+	}
+	return status(m.db)
+}
+
+func (m *Manager) migrate() error {
+	st, err := status(m.db)
+	if err != nil {
+		return err
+	}
+	_, versioned, err := schemaVersion(m.db)
+	if err != nil {
+		return err
+	}
+	if !versioned {
+		if err := m.startVersioning(st.Current); err != nil {
+			return err
+		}
+	}
+	ms, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	compact := false
+	for _, mg := range ms[st.Current:] {
+		c, err := m.apply(mg)
+		if err != nil {
+			return fmt.Errorf("миграция кеша %d_%s: %w", mg.Version, mg.Name, err)
+		}
+		compact = compact || c
+	}
+	if err := m.initKey(); err != nil {
+		return err
+	}
+	// До разделения кеш принадлежал единственной учётной записи.
+	if m.ns.UserID != "" {
+		c, err := m.adoptLegacy()
+		if err != nil {
+			return err
+		}
+		compact = compact || c
+	}
+	if compact {
+		return m.compact()
+	}
+	return nil
+}
+
+func (m *Manager) startVersioning(current int) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.Exec(`CREATE TABLE schema_version (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+	ms, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	for _, mg := range ms[:current] {
+		if _, err := tx.Exec(`INSERT INTO schema_version(version, name, applied_at) VALUES(?,?,?)`, mg.Version, mg.Name, time.Now().Unix()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (m *Manager) apply(mg migration) (bool, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.Exec(mg.sql); err != nil {
+		return false, err
+	}
+	compact := false
+	if data, ok := dataMigrations[mg.Name]; ok {
+		if compact, err = data(m, tx); err != nil {
+			return false, err
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_version(version, name, applied_at) VALUES(?,?,?)`, mg.Version, mg.Name, time.Now().Unix()); err != nil {
+		return false, err
+	}
+	return compact, tx.Commit()
+}
+
+type legacyRow struct {
+	key     string
+	json    []byte
+	payload []byte
+	meta    []byte
+}
+
+// encryptColumns удаляет нерасшифровываемые записи: это только кеш.
+func (m *Manager) encryptColumns(tx *sql.Tx) (bool, error) {
+	base := m.withKey(m.baseKey)
+	rows, err := readLegacy(tx, `SELECT key, payload_json, payload, meta FROM public_cache`)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range rows {
+		payload, derr := base.decrypt(r.payload, nil)
+		if derr != nil {
+			if _, err := tx.Exec(`DELETE FROM public_cache WHERE key=?`, r.key); err != nil {
+				return false, err
+			}
+			continue
+		}
+		if err := base.updateRow(tx, r.key, r.key, r.json, payload, r.meta); err != nil {
+			return false, err
+		}
+	}
+	outbox, err := readLegacy(tx, `SELECT id, NULL, payload, NULL FROM outbox`)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range outbox {
+		payload, derr := base.decrypt(r.payload, nil)
+		if derr != nil {
+			if _, err := tx.Exec(`DELETE FROM outbox WHERE id=?`, r.key); err != nil {
+				return false, err
+			}
+			continue
+		}
+		enc, err := base.encrypt(payload, aad("outbox", r.key))
+		if err != nil {
+			return false, err
+		}
+		if _, err := tx.Exec(`UPDATE outbox SET payload=? WHERE id=?`, enc, r.key); err != nil {
+			return false, err
+		}
+	}
+	return len(rows)+len(outbox) > 0, nil
+}
+
+// adoptLegacy сохраняет из общего кеша только реплику и очередь.
+func (m *Manager) adoptLegacy() (bool, error) {
+	base := m.withKey(m.baseKey)
+	tx, err := m.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	rows, err := readLegacy(tx, `SELECT key, payload_json, payload, meta FROM public_cache WHERE key NOT LIKE 'ns:%'`)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range rows {
+		pj, perr := base.decrypt(r.json, aad("payload_json", r.key))
+		payload, derr := base.decrypt(r.payload, aad("payload", r.key))
+		meta, merr := base.decrypt(r.meta, aad("meta", r.key))
+		if !strings.HasPrefix(r.key, "replica:") || perr != nil || derr != nil || merr != nil {
+			if _, err := tx.Exec(`DELETE FROM public_cache WHERE key=?`, r.key); err != nil {
+				return false, err
+			}
+			continue
+		}
+		if err := m.updateRow(tx, r.key, m.prefix+r.key, pj, payload, meta); err != nil {
+			return false, err
+		}
+		if _, err := tx.Exec(`UPDATE public_cache SET key_id=? WHERE key=?`, m.keyID, m.prefix+r.key); err != nil {
+			return false, err
+		}
+	}
+	outbox, err := readLegacy(tx, `SELECT id, NULL, payload, NULL FROM outbox WHERE ns=''`)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range outbox {
+		payload, derr := base.decrypt(r.payload, aad("outbox", r.key))
+		if derr != nil {
+			if _, err := tx.Exec(`DELETE FROM outbox WHERE id=?`, r.key); err != nil {
+				return false, err
+			}
+			continue
+		}
+		enc, err := m.encrypt(payload, aad("outbox", m.prefix+r.key))
+		if err != nil {
+			return false, err
+		}
+		if _, err := tx.Exec(`UPDATE outbox SET payload=?, ns=?, key_id=? WHERE id=?`, enc, m.prefix, m.keyID, r.key); err != nil {
+			return false, err
+		}
+	}
+	return len(rows)+len(outbox) > 0, tx.Commit()
+}
+
+func (m *Manager) updateRow(tx *sql.Tx, oldKey, key string, payloadJSON, payload, meta []byte) error {
+	encJSON, err := m.encrypt(payloadJSON, aad("payload_json", key))
+	if err != nil {
+		return err
+	}
+	enc, err := m.encrypt(payload, aad("payload", key))
+	if err != nil {
+		return err
+	}
+	encMeta, err := m.encrypt(meta, aad("meta", key))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE public_cache SET key=?, payload_json=?, payload=?, meta=? WHERE key=?`, key, encJSON, enc, encMeta, oldKey)
+	return err
+}
+
+func readLegacy(tx *sql.Tx, query string) ([]legacyRow, error) {
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var out []legacyRow
+	for rows.Next() {
+		var r legacyRow
+		var js, meta any
+		if err := rows.Scan(&r.key, &js, &r.payload, &meta); err != nil {
+			return nil, err
+		}
+		r.json, r.meta = asBytes(js), asBytes(meta)
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// asBytes принимает и старые TEXT-значения, и BLOB.
+func asBytes(v any) []byte {
+	switch x := v.(type) {
+	case []byte:
+		return x
+	case string:
+		return []byte(x)
+	}
+	return nil
+}
@@ -0,0 +1,367 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/99designs/keyring"
+	"github.com/stretchr/testify/require"
+)
+
+func testOptions(dir string) Options {
+	return Options{
+		Path:       filepath.Join(dir, "cache.db"),
+		TTLMinutes: 5,
+		KeyringConfig: keyring.Config{
+			AllowedBackends:  []keyring.BackendType{keyring.FileBackend},
+			FileDir:          dir,
+			FilePasswordFunc: func(string) (string, error) { return "pw", nil },
+			ServiceName:      "sufir-keeper-client",
+		},
+	}
+}
+
+func requireNoPlaintext(t *testing.T, path string, secrets ...string) {
+	t.Helper()
+	for _, p := range []string{path, path + "-wal"} {
+		raw, err := os.ReadFile(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		require.NoError(t, err)
+		for _, s := range secrets {
+			require.False(t, bytes.Contains(raw, []byte(s)), "%s найден в %s", s, filepath.Base(p))
+		}
+	}
+}
+
+func TestCacheEncryptsAllColumns(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions(dir)
+	m, err := New(opts)
+	require.NoError(t, err)
+	require.NoError(t, m.Put("items:get:1", []byte(`{"password":"hunter2-secret"}`), nil, "meta-secret"))
+	require.NoError(t, m.Put("items:get:2", []byte(`{"cvv":"987"}`), nil, ""))
+	require.NoError(t, m.Close())
+	requireNoPlaintext(t, opts.Path, "hunter2-secret", "meta-secret")
+
+	m, err = New(opts)
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+	pj, _, _, meta, err := m.Get("items:get:1")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"password":"hunter2-secret"}`, string(pj))
+	require.Equal(t, "meta-secret", meta)
+
+	// Шифртекст привязан к ключу записи.
+	_, err = m.db.Exec(`UPDATE public_cache SET payload_json=(SELECT payload_json FROM public_cache WHERE key=?) WHERE key=?`, m.prefix+"items:get:2", m.prefix+"items:get:1")
+	require.NoError(t, err)
+	_, _, _, _, err = m.Get("items:get:1")
+	require.Error(t, err)
+}
+
+// fixture — файл кеша в том виде, в каком его оставляли прежние версии
+// keepcli.
+type fixture struct {
+	name    string
+	schema  []string
+	version int
+	// detected — версия схемы, которую должна распознать миграция.
+	detected int
+	// stamped — схема создаётся миграциями до этой версии и отмечается в
+	// schema_version, как это делают версии с 0005 и новее.
+	stamped int
+	// write сохраняет запись так, как это делала версия.
+	write  func(t *testing.T, db *sql.DB, ring keyring.Keyring, key, pj string, payload []byte, meta string)
+	outbox func(t *testing.T, db *sql.DB, ring keyring.Keyring, id string, payload []byte)
+}
+
+var (
+	schemaPlain  = `CREATE TABLE public_cache (key TEXT PRIMARY KEY, payload_json TEXT, updated_at INTEGER, payload BLOB, meta TEXT)`
+	schemaOutbox = `CREATE TABLE outbox (seq INTEGER PRIMARY KEY AUTOINCREMENT, id TEXT NOT NULL UNIQUE, created_at INTEGER NOT NULL, attempts INTEGER NOT NULL DEFAULT 0, last_error TEXT NOT NULL DEFAULT '', payload BLOB)`
+	userNS       = Namespace{Server: "https://a", UserID: "u1"}
+)
+
+// legacyKey возвращает менеджер, шифрующий ключом keyring name, и создаёт
+// ключ, как это делали версии без версионирования ключей.
+func legacyKey(t *testing.T, ring keyring.Keyring, name string) *Manager {
+	t.Helper()
+	if _, err := ring.Get(name); err != nil {
+		key := make([]byte, 32)
+		_, err := rand.Read(key)
+		require.NoError(t, err)
+		require.NoError(t, ring.Set(keyring.Item{Key: name, Data: key}))
+	}
+	return (&Manager{ring: ring}).withKey(name)
+}
+
+func writePlain(t *testing.T, db *sql.DB, ring keyring.Keyring, key, pj string, payload []byte, meta string) {
+	enc, err := legacyKey(t, ring, "cache_key").encrypt(payload, nil)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO public_cache VALUES(?,?,?,?,?)`, key, pj, 1, enc, meta)
+	require.NoError(t, err)
+}
+
+func outboxPlain(t *testing.T, db *sql.DB, ring keyring.Keyring, id string, payload []byte) {
+	enc, err := legacyKey(t, ring, "cache_key").encrypt(payload, nil)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO outbox(id, created_at, payload) VALUES(?,?,?)`, id, 1, enc)
+	require.NoError(t, err)
+}
+
+// sealed повторяет шифрование с additional data; prefix и keyName задают
+// пространство имён (пустые — до разделения).
+func sealed(prefix, keyName string) func(*testing.T, *sql.DB, keyring.Keyring, string, string, []byte, string) {
+	return func(t *testing.T, db *sql.DB, ring keyring.Keyring, key, pj string, payload []byte, meta string) {
+		m := legacyKey(t, ring, keyName)
+		key = prefix + key
+		var cols [][]byte
+		for _, c := range []struct {
+			name string
+			v    []byte
+		}{{"payload_json", []byte(pj)}, {"payload", payload}, {"meta", []byte(meta)}} {
+			enc, err := m.encrypt(c.v, aad(c.name, key))
+			require.NoError(t, err)
+			cols = append(cols, enc)
+		}
+		_, err := db.Exec(`INSERT INTO public_cache(key, payload_json, updated_at, payload, meta) VALUES(?,?,?,?,?)`, key, cols[0], 1, cols[1], cols[2])
+		require.NoError(t, err)
+	}
+}
+
+func sealedOutbox(ns, keyName string) func(*testing.T, *sql.DB, keyring.Keyring, string, []byte) {
+	return func(t *testing.T, db *sql.DB, ring keyring.Keyring, id string, payload []byte) {
+		enc, err := legacyKey(t, ring, keyName).encrypt(payload, aad("outbox", ns+id))
+		require.NoError(t, err)
+		_, err = db.Exec(`INSERT INTO outbox(id, created_at, payload) VALUES(?,?,?)`, id, 1, enc)
+		require.NoError(t, err)
+	}
+}
+
+func fixtures() []fixture {
+	prefix := "ns:" + userNS.ID() + "/"
+	nsKey := "cache_key/" + userNS.ID()
+	nsOutbox := func(t *testing.T, db *sql.DB, ring keyring.Keyring, id string, payload []byte) {
+		sealedOutbox(prefix, nsKey)(t, db, ring, id, payload)
+		_, err := db.Exec(`UPDATE outbox SET ns=? WHERE id=?`, prefix, id)
+		require.NoError(t, err)
+	}
+	out := []fixture{
+		{name: "до outbox", schema: []string{schemaPlain}, detected: 1, write: writePlain},
+		{name: "outbox без шифрования столбцов", schema: []string{schemaPlain, schemaOutbox}, detected: 1, write: writePlain, outbox: outboxPlain},
+		{name: "шифрование столбцов", schema: []string{schemaPlain, schemaOutbox}, version: 1, detected: 3, write: sealed("", "cache_key"), outbox: sealedOutbox("", "cache_key")},
+		{
+			name:     "пространства имён",
+			schema:   []string{schemaPlain, schemaOutbox, `ALTER TABLE outbox ADD COLUMN ns TEXT NOT NULL DEFAULT ''`},
+			version:  2,
+			detected: 4,
+			write:    sealed(prefix, nsKey),
+			outbox:   nsOutbox,
+		},
+	}
+	ms, _ := loadMigrations()
+	for v := 4; v < len(ms); v++ {
+		out = append(out, fixture{
+			name:     fmt.Sprintf("schema_version %d (%s)", v, ms[v-1].Name),
+			stamped:  v,
+			detected: v,
+			write:    sealed(prefix, nsKey),
+			outbox:   nsOutbox,
+		})
+	}
+	return out
+}
+
+func (f fixture) build(t *testing.T, opts Options) {
+	t.Helper()
+	db, err := sql.Open("sqlite", opts.Path)
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+	for _, q := range f.schema {
+		_, err := db.Exec(q)
+		require.NoError(t, err)
+	}
+	if f.stamped > 0 {
+		ms, err := loadMigrations()
+		require.NoError(t, err)
+		_, err = db.Exec(`CREATE TABLE schema_version (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at INTEGER NOT NULL)`)
+		require.NoError(t, err)
+		for _, mg := range ms[:f.stamped] {
+			_, err := db.Exec(mg.sql)
+			require.NoError(t, err)
+			_, err = db.Exec(`INSERT INTO schema_version(version, name, applied_at) VALUES(?,?,1)`, mg.Version, mg.Name)
+			require.NoError(t, err)
+		}
+	}
+	_, err = db.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, f.version))
+	require.NoError(t, err)
+	ring, err := keyring.Open(opts.KeyringConfig)
+	require.NoError(t, err)
+	f.write(t, db, ring, "replica:item:1", `{"password":"legacy-secret"}`, []byte("blob"), "legacy-meta")
+	if f.outbox != nil {
+		f.outbox(t, db, ring, "op-1", []byte(`{"kind":"delete"}`))
+	}
+}
+
+func TestCacheUpgradesFromEveryVersion(t *testing.T) {
+	latest, err := statusAt(0)
+	require.NoError(t, err)
+	for _, f := range fixtures() {
+		t.Run(f.name, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := testOptions(dir)
+			f.build(t, opts)
+
+			before, err := Inspect(opts.Path)
+			require.NoError(t, err)
+			require.Equal(t, f.detected, before.Current)
+			require.Len(t, before.Pending, before.Latest-f.detected)
+
+			opts.Namespace = userNS
+			m, err := New(opts)
+			require.NoError(t, err)
+			defer func() { _ = m.Close() }()
+			st, err := m.Schema()
+			require.NoError(t, err)
+			require.Empty(t, st.Pending)
+			require.Equal(t, latest.Latest, st.Current)
+			var rows int
+			require.NoError(t, m.db.QueryRow(`SELECT COUNT(*) FROM schema_version`).Scan(&rows))
+			require.Equal(t, latest.Latest, rows)
+
+			pj, payload, _, meta, err := m.Get("replica:item:1")
+			require.NoError(t, err)
+			require.JSONEq(t, `{"password":"legacy-secret"}`, string(pj))
+			require.Equal(t, []byte("blob"), payload)
+			require.Equal(t, "legacy-meta", meta)
+			ops, err := m.OutboxList()
+			require.NoError(t, err)
+			if f.outbox != nil {
+				require.Len(t, ops, 1)
+				require.Equal(t, []byte(`{"kind":"delete"}`), ops[0].Payload)
+			} else {
+				require.Empty(t, ops)
+			}
+			requireNoPlaintext(t, opts.Path, "legacy-secret", "legacy-meta")
+		})
+	}
+}
+
+func TestCacheMigratesLegacyRows(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions(dir)
+	f := fixtures()[1]
+	f.build(t, opts)
+	db, err := sql.Open("sqlite", opts.Path)
+	require.NoError(t, err)
+	ring, err := keyring.Open(opts.KeyringConfig)
+	require.NoError(t, err)
+	writePlain(t, db, ring, "items:get:1", `{"password":"cached-secret"}`, []byte("blob"), "")
+	_, err = db.Exec(`INSERT INTO public_cache VALUES(?,?,?,?,?)`, "replica:item:2", `{"password":"broken-secret"}`, 1, []byte("garbage"), "")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	// Без пользователя записи шифруются, но остаются ничьими.
+	m, err := New(opts)
+	require.NoError(t, err)
+	_, _, _, _, err = m.Get("replica:item:1")
+	require.Error(t, err)
+	require.NoError(t, m.Close())
+	requireNoPlaintext(t, opts.Path, "legacy-secret", "legacy-meta", "cached-secret", "broken-secret")
+
+	opts.Namespace = userNS
+	m, err = New(opts)
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+	_, _, _, _, err = m.Get("replica:item:1")
+	require.NoError(t, err)
+	for _, k := range []string{"items:get:1", "replica:item:2"} {
+		_, _, _, _, err = m.Get(k)
+		require.Error(t, err, k)
+	}
+	ops, err := m.OutboxList()
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+}
+
+func TestCacheRefusesNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions(dir)
+	m, err := New(opts)
+	require.NoError(t, err)
+	_, err = m.db.Exec(`INSERT INTO schema_version(version, name, applied_at) VALUES(99, 'future', 0)`)
+	require.NoError(t, err)
+	require.NoError(t, m.Close())
+
+	_, err = New(opts)
+	require.ErrorIs(t, err, ErrSchemaTooNew)
+	_, err = Inspect(opts.Path)
+	require.ErrorIs(t, err, ErrSchemaTooNew)
+}
+
+func TestInspectDoesNotModify(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions(dir)
+	st, err := Inspect(opts.Path)
+	require.NoError(t, err)
+	require.Equal(t, 0, st.Current)
+	require.Len(t, st.Pending, st.Latest)
+	_, err = os.Stat(opts.Path)
+	require.True(t, os.IsNotExist(err))
+
+	fixtures()[0].build(t, opts)
+	st, err = Inspect(opts.Path)
+	require.NoError(t, err)
+	require.Equal(t, 1, st.Current)
+	require.Equal(t, "outbox", st.Pending[0].Name)
+	st, err = Inspect(opts.Path)
+	require.NoError(t, err)
+	require.Equal(t, 1, st.Current)
+}
+
+func TestCacheNamespacesAreIsolated(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions(dir)
+	opts.Namespace = Namespace{Server: "https://a", UserID: "alice"}
+	alice, err := New(opts)
+	require.NoError(t, err)
+	require.NoError(t, alice.Put("items:get:1", []byte(`{"v":"alice"}`), nil, ""))
+	require.NoError(t, alice.OutboxAdd("op-a", []byte("a")))
+	require.NoError(t, alice.Close())
+
+	for _, ns := range []Namespace{{Server: "https://a", UserID: "bob"}, {Server: "https://b", UserID: "alice"}} {
+		o := opts
+		o.Namespace = ns
+		other, err := New(o)
+		require.NoError(t, err)
+		_, _, _, _, err = other.Get("items:get:1")
+		require.Error(t, err)
+		ops, err := other.OutboxList()
+		require.NoError(t, err)
+		require.Empty(t, ops)
+		require.NoError(t, other.Put("items:get:1", []byte(`{"v":"other"}`), nil, ""))
+		require.NotEqual(t, alice.keyName, other.keyName)
+		require.NoError(t, other.Close())
+	}
+
+	alice, err = New(opts)
+	require.NoError(t, err)
+	defer func() { _ = alice.Close() }()
+	pj, _, _, _, err := alice.Get("items:get:1")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"v":"alice"}`, string(pj))
+
+	require.NoError(t, alice.Purge())
+	_, _, _, _, err = alice.Get("items:get:1")
+	require.Error(t, err)
+	ops, err := alice.OutboxList()
+	require.NoError(t, err)
+	require.Empty(t, ops)
+	_, err = alice.ring.Get(alice.keyName)
+	require.ErrorIs(t, err, keyring.ErrKeyNotFound)
+}
@@ -0,0 +1 @@
+CREATE TABLE IF NOT EXISTS public_cache (key TEXT PRIMARY KEY, payload_json BLOB, updated_at INTEGER, payload BLOB, meta BLOB);
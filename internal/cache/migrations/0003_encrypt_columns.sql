@@ -0,0 +1,2 @@
+-- Схема не меняется: payload_json и meta шифруются, а payload и outbox
+-- перешифровываются с additional data в encryptColumns.
@@ -0,0 +1 @@
+ALTER TABLE outbox ADD COLUMN ns TEXT NOT NULL DEFAULT '';
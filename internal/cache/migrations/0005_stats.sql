@@ -0,0 +1 @@
+CREATE TABLE IF NOT EXISTS cache_stats (ns TEXT PRIMARY KEY, hits INTEGER NOT NULL DEFAULT 0, misses INTEGER NOT NULL DEFAULT 0);
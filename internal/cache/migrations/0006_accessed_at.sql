@@ -0,0 +1,5 @@
+ALTER TABLE public_cache ADD COLUMN accessed_at INTEGER NOT NULL DEFAULT 0;
+UPDATE public_cache SET accessed_at = COALESCE(updated_at, 0);
+CREATE INDEX IF NOT EXISTS public_cache_accessed_at ON public_cache(accessed_at);
+CREATE INDEX IF NOT EXISTS public_cache_updated_at ON public_cache(updated_at);
+CREATE TABLE IF NOT EXISTS cache_maintenance (name TEXT PRIMARY KEY, at INTEGER NOT NULL);
@@ -0,0 +1,3 @@
+ALTER TABLE public_cache ADD COLUMN key_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE outbox ADD COLUMN key_id INTEGER NOT NULL DEFAULT 1;
+CREATE TABLE IF NOT EXISTS cache_keys (ns TEXT NOT NULL, key_id INTEGER NOT NULL, created_at INTEGER NOT NULL, PRIMARY KEY (ns, key_id));
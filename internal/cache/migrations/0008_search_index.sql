@@ -0,0 +1,3 @@
+-- В индексе не слова, а HMAC слов и их префиксов (см. search.go): открытый
+-- текст записей на диск не попадает.
+CREATE VIRTUAL TABLE IF NOT EXISTS search_index USING fts5(title, meta, fields, ns UNINDEXED, item_id UNINDEXED);
@@ -0,0 +1,3 @@
+CREATE TABLE IF NOT EXISTS blobs (ns TEXT NOT NULL, file_id TEXT NOT NULL, sha256 TEXT NOT NULL, size INTEGER NOT NULL, dek BLOB NOT NULL, key_id INTEGER NOT NULL, updated_at INTEGER NOT NULL, accessed_at INTEGER NOT NULL, PRIMARY KEY (ns, file_id));
+CREATE INDEX IF NOT EXISTS blobs_sha256 ON blobs(ns, sha256);
+CREATE INDEX IF NOT EXISTS blobs_accessed_at ON blobs(accessed_at);
@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"time"
+)
+
+// OutboxEntry — отложенная операция, payload хранится зашифрованным тем же
+// ключом, что и кеш.
+type OutboxEntry struct {
+	CreatedAt time.Time
+	ID        string
+	LastError string
+	Payload   []byte
+	Seq       int64
+	Attempts  int
+	ns        string
+	keyID     int
+}
+
+func (m *Manager) OutboxAdd(id string, payload []byte) error {
+	keyID, enc, err := m.encryptCurrent(payload, aad("outbox", m.prefix+id))
+	if err != nil {
+		return err
+	}
+	return m.queue.QueueAdd(OutboxEntry{ID: id, Payload: enc, CreatedAt: time.Now(), ns: m.prefix, keyID: keyID})
+}
+
+// OutboxList возвращает очередь в порядке добавления.
+func (m *Manager) OutboxList() ([]OutboxEntry, error) {
+	out, err := m.queue.QueueList(m.prefix)
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range out {
+		if out[i].Payload, err = m.decryptWith(e.keyID, e.Payload, aad("outbox", m.prefix+e.ID)); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (m *Manager) OutboxUpdate(id string, payload []byte) error {
+	keyID, enc, err := m.encryptCurrent(payload, aad("outbox", m.prefix+id))
+	if err != nil {
+		return err
+	}
+	return m.queue.QueueUpdate(m.prefix, id, enc, keyID)
+}
+
+func (m *Manager) OutboxFail(id, msg string) error {
+	return m.queue.QueueFail(m.prefix, id, msg)
+}
+
+func (m *Manager) OutboxDelete(id string) error {
+	return m.queue.QueueDelete(m.prefix, id)
+}
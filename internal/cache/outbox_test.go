@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/99designs/keyring"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxOrderAndEncryption(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cache.db")
+	m, err := New(Options{
+		Path:       path,
+		TTLMinutes: 5,
+		KeyringConfig: keyring.Config{
+			AllowedBackends:  []keyring.BackendType{keyring.FileBackend},
+			FileDir:          dir,
+			FilePasswordFunc: func(string) (string, error) { return "pw", nil },
+			ServiceName:      "sufir-keeper-client",
+		},
+	})
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+
+	require.NoError(t, m.OutboxAdd("b", []byte("top-secret-1")))
+	require.NoError(t, m.OutboxAdd("a", []byte("top-secret-2")))
+	require.Error(t, m.OutboxAdd("a", []byte("dup")))
+	require.NoError(t, m.OutboxUpdate("b", []byte("top-secret-3")))
+	require.NoError(t, m.OutboxFail("a", "timeout"))
+
+	list, err := m.OutboxList()
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, "b", list[0].ID)
+	require.Equal(t, []byte("top-secret-3"), list[0].Payload)
+	require.Equal(t, 1, list[1].Attempts)
+	require.Equal(t, "timeout", list[1].LastError)
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.False(t, bytes.Contains(raw, []byte("top-secret")))
+
+	require.NoError(t, m.OutboxDelete("b"))
+	list, err = m.OutboxList()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+}
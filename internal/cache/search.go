@@ -0,0 +1,203 @@
+package cache
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"maps"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Документы поиска не устаревают по TTL.
+const searchPrefix = "search:"
+
+const maxPrefix = 16
+
+// SearchDoc — индексируемые поля записи. Кеш индексирует документ целиком,
+// поэтому секретов в нём быть не должно.
+type SearchDoc struct {
+	CreatedAt *time.Time        `json:"created_at,omitempty"`
+	UpdatedAt *time.Time        `json:"updated_at,omitempty"`
+	Meta      map[string]string `json:"meta,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	ID        string            `json:"id"`
+	Title     string            `json:"title,omitempty"`
+	Type      string            `json:"type,omitempty"`
+}
+
+func (d *SearchDoc) merge(old SearchDoc) {
+	if d.Title == "" {
+		d.Title = old.Title
+	}
+	if d.Type == "" {
+		d.Type = old.Type
+	}
+	if d.Meta == nil {
+		d.Meta = old.Meta
+	}
+	if d.Fields == nil {
+		d.Fields = old.Fields
+	}
+	if d.CreatedAt == nil {
+		d.CreatedAt = old.CreatedAt
+	}
+	if d.UpdatedAt == nil {
+		d.UpdatedAt = old.UpdatedAt
+	}
+}
+
+func (d SearchDoc) equal(o SearchDoc) bool {
+	sameTime := func(a, b *time.Time) bool {
+		return (a == nil) == (b == nil) && (a == nil || a.Equal(*b))
+	}
+	return d.ID == o.ID && d.Title == o.Title && d.Type == o.Type &&
+		maps.Equal(d.Meta, o.Meta) && maps.Equal(d.Fields, o.Fields) &&
+		sameTime(d.CreatedAt, o.CreatedAt) && sameTime(d.UpdatedAt, o.UpdatedAt)
+}
+
+type SearchHit struct {
+	SearchDoc
+	// Rank — bm25: чем меньше, тем лучше совпадение.
+	Rank float64
+}
+
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// По файлу кеша нельзя проверить, встречается ли в записях слово.
+func searchKey(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("search-index"))
+	return mac.Sum(nil)
+}
+
+func term(key []byte, kind, word string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(kind + ":" + word))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+func terms(key []byte, texts ...string) string {
+	var out []string
+	for _, text := range texts {
+		for _, w := range words(text) {
+			r := []rune(w)
+			for i := 1; i <= min(len(r), maxPrefix); i++ {
+				out = append(out, term(key, "p", string(r[:i])))
+			}
+			out = append(out, term(key, "w", w))
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+func metaText(meta map[string]string) string {
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k + " " + meta[k] + " ")
+	}
+	return b.String()
+}
+
+func docTerms(sk []byte, doc SearchDoc) (title, meta, fields string) {
+	vals := make([]string, 0, len(doc.Fields))
+	for _, v := range doc.Fields {
+		vals = append(vals, v)
+	}
+	return terms(sk, doc.Title), terms(sk, metaText(doc.Meta)), terms(sk, vals...)
+}
+
+func queryTerms(sk []byte, w string) (prefix, word string) {
+	r := []rune(w)
+	return term(sk, "p", string(r[:min(len(r), maxPrefix)])), term(sk, "w", w)
+}
+
+type match struct {
+	id   string
+	rank float64
+}
+
+func (m *Manager) searchDoc(id string) (SearchDoc, error) {
+	var doc SearchDoc
+	pj, _, _, _, err := m.get(searchPrefix + id)
+	if err != nil {
+		return doc, err
+	}
+	return doc, json.Unmarshal(pj, &doc)
+}
+
+// Index добавляет запись в поисковый индекс, дополняя ранее сохранённый
+// документ полями, которых нет в doc.
+func (m *Manager) Index(doc SearchDoc) error {
+	if doc.ID == "" {
+		return errors.New("search doc id required")
+	}
+	if old, err := m.searchDoc(doc.ID); err == nil {
+		doc.merge(old)
+		if doc.equal(old) {
+			return nil
+		}
+	}
+	_, key, err := m.currentKey()
+	if err != nil {
+		return err
+	}
+	pj, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err := m.put(searchPrefix+doc.ID, pj, nil, "", time.Now()); err != nil {
+		return err
+	}
+	return m.index.IndexDoc(m.prefix, searchKey(key), doc)
+}
+
+func (m *Manager) Unindex(id string) error {
+	if err := m.index.UnindexDoc(m.prefix, id); err != nil {
+		return err
+	}
+	return m.Delete(searchPrefix + id)
+}
+
+// Search ищет записи со всеми словами запроса, лучшие совпадения первыми.
+// Пустой itemType — любой тип.
+func (m *Manager) Search(query, itemType string) ([]SearchHit, error) {
+	ws := words(query)
+	if len(ws) == 0 {
+		return nil, nil
+	}
+	_, key, err := m.currentKey()
+	if err != nil {
+		return nil, err
+	}
+	found, err := m.index.Match(m.prefix, searchKey(key), ws)
+	if err != nil {
+		return nil, err
+	}
+	var hits []SearchHit
+	for _, mt := range found {
+		doc, err := m.searchDoc(mt.id)
+		if err != nil {
+			// Документ вытеснен или повреждён; строку индекса уберёт PruneIndex.
+			continue
+		}
+		if itemType != "" && doc.Type != itemType {
+			continue
+		}
+		hits = append(hits, SearchHit{SearchDoc: doc, Rank: mt.rank})
+	}
+	return hits, nil
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func searchIDs(t *testing.T, m *Manager, query, itemType string) []string {
+	t.Helper()
+	hits, err := m.Search(query, itemType)
+	require.NoError(t, err)
+	ids := []string{}
+	for _, h := range hits {
+		ids = append(ids, h.ID)
+	}
+	return ids
+}
+
+func TestCacheSearchRanksAndMatchesPrefixes(t *testing.T) {
+	dir := t.TempDir()
+	m, err := New(testOptions(dir))
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+
+	require.NoError(t, m.Index(SearchDoc{ID: "1", Title: "Почта", Type: "CREDENTIAL", Meta: map[string]string{"url": "mail.example.com"}, Fields: map[string]string{"login": "alice"}}))
+	require.NoError(t, m.Index(SearchDoc{ID: "2", Title: "Example bank", Type: "CARD"}))
+	require.NoError(t, m.Index(SearchDoc{ID: "3", Title: "Заметка", Type: "TEXT"}))
+
+	require.Equal(t, []string{"2", "1"}, searchIDs(t, m, "example", ""), "совпадение в заголовке выше")
+	require.Equal(t, []string{"2", "1"}, searchIDs(t, m, "exa", ""))
+	require.Equal(t, []string{"1"}, searchIDs(t, m, "ПОЧ", ""))
+	require.Equal(t, []string{"1"}, searchIDs(t, m, "example ali", ""), "все слова запроса")
+	require.Equal(t, []string{"2"}, searchIDs(t, m, "example", "CARD"))
+	require.Empty(t, searchIDs(t, m, "xyz", ""))
+	require.Empty(t, searchIDs(t, m, " ", ""))
+
+	// Список записей не содержит данных: поля сохраняются.
+	require.NoError(t, m.Index(SearchDoc{ID: "1", Title: "Почтовый ящик"}))
+	hits, err := m.Search("alice", "")
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	require.Equal(t, "Почтовый ящик", hits[0].Title)
+	require.Equal(t, "CREDENTIAL", hits[0].Type)
+
+	require.NoError(t, m.Unindex("1"))
+	require.Empty(t, searchIDs(t, m, "alice", ""))
+
+	requireNoPlaintext(t, m.path, "Example", "alice", "example.com", "Заметка")
+}
+
+func TestCacheSearchSurvivesRekeyAndSweep(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	m, err := New(opts)
+	require.NoError(t, err)
+	require.NoError(t, m.Index(SearchDoc{ID: "1", Title: "deploy key"}))
+	_, err = m.db.Exec(`UPDATE public_cache SET updated_at=?`, time.Now().Add(-24*time.Hour).Unix())
+	require.NoError(t, err)
+	_, err = m.Rekey()
+	require.NoError(t, err)
+	require.Equal(t, []string{"1"}, searchIDs(t, m, "depl", ""))
+	require.NoError(t, m.Close())
+
+	m, err = New(opts)
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+	require.Equal(t, []string{"1"}, searchIDs(t, m, "depl", ""), "документы поиска не устаревают по TTL")
+
+	require.NoError(t, m.Delete(searchPrefix+"1"))
+	require.NoError(t, m.index.PruneIndex())
+	var rows int
+	require.NoError(t, m.db.QueryRow(`SELECT COUNT(*) FROM search_index`).Scan(&rows))
+	require.Zero(t, rows)
+}
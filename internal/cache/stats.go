@@ -0,0 +1,289 @@
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Реплика не устаревает: в ней могут быть неотправленные изменения.
+const replicaPrefix = "replica:"
+
+type PrefixStats struct {
+	Prefix  string
+	Entries int
+}
+
+type Stats struct {
+	Oldest    time.Time
+	Newest    time.Time
+	Path      string
+	Prefixes  []PrefixStats
+	TTL       time.Duration
+	SizeBytes int64
+	// BlobBytes — размер скачанных файлов в кеше, Blobs — их число (файлы с
+	// одинаковым содержимым считаются один раз).
+	BlobBytes int64
+	Hits      int64
+	Misses    int64
+	Entries   int
+	Fresh     int
+	Expired   int
+	Outbox    int
+	Blobs     int
+}
+
+// counters накапливаются в памяти и сохраняются при Close.
+type counters struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func (m *Manager) count(key string, found bool, ts time.Time) {
+	if strings.HasPrefix(key, replicaPrefix) {
+		return
+	}
+	if found && m.IsFresh(ts) {
+		m.stats.hits.Add(1)
+	} else {
+		m.stats.misses.Add(1)
+	}
+}
+
+func (m *Manager) flushStats() error {
+	h, ms := m.stats.hits.Swap(0), m.stats.misses.Swap(0)
+	if h == 0 && ms == 0 {
+		return nil
+	}
+	return m.counters.AddCounters(m.prefix, h, ms)
+}
+
+func groupOf(key string) string {
+	if i := strings.LastIndex(key, ":"); i > 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// Stats описывает записи текущего пространства имён.
+func (m *Manager) Stats() (Stats, error) {
+	st := Stats{Path: m.path, TTL: time.Duration(m.ttlMinutes) * time.Minute}
+	for _, p := range []string{m.path, m.path + "-wal"} {
+		if fi, err := os.Stat(p); err == nil {
+			st.SizeBytes += fi.Size()
+		}
+	}
+	groups := map[string]int{}
+	err := m.raw.Iterate(m.prefix, func(key string, rec Record) error {
+		key = strings.TrimPrefix(key, m.prefix)
+		at := rec.UpdatedAt
+		st.Entries++
+		groups[groupOf(key)]++
+		if st.Oldest.IsZero() || at.Before(st.Oldest) {
+			st.Oldest = at
+		}
+		if at.After(st.Newest) {
+			st.Newest = at
+		}
+		switch {
+		case strings.HasPrefix(key, replicaPrefix), strings.HasPrefix(key, searchPrefix):
+		case m.IsFresh(at):
+			st.Fresh++
+		default:
+			st.Expired++
+		}
+		return nil
+	})
+	if err != nil {
+		return st, err
+	}
+	for p, n := range groups {
+		st.Prefixes = append(st.Prefixes, PrefixStats{Prefix: p, Entries: n})
+	}
+	sort.Slice(st.Prefixes, func(i, j int) bool { return st.Prefixes[i].Prefix < st.Prefixes[j].Prefix })
+	ops, err := m.queue.QueueList(m.prefix)
+	if err != nil {
+		return st, err
+	}
+	st.Outbox = len(ops)
+	blobs, err := m.blobs.Blobs(m.prefix)
+	if err != nil {
+		return st, err
+	}
+	sizes := map[string]int64{}
+	for _, r := range blobs {
+		sizes[r.sum] = max(sizes[r.sum], r.size)
+	}
+	st.Blobs = len(sizes)
+	for _, n := range sizes {
+		st.BlobBytes += n
+	}
+	st.Hits, st.Misses, err = m.counters.Counters(m.prefix)
+	st.Hits += m.stats.hits.Load()
+	st.Misses += m.stats.misses.Load()
+	return st, err
+}
+
+// PurgePrefix удаляет записи с префиксом; пустой префикс удаляет всё, кроме
+// реплики, включая скачанные файлы. Очередь изменений не затрагивается.
+func (m *Manager) PurgePrefix(prefix string) (int64, error) {
+	if prefix != "" {
+		n, err := m.raw.DeletePrefix(m.prefix + prefix)
+		if err != nil {
+			return 0, err
+		}
+		return n, m.index.PruneIndex()
+	}
+	n, err := m.purge(func(key string, _ Record) bool {
+		return !strings.HasPrefix(key, replicaPrefix)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := m.index.PruneIndex(); err != nil {
+		return 0, err
+	}
+	blobs, err := m.blobs.Blobs(m.prefix)
+	if err != nil {
+		return n, err
+	}
+	return n + int64(len(blobs)), m.deleteBlobs()
+}
+
+// PurgeExpired удаляет записи и скачанные файлы с истёкшим TTL, кроме
+// реплики и поискового индекса.
+func (m *Manager) PurgeExpired() (int64, error) {
+	cutoff := time.Now().Unix() + 1
+	if m.ttlMinutes > 0 {
+		cutoff = time.Now().Add(-time.Duration(m.ttlMinutes) * time.Minute).Unix()
+	}
+	n, err := m.purge(func(key string, rec Record) bool {
+		return isExpirable(key) && rec.UpdatedAt.Unix() < cutoff
+	})
+	if err != nil {
+		return n, err
+	}
+	blobs, err := m.purgeBlobsBefore(cutoff)
+	return n + blobs, err
+}
+
+func (m *Manager) purge(drop func(key string, rec Record) bool) (int64, error) {
+	var keys []string
+	err := m.raw.Iterate(m.prefix, func(full string, rec Record) error {
+		if drop(strings.TrimPrefix(full, m.prefix), rec) {
+			keys = append(keys, full)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, k := range keys {
+		if err := m.raw.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(keys)), nil
+}
+
+type VerifyReport struct {
+	// Corrupt — ключи записей текущего пространства, которые не удалось
+	// расшифровать; записи очереди отмечены префиксом "outbox:", файлы —
+	// "blob:".
+	Corrupt []string
+	Checked int
+	// Foreign — записи чужих пространств имён: их ключ недоступен.
+	Foreign int
+}
+
+func (m *Manager) Verify() (VerifyReport, error) {
+	var rep VerifyReport
+	err := m.raw.Iterate("", func(key string, rec Record) error {
+		switch {
+		case isKVKey(key):
+		case !strings.HasPrefix(key, m.prefix):
+			rep.Foreign++
+		default:
+			rep.Checked++
+			if _, err := m.store.open(key, rec); err != nil {
+				rep.Corrupt = append(rep.Corrupt, strings.TrimPrefix(key, m.prefix))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return rep, err
+	}
+	ops, err := m.queue.QueueList("")
+	if err != nil {
+		return rep, err
+	}
+	for _, e := range ops {
+		if e.ns != m.prefix {
+			rep.Foreign++
+			continue
+		}
+		rep.Checked++
+		if _, err := m.decryptWith(e.keyID, e.Payload, aad("outbox", m.prefix+e.ID)); err != nil {
+			rep.Corrupt = append(rep.Corrupt, "outbox:"+e.ID)
+		}
+	}
+	return rep, m.verifyBlobs(&rep)
+}
+
+func (m *Manager) verifyBlobs(rep *VerifyReport) error {
+	rows, err := m.blobs.Blobs("")
+	if err != nil {
+		return err
+	}
+	for _, r := range rows {
+		if r.ns != m.prefix {
+			rep.Foreign++
+			continue
+		}
+		rep.Checked++
+		if !m.blobIntact(r) {
+			rep.Corrupt = append(rep.Corrupt, "blob:"+r.fileID)
+		}
+	}
+	return nil
+}
+
+type ExportEntry struct {
+	UpdatedAt   time.Time       `json:"updated_at"`
+	Key         string          `json:"key"`
+	Meta        string          `json:"meta,omitempty"`
+	PayloadJSON json.RawMessage `json:"payload_json,omitempty"`
+	Payload     []byte          `json:"payload,omitempty"`
+}
+
+type Export struct {
+	Entries []ExportEntry `json:"entries"`
+	Outbox  []OutboxEntry `json:"outbox"`
+}
+
+// Export расшифровывает записи текущего пространства имён. Нерасшифровываемые
+// записи пропускаются — их показывает Verify.
+func (m *Manager) Export() (Export, error) {
+	var out Export
+	keys, err := m.Keys("")
+	if err != nil {
+		return out, err
+	}
+	for _, k := range keys {
+		pj, payload, ts, meta, err := m.get(k)
+		if err != nil {
+			continue
+		}
+		e := ExportEntry{Key: k, UpdatedAt: ts, Meta: meta, Payload: payload}
+		if json.Valid(pj) {
+			e.PayloadJSON = pj
+		}
+		out.Entries = append(out.Entries, e)
+	}
+	out.Outbox, err = m.OutboxList()
+	return out, err
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheStatsAndPurge(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions(dir)
+	m, err := New(opts)
+	require.NoError(t, err)
+	require.NoError(t, m.Put("items:get:1", []byte(`{}`), nil, ""))
+	require.NoError(t, m.PutWithTimestamp("items:get:2", []byte(`{}`), nil, "", time.Now().Add(-time.Hour)))
+	require.NoError(t, m.PutWithTimestamp("items:list:a", []byte(`{}`), nil, "", time.Now().Add(-time.Hour)))
+	require.NoError(t, m.PutWithTimestamp("replica:item:1", nil, []byte("r"), "", time.Now().Add(-time.Hour)))
+	require.NoError(t, m.OutboxAdd("op-1", []byte("x")))
+	_, _, _, _, _ = m.Get("items:get:1")
+	_, _, _, _, _ = m.Get("items:get:2")
+	_, _, _, _, _ = m.Get("items:get:404")
+	_, _, _, _, _ = m.Get("replica:item:1")
+	st, err := m.Stats()
+	require.NoError(t, err)
+	require.Equal(t, 4, st.Entries)
+	require.Equal(t, 1, st.Fresh)
+	require.Equal(t, 2, st.Expired)
+	require.Equal(t, 1, st.Outbox)
+	require.Equal(t, []PrefixStats{{"items:get", 2}, {"items:list", 1}, {"replica:item", 1}}, st.Prefixes)
+	require.Positive(t, st.SizeBytes)
+	require.True(t, st.Oldest.Before(st.Newest))
+	require.NoError(t, m.Close())
+
+	// Счётчики переживают перезапуск, устаревшие записи удаляются при открытии.
+	m, err = New(opts)
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+	st, err = m.Stats()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), st.Hits)
+	require.Equal(t, int64(2), st.Misses)
+	require.Equal(t, 2, st.Entries)
+	require.Zero(t, st.Expired)
+
+	require.NoError(t, m.PutWithTimestamp("items:get:2", []byte(`{}`), nil, "", time.Now().Add(-time.Hour)))
+	require.NoError(t, m.PutWithTimestamp("items:list:a", []byte(`{}`), nil, "", time.Now().Add(-time.Hour)))
+	n, err := m.PurgeExpired()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n)
+	n, err = m.PurgePrefix("")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	keys, err := m.Keys("")
+	require.NoError(t, err)
+	require.Equal(t, []string{"replica:item:1"}, keys)
+	n, err = m.PurgePrefix("replica:")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+}
+
+func TestCacheVerifyAndExport(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions(dir)
+	opts.Namespace = Namespace{Server: "https://a", UserID: "bob"}
+	bob, err := New(opts)
+	require.NoError(t, err)
+	require.NoError(t, bob.Put("items:get:1", []byte(`{}`), nil, ""))
+	require.NoError(t, bob.Close())
+
+	opts.Namespace = userNS
+	m, err := New(opts)
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+	require.NoError(t, m.Put("items:get:1", []byte(`{"password":"p"}`), []byte("b"), "meta"))
+	require.NoError(t, m.Put("items:get:2", []byte(`{}`), nil, ""))
+	require.NoError(t, m.OutboxAdd("op-1", []byte("x")))
+	_, err = m.db.Exec(`UPDATE public_cache SET meta=? WHERE key=?`, []byte("garbage-garbage-garbage"), m.prefix+"items:get:2")
+	require.NoError(t, err)
+
+	rep, err := m.Verify()
+	require.NoError(t, err)
+	require.Equal(t, 3, rep.Checked)
+	require.Equal(t, 1, rep.Foreign)
+	require.Equal(t, []string{"items:get:2"}, rep.Corrupt)
+
+	dump, err := m.Export()
+	require.NoError(t, err)
+	require.Len(t, dump.Entries, 1)
+	require.Equal(t, "items:get:1", dump.Entries[0].Key)
+	require.JSONEq(t, `{"password":"p"}`, string(dump.Entries[0].PayloadJSON))
+	require.Equal(t, "meta", dump.Entries[0].Meta)
+	require.Len(t, dump.Outbox, 1)
+}
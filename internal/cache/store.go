@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotFound — записи с таким ключом в кеше нет.
+var ErrNotFound = errors.New("запись не найдена в кеше")
+
+// ErrUnsupported — хранилище не умеет выполнить операцию.
+var ErrUnsupported = errors.New("операция не поддерживается хранилищем кеша")
+
+const (
+	BackendSQLite = "sqlite"
+	BackendMemory = "memory"
+	BackendBolt   = "bbolt"
+)
+
+func ParseBackend(s string) (string, error) {
+	switch s {
+	case "":
+		return BackendSQLite, nil
+	case BackendSQLite, BackendMemory, BackendBolt:
+		return s, nil
+	}
+	return "", fmt.Errorf("неизвестное хранилище кеша %q: ожидается %s, %s или %s", s, BackendSQLite, BackendMemory, BackendBolt)
+}
+
+// Record — запись хранилища. Store хранит поля как есть, шифрует их
+// EncryptedStore.
+type Record struct {
+	UpdatedAt   time.Time
+	AccessedAt  time.Time
+	PayloadJSON []byte
+	Payload     []byte
+	Meta        []byte
+	// KeyID — версия ключа, которым зашифрованы поля; 0 — поля открыты.
+	KeyID int
+}
+
+func (r Record) size(key string) int64 {
+	return int64(len(key) + len(r.PayloadJSON) + len(r.Payload) + len(r.Meta))
+}
+
+// Store — хранилище записей кеша по строковому ключу. Iterate обходит
+// записи с префиксом в порядке ключей; fn не должна изменять хранилище.
+type Store interface {
+	Get(key string) (Record, error)
+	Put(key string, rec Record) error
+	Delete(key string) error
+	DeletePrefix(prefix string) (int64, error)
+	Iterate(prefix string, fn func(key string, rec Record) error) error
+	Close() error
+}
+
+type toucher interface {
+	Touch(key string, at time.Time) error
+}
+
+// Хранилище может само держать очередь, индекс, блобы, версии ключа и
+// счётчики; иначе Manager хранит их в записях Store (kv.go).
+
+type queueStore interface {
+	QueueAdd(e OutboxEntry) error
+	QueueList(ns string) ([]OutboxEntry, error)
+	QueueUpdate(ns, id string, payload []byte, keyID int) error
+	QueueFail(ns, id, msg string) error
+	QueueDelete(ns, id string) error
+	QueueClear(ns string) error
+}
+
+// searchIndex хранит HMAC слов документов (см. terms), а не сами слова.
+type searchIndex interface {
+	IndexDoc(ns string, sk []byte, doc SearchDoc) error
+	UnindexDoc(ns, id string) error
+	Match(ns string, sk []byte, query []string) ([]match, error)
+	PruneIndex() error
+}
+
+type blobStore interface {
+	Blobs(ns string) ([]blobRow, error)
+	Blob(ns, fileID string) (blobRow, error)
+	PutBlobRow(r blobRow) error
+	DeleteBlobRow(ns, fileID string) error
+}
+
+type keyVersions interface {
+	// KeyVersions возвращает версии по возрастанию.
+	KeyVersions(ns string) ([]int, error)
+	AddKeyVersion(ns string, id int) error
+	DropKeyVersion(ns string, id int) error
+}
+
+type counterStore interface {
+	AddCounters(ns string, hits, misses int64) error
+	Counters(ns string) (hits, misses int64, err error)
+}
+
+// Метки служебных задач не шифруются и не учитываются в Stats.
+type markStore interface {
+	Mark(name string, at time.Time) error
+	// MarkedAt возвращает нулевое время, если метки нет.
+	MarkedAt(name string) (time.Time, error)
+	// Claim ставит метку, если она старше interval; из нескольких процессов
+	// метку получает только один.
+	Claim(name string, interval time.Duration) (bool, error)
+}
+
+type lruStore interface {
+	Sweep(before time.Time) error
+	// Evict возвращает число и размер оставшихся вытесняемых записей.
+	Evict(maxEntries int, maxBytes int64) (int, int64, error)
+}
+
+type compacter interface {
+	Compact() error
+	// CompactIfDue — Compact не чаще раза в interval на все процессы.
+	CompactIfDue(interval time.Duration) error
+}
+
+// s внутри fn — то же хранилище в транзакции.
+type batcher interface {
+	Batch(fn func(s Store) error) error
+}
@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var boltBucket = []byte("entries")
+
+// Файл bbolt открывает только один процесс, остальные ждут до busyTimeout.
+type boltStore struct {
+	db *bolt.DB
+}
+
+type boltRecord struct {
+	PayloadJSON []byte `json:"pj,omitempty"`
+	Payload     []byte `json:"p,omitempty"`
+	Meta        []byte `json:"m,omitempty"`
+	UpdatedAt   int64  `json:"u"`
+	AccessedAt  int64  `json:"a"`
+	KeyID       int    `json:"k,omitempty"`
+}
+
+func OpenBoltStore(path string) (Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: busyTimeout})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("файл кеша %s занят другим процессом keepcli", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("открыть %s как bbolt: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+func encodeBolt(r Record) ([]byte, error) {
+	return json.Marshal(boltRecord{
+		PayloadJSON: r.PayloadJSON, Payload: r.Payload, Meta: r.Meta,
+		UpdatedAt: r.UpdatedAt.Unix(), AccessedAt: r.AccessedAt.Unix(), KeyID: r.KeyID,
+	})
+}
+
+func decodeBolt(v []byte) (Record, error) {
+	var b boltRecord
+	if err := json.Unmarshal(v, &b); err != nil {
+		return Record{}, err
+	}
+	return Record{
+		PayloadJSON: b.PayloadJSON, Payload: b.Payload, Meta: b.Meta,
+		UpdatedAt: time.Unix(b.UpdatedAt, 0), AccessedAt: time.Unix(b.AccessedAt, 0), KeyID: b.KeyID,
+	}, nil
+}
+
+func (s *boltStore) Get(key string) (Record, error) {
+	var rec Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(boltBucket).Get([]byte(key))
+		if v == nil {
+			return ErrNotFound
+		}
+		var err error
+		rec, err = decodeBolt(v)
+		return err
+	})
+	return rec, err
+}
+
+func (s *boltStore) Put(key string, rec Record) error {
+	v, err := encodeBolt(rec)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put([]byte(key), v)
+	})
+}
+
+func (s *boltStore) Touch(key string, at time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltBucket)
+		v := b.Get([]byte(key))
+		if v == nil {
+			return nil
+		}
+		rec, err := decodeBolt(v)
+		if err != nil {
+			return err
+		}
+		rec.AccessedAt = at
+		if v, err = encodeBolt(rec); err != nil {
+			return err
+		}
+		return b.Put([]byte(key), v)
+	})
+}
+
+func (s *boltStore) Delete(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete([]byte(key))
+	})
+}
+
+func (s *boltStore) DeletePrefix(prefix string) (int64, error) {
+	var n int64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltBucket).Cursor()
+		p := []byte(prefix)
+		for k, _ := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, _ = c.Seek(p) {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// fn вызывается после транзакции, поэтому может обращаться к хранилищу.
+func (s *boltStore) Iterate(prefix string, fn func(string, Record) error) error {
+	var keys []string
+	var recs []Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltBucket).Cursor()
+		p := []byte(prefix)
+		for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+			rec, err := decodeBolt(v)
+			if err != nil {
+				return fmt.Errorf("запись %s: %w", k, err)
+			}
+			keys = append(keys, string(k))
+			recs = append(recs, rec)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i, k := range keys {
+		if err := fn(k, recs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryStore struct {
+	recs map[string]Record
+	mu   sync.RWMutex
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{recs: map[string]Record{}}
+}
+
+func cloneRecord(r Record) Record {
+	r.PayloadJSON = bytes.Clone(r.PayloadJSON)
+	r.Payload = bytes.Clone(r.Payload)
+	r.Meta = bytes.Clone(r.Meta)
+	return r
+}
+
+func (s *memoryStore) Get(key string) (Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.recs[key]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	return cloneRecord(r), nil
+}
+
+func (s *memoryStore) Put(key string, rec Record) error {
+	s.mu.Lock()
+	s.recs[key] = cloneRecord(rec)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) Touch(key string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.recs[key]; ok {
+		r.AccessedAt = at
+		s.recs[key] = r
+	}
+	return nil
+}
+
+func (s *memoryStore) Delete(key string) error {
+	s.mu.Lock()
+	delete(s.recs, key)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) DeletePrefix(prefix string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for k := range s.recs {
+		if strings.HasPrefix(k, prefix) {
+			delete(s.recs, k)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *memoryStore) Iterate(prefix string, fn func(string, Record) error) error {
+	s.mu.RLock()
+	keys := make([]string, 0, len(s.recs))
+	for k := range s.recs {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	recs := make([]Record, len(keys))
+	for i, k := range keys {
+		recs[i] = cloneRecord(s.recs[k])
+	}
+	s.mu.RUnlock()
+	for i, k := range keys {
+		if err := fn(k, recs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
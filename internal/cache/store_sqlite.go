@@ -0,0 +1,377 @@
+package cache
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+type sqliteStore struct {
+	db *sql.DB
+	// q — db или транзакция Batch.
+	q execer
+}
+
+type execer interface {
+	Exec(string, ...any) (sql.Result, error)
+	Query(string, ...any) (*sql.Rows, error)
+	QueryRow(string, ...any) *sql.Row
+}
+
+func newSQLiteStore(db *sql.DB) sqliteStore {
+	return sqliteStore{db: db, q: db}
+}
+
+func (s sqliteStore) Get(key string) (Record, error) {
+	var rec Record
+	var ts, accessed int64
+	err := s.q.QueryRow(`SELECT payload_json, payload, meta, updated_at, accessed_at, key_id FROM public_cache WHERE key=?`, key).
+		Scan(&rec.PayloadJSON, &rec.Payload, &rec.Meta, &ts, &accessed, &rec.KeyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rec, ErrNotFound
+	}
+	rec.UpdatedAt, rec.AccessedAt = time.Unix(ts, 0), time.Unix(accessed, 0)
+	return rec, err
+}
+
+func (s sqliteStore) Put(key string, rec Record) error {
+	_, err := s.q.Exec(`INSERT INTO public_cache(key, payload_json, updated_at, payload, meta, accessed_at, key_id) VALUES(?,?,?,?,?,?,?) ON CONFLICT(key) DO UPDATE SET payload_json=excluded.payload_json, updated_at=excluded.updated_at, payload=excluded.payload, meta=excluded.meta, accessed_at=excluded.accessed_at, key_id=excluded.key_id`,
+		key, rec.PayloadJSON, rec.UpdatedAt.Unix(), rec.Payload, rec.Meta, rec.AccessedAt.Unix(), rec.KeyID)
+	return err
+}
+
+func (s sqliteStore) Touch(key string, at time.Time) error {
+	_, err := s.q.Exec(`UPDATE public_cache SET accessed_at=? WHERE key=?`, at.Unix(), key)
+	return err
+}
+
+func (s sqliteStore) Delete(key string) error {
+	_, err := s.q.Exec(`DELETE FROM public_cache WHERE key=?`, key)
+	return err
+}
+
+func (s sqliteStore) DeletePrefix(prefix string) (int64, error) {
+	res, err := s.q.Exec(`DELETE FROM public_cache WHERE key LIKE ?`, prefix+"%")
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Iterate читает записи целиком до вызова fn: у базы одно соединение, и
+// запросы из fn ждали бы закрытия курсора.
+func (s sqliteStore) Iterate(prefix string, fn func(string, Record) error) error {
+	rows, err := s.q.Query(`SELECT key, payload_json, payload, meta, updated_at, accessed_at, key_id FROM public_cache WHERE key LIKE ? ORDER BY key`, prefix+"%")
+	if err != nil {
+		return err
+	}
+	var keys []string
+	var recs []Record
+	for rows.Next() {
+		var k string
+		var rec Record
+		var ts, accessed int64
+		if err := rows.Scan(&k, &rec.PayloadJSON, &rec.Payload, &rec.Meta, &ts, &accessed, &rec.KeyID); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		rec.UpdatedAt, rec.AccessedAt = time.Unix(ts, 0), time.Unix(accessed, 0)
+		keys = append(keys, k)
+		recs = append(recs, rec)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i, k := range keys {
+		if err := fn(k, recs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s sqliteStore) Batch(fn func(Store) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := fn(sqliteStore{db: s.db, q: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s sqliteStore) QueueAdd(e OutboxEntry) error {
+	_, err := s.q.Exec(`INSERT INTO outbox(id, created_at, payload, ns, key_id) VALUES(?,?,?,?,?)`, e.ID, e.CreatedAt.Unix(), e.Payload, e.ns, e.keyID)
+	return err
+}
+
+func (s sqliteStore) QueueList(ns string) ([]OutboxEntry, error) {
+	rows, err := s.q.Query(`SELECT seq, id, created_at, attempts, last_error, payload, key_id, ns FROM outbox WHERE ?='' OR ns=? ORDER BY seq`, ns, ns)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var out []OutboxEntry
+	for rows.Next() {
+		var e OutboxEntry
+		var ts int64
+		if err := rows.Scan(&e.Seq, &e.ID, &ts, &e.Attempts, &e.LastError, &e.Payload, &e.keyID, &e.ns); err != nil {
+			return nil, err
+		}
+		e.CreatedAt = time.Unix(ts, 0)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (s sqliteStore) QueueUpdate(ns, id string, payload []byte, keyID int) error {
+	_, err := s.q.Exec(`UPDATE outbox SET payload=?, key_id=? WHERE id=? AND ns=?`, payload, keyID, id, ns)
+	return err
+}
+
+func (s sqliteStore) QueueFail(ns, id, msg string) error {
+	_, err := s.q.Exec(`UPDATE outbox SET attempts=attempts+1, last_error=? WHERE id=? AND ns=?`, msg, id, ns)
+	return err
+}
+
+func (s sqliteStore) QueueDelete(ns, id string) error {
+	_, err := s.q.Exec(`DELETE FROM outbox WHERE id=? AND ns=?`, id, ns)
+	return err
+}
+
+func (s sqliteStore) QueueClear(ns string) error {
+	_, err := s.q.Exec(`DELETE FROM outbox WHERE ns=?`, ns)
+	return err
+}
+
+func (s sqliteStore) IndexDoc(ns string, sk []byte, doc SearchDoc) error {
+	if err := s.UnindexDoc(ns, doc.ID); err != nil {
+		return err
+	}
+	title, meta, fields := docTerms(sk, doc)
+	_, err := s.q.Exec(`INSERT INTO search_index(title, meta, fields, ns, item_id) VALUES(?,?,?,?,?)`, title, meta, fields, ns, doc.ID)
+	return err
+}
+
+func (s sqliteStore) UnindexDoc(ns, id string) error {
+	_, err := s.q.Exec(`DELETE FROM search_index WHERE ns=? AND item_id=?`, ns, id)
+	return err
+}
+
+func (s sqliteStore) Match(ns string, sk []byte, query []string) ([]match, error) {
+	parts := make([]string, 0, len(query))
+	for _, w := range query {
+		p, t := queryTerms(sk, w)
+		parts = append(parts, "("+p+" OR "+t+")")
+	}
+	rows, err := s.q.Query(`SELECT item_id, bm25(search_index, 10.0, 3.0, 1.0) AS rank FROM search_index WHERE search_index MATCH ? AND ns=? ORDER BY rank`, strings.Join(parts, " AND "), ns)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var out []match
+	for rows.Next() {
+		var mt match
+		if err := rows.Scan(&mt.id, &mt.rank); err != nil {
+			return nil, err
+		}
+		out = append(out, mt)
+	}
+	return out, rows.Err()
+}
+
+func (s sqliteStore) PruneIndex() error {
+	_, err := s.q.Exec(`DELETE FROM search_index WHERE NOT EXISTS (SELECT 1 FROM public_cache WHERE key = search_index.ns || '` + searchPrefix + `' || search_index.item_id)`)
+	return err
+}
+
+func (s sqliteStore) Blobs(ns string) ([]blobRow, error) {
+	rows, err := s.q.Query(`SELECT ns, file_id, sha256, size, dek, key_id, updated_at, accessed_at FROM blobs WHERE ?='' OR ns=? ORDER BY ns, file_id`, ns, ns)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var out []blobRow
+	for rows.Next() {
+		r, err := scanBlob(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func (s sqliteStore) Blob(ns, fileID string) (blobRow, error) {
+	r, err := scanBlob(s.q.QueryRow(`SELECT ns, file_id, sha256, size, dek, key_id, updated_at, accessed_at FROM blobs WHERE ns=? AND file_id=?`, ns, fileID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return r, ErrNotFound
+	}
+	return r, err
+}
+
+func scanBlob(row interface{ Scan(...any) error }) (blobRow, error) {
+	var r blobRow
+	var ts, accessed int64
+	err := row.Scan(&r.ns, &r.fileID, &r.sum, &r.size, &r.dek, &r.keyID, &ts, &accessed)
+	r.updatedAt, r.accessedAt = time.Unix(ts, 0), time.Unix(accessed, 0)
+	return r, err
+}
+
+func (s sqliteStore) PutBlobRow(r blobRow) error {
+	_, err := s.q.Exec(`INSERT INTO blobs(ns, file_id, sha256, size, dek, key_id, updated_at, accessed_at) VALUES(?,?,?,?,?,?,?,?) ON CONFLICT(ns, file_id) DO UPDATE SET sha256=excluded.sha256, size=excluded.size, dek=excluded.dek, key_id=excluded.key_id, updated_at=excluded.updated_at, accessed_at=excluded.accessed_at`,
+		r.ns, r.fileID, r.sum, r.size, r.dek, r.keyID, r.updatedAt.Unix(), r.accessedAt.Unix())
+	return err
+}
+
+func (s sqliteStore) DeleteBlobRow(ns, fileID string) error {
+	_, err := s.q.Exec(`DELETE FROM blobs WHERE ns=? AND file_id=?`, ns, fileID)
+	return err
+}
+
+func (s sqliteStore) KeyVersions(ns string) ([]int, error) {
+	rows, err := s.q.Query(`SELECT key_id FROM cache_keys WHERE ns=? ORDER BY key_id`, ns)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s sqliteStore) AddKeyVersion(ns string, id int) error {
+	_, err := s.q.Exec(`INSERT OR IGNORE INTO cache_keys(ns, key_id, created_at) VALUES(?,?,?)`, ns, id, time.Now().Unix())
+	return err
+}
+
+func (s sqliteStore) DropKeyVersion(ns string, id int) error {
+	_, err := s.q.Exec(`DELETE FROM cache_keys WHERE ns=? AND key_id=?`, ns, id)
+	return err
+}
+
+func (s sqliteStore) AddCounters(ns string, hits, misses int64) error {
+	_, err := s.q.Exec(`INSERT INTO cache_stats(ns, hits, misses) VALUES(?,?,?) ON CONFLICT(ns) DO UPDATE SET hits=hits+excluded.hits, misses=misses+excluded.misses`, ns, hits, misses)
+	return err
+}
+
+func (s sqliteStore) Counters(ns string) (hits, misses int64, err error) {
+	err = s.q.QueryRow(`SELECT hits, misses FROM cache_stats WHERE ns=?`, ns).Scan(&hits, &misses)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, nil
+	}
+	return hits, misses, err
+}
+
+// Реплика не вытесняется: в ней могут быть неотправленные изменения.
+const evictable = `key NOT LIKE 'replica:%' AND key NOT LIKE 'ns:%/replica:%'`
+
+const expirable = evictable + ` AND key NOT LIKE 'ns:%/` + searchPrefix + `%'`
+
+const entrySize = `length(key) + IFNULL(length(payload_json), 0) + IFNULL(length(payload), 0) + IFNULL(length(meta), 0)`
+
+func (s sqliteStore) Sweep(before time.Time) error {
+	_, err := s.q.Exec(`DELETE FROM public_cache WHERE updated_at < ? AND `+expirable, before.Unix())
+	return err
+}
+
+func (s sqliteStore) Evict(maxEntries int, maxBytes int64) (int, int64, error) {
+	n, size, err := s.usage()
+	if err != nil {
+		return 0, 0, err
+	}
+	if (maxEntries <= 0 || n <= maxEntries) && (maxBytes <= 0 || size <= maxBytes) {
+		return n, size, nil
+	}
+	if maxEntries > 0 && n > maxEntries {
+		if _, err := s.q.Exec(`DELETE FROM public_cache WHERE key IN (
+			SELECT key FROM (SELECT key, ROW_NUMBER() OVER (ORDER BY accessed_at DESC, key) AS rank FROM public_cache WHERE `+evictable+`)
+			WHERE rank > ?)`, maxEntries); err != nil {
+			return 0, 0, err
+		}
+	}
+	if maxBytes > 0 && size > maxBytes {
+		if _, err := s.q.Exec(`DELETE FROM public_cache WHERE key IN (
+			SELECT key FROM (SELECT key, SUM(`+entrySize+`) OVER (ORDER BY accessed_at DESC, key) AS total FROM public_cache WHERE `+evictable+`)
+			WHERE total > ?)`, maxBytes); err != nil {
+			return 0, 0, err
+		}
+	}
+	return s.usage()
+}
+
+func (s sqliteStore) usage() (n int, size int64, err error) {
+	err = s.q.QueryRow(`SELECT COUNT(*), IFNULL(SUM(`+entrySize+`), 0) FROM public_cache WHERE `+evictable).Scan(&n, &size)
+	return n, size, err
+}
+
+func (s sqliteStore) Compact() error {
+	if _, err := s.db.Exec(`VACUUM`); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`)
+	return err
+}
+
+func (s sqliteStore) CompactIfDue(interval time.Duration) error {
+	var free int
+	if err := s.db.QueryRow(`PRAGMA freelist_count`).Scan(&free); err != nil || free == 0 {
+		return err
+	}
+	ok, err := s.Claim("vacuum", interval)
+	if err != nil || !ok {
+		return err
+	}
+	// VACUUM не ждёт другие процессы: если файл занят, попытка повторится при
+	// следующем открытии.
+	if _, err := s.db.Exec(`PRAGMA busy_timeout=0`); err != nil {
+		return err
+	}
+	defer func() { _, _ = s.db.Exec(`PRAGMA busy_timeout=` + busyTimeoutMillis()) }()
+	if err := s.Compact(); err != nil {
+		_, _ = s.db.Exec(`DELETE FROM cache_maintenance WHERE name='vacuum'`)
+		return err
+	}
+	return nil
+}
+
+func (s sqliteStore) Mark(name string, at time.Time) error {
+	_, err := s.q.Exec(`INSERT INTO cache_maintenance(name, at) VALUES(?, ?) ON CONFLICT(name) DO UPDATE SET at=excluded.at`, name, at.Unix())
+	return err
+}
+
+func (s sqliteStore) MarkedAt(name string) (time.Time, error) {
+	var at int64
+	err := s.q.QueryRow(`SELECT at FROM cache_maintenance WHERE name=?`, name).Scan(&at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(at, 0), nil
+}
+
+func (s sqliteStore) Claim(name string, interval time.Duration) (bool, error) {
+	now := time.Now()
+	res, err := s.db.Exec(`INSERT INTO cache_maintenance(name, at) VALUES(?, ?) ON CONFLICT(name) DO UPDATE SET at=excluded.at WHERE at < ?`, name, now.Unix(), now.Add(-interval).Unix())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
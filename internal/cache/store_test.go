@@ -0,0 +1,217 @@
+package cache
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	dir := t.TempDir()
+	bolt, err := OpenBoltStore(filepath.Join(dir, "cache.bolt"))
+	require.NoError(t, err)
+	m, err := New(testOptions(dir))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = bolt.Close()
+		_ = m.Close()
+	})
+	return map[string]Store{
+		BackendMemory: NewMemoryStore(),
+		BackendBolt:   bolt,
+		BackendSQLite: m.raw,
+	}
+}
+
+func TestStores(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			at := time.Unix(1700000000, 0)
+			_, err := s.Get("a/1")
+			require.ErrorIs(t, err, ErrNotFound)
+
+			for _, k := range []string{"b/1", "a/2", "a/1"} {
+				require.NoError(t, s.Put(k, Record{PayloadJSON: []byte(`{}`), Payload: []byte(k), UpdatedAt: at, AccessedAt: at, KeyID: 1}))
+			}
+			rec, err := s.Get("a/1")
+			require.NoError(t, err)
+			require.Equal(t, []byte("a/1"), rec.Payload)
+			require.Equal(t, at.Unix(), rec.UpdatedAt.Unix())
+			require.Equal(t, 1, rec.KeyID)
+
+			var keys []string
+			require.NoError(t, s.Iterate("a/", func(k string, _ Record) error {
+				keys = append(keys, k)
+				return nil
+			}))
+			require.Equal(t, []string{"a/1", "a/2"}, keys, "по возрастанию ключа")
+
+			// Запись внутри Iterate не должна блокировать хранилище.
+			require.NoError(t, s.Iterate("b/", func(k string, rec Record) error {
+				return s.Put(k, rec)
+			}))
+
+			require.NoError(t, s.Delete("b/1"))
+			require.NoError(t, s.Delete("b/1"))
+			n, err := s.DeletePrefix("a/")
+			require.NoError(t, err)
+			require.EqualValues(t, 2, n)
+			require.NoError(t, s.Iterate("", func(k string, _ Record) error {
+				t.Fatalf("осталась запись %s", k)
+				return nil
+			}))
+		})
+	}
+}
+
+func TestEncryptedStore(t *testing.T) {
+	raw := NewMemoryStore()
+	keys, err := RandomKey()
+	require.NoError(t, err)
+	s := Encrypted(raw, keys)
+	require.NoError(t, s.Put("k1", Record{PayloadJSON: []byte(`{"secret":1}`), Payload: []byte("top-secret"), Meta: []byte("meta-secret")}))
+
+	sealed, err := raw.Get("k1")
+	require.NoError(t, err)
+	for _, col := range [][]byte{sealed.PayloadJSON, sealed.Payload, sealed.Meta} {
+		require.False(t, bytes.Contains(col, []byte("secret")))
+	}
+	rec, err := s.Get("k1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("top-secret"), rec.Payload)
+
+	// Шифртекст привязан к ключу записи.
+	require.NoError(t, raw.Put("k2", sealed))
+	_, err = s.Get("k2")
+	require.Error(t, err)
+
+	other, err := RandomKey()
+	require.NoError(t, err)
+	_, err = Encrypted(raw, other).Get("k1")
+	require.Error(t, err)
+
+	require.NoError(t, raw.Put("plain", Record{Payload: []byte("x")}))
+	_, err = s.Get("plain")
+	require.Error(t, err)
+}
+
+func TestMemoryBackend(t *testing.T) {
+	m, err := New(Options{Backend: BackendMemory, TTLMinutes: 5})
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+	require.Equal(t, BackendMemory, m.Backend())
+
+	require.NoError(t, m.Put("items:get:1", []byte(`{"id":"1"}`), nil, ""))
+	require.NoError(t, m.Put("items:list", []byte(`[]`), nil, ""))
+	pj, _, _, _, err := m.Get("items:get:1")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"id":"1"}`, string(pj))
+	_, _, _, _, err = m.Get("items:get:2")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, m.OutboxAdd("b", []byte("p1")))
+	require.NoError(t, m.OutboxAdd("a", []byte("p2")))
+	require.Error(t, m.OutboxAdd("a", []byte("dup")))
+	require.NoError(t, m.OutboxFail("a", "timeout"))
+	ops, err := m.OutboxList()
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+	require.Equal(t, "b", ops[0].ID)
+	require.Equal(t, 1, ops[1].Attempts)
+
+	require.NoError(t, m.Index(SearchDoc{ID: "1", Title: "Example bank", Type: "CARD"}))
+	require.NoError(t, m.Index(SearchDoc{ID: "2", Title: "Почта", Meta: map[string]string{"url": "mail.example.com"}}))
+	require.Equal(t, []string{"1", "2"}, searchIDs(t, m, "exa", ""))
+	require.Equal(t, []string{"2"}, searchIDs(t, m, "поч", ""))
+
+	st, err := m.Stats()
+	require.NoError(t, err)
+	require.Equal(t, 4, st.Entries)
+	require.Equal(t, 2, st.Outbox)
+	require.EqualValues(t, 1, st.Hits)
+	require.EqualValues(t, 1, st.Misses)
+
+	rep, err := m.Verify()
+	require.NoError(t, err)
+	require.Equal(t, 6, rep.Checked)
+	require.Empty(t, rep.Corrupt)
+
+	n, err := m.PurgePrefix("items:")
+	require.NoError(t, err)
+	require.EqualValues(t, 2, n)
+
+	_, err = m.PutBlob("f", []byte("data"))
+	require.ErrorIs(t, err, ErrUnsupported)
+	_, err = m.Rekey()
+	require.NoError(t, err)
+	require.Equal(t, 2, m.KeyVersion())
+	require.Equal(t, []string{"2"}, searchIDs(t, m, "поч", ""))
+	ops, err = m.OutboxList()
+	require.NoError(t, err)
+	require.Equal(t, []byte("p1"), ops[0].Payload)
+}
+
+func TestBoltBackendPersists(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions(dir)
+	opts.Backend = BackendBolt
+	opts.Path = filepath.Join(dir, "cache.bolt")
+	m, err := New(opts)
+	require.NoError(t, err)
+	require.NoError(t, m.Put("items:get:1", []byte(`{"id":"1"}`), []byte("top-secret"), ""))
+	require.NoError(t, m.OutboxAdd("op", []byte("queued-secret")))
+	require.NoError(t, m.Close())
+	requireNoPlaintext(t, opts.Path, "top-secret", "queued-secret")
+
+	m, err = New(opts)
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+	_, payload, _, _, err := m.Get("items:get:1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("top-secret"), payload)
+	ops, err := m.OutboxList()
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+}
+
+func TestBoltBackendRekeyBlobsAndSearch(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions(dir)
+	opts.Backend = BackendBolt
+	opts.Path = filepath.Join(dir, "cache.bolt")
+	m, err := New(opts)
+	require.NoError(t, err)
+	require.NoError(t, m.Index(SearchDoc{ID: "1", Title: "Example bank"}))
+	require.NoError(t, m.OutboxAdd("op", []byte("queued")))
+	_, err = m.PutBlob("f1", []byte("blob-secret"))
+	require.NoError(t, err)
+	n, err := m.Rekey()
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.NoError(t, m.Close())
+	requireNoPlaintext(t, opts.Path, "Example", "queued", "blob-secret")
+
+	m, err = New(opts)
+	require.NoError(t, err)
+	defer func() { _ = m.Close() }()
+	require.Equal(t, 2, m.KeyVersion())
+	_, err = m.ring.Get(m.keyItem(1))
+	require.Error(t, err, "прежняя версия удалена")
+	require.Equal(t, []string{"1"}, searchIDs(t, m, "exa", ""))
+	data, _, err := m.GetBlob("f1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("blob-secret"), data)
+	rep, err := m.Verify()
+	require.NoError(t, err)
+	require.Equal(t, 3, rep.Checked)
+	require.Empty(t, rep.Corrupt)
+
+	st, err := m.Stats()
+	require.NoError(t, err)
+	require.Equal(t, 1, st.Blobs)
+	require.Equal(t, 1, st.Outbox)
+}
@@ -0,0 +1,193 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/agentd"
+	"github.com/GoLessons/sufir-keeper-client/internal/api"
+	"github.com/GoLessons/sufir-keeper-client/internal/config"
+	"github.com/GoLessons/sufir-keeper-client/internal/logging"
+	"github.com/GoLessons/sufir-keeper-client/internal/service"
+)
+
+func AttachAgentCommands(root *cobra.Command) {
+	c := &cobra.Command{
+		Use:   "agent",
+		Short: "Фоновый агент, держащий открытую сессию",
+	}
+	c.PersistentFlags().String("socket", "", "Путь к unix-сокету агента")
+	c.AddCommand(newAgentStartCmd())
+	c.AddCommand(newAgentStopCmd())
+	c.AddCommand(newAgentStatusCmd())
+	root.AddCommand(c)
+}
+
+func newAgentStartCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "start",
+		Short: "Запустить агент",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			socket := agentSocket(cmd)
+			if agentd.Running(cmd.Context(), socket) {
+				return fmt.Errorf("агент уже запущен: %s", socket)
+			}
+			foreground, _ := cmd.Flags().GetBool("foreground")
+			if !foreground {
+				return spawnAgent(cmd, socket)
+			}
+			return runAgent(cmd, socket)
+		},
+	}
+	cmd.Flags().Bool("foreground", false, "Не уходить в фон")
+	cmd.Flags().Duration("cache-ttl", agentd.DefaultCacheTTL, "Время жизни записей в памяти агента")
+	return cmd
+}
+
+func newAgentStopCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "stop",
+		Short: "Остановить агент",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			socket := agentSocket(cmd)
+			if !agentd.Running(cmd.Context(), socket) {
+				return errors.New("агент не запущен")
+			}
+			if err := agentd.Stop(cmd.Context(), socket); err != nil {
+				return err
+			}
+			_, err := cmd.OutOrStdout().Write([]byte("OK\n"))
+			return err
+		},
+	}
+}
+
+func newAgentStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Показать состояние агента",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			socket := agentSocket(cmd)
+			st, err := agentd.GetStatus(cmd.Context(), socket)
+			if err != nil {
+				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "not running (%s)\n", socket)
+				return nil
+			}
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "running pid=%d socket=%s server=%s since=%s cached=%d\n",
+				st.PID, socket, st.BaseURL, st.StartedAt.Format(time.RFC3339), st.CachedItems)
+			return nil
+		},
+	}
+}
+
+func agentSocket(cmd *cobra.Command) string {
+	if s, _ := cmd.Flags().GetString("socket"); s != "" {
+		return s
+	}
+	cfg := cmd.Context().Value(cfgContextKey).(config.Config)
+	if cfg.Agent.Socket != "" {
+		return cfg.Agent.Socket
+	}
+	return agentd.DefaultSocket()
+}
+
+func spawnAgent(cmd *cobra.Command, socket string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	args := append(append([]string{}, os.Args[1:]...), "--foreground", "--socket", socket)
+	p := exec.Command(exe, args...)
+	p.SysProcAttr = detachedProcAttr()
+	if err := p.Start(); err != nil {
+		return err
+	}
+	pid := p.Process.Pid
+	_ = p.Process.Release()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if agentd.Running(cmd.Context(), socket) {
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "агент запущен (pid %d): %s\n", pid, socket)
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return errors.New("агент не ответил за 5 секунд, запустите с --foreground для диагностики")
+}
+
+func runAgent(cmd *cobra.Command, socket string) error {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	cfg := ctx.Value(cfgContextKey).(config.Config)
+	log := ctx.Value(logContextKey).(logging.Logger)
+	store, err := newStore(cfg)
+	if err != nil {
+		return err
+	}
+	cl, err := api.NewDirect(cfg, log, store)
+	if err != nil {
+		return err
+	}
+	cacheTTL, _ := cmd.Flags().GetDuration("cache-ttl")
+	opts := agentd.Options{
+		Upstream: cl.HTTP.HTTPClient,
+		BaseURL:  cfg.Server.BaseURL,
+		Identity: api.AgentIdentity(cfg),
+		Socket:   socket,
+		CacheTTL: cacheTTL,
+		Log:      log,
+		Refresh: func(ctx context.Context) (time.Duration, error) {
+			if !store.HasRefreshToken() {
+				return 0, errors.New("no refresh token")
+			}
+			t, err := cl.Auth.Refresh(ctx, cfg.Server.BaseURL)
+			if err != nil {
+				return 0, err
+			}
+			return time.Duration(t.ExpiresIn) * time.Second, nil
+		},
+	}
+	if inv, ok := store.(interface{ Invalidate() }); ok {
+		opts.Invalidate = inv.Invalidate
+	}
+	if cfg.Outbox.Enabled && cfg.Cache.Enabled {
+		opts.Flush = func(ctx context.Context) error {
+			cm, err := newCache(cfg)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = cm.Close() }()
+			_, err = service.NewItemsService(api.NewWrapper(cl), cm, cfg).FlushOutbox(ctx)
+			return err
+		}
+	}
+	ln, err := agentd.Listen(socket)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(socket) }()
+	return agentd.New(opts).Serve(ctx, ln)
+}
+
+// notifyAgent просит запущенный агент перечитать токены после входа или
+// выхода; отсутствие агента не ошибка.
+func notifyAgent(cmd *cobra.Command, cfg config.Config) {
+	if cfg.Agent.Disabled {
+		return
+	}
+	socket := cfg.Agent.Socket
+	if socket == "" {
+		socket = agentd.DefaultSocket()
+	}
+	if agentd.Running(cmd.Context(), socket) {
+		_ = agentd.Reload(cmd.Context(), socket)
+	}
+}
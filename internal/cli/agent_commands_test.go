@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttachAgentCommands(t *testing.T) {
+	root := NewRootCmd("", "", "")
+	ag, _, err := root.Find([]string{"agent"})
+	require.NoError(t, err)
+	names := make([]string, 0, len(ag.Commands()))
+	for _, c := range ag.Commands() {
+		names = append(names, c.Name())
+	}
+	require.ElementsMatch(t, []string{"start", "stop", "status"}, names)
+}
+
+func TestAgentStatusAndStopWhenNotRunning(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "none.sock")
+	cmd := NewRootCmd("dev", "none", "2025-01-01")
+	var buf bytes.Buffer
+	cmd.SetOut(&buf)
+	cmd.SetErr(&buf)
+	cmd.SetArgs([]string{"--ca-cert-path=", "agent", "status", "--socket", socket})
+	require.NoError(t, cmd.Execute())
+	require.Contains(t, buf.String(), "not running")
+
+	cmd = NewRootCmd("dev", "none", "2025-01-01")
+	cmd.SetOut(&buf)
+	cmd.SetErr(&buf)
+	cmd.SetArgs([]string{"--ca-cert-path=", "agent", "stop", "--socket", socket})
+	require.Error(t, cmd.Execute())
+}
@@ -0,0 +1,9 @@
+//go:build unix
+
+package cli
+
+import "syscall"
+
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
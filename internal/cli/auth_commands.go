@@ -2,8 +2,12 @@ package cli
 
 import (
 	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"strings"
 
@@ -17,6 +21,7 @@ import (
 	"github.com/GoLessons/sufir-keeper-client/internal/cache"
 	"github.com/GoLessons/sufir-keeper-client/internal/config"
 	"github.com/GoLessons/sufir-keeper-client/internal/logging"
+	"github.com/GoLessons/sufir-keeper-client/internal/replica"
 )
 
 func AttachAuthCommands(root *cobra.Command) {
@@ -58,6 +63,15 @@ func newLoginCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			if info, verr := cl.Auth.Verify(ctx, cfg.Server.BaseURL); verr == nil {
+				err = rememberIdentity(cfg, info.UserID)
+			} else {
+				err = rememberAnonymous(cfg)
+			}
+			if err != nil {
+				return err
+			}
+			notifyAgent(cmd, cfg)
 			_, err = cmd.OutOrStdout().Write([]byte("OK\n"))
 			return err
 		},
@@ -109,7 +123,7 @@ func newRegisterCmd() *cobra.Command {
 }
 
 func newLogoutCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "logout",
 		Short: "Выйти из системы",
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -127,10 +141,21 @@ func newLogoutCmd() *cobra.Command {
 			if err := cl.Auth.Logout(ctx, cfg.Server.BaseURL); err != nil {
 				return err
 			}
+			discard, _ := cmd.Flags().GetBool("discard-unsent")
+			kept, err := purgeCache(cfg, discard)
+			if err != nil {
+				return err
+			}
+			if kept > 0 {
+				_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "сохранены неотправленные изменения: %d; они будут отправлены после входа (удалить: keepcli logout --discard-unsent)\n", kept)
+			}
+			notifyAgent(cmd, cfg)
 			_, err = cmd.OutOrStdout().Write([]byte("OK\n"))
 			return err
 		},
 	}
+	cmd.Flags().Bool("discard-unsent", false, "Удалить и неотправленные изменения (очередь и реплику)")
+	return cmd
 }
 
 func newStatusCmd() *cobra.Command {
@@ -159,6 +184,9 @@ func newStatusCmd() *cobra.Command {
 				_, werr := cmd.OutOrStdout().Write([]byte("Токен недействителен\n"))
 				return werr
 			}
+			if _, known := knownIdentity(cfg); !known {
+				_ = rememberIdentity(cfg, info.UserID)
+			}
 			out := fmt.Sprintf("Авторизован: %s\n", info.UserID)
 			_, werr := cmd.OutOrStdout().Write([]byte(out))
 			return werr
@@ -196,15 +224,144 @@ func newStore(cfg config.Config) (auth.TokenStore, error) {
 }
 
 func newCache(cfg config.Config) (*cache.Manager, error) {
+	cm, err := openCache(cfg, false)
+	switch {
+	case errors.Is(err, cache.ErrKeyMissing):
+		return nil, fmt.Errorf("%w: сохранённые в кеше данные не расшифровать; удалите их командой `keepcli cache purge --missing-key`", err)
+	case errors.Is(err, cache.ErrKeyUnavailable):
+		return nil, fmt.Errorf("%w; проверьте настройки auth.backend и auth.file_dir", err)
+	}
+	return cm, err
+}
+
+func openCache(cfg config.Config, discardMissingKey bool) (*cache.Manager, error) {
 	kr := keyringConfigFromAuth(cfg)
 	return cache.New(cache.Options{
-		Path:          cfg.Cache.Path,
-		TTLMinutes:    cfg.Cache.TTLMinutes,
-		KeyringConfig: kr,
-		KeyName:       "cache_key",
+		Backend:           cfg.Cache.Backend,
+		Path:              cfg.Cache.Path,
+		TTLMinutes:        cfg.Cache.TTLMinutes,
+		StaleMinutes:      cfg.Cache.StaleMinutes,
+		MaxEntries:        cfg.Cache.MaxEntries,
+		MaxBytes:          int64(cfg.Cache.MaxBytes),
+		MaxBlobBytes:      int64(cfg.Cache.BlobMaxBytes),
+		KeyringConfig:     kr,
+		KeyName:           "cache_key",
+		Namespace:         cacheNamespace(cfg),
+		DiscardMissingKey: discardMissingKey,
 	})
 }
 
+const (
+	identityKey     = "cache_identity"
+	anonymousPrefix = "anonymous:"
+)
+
+// identity — владелец токенов; по нему выбирается пространство имён кеша.
+type identity struct {
+	Server string `json:"server"`
+	UserID string `json:"user_id"`
+}
+
+func normalizeServer(u string) string {
+	return strings.TrimRight(strings.TrimSpace(u), "/")
+}
+
+func loadIdentity(cfg config.Config) (identity, bool) {
+	ring, err := keyring.Open(keyringConfigFromAuth(cfg))
+	if err != nil {
+		return identity{}, false
+	}
+	it, err := ring.Get(identityKey)
+	if err != nil {
+		return identity{}, false
+	}
+	var id identity
+	if json.Unmarshal(it.Data, &id) != nil {
+		return identity{}, false
+	}
+	return id, true
+}
+
+func rememberIdentity(cfg config.Config, userID string) error {
+	ring, err := keyring.Open(keyringConfigFromAuth(cfg))
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(identity{Server: normalizeServer(cfg.Server.BaseURL), UserID: userID})
+	if err != nil {
+		return err
+	}
+	return ring.Set(keyring.Item{Key: identityKey, Data: b})
+}
+
+// Каждый вход с неизвестным пользователем получает своё пространство кеша.
+func rememberAnonymous(cfg config.Config) error {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	return rememberIdentity(cfg, anonymousPrefix+hex.EncodeToString(b))
+}
+
+// Сохранённое пространство не заменяется до logout: в нём могут быть
+// неотправленные изменения.
+func knownIdentity(cfg config.Config) (identity, bool) {
+	id, ok := loadIdentity(cfg)
+	if !ok || id.Server != normalizeServer(cfg.Server.BaseURL) {
+		return identity{}, false
+	}
+	return id, true
+}
+
+func forgetIdentity(cfg config.Config) error {
+	ring, err := keyring.Open(keyringConfigFromAuth(cfg))
+	if err != nil {
+		return err
+	}
+	if err := ring.Remove(identityKey); err != nil && !errors.Is(err, keyring.ErrKeyNotFound) && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Без входа кеш работает в общем анонимном пространстве сервера.
+func cacheNamespace(cfg config.Config) cache.Namespace {
+	ns := cache.Namespace{Server: normalizeServer(cfg.Server.BaseURL)}
+	if id, ok := knownIdentity(cfg); ok {
+		ns.UserID = id.UserID
+	}
+	return ns
+}
+
+// purgeCache без discard сохраняет неотправленные изменения и ключ и
+// возвращает их число.
+func purgeCache(cfg config.Config, discard bool) (int, error) {
+	// Записи под пропавшим ключом не прочитать, поэтому они удаляются сразу.
+	cm, err := openCache(cfg, true)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = cm.Close() }()
+	ops, err := cm.OutboxList()
+	if err != nil {
+		return 0, err
+	}
+	dirty, err := replica.New(cm).Pending()
+	if err != nil {
+		return 0, err
+	}
+	if kept := len(ops) + len(dirty); kept > 0 && !discard {
+		if _, err := cm.PurgePrefix(""); err != nil {
+			return 0, err
+		}
+		return kept, forgetIdentity(cfg)
+	}
+	if err := cm.Purge(); err != nil {
+		return 0, err
+	}
+	return 0, forgetIdentity(cfg)
+}
+
 func keyringConfigFromAuth(cfg config.Config) keyring.Config {
 	c := keyring.Config{
 		ServiceName: cfg.Auth.TokenStoreService,
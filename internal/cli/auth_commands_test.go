@@ -2,9 +2,17 @@ package cli
 
 import (
 	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/cache"
+	"github.com/GoLessons/sufir-keeper-client/internal/config"
 )
 
 func TestAttachAuthCommands(t *testing.T) {
@@ -34,3 +42,178 @@ func TestStatusNotAuthorized(t *testing.T) {
 		t.Fatal("empty output")
 	}
 }
+
+func TestCLI_LoginSelectsCacheNamespaceAndLogoutPurgesIt(t *testing.T) {
+	dir := t.TempDir()
+	srv := newMockServer(t)
+	defer srv.Close()
+	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
+	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
+	t.Setenv("SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", "sufir-keeper-client")
+	t.Setenv("SUFIR_KEEPER_AGENT_DISABLED", "true")
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
+	cfgPath := filepath.Join(dir, "cfg.json")
+	require.NoError(t, os.WriteFile(cfgPath, []byte("{}"), 0o600))
+	run := func(args ...string) {
+		cmd := NewRootCmd("dev", "none", "2025-01-01")
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs(append([]string{"--config", cfgPath, "--server", srv.URL + "/", "--ca-cert-path=", "--log-level", "info"}, args...))
+		require.NoError(t, cmd.ExecuteContext(context.Background()), buf.String())
+	}
+	cfg := config.Config{}
+	cfg.Server.BaseURL = srv.URL
+	cfg.Auth.Backend = "file"
+	cfg.Auth.FileDir = dir
+	cfg.Auth.TokenStoreService = "sufir-keeper-client"
+	cfg.Cache.Path = filepath.Join(dir, "cache.db")
+	cfg.Cache.TTLMinutes = 5
+
+	run("login", "--login", "u", "--password", "p")
+	require.Equal(t, cache.Namespace{Server: srv.URL, UserID: "user-1"}, cacheNamespace(cfg))
+	other := cfg
+	other.Server.BaseURL = "https://other.example"
+	require.Empty(t, cacheNamespace(other).UserID)
+
+	cm, err := newCache(cfg)
+	require.NoError(t, err)
+	require.NoError(t, cm.Put("items:get:1", []byte(`{}`), nil, ""))
+	require.NoError(t, cm.Close())
+
+	run("logout")
+	require.Empty(t, cacheNamespace(cfg).UserID)
+	require.NoError(t, rememberIdentity(cfg, "user-1"))
+	cm, err = newCache(cfg)
+	require.NoError(t, err)
+	defer func() { _ = cm.Close() }()
+	_, _, _, _, err = cm.Get("items:get:1")
+	require.Error(t, err)
+}
+
+func TestCLI_LogoutKeepsUnsentChanges(t *testing.T) {
+	dir := t.TempDir()
+	srv := newMockServer(t)
+	defer srv.Close()
+	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
+	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
+	t.Setenv("SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", "sufir-keeper-client")
+	t.Setenv("SUFIR_KEEPER_AGENT_DISABLED", "true")
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
+	cfgPath := filepath.Join(dir, "cfg.json")
+	require.NoError(t, os.WriteFile(cfgPath, []byte("{}"), 0o600))
+	run := func(args ...string) string {
+		cmd := NewRootCmd("dev", "none", "2025-01-01")
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs(append([]string{"--config", cfgPath, "--server", srv.URL + "/", "--ca-cert-path=", "--log-level", "info"}, args...))
+		require.NoError(t, cmd.ExecuteContext(context.Background()), buf.String())
+		return buf.String()
+	}
+	cfg := config.Config{}
+	cfg.Server.BaseURL = srv.URL
+	cfg.Auth.Backend = "file"
+	cfg.Auth.FileDir = dir
+	cfg.Auth.TokenStoreService = "sufir-keeper-client"
+	cfg.Cache.Path = filepath.Join(dir, "cache.db")
+	cfg.Cache.TTLMinutes = 5
+	open := func() *cache.Manager {
+		require.NoError(t, rememberIdentity(cfg, "user-1"))
+		cm, err := newCache(cfg)
+		require.NoError(t, err)
+		return cm
+	}
+
+	run("login", "--login", "u", "--password", "p")
+	cm, err := newCache(cfg)
+	require.NoError(t, err)
+	require.NoError(t, cm.Put("items:get:1", []byte(`{}`), nil, ""))
+	require.NoError(t, cm.OutboxAdd("op-1", []byte(`{"kind":"delete"}`)))
+	require.NoError(t, cm.Close())
+
+	require.Contains(t, run("logout"), "неотправленные изменения: 1")
+	cm = open()
+	_, _, _, _, err = cm.Get("items:get:1")
+	require.Error(t, err)
+	ops, err := cm.OutboxList()
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	require.NoError(t, cm.Close())
+
+	run("login", "--login", "u", "--password", "p")
+	run("logout", "--discard-unsent")
+	cm = open()
+	defer func() { _ = cm.Close() }()
+	ops, err = cm.OutboxList()
+	require.NoError(t, err)
+	require.Empty(t, ops)
+}
+
+func TestCLI_LoginsWithoutVerifyDoNotShareCache(t *testing.T) {
+	dir := t.TempDir()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"a","refresh_token":"r","token_type":"bearer","expires_in":3600}`))
+	})
+	mux.HandleFunc("/auth-verify", http.NotFound)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
+	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
+	t.Setenv("SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", "sufir-keeper-client")
+	t.Setenv("SUFIR_KEEPER_AGENT_DISABLED", "true")
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
+	cfgPath := filepath.Join(dir, "cfg.json")
+	require.NoError(t, os.WriteFile(cfgPath, []byte("{}"), 0o600))
+	login := func(user string) {
+		cmd := NewRootCmd("dev", "none", "2025-01-01")
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"--config", cfgPath, "--server", srv.URL, "--ca-cert-path=", "login", "--login", user, "--password", "p"})
+		require.NoError(t, cmd.ExecuteContext(context.Background()), buf.String())
+	}
+	cfg := config.Config{}
+	cfg.Server.BaseURL = srv.URL
+	cfg.Auth.Backend = "file"
+	cfg.Auth.FileDir = dir
+	cfg.Auth.TokenStoreService = "sufir-keeper-client"
+	cfg.Cache.Path = filepath.Join(dir, "cache.db")
+	cfg.Cache.TTLMinutes = 5
+
+	login("alice")
+	alice := cacheNamespace(cfg)
+	require.NotEmpty(t, alice.UserID)
+	cm, err := newCache(cfg)
+	require.NoError(t, err)
+	require.NoError(t, cm.Put("items:get:1", []byte(`{"title":"alice"}`), nil, ""))
+	require.NoError(t, cm.Close())
+
+	login("bob")
+	require.NotEqual(t, alice, cacheNamespace(cfg))
+	cm, err = newCache(cfg)
+	require.NoError(t, err)
+	defer func() { _ = cm.Close() }()
+	_, _, _, _, err = cm.Get("items:get:1")
+	require.Error(t, err)
+	keys, err := cm.Keys("")
+	require.NoError(t, err)
+	require.Empty(t, keys)
+}
+
+func TestNewCacheReportsUnavailableKeyring(t *testing.T) {
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "not-a-dir")
+	require.NoError(t, os.WriteFile(blocker, nil, 0o600))
+	cfg := config.Config{}
+	cfg.Server.BaseURL = "https://keeper.example"
+	cfg.Auth.Backend = "file"
+	cfg.Auth.FileDir = filepath.Join(blocker, "keyring")
+	cfg.Cache.Path = filepath.Join(dir, "cache.db")
+
+	_, err := newCache(cfg)
+	require.ErrorIs(t, err, cache.ErrKeyUnavailable)
+	require.Contains(t, err.Error(), "auth.file_dir")
+}
@@ -0,0 +1,263 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/cache"
+	"github.com/GoLessons/sufir-keeper-client/internal/config"
+)
+
+func AttachCacheCommands(root *cobra.Command) {
+	c := &cobra.Command{
+		Use:   "cache",
+		Short: "Обслуживание локального кеша",
+	}
+	c.AddCommand(newCacheMigrateCmd())
+	c.AddCommand(newCacheStatsCmd())
+	c.AddCommand(newCachePurgeCmd())
+	c.AddCommand(newCacheVerifyCmd())
+	c.AddCommand(newCacheExportCmd())
+	c.AddCommand(newCacheRekeyCmd())
+	root.AddCommand(c)
+}
+
+func newCacheMigrateCmd() *cobra.Command {
+	var dryRun bool
+	c := &cobra.Command{
+		Use:   "migrate",
+		Short: "Обновить схему базы кеша",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := cmd.Context().Value(cfgContextKey).(config.Config)
+			backend, err := cache.ParseBackend(cfg.Cache.Backend)
+			if err != nil {
+				return err
+			}
+			if backend != cache.BackendSQLite {
+				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "миграции нужны только хранилищу sqlite, настроено %s\n", backend)
+				return nil
+			}
+			st, err := cache.Inspect(cfg.Cache.Path)
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			if len(st.Pending) == 0 {
+				_, _ = fmt.Fprintf(out, "схема кеша актуальна (версия %d)\n", st.Current)
+				return nil
+			}
+			if !dryRun {
+				// Миграции применяются при открытии кеша.
+				cm, err := newCache(cfg)
+				if err != nil {
+					return err
+				}
+				defer func() { _ = cm.Close() }()
+			}
+			verb := "применена"
+			if dryRun {
+				verb = "будет применена"
+			}
+			for _, mg := range st.Pending {
+				_, _ = fmt.Fprintf(out, "%s миграция %04d_%s\n", verb, mg.Version, mg.Name)
+			}
+			return nil
+		},
+	}
+	c.Flags().BoolVar(&dryRun, "dry-run", false, "только показать ожидающие миграции")
+	return c
+}
+
+func withCache(cmd *cobra.Command, fn func(cm *cache.Manager) error) error {
+	cfg := cmd.Context().Value(cfgContextKey).(config.Config)
+	cm, err := newCache(cfg)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = cm.Close() }()
+	return fn(cm)
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f МиБ", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f КиБ", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d Б", n)
+}
+
+func newCacheStatsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "stats",
+		Short: "Показать состояние кеша",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withCache(cmd, func(cm *cache.Manager) error {
+				st, err := cm.Stats()
+				if err != nil {
+					return err
+				}
+				tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+				_, _ = fmt.Fprintf(tw, "Файл:\t%s (%s)\n", st.Path, formatSize(st.SizeBytes))
+				ttl := "отключён"
+				if st.TTL > 0 {
+					ttl = st.TTL.String()
+				}
+				_, _ = fmt.Fprintf(tw, "TTL:\t%s\n", ttl)
+				_, _ = fmt.Fprintf(tw, "Версия ключа:\t%d\n", cm.KeyVersion())
+				_, _ = fmt.Fprintf(tw, "Записей:\t%d (свежих %d, устаревших %d)\n", st.Entries, st.Fresh, st.Expired)
+				if st.Entries > 0 {
+					_, _ = fmt.Fprintf(tw, "Самая старая:\t%s\n", st.Oldest.Local().Format(time.RFC3339))
+					_, _ = fmt.Fprintf(tw, "Самая новая:\t%s\n", st.Newest.Local().Format(time.RFC3339))
+				}
+				_, _ = fmt.Fprintf(tw, "Попаданий/промахов:\t%d/%d\n", st.Hits, st.Misses)
+				_, _ = fmt.Fprintf(tw, "Очередь изменений:\t%d\n", st.Outbox)
+				_, _ = fmt.Fprintf(tw, "Скачанных файлов:\t%d (%s)\n", st.Blobs, formatSize(st.BlobBytes))
+				for _, p := range st.Prefixes {
+					_, _ = fmt.Fprintf(tw, "  %s\t%d\n", p.Prefix, p.Entries)
+				}
+				return tw.Flush()
+			})
+		},
+	}
+}
+
+func newCachePurgeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "purge",
+		Short: "Удалить записи кеша (реплика и очередь сохраняются, если не указаны явно)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			prefix, _ := cmd.Flags().GetString("prefix")
+			expired, _ := cmd.Flags().GetBool("expired")
+			missingKey, _ := cmd.Flags().GetBool("missing-key")
+			if expired && prefix != "" {
+				return errors.New("--prefix и --expired несовместимы")
+			}
+			if missingKey {
+				return purgeMissingKey(cmd)
+			}
+			return withCache(cmd, func(cm *cache.Manager) error {
+				var n int64
+				var err error
+				if expired {
+					n, err = cm.PurgeExpired()
+				} else {
+					n, err = cm.PurgePrefix(prefix)
+				}
+				if err != nil {
+					return err
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "удалено записей: %d\n", n)
+				return nil
+			})
+		},
+	}
+	cmd.Flags().String("prefix", "", "Удалить записи с префиксом ключа (например, items:list:)")
+	cmd.Flags().Bool("expired", false, "Удалить записи с истёкшим TTL")
+	cmd.Flags().Bool("missing-key", false, "Если ключ шифрования пропал из keyring, удалить все записи и очередь и создать новый ключ")
+	return cmd
+}
+
+// При доступном ключе purgeMissingKey ничего не меняет.
+func purgeMissingKey(cmd *cobra.Command) error {
+	cfg := cmd.Context().Value(cfgContextKey).(config.Config)
+	out := cmd.OutOrStdout()
+	cm, err := openCache(cfg, false)
+	if err == nil {
+		_ = cm.Close()
+		_, _ = fmt.Fprintln(out, "ключ шифрования кеша на месте, удалять нечего")
+		return nil
+	}
+	if !errors.Is(err, cache.ErrKeyMissing) {
+		return err
+	}
+	cm, err = openCache(cfg, true)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = cm.Close() }()
+	_, _ = fmt.Fprintf(out, "записи, зашифрованные пропавшим ключом, удалены; новый ключ версии %d\n", cm.KeyVersion())
+	return nil
+}
+
+func newCacheVerifyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify",
+		Short: "Проверить, что все записи кеша расшифровываются",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withCache(cmd, func(cm *cache.Manager) error {
+				rep, err := cm.Verify()
+				if err != nil {
+					return err
+				}
+				out := cmd.OutOrStdout()
+				_, _ = fmt.Fprintf(out, "проверено: %d, повреждено: %d, других пространств: %d\n", rep.Checked, len(rep.Corrupt), rep.Foreign)
+				for _, k := range rep.Corrupt {
+					_, _ = fmt.Fprintf(out, "  повреждена %s\n", k)
+				}
+				if len(rep.Corrupt) > 0 {
+					return fmt.Errorf("в кеше повреждённые записи: %d (удалите их через cache purge --prefix)", len(rep.Corrupt))
+				}
+				return nil
+			})
+		},
+	}
+}
+
+func newCacheExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Выгрузить расшифрованный кеш в JSON для отладки",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output, _ := cmd.Flags().GetString("output")
+			yes, _ := cmd.Flags().GetBool("yes")
+			if !yes && !askYes(cmd, bufio.NewReader(cmd.InOrStdin()), "Выгрузка содержит секреты в открытом виде. Продолжить?") {
+				return errors.New("выгрузка отменена")
+			}
+			return withCache(cmd, func(cm *cache.Manager) error {
+				dump, err := cm.Export()
+				if err != nil {
+					return err
+				}
+				b, err := json.MarshalIndent(dump, "", "  ")
+				if err != nil {
+					return err
+				}
+				b = append(b, '\n')
+				if output == "" {
+					_, err = cmd.OutOrStdout().Write(b)
+					return err
+				}
+				return os.WriteFile(output, b, 0o600)
+			})
+		},
+	}
+	cmd.Flags().StringP("output", "o", "", "Файл для выгрузки (по умолчанию stdout)")
+	cmd.Flags().Bool("yes", false, "Не запрашивать подтверждение")
+	return cmd
+}
+
+func newCacheRekeyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rekey",
+		Short: "Перешифровать кеш новым ключом и удалить прежний",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withCache(cmd, func(cm *cache.Manager) error {
+				n, err := cm.Rekey()
+				if err != nil {
+					return err
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "перешифровано записей: %d, версия ключа: %d\n", n, cm.KeyVersion())
+				return nil
+			})
+		},
+	}
+}
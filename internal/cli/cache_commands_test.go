@@ -0,0 +1,203 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/99designs/keyring"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/cache"
+	"github.com/GoLessons/sufir-keeper-client/internal/config"
+)
+
+func cacheCLI(t *testing.T) (dir string, run func(stdin string, args ...string) (string, error)) {
+	dir = t.TempDir()
+	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
+	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
+	t.Setenv("SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", "sufir-keeper-client")
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
+	t.Setenv("SUFIR_KEEPER_AGENT_DISABLED", "true")
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "xdg"))
+	cfgPath := filepath.Join(dir, "cfg.json")
+	require.NoError(t, os.WriteFile(cfgPath, []byte("{}"), 0o600))
+
+	return dir, func(stdin string, args ...string) (string, error) {
+		cmd := NewRootCmd("dev", "none", "2025-01-01")
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetIn(strings.NewReader(stdin))
+		cmd.SetArgs(append([]string{"--config", cfgPath, "--server", "http://127.0.0.1:1", "--log-level", "info"}, args...))
+		err := cmd.ExecuteContext(context.Background())
+		return buf.String(), err
+	}
+}
+
+// cacheTestConfig совпадает с конфигурацией, которую получает cacheCLI.
+func cacheTestConfig(dir string) config.Config {
+	cfg := config.Config{}
+	cfg.Server.BaseURL = "http://127.0.0.1:1"
+	cfg.Auth.Backend = "file"
+	cfg.Auth.FileDir = dir
+	cfg.Auth.TokenStoreService = "sufir-keeper-client"
+	cfg.Cache.Path = filepath.Join(dir, "cache.db")
+	cfg.Cache.TTLMinutes = 5
+	return cfg
+}
+
+func TestCLI_CacheMigrateDryRun(t *testing.T) {
+	dir, run := cacheCLI(t)
+
+	out, err := run("", "cache", "migrate", "--dry-run")
+	require.NoError(t, err)
+	require.Contains(t, out, "будет применена миграция 0001_public_cache")
+	_, err = os.Stat(filepath.Join(dir, "cache.db"))
+	require.True(t, os.IsNotExist(err))
+
+	out, err = run("", "cache", "migrate")
+	require.NoError(t, err)
+	require.Contains(t, out, "применена миграция 0004_outbox_namespace")
+
+	out, err = run("", "cache", "migrate", "--dry-run")
+	require.NoError(t, err)
+	require.Contains(t, out, "схема кеша актуальна")
+}
+
+func TestCLI_CacheBoltBackend(t *testing.T) {
+	dir, run := cacheCLI(t)
+	t.Setenv("SUFIR_KEEPER_CACHE_BACKEND", "bbolt")
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.bolt"))
+	cfg := cacheTestConfig(dir)
+	cfg.Cache.Backend = "bbolt"
+	cfg.Cache.Path = filepath.Join(dir, "cache.bolt")
+	cm, err := newCache(cfg)
+	require.NoError(t, err)
+	require.NoError(t, cm.Put("items:get:1", []byte(`{}`), nil, ""))
+	require.NoError(t, cm.Close())
+
+	out, err := run("", "cache", "stats")
+	require.NoError(t, err)
+	require.Regexp(t, `Записей:\s+1`, out)
+
+	out, err = run("", "cache", "migrate")
+	require.NoError(t, err)
+	require.Contains(t, out, "миграции нужны только хранилищу sqlite")
+
+	t.Setenv("SUFIR_KEEPER_CACHE_BACKEND", "redis")
+	_, err = run("", "cache", "stats")
+	require.ErrorContains(t, err, "неизвестное хранилище кеша")
+}
+
+func TestCLI_CacheStatsPurgeVerifyExport(t *testing.T) {
+	dir, run := cacheCLI(t)
+	cfg := cacheTestConfig(dir)
+	cm, err := newCache(cfg)
+	require.NoError(t, err)
+	require.NoError(t, cm.Put("items:get:1", []byte(`{"password":"exported-secret"}`), nil, ""))
+	require.NoError(t, cm.Put("items:list:a", []byte(`{}`), nil, ""))
+	require.NoError(t, cm.Close())
+
+	out, err := run("", "cache", "stats")
+	require.NoError(t, err)
+	require.Contains(t, out, "Записей:")
+	require.Contains(t, out, "items:get")
+	require.Contains(t, out, "items:list")
+
+	out, err = run("", "cache", "verify")
+	require.NoError(t, err)
+	require.Contains(t, out, "повреждено: 0")
+
+	_, err = run("n\n", "cache", "export")
+	require.Error(t, err)
+	out, err = run("да\n", "cache", "export")
+	require.NoError(t, err)
+	require.Contains(t, out, "exported-secret")
+	dump := filepath.Join(dir, "dump.json")
+	_, err = run("", "cache", "export", "--yes", "-o", dump)
+	require.NoError(t, err)
+	fi, err := os.Stat(dump)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	out, err = run("", "cache", "purge", "--prefix", "items:list:")
+	require.NoError(t, err)
+	require.Contains(t, out, "удалено записей: 1")
+	_, err = run("", "cache", "purge", "--prefix", "x", "--expired")
+	require.Error(t, err)
+}
+
+func TestCLI_CacheRekeyAndMissingKey(t *testing.T) {
+	dir, run := cacheCLI(t)
+	cfg := cacheTestConfig(dir)
+	cm, err := newCache(cfg)
+	require.NoError(t, err)
+	require.NoError(t, cm.Put("items:get:1", []byte(`{}`), nil, ""))
+	require.NoError(t, cm.Close())
+
+	out, err := run("", "cache", "rekey")
+	require.NoError(t, err)
+	require.Contains(t, out, "перешифровано записей: 1, версия ключа: 2")
+
+	out, err = run("", "cache", "purge", "--missing-key")
+	require.NoError(t, err)
+	require.Contains(t, out, "удалять нечего")
+
+	ring, err := keyring.Open(keyringConfigFromAuth(cfg))
+	require.NoError(t, err)
+	require.NoError(t, ring.Remove("cache_key/"+cacheNamespace(cfg).ID()+"/v2"))
+	_, err = run("", "cache", "stats")
+	require.ErrorIs(t, err, cache.ErrKeyMissing)
+	require.ErrorContains(t, err, "cache purge --missing-key")
+
+	out, err = run("", "cache", "purge", "--missing-key")
+	require.NoError(t, err)
+	require.Contains(t, out, "новый ключ версии 3")
+	out, err = run("", "cache", "stats")
+	require.NoError(t, err)
+	require.Contains(t, out, "0 (свежих 0, устаревших 0)")
+}
+
+func TestCLI_ReadPolicyCacheOnly(t *testing.T) {
+	dir, run := cacheCLI(t)
+	const id = "00000000-0000-0000-0000-000000000001"
+
+	_, err := run("", "--ca-cert-path=", "get", id, "--read-policy", "offline")
+	require.ErrorContains(t, err, "неизвестный режим чтения")
+
+	_, err = run("", "--ca-cert-path=", "get", id, "--read-policy", "cache-only")
+	require.ErrorContains(t, err, "запись отсутствует в кеше")
+
+	cm, err := newCache(cacheTestConfig(dir))
+	require.NoError(t, err)
+	require.NoError(t, cm.Put("items:get:"+id, []byte(`{"id":"`+id+`","title":"cached","data":{"type":"TEXT","value":"v"}}`), nil, ""))
+	require.NoError(t, cm.Close())
+
+	t.Setenv("SUFIR_KEEPER_CACHE_READ_POLICY", "cache-only")
+	out, err := run("", "--ca-cert-path=", "get", id)
+	require.NoError(t, err)
+	require.Contains(t, out, "данные из кеша, возраст")
+	require.Contains(t, out, "cached")
+}
+
+func TestCLI_ListLocalSearch(t *testing.T) {
+	dir, run := cacheCLI(t)
+	cm, err := newCache(cacheTestConfig(dir))
+	require.NoError(t, err)
+	require.NoError(t, cm.Index(cache.SearchDoc{ID: "00000000-0000-0000-0000-000000000001", Title: "Deploy key", Type: "TEXT"}))
+	require.NoError(t, cm.Index(cache.SearchDoc{ID: "00000000-0000-0000-0000-000000000002", Title: "Почта"}))
+	require.NoError(t, cm.Close())
+
+	_, err = run("", "--ca-cert-path=", "list", "--local")
+	require.ErrorContains(t, err, "требует строку поиска")
+
+	out, err := run("", "--ca-cert-path=", "list", "--local", "--search", "dep")
+	require.NoError(t, err)
+	require.Contains(t, out, "результаты локального поиска")
+	require.Contains(t, out, "Deploy key")
+	require.NotContains(t, out, "Почта")
+}
@@ -0,0 +1,270 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/config"
+)
+
+func AttachConfigCommands(root *cobra.Command) {
+	c := &cobra.Command{
+		Use:         "config",
+		Short:       "Просмотр и правка конфигурации",
+		Annotations: map[string]string{tolerateConfigErrors: "true"},
+	}
+	c.AddCommand(newConfigInitCmd())
+	c.AddCommand(newConfigGetCmd())
+	c.AddCommand(newConfigSetCmd())
+	c.AddCommand(newConfigUnsetCmd())
+	c.AddCommand(newConfigListCmd())
+	c.AddCommand(newConfigValidateCmd())
+	root.AddCommand(c)
+}
+
+func lookupKey(name string) (config.Key, error) {
+	k, ok := config.LookupKey(name)
+	if !ok {
+		return k, fmt.Errorf("неизвестный ключ %q; все ключи: keepcli config list", name)
+	}
+	return k, nil
+}
+
+func readLayers(cfg config.Config) ([]*config.File, error) {
+	var files []*config.File
+	for i := len(cfg.ConfigFiles) - 1; i >= 0; i-- {
+		f, err := config.ReadFile(cfg.ConfigFiles[i])
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// keyOrigin — откуда взято значение: flag, env, profile, file или default.
+func keyOrigin(cmd *cobra.Command, cfg config.Config, layers []*config.File, k config.Key) string {
+	if name, ok := flagKeys[k.Name]; ok {
+		if fl := cmd.Root().PersistentFlags().Lookup(name); fl != nil && fl.Changed {
+			return "flag --" + name
+		}
+	}
+	if os.Getenv(k.Env) != "" {
+		return "env " + k.Env
+	}
+	if cfg.Profile != "" {
+		for _, f := range layers {
+			if _, ok := f.Get("profiles." + cfg.Profile + "." + k.Name); ok {
+				return "profile " + cfg.Profile
+			}
+		}
+	}
+	for _, f := range layers {
+		if _, ok := f.Get(k.Name); ok {
+			return "file " + f.Path()
+		}
+	}
+	return "default"
+}
+
+func newConfigInitCmd() *cobra.Command {
+	var force bool
+	c := &cobra.Command{
+		Use:   "init",
+		Short: "Создать файл конфигурации, отвечая на вопросы",
+		Long: "Создаёт пользовательский файл конфигурации ($XDG_CONFIG_HOME/sufir-keeper/config.json, " +
+			"config.yaml или config.toml) или файл из --config/SUFIR_KEEPER_CONFIG. Пустой ответ оставляет текущее значение.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := cmd.Context().Value(cfgContextKey).(config.Config)
+			path := config.DefaultPath()
+			if cmd.Root().PersistentFlags().Changed("config") || os.Getenv("SUFIR_KEEPER_CONFIG") != "" {
+				path = cfg.ConfigFile
+			}
+			if _, err := os.Stat(path); err == nil && !force {
+				return fmt.Errorf("файл %s уже существует; дополнить его: --force", path)
+			}
+			f, err := config.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			in := bufio.NewReader(cmd.InOrStdin())
+			for _, name := range []string{"server.base_url", "tls.ca_cert_path", "log.level", "cache.read_policy"} {
+				k, _ := config.LookupKey(name)
+				cur := k.Value(cfg)
+				_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "%s [%s]: ", name, cur)
+				line, err := in.ReadString('\n')
+				if err != nil && line == "" {
+					return errors.New("ввод прерван, файл не записан")
+				}
+				val := strings.TrimSpace(line)
+				if val == "" {
+					val = cur
+				}
+				if err := k.Check(val); err != nil {
+					return err
+				}
+				f.Set(name, val)
+			}
+			if err := f.Write(); err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "конфигурация записана в %s\n", path)
+			return nil
+		},
+	}
+	c.Flags().BoolVar(&force, "force", false, "дополнить существующий файл")
+	return c
+}
+
+func newConfigGetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "get KEY",
+		Short: "Показать действующее значение ключа",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			k, err := lookupKey(args[0])
+			if err != nil {
+				return err
+			}
+			cfg := cmd.Context().Value(cfgContextKey).(config.Config)
+			_, _ = fmt.Fprintln(cmd.OutOrStdout(), k.Value(cfg))
+			return nil
+		},
+	}
+}
+
+func newConfigSetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "set KEY VALUE",
+		Short: "Записать значение в файл конфигурации",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			k, err := lookupKey(args[0])
+			if err != nil {
+				return err
+			}
+			if err := k.Check(args[1]); err != nil {
+				return err
+			}
+			f, cfg, err := configFile(cmd)
+			if err != nil {
+				return err
+			}
+			f.Set(k.Name, args[1])
+			if err := f.Write(); err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s = %s записано в %s\n", k.Name, args[1], f.Path())
+			layers, err := readLayers(cfg)
+			if err != nil {
+				return err
+			}
+			warnOverridden(cmd, cfg, layers, k)
+			return nil
+		},
+	}
+}
+
+func warnOverridden(cmd *cobra.Command, cfg config.Config, layers []*config.File, k config.Key) {
+	switch o := keyOrigin(cmd, cfg, layers, k); {
+	case strings.HasPrefix(o, "env "), strings.HasPrefix(o, "flag "), strings.HasPrefix(o, "profile "):
+		_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "значение из файла перекрыто: %s\n", o)
+	}
+}
+
+func newConfigUnsetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "unset KEY",
+		Short: "Удалить значение из файла конфигурации",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			k, err := lookupKey(args[0])
+			if err != nil {
+				return err
+			}
+			f, _, err := configFile(cmd)
+			if err != nil {
+				return err
+			}
+			if !f.Unset(k.Name) {
+				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s не задан в %s\n", k.Name, f.Path())
+				return nil
+			}
+			if err := f.Write(); err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s удалён из %s\n", k.Name, f.Path())
+			return nil
+		},
+	}
+}
+
+func newConfigListCmd() *cobra.Command {
+	var showOrigin bool
+	c := &cobra.Command{
+		Use:   "list",
+		Short: "Показать действующую конфигурацию",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := cmd.Context().Value(cfgContextKey).(config.Config)
+			layers, err := readLayers(cfg)
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			_, _ = fmt.Fprintf(out, "Файл для правки: %s\n", cfg.ConfigFile)
+			for _, p := range cfg.ConfigFiles {
+				_, _ = fmt.Fprintf(out, "Прочитан: %s\n", p)
+			}
+			if cfg.Profile != "" {
+				_, _ = fmt.Fprintf(out, "Профиль: %s\n", cfg.Profile)
+			}
+			tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+			for _, k := range config.Keys {
+				if showOrigin {
+					_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", k.Name, k.Value(cfg), keyOrigin(cmd, cfg, layers, k))
+					continue
+				}
+				_, _ = fmt.Fprintf(tw, "%s\t%s\n", k.Name, k.Value(cfg))
+			}
+			return tw.Flush()
+		},
+	}
+	c.Flags().BoolVar(&showOrigin, "show-origin", false, "показать источник значения: flag, env, profile, file или default")
+	return c
+}
+
+func newConfigValidateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate",
+		Short: "Проверить конфигурацию",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := cmd.Context().Value(cfgContextKey).(config.Config)
+			loadErr, _ := cmd.Context().Value(cfgErrContextKey).(error)
+			errs := append(unjoin(loadErr), unjoin(config.Validate(cfg))...)
+			if len(errs) == 0 {
+				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "конфигурация корректна (%s)\n", cfg.ConfigFile)
+				return nil
+			}
+			for _, err := range errs {
+				_, _ = fmt.Fprintln(cmd.OutOrStdout(), err)
+			}
+			return fmt.Errorf("ошибок в конфигурации: %d", len(errs))
+		},
+	}
+}
+
+func unjoin(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if j, ok := err.(interface{ Unwrap() []error }); ok {
+		return j.Unwrap()
+	}
+	return []error{err}
+}
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCLI_ConfigSetGetListValidate(t *testing.T) {
+	dir, run := cacheCLI(t)
+
+	_, err := run("", "config", "set", "cache.ttl_minutes", "abc")
+	require.ErrorContains(t, err, `cache.ttl_minutes: ожидается целое неотрицательное число, получено "abc"`)
+	_, err = run("", "config", "set", "cache.colour", "red")
+	require.ErrorContains(t, err, "неизвестный ключ")
+
+	_, err = run("", "config", "set", "cache.ttl_minutes", "30")
+	require.NoError(t, err)
+	out, err := run("", "config", "get", "cache.ttl_minutes")
+	require.NoError(t, err)
+	require.Equal(t, "30\n", out)
+
+	out, err = run("", "config", "set", "cache.path", filepath.Join(dir, "other.db"))
+	require.NoError(t, err)
+	require.Contains(t, out, "значение из файла перекрыто: env SUFIR_KEEPER_CACHE_PATH")
+
+	out, err = run("", "config", "list", "--show-origin")
+	require.NoError(t, err)
+	require.Regexp(t, `server\.base_url\s+http://127\.0\.0\.1:1\s+flag --server`, out)
+	require.Regexp(t, `cache\.ttl_minutes\s+30\s+file`, out)
+	require.Regexp(t, `cache\.path\s+\S+cache\.db\s+env SUFIR_KEEPER_CACHE_PATH`, out)
+	require.Regexp(t, `log\.level\s+info\s+flag --log-level`, out)
+	require.Regexp(t, `cache\.read_policy\s+network-first\s+default`, out)
+
+	out, err = run("", "config", "validate")
+	require.NoError(t, err)
+	require.Contains(t, out, "конфигурация корректна")
+
+	// Ошибочное значение в файле не мешает командам config, но не
+	// пропускается остальными.
+	raw, err := os.ReadFile(filepath.Join(dir, "cfg.json"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cfg.json"), []byte(`{"cache":{"ttl_minutes":"ten","read_policy":"sometimes"}}`), 0o600))
+	out, err = run("", "config", "validate")
+	require.ErrorContains(t, err, "ошибок в конфигурации: 2")
+	require.Contains(t, out, `cache.ttl_minutes: ожидается целое неотрицательное число, получено "ten"`)
+	require.Contains(t, out, `cache.read_policy: ожидается одно из: network-first, cache-first, cache-only, получено "sometimes"`)
+	_, err = run("", "cache", "stats")
+	require.ErrorContains(t, err, "cache.ttl_minutes")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cfg.json"), raw, 0o600))
+
+	_, err = run("", "config", "unset", "cache.ttl_minutes")
+	require.NoError(t, err)
+	out, err = run("", "config", "get", "cache.ttl_minutes")
+	require.NoError(t, err)
+	require.Equal(t, "180\n", out)
+}
+
+func TestCLI_ConfigInit(t *testing.T) {
+	_, run := cacheCLI(t)
+	xdg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	path := filepath.Join(xdg, "sufir-keeper", "config.json")
+
+	// cacheCLI передаёт --config, поэтому файл указывается явно.
+	_, err := run("https://keeper.example/api/v1\n\ndebug\n\n", "--config", path, "config", "init")
+	require.NoError(t, err)
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(raw), `"base_url": "https://keeper.example/api/v1"`)
+	require.Contains(t, string(raw), `"level": "debug"`)
+
+	_, err = run("\n\n\n\n", "--config", path, "config", "init")
+	require.ErrorContains(t, err, "уже существует")
+	_, err = run("not a url\n", "--config", path, "config", "init", "--force")
+	require.ErrorContains(t, err, "server.base_url: ожидается абсолютный URL")
+}
+
+func TestCLI_ConfigListLayers(t *testing.T) {
+	dir, run := cacheCLI(t)
+	user := filepath.Join(dir, "xdg", "sufir-keeper", "config.yaml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(user), 0o700))
+	require.NoError(t, os.WriteFile(user, []byte("cache:\n  ttl_minutes: 45\n  max_entries: 5\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cfg.json"), []byte(`{"cache":{"max_entries":7}}`), 0o600))
+
+	out, err := run("", "config", "list", "--show-origin")
+	require.NoError(t, err)
+	require.Contains(t, out, "Файл для правки: "+filepath.Join(dir, "cfg.json"))
+	require.Contains(t, out, "Прочитан: "+user)
+	require.Regexp(t, `cache\.ttl_minutes\s+45\s+file \S+config\.yaml`, out)
+	require.Regexp(t, `cache\.max_entries\s+7\s+file \S+cfg\.json`, out)
+}
+
+func TestCLI_ConfigHTTP(t *testing.T) {
+	_, run := cacheCLI(t)
+
+	out, err := run("", "--http-timeout", "5s", "config", "list", "--show-origin")
+	require.NoError(t, err)
+	require.Regexp(t, `http\.timeout\s+5s\s+flag --http-timeout`, out)
+	require.Regexp(t, `http\.retry_max\s+3\s+default`, out)
+	require.Regexp(t, `http\.retry_wait_max\s+2s\s+default`, out)
+	require.Regexp(t, `http\.user_agent\s+keepcli/dev\s+default`, out)
+
+	_, err = run("", "--http-timeout", "soon", "cache", "stats")
+	require.ErrorContains(t, err, `http.timeout: ожидается неотрицательная длительность вида 500ms, 30s или 1m, получено "soon"`)
+	_, err = run("", "config", "set", "http.retry_wait_min", "fast")
+	require.ErrorContains(t, err, "http.retry_wait_min")
+}
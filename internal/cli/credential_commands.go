@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+
+	openapi_types "github.com/oapi-codegen/runtime/types"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/credproc"
+)
+
+func AttachCredentialProcessCommands(root *cobra.Command) {
+	c := &cobra.Command{
+		Use:   "credential-process",
+		Short: "Выдать учётные данные для внешних инструментов (AWS, Kubernetes)",
+	}
+	c.AddCommand(newCredentialProcessAWSCmd())
+	c.AddCommand(newCredentialProcessK8sCmd())
+	root.AddCommand(c)
+}
+
+func newCredentialProcessAWSCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "aws [id]",
+		Short: "JSON для credential_process в ~/.aws/config",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			item, err := loadCredentialItem(cmd, args[0])
+			if err != nil {
+				return err
+			}
+			out, err := credproc.AWS(item)
+			if err != nil {
+				return err
+			}
+			return json.NewEncoder(cmd.OutOrStdout()).Encode(out)
+		},
+	}
+}
+
+func newCredentialProcessK8sCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "k8s [id]",
+		Short: "ExecCredential для exec-плагина kubectl",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			item, err := loadCredentialItem(cmd, args[0])
+			if err != nil {
+				return err
+			}
+			out, err := credproc.K8s(item, credproc.K8sAPIVersion(os.Getenv("KUBERNETES_EXEC_INFO")))
+			if err != nil {
+				return err
+			}
+			return json.NewEncoder(cmd.OutOrStdout()).Encode(out)
+		},
+	}
+}
+
+func loadCredentialItem(cmd *cobra.Command, arg string) (apigen.ItemResponse, error) {
+	idv, err := uuid.Parse(arg)
+	if err != nil {
+		return apigen.ItemResponse{}, errors.New("некорректный UUID")
+	}
+	var id openapi_types.UUID
+	if err := id.UnmarshalText([]byte(idv.String())); err != nil {
+		return apigen.ItemResponse{}, err
+	}
+	svc, _, closeFn, err := newItemsService(cmd)
+	if err != nil {
+		return apigen.ItemResponse{}, err
+	}
+	defer closeFn()
+	return credproc.Load(cmd.Context(), svc, id, time.Now())
+}
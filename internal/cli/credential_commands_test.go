@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttachCredentialProcessCommands(t *testing.T) {
+	root := NewRootCmd("", "", "")
+	cp, _, err := root.Find([]string{"credential-process"})
+	require.NoError(t, err)
+	names := make([]string, 0, len(cp.Commands()))
+	for _, c := range cp.Commands() {
+		names = append(names, c.Name())
+	}
+	require.Contains(t, names, "aws")
+	require.Contains(t, names, "k8s")
+}
+
+func TestCredentialProcessRejectsBadUUID(t *testing.T) {
+	cmd := NewRootCmd("dev", "none", "2025-01-01")
+	var buf bytes.Buffer
+	cmd.SetOut(&buf)
+	cmd.SetErr(&buf)
+	cmd.SetArgs([]string{"--ca-cert-path=", "credential-process", "aws", "not-a-uuid"})
+	require.Error(t, cmd.Execute())
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/dockercred"
+)
+
+func AttachDockerCommands(root *cobra.Command) {
+	root.AddCommand(newDockerCredentialCmd(root))
+}
+
+func newDockerCredentialCmd(root *cobra.Command) *cobra.Command {
+	return &cobra.Command{
+		Use:       "docker-credential [store|get|erase|list|version]",
+		Short:     "Docker credential helper на базе хранилища",
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"store", "get", "erase", "list", "version"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if args[0] == "version" {
+				_, err := fmt.Fprintf(cmd.OutOrStdout(), "%s %s\n", dockercred.BinaryName, nonEmpty(root.Version, "dev"))
+				return err
+			}
+			svc, _, closeFn, err := newItemsService(cmd)
+			if err != nil {
+				_, _ = fmt.Fprintln(cmd.OutOrStdout(), err.Error())
+				return err
+			}
+			defer closeFn()
+			h := dockercred.NewHelper(svc)
+			if err := h.Serve(cmd.Context(), args[0], cmd.InOrStdin(), cmd.OutOrStdout()); err != nil {
+				// docker читает текст ошибки из stdout helper'а
+				_, _ = fmt.Fprintln(cmd.OutOrStdout(), err.Error())
+				return err
+			}
+			return nil
+		},
+	}
+}
+
+func DockerCredentialArgs(argv0 string, args []string) ([]string, bool) {
+	if !dockercred.IsHelperName(argv0) {
+		return nil, false
+	}
+	return append([]string{"docker-credential"}, args...), true
+}
@@ -0,0 +1,26 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDockerCredentialArgs(t *testing.T) {
+	args, ok := DockerCredentialArgs("/usr/bin/docker-credential-keepcli", []string{"get"})
+	require.True(t, ok)
+	require.Equal(t, []string{"docker-credential", "get"}, args)
+	_, ok = DockerCredentialArgs("/usr/bin/keepcli", []string{"get"})
+	require.False(t, ok)
+}
+
+func TestDockerCredentialVersion(t *testing.T) {
+	cmd := NewRootCmd("1.2.3", "none", "2025-01-01")
+	var buf bytes.Buffer
+	cmd.SetOut(&buf)
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs([]string{"--ca-cert-path=", "docker-credential", "version"})
+	require.NoError(t, cmd.Execute())
+	require.Equal(t, "docker-credential-keepcli 1.2.3\n", buf.String())
+}
@@ -0,0 +1,271 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+
+	"github.com/99designs/keyring"
+	"github.com/spf13/cobra"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/config"
+	"github.com/GoLessons/sufir-keeper-client/internal/e2e"
+)
+
+func AttachE2ECommands(root *cobra.Command) {
+	c := &cobra.Command{
+		Use:   "e2e",
+		Short: "Сквозное шифрование данных записей мастер-паролем",
+	}
+	c.AddCommand(newE2EInitCmd())
+	c.AddCommand(newE2EUnlockCmd())
+	c.AddCommand(newE2ELockCmd())
+	c.AddCommand(newE2EStatusCmd())
+	c.AddCommand(newE2ERotateKeyCmd())
+	root.AddCommand(c)
+}
+
+func newE2EInitCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "init",
+		Short: "Задать мастер-пароль и включить шифрование новых записей",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			_, w, closeFn, err := newRawItemsService(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeFn()
+			if _, _, err := e2e.LoadState(ctx, w); err == nil {
+				return errors.New("e2e-шифрование уже настроено, используйте e2e unlock или e2e rotate-key")
+			} else if !errors.Is(err, e2e.ErrNotInitialized) {
+				return err
+			}
+			in := bufio.NewReader(cmd.InOrStdin())
+			pw, err := readNewMasterPassword(cmd, in)
+			if err != nil {
+				return err
+			}
+			params, key, err := newE2EParams(pw)
+			if err != nil {
+				return err
+			}
+			if err := e2e.SaveState(ctx, w, nil, e2e.State{Current: params}); err != nil {
+				return err
+			}
+			if err := saveLocalE2EKey(cmd, key); err != nil {
+				return err
+			}
+			_, err = cmd.OutOrStdout().Write([]byte("OK\n"))
+			return err
+		},
+	}
+}
+
+func newE2EUnlockCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "unlock",
+		Short: "Получить ключ из мастер-пароля и сохранить его в keyring",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			_, w, closeFn, err := newRawItemsService(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeFn()
+			st, _, err := e2e.LoadState(ctx, w)
+			if err != nil {
+				return err
+			}
+			pw, err := readSecret(cmd, bufio.NewReader(cmd.InOrStdin()), "Мастер-пароль: ")
+			if err != nil {
+				return err
+			}
+			key, err := e2e.Derive([]byte(pw), st.Current)
+			if err != nil {
+				return err
+			}
+			if err := saveLocalE2EKey(cmd, key); err != nil {
+				return err
+			}
+			_, err = cmd.OutOrStdout().Write([]byte("OK\n"))
+			return err
+		},
+	}
+}
+
+func newE2ELockCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "lock",
+		Short: "Удалить ключ из keyring",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := cmd.Context().Value(cfgContextKey).(config.Config)
+			kr, err := keyring.Open(keyringConfigFromAuth(cfg))
+			if err != nil {
+				return err
+			}
+			if err := e2e.ForgetLocalKey(kr); err != nil {
+				return err
+			}
+			notifyAgent(cmd, cfg)
+			_, err = cmd.OutOrStdout().Write([]byte("OK\n"))
+			return err
+		},
+	}
+}
+
+func newE2EStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Показать состояние e2e-шифрования",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := cmd.Context().Value(cfgContextKey).(config.Config)
+			local := "locked"
+			if kr, err := keyring.Open(keyringConfigFromAuth(cfg)); err == nil {
+				if k, err := e2e.LoadLocalKey(kr); err == nil {
+					local = "unlocked key=" + k.ID
+				}
+			}
+			_, w, closeFn, err := newRawItemsService(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeFn()
+			st, _, err := e2e.LoadState(cmd.Context(), w)
+			if errors.Is(err, e2e.ErrNotInitialized) {
+				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "server: not initialized\nlocal: %s\n", local)
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "server: key=%s kdf=%s\nlocal: %s\n", st.Current.KeyID(), st.Current.KDF, local)
+			if st.Pending != nil {
+				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "pending rotation: key=%s\n", st.Pending.KeyID())
+			}
+			return nil
+		},
+	}
+}
+
+func newE2ERotateKeyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rotate-key",
+		Short: "Сменить мастер-пароль и перешифровать все записи",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			svc, w, closeFn, err := newRawItemsService(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeFn()
+			st, id, err := e2e.LoadState(ctx, w)
+			if err != nil {
+				return err
+			}
+			in := bufio.NewReader(cmd.InOrStdin())
+			oldPw, err := readSecret(cmd, in, "Текущий мастер-пароль: ")
+			if err != nil {
+				return err
+			}
+			oldKey, err := e2e.Derive([]byte(oldPw), st.Current)
+			if err != nil {
+				return err
+			}
+			newPw, err := readNewMasterPassword(cmd, in)
+			if err != nil {
+				return err
+			}
+			var newKey e2e.Key
+			if st.Pending != nil {
+				if newKey, err = e2e.Derive([]byte(newPw), *st.Pending); err != nil {
+					return fmt.Errorf("прерванная ротация начата с другим новым паролем: %w", err)
+				}
+			} else {
+				params, key, err := newE2EParams(newPw)
+				if err != nil {
+					return err
+				}
+				st.Pending = &params
+				if err := e2e.SaveState(ctx, w, id, st); err != nil {
+					return err
+				}
+				newKey = key
+			}
+			n, err := e2e.Rotate(ctx, w, e2e.NewSealer(oldKey), e2e.NewSealer(newKey))
+			svc.InvalidateCache()
+			if err != nil {
+				return fmt.Errorf("перешифровано %d записей, повторите команду для продолжения: %w", n, err)
+			}
+			if err := e2e.SaveState(ctx, w, id, e2e.State{Current: *st.Pending}); err != nil {
+				return err
+			}
+			if err := saveLocalE2EKey(cmd, newKey); err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "перешифровано записей: %d\n", n)
+			return nil
+		},
+	}
+}
+
+func readNewMasterPassword(cmd *cobra.Command, in *bufio.Reader) (string, error) {
+	pw, err := readSecret(cmd, in, "Новый мастер-пароль: ")
+	if err != nil {
+		return "", err
+	}
+	if pw == "" {
+		return "", errors.New("мастер-пароль не может быть пустым")
+	}
+	again, err := readSecret(cmd, in, "Повторите мастер-пароль: ")
+	if err != nil {
+		return "", err
+	}
+	if pw != again {
+		return "", errors.New("пароли не совпадают")
+	}
+	return pw, nil
+}
+
+func newE2EParams(pw string) (e2e.Params, e2e.Key, error) {
+	params, err := e2e.NewParams()
+	if err != nil {
+		return e2e.Params{}, e2e.Key{}, err
+	}
+	key, err := e2e.Derive([]byte(pw), params)
+	if err != nil {
+		return e2e.Params{}, e2e.Key{}, err
+	}
+	params, err = params.WithCheck(key)
+	return params, key, err
+}
+
+func saveLocalE2EKey(cmd *cobra.Command, key e2e.Key) error {
+	cfg := cmd.Context().Value(cfgContextKey).(config.Config)
+	kr, err := keyring.Open(keyringConfigFromAuth(cfg))
+	if err != nil {
+		return err
+	}
+	if err := e2e.SaveLocalKey(kr, key); err != nil {
+		return err
+	}
+	notifyAgent(cmd, cfg)
+	return nil
+}
+
+// loadSealer возвращает шифратор, если ключ разблокирован. При
+// e2e.enabled отсутствие ключа — ошибка, чтобы записи не ушли на сервер
+// открытым текстом.
+func loadSealer(cfg config.Config) (*e2e.Sealer, error) {
+	kr, err := keyring.Open(keyringConfigFromAuth(cfg))
+	if err == nil {
+		var key e2e.Key
+		if key, err = e2e.LoadLocalKey(kr); err == nil {
+			return e2e.NewSealer(key), nil
+		}
+	}
+	if cfg.E2E.Enabled {
+		return nil, fmt.Errorf("e2e-шифрование включено, но ключ не разблокирован, выполните keepcli e2e unlock: %w", err)
+	}
+	return nil, nil
+}
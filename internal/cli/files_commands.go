@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -12,11 +13,13 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
+	"go.uber.org/zap"
 
 	openapi_types "github.com/oapi-codegen/runtime/types"
 
 	"github.com/GoLessons/sufir-keeper-client/internal/api"
 	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/cache"
 	"github.com/GoLessons/sufir-keeper-client/internal/config"
 	"github.com/GoLessons/sufir-keeper-client/internal/logging"
 )
@@ -97,6 +100,7 @@ func newFilesUploadCmd() *cobra.Command {
 }
 
 func newFilesDownloadCmd() *cobra.Command {
+	var noCache bool
 	cmd := &cobra.Command{
 		Use:   "download [id] [out]",
 		Short: "Скачать файл",
@@ -110,24 +114,47 @@ func newFilesDownloadCmd() *cobra.Command {
 			ctx := cmd.Context()
 			cfg := ctx.Value(cfgContextKey).(config.Config)
 			log := ctx.Value(logContextKey).(logging.Logger)
-			store, err := newStore(cfg)
-			if err != nil {
-				return err
-			}
-			cl, err := api.New(cfg, log, store)
-			if err != nil {
-				return err
-			}
-			w := api.NewWrapper(cl)
 			var id openapi_types.UUID
 			if err := id.UnmarshalText([]byte(idv.String())); err != nil {
 				return err
 			}
-			resp, err := w.DownloadFile(ctx, id)
+			var cm *cache.Manager
+			if cfg.Cache.Enabled {
+				if cm, err = newCache(cfg); err != nil {
+					// Без кеша файл по-прежнему можно скачать с сервера.
+					log.Warn("cache unavailable", zap.Error(err))
+					cm = nil
+				} else {
+					defer func() { _ = cm.Close() }()
+				}
+			}
+			body, err := cachedFile(cm, id.String(), noCache)
 			if err != nil {
-				return err
+				log.Warn("cached file discarded", zap.String("id", id.String()), zap.Error(err))
+			}
+			if body != nil {
+				_, _ = fmt.Fprintln(cmd.ErrOrStderr(), "файл из кеша")
+			} else {
+				store, err := newStore(cfg)
+				if err != nil {
+					return err
+				}
+				cl, err := api.New(cfg, log, store)
+				if err != nil {
+					return err
+				}
+				resp, err := api.NewWrapper(cl).DownloadFile(ctx, id)
+				if err != nil {
+					return err
+				}
+				body = resp.Body
+				if cm != nil {
+					if _, err := cm.PutBlob(id.String(), body); err != nil && !errors.Is(err, cache.ErrUnsupported) {
+						log.Warn("cache file failed", zap.Error(err))
+					}
+				}
 			}
-			total := len(resp.Body)
+			total := len(body)
 			chunk := 64 * 1024
 			var written int
 			f, err := os.OpenFile(out, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
@@ -141,7 +168,7 @@ func newFilesDownloadCmd() *cobra.Command {
 				if end > total {
 					end = total
 				}
-				n, werr := f.Write(resp.Body[i:end])
+				n, werr := f.Write(body[i:end])
 				if werr != nil {
 					return werr
 				}
@@ -155,9 +182,26 @@ func newFilesDownloadCmd() *cobra.Command {
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&noCache, "no-cache", false, "Скачать файл с сервера, даже если он есть в кеше")
 	return cmd
 }
 
+// Ошибка — только о повреждённом файле; прочие промахи означают скачивание
+// с сервера.
+func cachedFile(cm *cache.Manager, id string, noCache bool) ([]byte, error) {
+	if cm == nil || noCache {
+		return nil, nil
+	}
+	data, updatedAt, err := cm.GetBlob(id)
+	if errors.Is(err, cache.ErrBlobCorrupt) {
+		return nil, err
+	}
+	if err != nil || !cm.IsFresh(updatedAt) {
+		return nil, nil
+	}
+	return data, nil
+}
+
 func buildPresignedMultipartWithProgress(file io.Reader, filename string, total int64, fields map[string]string, out io.Writer) (io.Reader, string, error) {
 	pr, pw := io.Pipe()
 	w := multipart.NewWriter(pw)
@@ -2,6 +2,11 @@ package cli
 
 import (
 	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -28,3 +33,39 @@ func TestUploadRequiresPath(t *testing.T) {
 		t.Fatal("expected error")
 	}
 }
+
+func TestCLI_DownloadServedFromBlobCache(t *testing.T) {
+	dir, run := cacheCLI(t)
+	var requests atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/files/", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte("file-content"))
+	})
+	srv := httptest.NewServer(mux)
+	id := "00000000-0000-0000-0000-000000000001"
+	out := filepath.Join(dir, "out.bin")
+
+	res, err := run("", "--server", srv.URL, "--ca-cert-path=", "download", id, out)
+	require.NoError(t, err)
+	require.NotContains(t, res, "файл из кеша")
+	require.Equal(t, int32(1), requests.Load())
+
+	res, err = run("", "--server", srv.URL, "--ca-cert-path=", "download", id, out)
+	require.NoError(t, err)
+	require.Contains(t, res, "файл из кеша")
+	require.Equal(t, int32(1), requests.Load())
+
+	_, err = run("", "--server", srv.URL, "--ca-cert-path=", "download", "--no-cache", id, out)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), requests.Load())
+
+	srv.Close()
+	require.NoError(t, os.Remove(out))
+	res, err = run("", "--server", srv.URL, "--ca-cert-path=", "download", id, out)
+	require.NoError(t, err)
+	require.Contains(t, res, "файл из кеша")
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, "file-content", string(data))
+}
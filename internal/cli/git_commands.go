@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/gitcred"
+)
+
+func AttachGitCommands(root *cobra.Command) {
+	root.AddCommand(newGitCredentialCmd())
+}
+
+func newGitCredentialCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:       "git-credential [get|store|erase]",
+		Short:     "Git credential helper на базе хранилища",
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"get", "store", "erase"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req, err := gitcred.ParseRequest(cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			switch args[0] {
+			case "get", "store", "erase":
+			default:
+				// git игнорирует неизвестные операции helper'а
+				return nil
+			}
+			ctx := cmd.Context()
+			svc, _, closeFn, err := newItemsService(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeFn()
+			h := gitcred.NewHelper(svc)
+			switch args[0] {
+			case "get":
+				return h.Get(ctx, req, cmd.OutOrStdout())
+			case "store":
+				return h.Store(ctx, req)
+			default:
+				return h.Erase(ctx, req)
+			}
+		},
+	}
+}
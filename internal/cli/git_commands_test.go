@@ -0,0 +1,28 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttachGitCommands(t *testing.T) {
+	root := NewRootCmd("", "", "")
+	names := make([]string, 0, len(root.Commands()))
+	for _, c := range root.Commands() {
+		names = append(names, c.Name())
+	}
+	require.Contains(t, names, "git-credential")
+}
+
+func TestGitCredentialRejectsMalformedInput(t *testing.T) {
+	cmd := NewRootCmd("dev", "none", "2025-01-01")
+	var buf bytes.Buffer
+	cmd.SetOut(&buf)
+	cmd.SetErr(&buf)
+	cmd.SetIn(strings.NewReader("garbage\n"))
+	cmd.SetArgs([]string{"--ca-cert-path=", "git-credential", "get"})
+	require.Error(t, cmd.Execute())
+}
@@ -20,6 +20,7 @@ func TestCLI_ItemsList_And_FilesDownload(t *testing.T) {
 	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
 	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
 	t.Setenv("SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", "sufir-keeper-client")
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
 	cfgPath := filepath.Join(dir, "cfg.json")
 	if err := os.WriteFile(cfgPath, []byte("{}"), 0o600); err != nil {
 		t.Fatal(err)
@@ -58,6 +59,7 @@ func TestCLI_ItemsListWithFlags(t *testing.T) {
 	defer srv.Close()
 	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
 	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
 	t.Setenv("SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", "sufir-keeper-client")
 	cfgPath := filepath.Join(dir, "cfg.json")
 	if err := os.WriteFile(cfgPath, []byte("{}"), 0o600); err != nil {
@@ -87,6 +89,7 @@ func TestCLI_ItemsCreateUpdateDelete(t *testing.T) {
 	defer srv.Close()
 	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
 	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
 	t.Setenv("SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", "sufir-keeper-client")
 	cfgPath := filepath.Join(dir, "cfg.json")
 	if err := os.WriteFile(cfgPath, []byte("{}"), 0o600); err != nil {
@@ -141,6 +144,7 @@ func TestCLI_ItemsCreateUnauthorized(t *testing.T) {
 	defer srv.Close()
 	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
 	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
 	t.Setenv("SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", "sufir-keeper-client")
 	cfgPath := filepath.Join(dir, "cfg.json")
 	if err := os.WriteFile(cfgPath, []byte("{}"), 0o600); err != nil {
@@ -172,6 +176,7 @@ func TestCLI_ItemsUpdateUnauthorized(t *testing.T) {
 	defer srv.Close()
 	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
 	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
 	t.Setenv("SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", "sufir-keeper-client")
 	cfgPath := filepath.Join(dir, "cfg.json")
 	if err := os.WriteFile(cfgPath, []byte("{}"), 0o600); err != nil {
@@ -203,6 +208,7 @@ func TestCLI_ItemsDeleteUnauthorized(t *testing.T) {
 	defer srv.Close()
 	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
 	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
 	t.Setenv("SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", "sufir-keeper-client")
 	cfgPath := filepath.Join(dir, "cfg.json")
 	if err := os.WriteFile(cfgPath, []byte("{}"), 0o600); err != nil {
@@ -225,6 +231,7 @@ func TestCLI_UpdateTextWithMeta(t *testing.T) {
 	defer srv.Close()
 	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
 	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
 	t.Setenv("SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", "sufir-keeper-client")
 	cfgPath := filepath.Join(dir, "cfg.json")
 	if err := os.WriteFile(cfgPath, []byte("{}"), 0o600); err != nil {
@@ -246,6 +253,7 @@ func TestCLI_ItemsGet(t *testing.T) {
 	defer srv.Close()
 	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
 	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
 	t.Setenv("SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", "sufir-keeper-client")
 	cfgPath := filepath.Join(dir, "cfg.json")
 	if err := os.WriteFile(cfgPath, []byte("{}"), 0o600); err != nil {
@@ -276,6 +284,7 @@ func TestCLI_ItemsGetUnauthorized(t *testing.T) {
 	defer srv.Close()
 	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
 	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
 	t.Setenv("SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", "sufir-keeper-client")
 	cfgPath := filepath.Join(dir, "cfg.json")
 	if err := os.WriteFile(cfgPath, []byte("{}"), 0o600); err != nil {
@@ -298,6 +307,7 @@ func TestCLI_FilesUpload(t *testing.T) {
 	defer srv.Close()
 	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
 	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
 	t.Setenv("SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", "sufir-keeper-client")
 	cfgPath := filepath.Join(dir, "cfg.json")
 	if err := os.WriteFile(cfgPath, []byte("{}"), 0o600); err != nil {
@@ -330,6 +340,7 @@ func TestCLI_DownloadUnauthorized(t *testing.T) {
 	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
 	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
 	t.Setenv("SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", "sufir-keeper-client")
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
 	cfgPath := filepath.Join(dir, "cfg.json")
 	if err := os.WriteFile(cfgPath, []byte("{}"), 0o600); err != nil {
 		t.Fatal(err)
@@ -372,6 +383,7 @@ func TestCLI_UploadError(t *testing.T) {
 	defer srv.Close()
 	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
 	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
 	t.Setenv("SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", "sufir-keeper-client")
 	cfgPath := filepath.Join(dir, "cfg.json")
 	if err := os.WriteFile(cfgPath, []byte("{}"), 0o600); err != nil {
@@ -471,6 +483,7 @@ func TestCLI_AuthLoginStatusLogout(t *testing.T) {
 	defer srv.Close()
 	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
 	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
 	t.Setenv("SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", "sufir-keeper-client")
 	cfgPath := filepath.Join(dir, "cfg.json")
 	if err := os.WriteFile(cfgPath, []byte("{}"), 0o600); err != nil {
@@ -14,6 +14,7 @@ func TestCLI_CreateTypes_Credential_Card_Binary(t *testing.T) {
 	defer srv.Close()
 	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
 	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
 	t.Setenv("SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", "sufir-keeper-client")
 
 	// login first
@@ -81,6 +82,7 @@ func TestCLI_UpdateTypes_Credential_Card_Binary(t *testing.T) {
 	defer srv.Close()
 	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
 	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
 	t.Setenv("SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", "sufir-keeper-client")
 
 	id := "00000000-0000-0000-0000-000000000001"
@@ -1,8 +1,16 @@
 package cli
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -11,13 +19,16 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
+	"go.uber.org/zap"
 
 	openapi_types "github.com/oapi-codegen/runtime/types"
 
 	"github.com/GoLessons/sufir-keeper-client/internal/api"
 	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/cache"
 	"github.com/GoLessons/sufir-keeper-client/internal/config"
 	"github.com/GoLessons/sufir-keeper-client/internal/logging"
+	"github.com/GoLessons/sufir-keeper-client/internal/replica"
 	"github.com/GoLessons/sufir-keeper-client/internal/service"
 )
 
@@ -33,6 +44,7 @@ func AttachItemsCommands(root *cobra.Command) {
 	root.AddCommand(newItemsGetCmd())
 	root.AddCommand(newItemsCreateCmd())
 	root.AddCommand(newItemsUpdateCmd())
+	root.AddCommand(newItemsEditCmd())
 	root.AddCommand(newItemsDeleteCmd())
 }
 
@@ -42,23 +54,11 @@ func newItemsListCmd() *cobra.Command {
 		Short: "Список записей",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
-			cfg := ctx.Value(cfgContextKey).(config.Config)
-			log := ctx.Value(logContextKey).(logging.Logger)
-			store, err := newStore(cfg)
+			svc, _, closeFn, err := newItemsService(cmd)
 			if err != nil {
 				return err
 			}
-			cl, err := api.New(cfg, log, store)
-			if err != nil {
-				return err
-			}
-			cm, cerr := newCache(cfg)
-			if cerr != nil {
-				return cerr
-			}
-			defer func() { _ = cm.Close() }()
-			w := api.NewWrapper(cl)
-			svc := service.NewItemsService(w, cm, cfg)
+			defer closeFn()
 			var params apigen.GetItemsParams
 			if s := strings.TrimSpace(cmd.Flag("search").Value.String()); s != "" {
 				params.S = &s
@@ -77,10 +77,17 @@ func newItemsListCmd() *cobra.Command {
 					params.Offset = &n
 				}
 			}
-			resp, err := svc.List(ctx, &params)
+			list := svc.List
+			if local, _ := cmd.Flags().GetBool("local"); local {
+				list = func(_ context.Context, p *apigen.GetItemsParams) (*apigen.GetItemsResponse, error) {
+					return svc.SearchLocal(p)
+				}
+			}
+			resp, err := list(ctx, &params)
 			if err != nil {
 				return err
 			}
+			printSource(cmd, resp.HTTPResponse)
 			if resp.JSON200 != nil && resp.JSON200.Items != nil {
 				tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
 				_, _ = fmt.Fprintln(tw, "ID\tTitle\tCreatedAt\tUpdatedAt\tMeta")
@@ -113,6 +120,7 @@ func newItemsListCmd() *cobra.Command {
 	cmd.Flags().String("type", "", "Тип записи: TEXT|CREDENTIAL|CARD|BINARY")
 	cmd.Flags().Int("limit", 0, "Лимит")
 	cmd.Flags().Int("offset", 0, "Смещение")
+	cmd.Flags().Bool("local", false, "Искать (--search) по локальному индексу без обращения к серверу")
 	return cmd
 }
 
@@ -127,23 +135,11 @@ func newItemsGetCmd() *cobra.Command {
 				return errors.New("некорректный UUID")
 			}
 			ctx := cmd.Context()
-			cfg := ctx.Value(cfgContextKey).(config.Config)
-			log := ctx.Value(logContextKey).(logging.Logger)
-			store, err := newStore(cfg)
+			svc, _, closeFn, err := newItemsService(cmd)
 			if err != nil {
 				return err
 			}
-			cl, err := api.New(cfg, log, store)
-			if err != nil {
-				return err
-			}
-			cm, cerr := newCache(cfg)
-			if cerr != nil {
-				return cerr
-			}
-			defer func() { _ = cm.Close() }()
-			w := api.NewWrapper(cl)
-			svc := service.NewItemsService(w, cm, cfg)
+			defer closeFn()
 			var id openapi_types.UUID
 			if err := id.UnmarshalText([]byte(idv.String())); err != nil {
 				return err
@@ -152,6 +148,7 @@ func newItemsGetCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			printSource(cmd, resp.HTTPResponse)
 			if resp.JSON200 != nil {
 				tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
 				idText := ""
@@ -195,6 +192,9 @@ func newItemsGetCmd() *cobra.Command {
 				_, _ = fmt.Fprintf(tw, "Meta\t%s\n", metaText)
 				_, _ = fmt.Fprintf(tw, "CreatedAt\t%s\n", createdAtText)
 				_, _ = fmt.Fprintf(tw, "UpdatedAt\t%s\n", updatedAtText)
+				if etag := service.VersionOf(resp).ETag; etag != "" {
+					_, _ = fmt.Fprintf(tw, "ETag\t%s\n", etag)
+				}
 				_ = tw.Flush()
 			}
 			return nil
@@ -268,27 +268,18 @@ func newItemsCreateCmd() *cobra.Command {
 				body.Meta = &meta
 			}
 			ctx := cmd.Context()
-			cfg := ctx.Value(cfgContextKey).(config.Config)
-			log := ctx.Value(logContextKey).(logging.Logger)
-			store, err := newStore(cfg)
+			svc, _, closeFn, err := newItemsService(cmd)
 			if err != nil {
 				return err
 			}
-			cl, err := api.New(cfg, log, store)
-			if err != nil {
-				return err
-			}
-			cm, cerr := newCache(cfg)
-			if cerr != nil {
-				return cerr
-			}
-			defer func() { _ = cm.Close() }()
-			w := api.NewWrapper(cl)
-			svc := service.NewItemsService(w, cm, cfg)
+			defer closeFn()
 			resp, err := svc.Create(ctx, body)
 			if err != nil {
 				return err
 			}
+			if service.Queued(resp) {
+				printQueued(cmd)
+			}
 			if resp.JSON201 != nil && resp.JSON201.Id != nil {
 				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s\n", resp.JSON201.Id.String())
 			} else {
@@ -443,37 +434,21 @@ func newItemsUpdateCmd() *cobra.Command {
 				}
 				body = u
 			}
-			ctx := cmd.Context()
-			cfg := ctx.Value(cfgContextKey).(config.Config)
-			log := ctx.Value(logContextKey).(logging.Logger)
-			store, err := newStore(cfg)
+			svc, _, closeFn, err := newItemsService(cmd)
 			if err != nil {
 				return err
 			}
-			cl, err := api.New(cfg, log, store)
-			if err != nil {
-				return err
-			}
-			cm, cerr := newCache(cfg)
-			if cerr != nil {
-				return cerr
-			}
-			defer func() { _ = cm.Close() }()
-			w := api.NewWrapper(cl)
-			svc := service.NewItemsService(w, cm, cfg)
+			defer closeFn()
 			var id openapi_types.UUID
 			if err := id.UnmarshalText([]byte(idv.String())); err != nil {
 				return err
 			}
-			resp, err := svc.Update(ctx, id, body)
+			ifMatch, _ := cmd.Flags().GetString("if-match")
+			resp, err := updateChecked(cmd, svc, id, versionFromFlag(ifMatch), body)
 			if err != nil {
 				return err
 			}
-			if resp.JSON200 != nil && resp.JSON200.Id != nil {
-				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s\n", resp.JSON200.Id.String())
-			} else {
-				_, _ = cmd.OutOrStdout().Write([]byte("OK\n"))
-			}
+			printUpdated(cmd, resp)
 			return nil
 		},
 	}
@@ -489,45 +464,284 @@ func newItemsUpdateCmd() *cobra.Command {
 	cmd.Flags().String("filename", "", "Имя файла для BINARY")
 	cmd.Flags().String("binary-id", "", "UUID файла для BINARY")
 	cmd.Flags().String("meta", "", "Метаданные key=value через запятую")
+	cmd.Flags().String("if-match", "", "Версия записи (UpdatedAt или ETag из get), поверх которой делается изменение; без флага запись перезаписывается без проверки, используйте edit")
 	return cmd
 }
 
-func newItemsDeleteCmd() *cobra.Command {
+// editDoc — запись в том виде, в каком её правит пользователь в edit.
+type editDoc struct {
+	Title string            `json:"title"`
+	Meta  map[string]string `json:"meta,omitempty"`
+	Data  json.RawMessage   `json:"data,omitempty"`
+}
+
+func newItemsEditCmd() *cobra.Command {
 	return &cobra.Command{
-		Use:   "delete [id]",
-		Short: "Удалить запись",
+		Use:   "edit [id]",
+		Short: "Изменить запись в редакторе ($VISUAL, $EDITOR)",
+		Long:  "Открывает запись в редакторе как JSON и сохраняет изменения, только если запись не изменили на сервере после чтения.",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			idv, err := uuid.Parse(args[0])
 			if err != nil {
 				return errors.New("некорректный UUID")
 			}
-			ctx := cmd.Context()
-			cfg := ctx.Value(cfgContextKey).(config.Config)
-			log := ctx.Value(logContextKey).(logging.Logger)
-			store, err := newStore(cfg)
+			svc, _, closeFn, err := newItemsService(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeFn()
+			var id openapi_types.UUID
+			if err := id.UnmarshalText([]byte(idv.String())); err != nil {
+				return err
+			}
+			base, err := svc.Get(service.WithReadPolicy(cmd.Context(), service.NetworkFirst), id)
 			if err != nil {
 				return err
 			}
-			cl, err := api.New(cfg, log, store)
+			if base.JSON200 == nil {
+				return errors.New("сервер не вернул запись")
+			}
+			before, err := editDocOf(base.JSON200)
+			if err != nil {
+				return err
+			}
+			after, err := editInEditor(cmd, before)
+			if err != nil {
+				return err
+			}
+			body, changed, err := editUpdate(before, after)
 			if err != nil {
 				return err
 			}
-			cm, cerr := newCache(cfg)
-			if cerr != nil {
-				return cerr
+			if !changed {
+				_, _ = fmt.Fprintln(cmd.ErrOrStderr(), "изменений нет")
+				return nil
+			}
+			resp, err := updateChecked(cmd, svc, id, base, body)
+			if err != nil {
+				return err
 			}
-			defer func() { _ = cm.Close() }()
-			w := api.NewWrapper(cl)
-			svc := service.NewItemsService(w, cm, cfg)
+			printUpdated(cmd, resp)
+			return nil
+		},
+	}
+}
+
+func editDocOf(it *apigen.ItemResponse) (editDoc, error) {
+	var doc editDoc
+	if it.Title != nil {
+		doc.Title = *it.Title
+	}
+	if it.Meta != nil {
+		doc.Meta = *it.Meta
+	}
+	if it.Data != nil {
+		raw, err := it.Data.MarshalJSON()
+		if err != nil {
+			return doc, err
+		}
+		doc.Data = raw
+	}
+	return doc, nil
+}
+
+// Временный файл доступен только владельцу.
+func editInEditor(cmd *cobra.Command, doc editDoc) (editDoc, error) {
+	raw, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return doc, err
+	}
+	f, err := os.CreateTemp("", "keepcli-edit-*.json")
+	if err != nil {
+		return doc, err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	_, err = f.Write(append(raw, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return doc, err
+	}
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	argv := strings.Fields(editor)
+	e := exec.CommandContext(cmd.Context(), argv[0], append(argv[1:], f.Name())...)
+	e.Stdin, e.Stdout, e.Stderr = os.Stdin, cmd.OutOrStdout(), cmd.ErrOrStderr()
+	if err := e.Run(); err != nil {
+		return doc, fmt.Errorf("редактор %s: %w", argv[0], err)
+	}
+	raw, err = os.ReadFile(f.Name())
+	if err != nil {
+		return doc, err
+	}
+	var out editDoc
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return doc, fmt.Errorf("некорректный JSON после редактирования: %w", err)
+	}
+	return out, nil
+}
+
+// editUpdate отправляет только изменённые поля.
+func editUpdate(before, after editDoc) (apigen.ItemUpdate, bool, error) {
+	var u apigen.ItemUpdate
+	changed := false
+	if after.Title != before.Title {
+		if strings.TrimSpace(after.Title) == "" {
+			return u, false, errors.New("title не может быть пустым")
+		}
+		u.Title = &after.Title
+		changed = true
+	}
+	if !reflect.DeepEqual(after.Meta, before.Meta) && (len(after.Meta) > 0 || len(before.Meta) > 0) {
+		meta := after.Meta
+		if meta == nil {
+			meta = map[string]string{}
+		}
+		u.Meta = &meta
+		changed = true
+	}
+	if len(after.Data) == 0 && len(before.Data) > 0 {
+		return u, false, errors.New("data не может быть пустым")
+	}
+	same, err := sameJSON(before.Data, after.Data)
+	if err != nil {
+		return u, false, err
+	}
+	if !same {
+		var d apigen.ItemUpdate_Data
+		if err := d.UnmarshalJSON(after.Data); err != nil {
+			return u, false, err
+		}
+		u.Data = &d
+		changed = true
+	}
+	return u, changed, nil
+}
+
+func sameJSON(a, b json.RawMessage) (bool, error) {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b), nil
+	}
+	var va, vb any
+	if err := json.Unmarshal(a, &va); err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(va, vb), nil
+}
+
+// Содержимое записи на момент чтения неизвестно: колонка Base при конфликте пуста.
+func versionFromFlag(ifMatch string) *apigen.GetItemResponse {
+	ifMatch = strings.TrimSpace(ifMatch)
+	if ifMatch == "" {
+		return nil
+	}
+	item := apigen.ItemResponse{}
+	base := &apigen.GetItemResponse{JSON200: &item}
+	if t, err := time.Parse(time.RFC3339Nano, ifMatch); err == nil {
+		item.UpdatedAt = &t
+	} else {
+		base.HTTPResponse = &http.Response{Header: http.Header{"Etag": []string{ifMatch}}}
+	}
+	return base
+}
+
+func printUpdated(cmd *cobra.Command, resp *apigen.UpdateItemResponse) {
+	if service.Queued(resp) {
+		printQueued(cmd)
+	}
+	if resp.JSON200 != nil && resp.JSON200.Id != nil {
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s\n", resp.JSON200.Id.String())
+	} else {
+		_, _ = cmd.OutOrStdout().Write([]byte("OK\n"))
+	}
+}
+
+// Без base запись перезаписывается без проверки.
+func updateChecked(cmd *cobra.Command, svc *service.ItemsService, id openapi_types.UUID, base *apigen.GetItemResponse, body apigen.ItemUpdate) (*apigen.UpdateItemResponse, error) {
+	ctx := service.WithReadPolicy(cmd.Context(), service.NetworkFirst)
+	in := bufio.NewReader(cmd.InOrStdin())
+	out := cmd.ErrOrStderr()
+	for {
+		resp, err := svc.UpdateFrom(ctx, id, base, body)
+		var ce *service.ConflictError
+		if !errors.As(err, &ce) {
+			return resp, err
+		}
+		printConflict(out, id, ce)
+		if ce.Current == nil {
+			return nil, err
+		}
+		if !askYes(cmd, in, "Применить изменения поверх текущей версии?") {
+			return nil, err
+		}
+		base = ce.Current
+	}
+}
+
+// askYes задаёт вопрос в stderr и ждёт ответа y/yes/д/да.
+func askYes(cmd *cobra.Command, in *bufio.Reader, question string) bool {
+	_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "%s [y/N]: ", question)
+	line, err := in.ReadString('\n')
+	if err != nil && line == "" {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes", "д", "да":
+		return true
+	}
+	return false
+}
+
+func printConflict(w io.Writer, id openapi_types.UUID, ce *service.ConflictError) {
+	_, _ = fmt.Fprintf(w, "Конфликт: запись %s изменена на сервере после чтения\n", id.String())
+	if ce.Remote == nil {
+		_, _ = fmt.Fprintln(w, "Запись удалена на сервере")
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "Field\tBase\tLocal\tRemote")
+	for _, d := range ce.Diff() {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", d.Field, d.Base, d.Local, d.Remote)
+	}
+	_ = tw.Flush()
+}
+
+func newItemsDeleteCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete [id]",
+		Short: "Удалить запись",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			idv, err := uuid.Parse(args[0])
+			if err != nil {
+				return errors.New("некорректный UUID")
+			}
+			ctx := cmd.Context()
+			svc, _, closeFn, err := newItemsService(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeFn()
 			var id openapi_types.UUID
 			if err := id.UnmarshalText([]byte(idv.String())); err != nil {
 				return err
 			}
-			_, err = svc.Delete(ctx, id)
+			resp, err := svc.Delete(ctx, id)
 			if err != nil {
 				return err
 			}
+			if service.Queued(resp) {
+				printQueued(cmd)
+			}
 			_, _ = cmd.OutOrStdout().Write([]byte("OK\n"))
 			return nil
 		},
@@ -597,3 +811,98 @@ func detectItemTypeAndFields(data *apigen.ItemResponse_Data) (string, map[string
 	}
 	return "", nil
 }
+
+func newItemsService(cmd *cobra.Command) (*service.ItemsService, *api.Wrapper, func(), error) {
+	svc, w, closeFn, err := newRawItemsService(cmd)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	sealer, err := loadSealer(cmd.Context().Value(cfgContextKey).(config.Config))
+	if err != nil {
+		closeFn()
+		return nil, nil, nil, err
+	}
+	if sealer != nil {
+		svc.SetSealer(sealer)
+	}
+	return svc, w, closeFn, nil
+}
+
+// newRawItemsService не подключает e2e-шифрование; нужен командам e2e,
+// которые работают с ключами до их разблокировки.
+func newRawItemsService(cmd *cobra.Command) (*service.ItemsService, *api.Wrapper, func(), error) {
+	cfg := cmd.Context().Value(cfgContextKey).(config.Config)
+	policy, err := service.ParseReadPolicy(cfg.Cache.ReadPolicy)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	w, cm, err := newWrapperAndCache(cmd)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if cfg.Sync.Offline {
+		// Реплика локальна, поэтому режим чтения к ней не применяется.
+		offline := cfg
+		offline.Cache.Enabled = false
+		offline.Cache.ReadPolicy = ""
+		return service.NewItemsService(replica.New(cm), cm, offline), w, func() { _ = cm.Close() }, nil
+	}
+	svc := service.NewItemsService(w, cm, cfg)
+	svc.SetReadPolicy(policy)
+	closeFn := func() {
+		svc.Wait()
+		_ = cm.Close()
+	}
+	if cfg.Outbox.Enabled && policy != service.CacheOnly {
+		n, err := svc.TryFlushOutbox(cmd.Context())
+		if n > 0 {
+			_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "отправлено отложенных операций: %d\n", n)
+		}
+		if errors.Is(err, service.ErrOutboxRejected) {
+			_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "%v (keepcli outbox list)\n", err)
+		} else if err != nil {
+			log := cmd.Context().Value(logContextKey).(logging.Logger)
+			log.Debug("outbox flush failed", zap.Error(err))
+		}
+	}
+	return svc, w, closeFn, nil
+}
+
+func printSource(cmd *cobra.Command, resp *http.Response) {
+	src := service.SourceOf(resp)
+	if src.Index {
+		_, _ = fmt.Fprintln(cmd.ErrOrStderr(), "результаты локального поиска по кешу")
+		return
+	}
+	if !src.Cached {
+		return
+	}
+	note := fmt.Sprintf("данные из кеша, возраст %s", src.Age.Round(time.Second))
+	if src.Stale {
+		note += " (устарели)"
+	}
+	_, _ = fmt.Fprintln(cmd.ErrOrStderr(), note)
+}
+
+func printQueued(cmd *cobra.Command) {
+	_, _ = fmt.Fprintln(cmd.ErrOrStderr(), "сервер недоступен: операция поставлена в очередь (keepcli outbox list)")
+}
+
+func newWrapperAndCache(cmd *cobra.Command) (*api.Wrapper, *cache.Manager, error) {
+	ctx := cmd.Context()
+	cfg := ctx.Value(cfgContextKey).(config.Config)
+	log := ctx.Value(logContextKey).(logging.Logger)
+	store, err := newStore(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	cl, err := api.New(cfg, log, store)
+	if err != nil {
+		return nil, nil, err
+	}
+	cm, err := newCache(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return api.NewWrapper(cl), cm, nil
+}
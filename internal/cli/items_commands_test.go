@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// teammateServer хранит одну запись; сразу после первого чтения её меняет
+// другой пользователь.
+type teammateServer struct {
+	mu      sync.Mutex
+	item    map[string]any
+	version int
+	reads   int
+	ifMatch []string
+}
+
+func (s *teammateServer) etag() string {
+	return `"v` + string(rune('0'+s.version)) + `"`
+}
+
+func (s *teammateServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("ETag", s.etag())
+		_ = json.NewEncoder(w).Encode(s.item)
+		if s.reads++; s.reads == 1 {
+			s.version++
+			s.item["data"] = map[string]any{"type": "CREDENTIAL", "login": "bob", "password": "p-remote"}
+			s.item["updated_at"] = time.Date(2026, 1, 1, 10, 1, 0, 0, time.UTC).Format(time.RFC3339Nano)
+		}
+	case http.MethodPut:
+		s.ifMatch = append(s.ifMatch, r.Header.Get("If-Match"))
+		if r.Header.Get("If-Match") != s.etag() {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			_ = json.NewEncoder(w).Encode(map[string]any{"message": "version mismatch"})
+			return
+		}
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if t, ok := body["title"]; ok {
+			s.item["title"] = t
+		}
+		s.version++
+		_ = json.NewEncoder(w).Encode(s.item)
+	}
+}
+
+func TestCLI_EditDetectsChangeAfterRead(t *testing.T) {
+	dir := t.TempDir()
+	const id = "00000000-0000-0000-0000-000000000001"
+	ts := &teammateServer{version: 1, item: map[string]any{
+		"id":         id,
+		"title":      "db",
+		"data":       map[string]any{"type": "CREDENTIAL", "login": "bob", "password": "p1"},
+		"updated_at": time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC).Format(time.RFC3339Nano),
+	}}
+	srv := httptest.NewServer(ts)
+	defer srv.Close()
+	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
+	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
+	editor := filepath.Join(dir, "editor.sh")
+	require.NoError(t, os.WriteFile(editor, []byte("#!/bin/sh\nsed -i 's/\"title\": \"db\"/\"title\": \"db-local\"/' \"$1\"\n"), 0o700))
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", editor)
+	cfgPath := filepath.Join(dir, "cfg.json")
+	require.NoError(t, os.WriteFile(cfgPath, []byte("{}"), 0o600))
+
+	var buf bytes.Buffer
+	cmd := NewRootCmd("dev", "none", time.Now().Format(time.RFC3339))
+	cmd.SetOut(&buf)
+	cmd.SetErr(&buf)
+	cmd.SetIn(strings.NewReader("y\n"))
+	cmd.SetArgs([]string{"--config", cfgPath, "--server", srv.URL, "--ca-cert-path=", "edit", id})
+	require.NoError(t, cmd.ExecuteContext(context.Background()), buf.String())
+
+	out := buf.String()
+	require.Contains(t, out, "Конфликт")
+	rows := map[string][]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if f := strings.Fields(line); len(f) > 0 {
+			rows[f[0]] = f[1:]
+		}
+	}
+	require.Equal(t, []string{"db", "db-local", "db"}, rows["title"])
+	require.Equal(t, []string{"p1", "p1", "p-remote"}, rows["data.password"])
+	require.NotContains(t, rows, "data.login")
+	require.Equal(t, []string{`"v1"`, `"v2"`}, ts.ifMatch, "первая запись отправляется с версией на момент чтения")
+	require.Equal(t, "db-local", ts.item["title"])
+}
@@ -66,6 +66,9 @@ func TestCLI_CreateCardMissingFields(t *testing.T) {
 
 func TestCLI_ListInvalidParamsHandled(t *testing.T) {
 	dir := t.TempDir()
+	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
+	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
 	mux := http.NewServeMux()
 	mux.HandleFunc("/items", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
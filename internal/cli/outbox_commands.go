@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/config"
+	"github.com/GoLessons/sufir-keeper-client/internal/service"
+)
+
+func AttachOutboxCommands(root *cobra.Command) {
+	c := &cobra.Command{
+		Use:   "outbox",
+		Short: "Очередь операций, не отправленных на сервер",
+	}
+	c.AddCommand(newOutboxListCmd())
+	c.AddCommand(newOutboxRetryCmd())
+	c.AddCommand(newOutboxDropCmd())
+	root.AddCommand(c)
+}
+
+// newOutboxService не отправляет очередь при создании, в отличие от
+// newItemsService: командам outbox нужен её исходный вид.
+func newOutboxService(cmd *cobra.Command, online bool) (*service.ItemsService, func(), error) {
+	cfg := cmd.Context().Value(cfgContextKey).(config.Config)
+	if !online {
+		cm, err := newCache(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		return service.NewItemsService(nil, cm, cfg), func() { _ = cm.Close() }, nil
+	}
+	w, cm, err := newWrapperAndCache(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	return service.NewItemsService(w, cm, cfg), func() { _ = cm.Close() }, nil
+}
+
+func newOutboxListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "Показать отложенные операции",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, closeFn, err := newOutboxService(cmd, false)
+			if err != nil {
+				return err
+			}
+			defer closeFn()
+			ops, err := svc.Outbox()
+			if err != nil {
+				return err
+			}
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			_, _ = fmt.Fprintln(tw, "ID\tOp\tItem\tTitle\tCreatedAt\tAttempts\tState\tLastError")
+			for _, q := range ops {
+				title := ""
+				switch {
+				case q.Op.Create != nil:
+					title = q.Op.Create.Title
+				case q.Op.Update != nil && q.Op.Update.Title != nil:
+					title = *q.Op.Update.Title
+				}
+				state := "pending"
+				if q.Op.Rejected != "" {
+					state = "rejected"
+				}
+				_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", q.ID, q.Op.Kind, q.Op.ItemID, title, q.CreatedAt.Format(time.RFC3339), q.Attempts, state, q.LastError)
+			}
+			return tw.Flush()
+		},
+	}
+}
+
+func newOutboxRetryCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "retry",
+		Short: "Отправить отложенные операции на сервер",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, closeFn, err := newOutboxService(cmd, true)
+			if err != nil {
+				return err
+			}
+			defer closeFn()
+			n, err := svc.FlushOutbox(cmd.Context())
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "отправлено: %d\n", n)
+			if errors.Is(err, service.ErrOutboxRejected) {
+				return fmt.Errorf("%w: удалите их (keepcli outbox drop) и повторите изменения", err)
+			}
+			if err != nil {
+				return fmt.Errorf("очередь остановлена на ошибке: %w", err)
+			}
+			return nil
+		},
+	}
+}
+
+func newOutboxDropCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "drop [id]",
+		Short: "Удалить операцию из очереди без отправки",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			all, _ := cmd.Flags().GetBool("all")
+			if all == (len(args) == 1) {
+				return errors.New("укажите id операции или --all")
+			}
+			svc, closeFn, err := newOutboxService(cmd, false)
+			if err != nil {
+				return err
+			}
+			defer closeFn()
+			ops, err := svc.Outbox()
+			if err != nil {
+				return err
+			}
+			var ids []string
+			for _, q := range ops {
+				if all || q.ID == args[0] {
+					ids = append(ids, q.ID)
+				}
+			}
+			if !all && len(ids) == 0 {
+				return fmt.Errorf("операция %s не найдена в очереди", args[0])
+			}
+			for _, id := range ids {
+				if err := svc.DropOutbox(id); err != nil {
+					return err
+				}
+			}
+			svc.InvalidateCache()
+			_, _ = cmd.OutOrStdout().Write([]byte("OK\n"))
+			return nil
+		},
+	}
+	cmd.Flags().Bool("all", false, "Очистить всю очередь")
+	return cmd
+}
@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCLI_OutboxQueuesWhenServerIsDown(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
+	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
+	t.Setenv("SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", "sufir-keeper-client")
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
+	t.Setenv("SUFIR_KEEPER_AGENT_DISABLED", "true")
+	t.Setenv("SUFIR_KEEPER_OUTBOX_ENABLED", "true")
+	cfgPath := filepath.Join(dir, "cfg.json")
+	require.NoError(t, os.WriteFile(cfgPath, []byte("{}"), 0o600))
+
+	run := func(args ...string) (string, error) {
+		cmd := NewRootCmd("dev", "none", "2025-01-01")
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs(append([]string{"--config", cfgPath, "--server", "http://127.0.0.1:1", "--ca-cert-path=", "--log-level", "info"}, args...))
+		err := cmd.ExecuteContext(context.Background())
+		return buf.String(), err
+	}
+
+	out, err := run("create", "--title", "queued-note", "--value", "v")
+	require.NoError(t, err)
+	require.Contains(t, out, "очередь")
+
+	out, err = run("list")
+	require.NoError(t, err)
+	require.Contains(t, out, "queued-note")
+
+	out, err = run("outbox", "list")
+	require.NoError(t, err)
+	require.Contains(t, out, "create")
+	require.Contains(t, out, "queued-note")
+
+	_, err = run("outbox", "retry")
+	require.Error(t, err)
+	_, err = run("outbox", "drop")
+	require.Error(t, err)
+
+	_, err = run("outbox", "drop", "--all")
+	require.NoError(t, err)
+	out, err = run("outbox", "list")
+	require.NoError(t, err)
+	require.NotContains(t, out, "queued-note")
+}
@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/config"
+)
+
+func AttachProfileCommands(root *cobra.Command) {
+	c := &cobra.Command{
+		Use:   "profile",
+		Short: "Профили: именованные наборы сервера, CA, keyring и кеша",
+	}
+	c.AddCommand(newProfileListCmd())
+	c.AddCommand(newProfileAddCmd())
+	c.AddCommand(newProfileUseCmd())
+	c.AddCommand(newProfileRemoveCmd())
+	root.AddCommand(c)
+}
+
+func configFile(cmd *cobra.Command) (*config.File, config.Config, error) {
+	cfg := cmd.Context().Value(cfgContextKey).(config.Config)
+	f, err := config.ReadFile(cfg.ConfigFile)
+	return f, cfg, err
+}
+
+func newProfileListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "Показать профили; * — выбранный",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, cfg, err := configFile(cmd)
+			if err != nil {
+				return err
+			}
+			names := f.Profiles()
+			if len(names) == 0 {
+				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "профилей нет; добавьте: keepcli profile add NAME --base-url URL\n")
+				return nil
+			}
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			_, _ = fmt.Fprintln(tw, "\tName\tServer")
+			for _, name := range names {
+				mark := ""
+				if name == cfg.Profile {
+					mark = "*"
+				}
+				p, _ := f.Profile(name)
+				_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", mark, name, p["server.base_url"])
+			}
+			return tw.Flush()
+		},
+	}
+}
+
+func newProfileAddCmd() *cobra.Command {
+	var baseURL, caCert, service, cachePath string
+	var use bool
+	c := &cobra.Command{
+		Use:   "add NAME",
+		Short: "Добавить профиль",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			if err := config.ValidateProfileName(name); err != nil {
+				return err
+			}
+			f, _, err := configFile(cmd)
+			if err != nil {
+				return err
+			}
+			if _, ok := f.Profile(name); ok {
+				return fmt.Errorf("профиль %s уже существует", name)
+			}
+			f.SetProfile(name, map[string]string{
+				"server.base_url":          baseURL,
+				"tls.ca_cert_path":         caCert,
+				"auth.token_store_service": service,
+				"cache.path":               cachePath,
+			})
+			if use {
+				f.SetCurrentProfile(name)
+			}
+			if err := f.Write(); err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "профиль %s добавлен в %s\n", name, f.Path())
+			return nil
+		},
+	}
+	c.Flags().StringVar(&baseURL, "base-url", "", "адрес сервера API")
+	c.Flags().StringVar(&caCert, "ca-cert", "", "путь к CA сертификату сервера")
+	c.Flags().StringVar(&service, "keyring-service", "", "имя сервиса keyring для токенов (по умолчанию общее с суффиксом профиля)")
+	c.Flags().StringVar(&cachePath, "cache-path", "", "путь к файлу кеша (по умолчанию каталог profiles/NAME рядом с общим)")
+	c.Flags().BoolVar(&use, "use", false, "сразу выбрать профиль")
+	_ = c.MarkFlagRequired("base-url")
+	return c
+}
+
+func newProfileUseCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "use NAME",
+		Short: "Выбрать профиль для следующих команд",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, _, err := configFile(cmd)
+			if err != nil {
+				return err
+			}
+			if _, ok := f.Profile(args[0]); !ok {
+				return fmt.Errorf("%w: %s", config.ErrUnknownProfile, args[0])
+			}
+			f.SetCurrentProfile(args[0])
+			if err := f.Write(); err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "выбран профиль %s\n", args[0])
+			return nil
+		},
+	}
+}
+
+func newProfileRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove NAME",
+		Short: "Удалить профиль (токены и кеш профиля удаляет logout)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, _, err := configFile(cmd)
+			if err != nil {
+				return err
+			}
+			if !f.RemoveProfile(args[0]) {
+				return fmt.Errorf("%w: %s", config.ErrUnknownProfile, args[0])
+			}
+			if err := f.Write(); err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "профиль %s удалён\n", args[0])
+			return nil
+		},
+	}
+}
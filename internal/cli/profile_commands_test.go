@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/config"
+)
+
+func TestCLI_Profiles(t *testing.T) {
+	dir, run := cacheCLI(t)
+
+	out, err := run("", "profile", "list")
+	require.NoError(t, err)
+	require.Contains(t, out, "профилей нет")
+
+	_, err = run("", "profile", "add", "Dev", "--base-url", "https://dev.example/api/v1")
+	require.ErrorContains(t, err, "недопустимое имя профиля")
+	_, err = run("", "profile", "add", "dev", "--base-url", "https://dev.example/api/v1")
+	require.NoError(t, err)
+	_, err = run("", "profile", "add", "prod", "--base-url", "https://prod.example/api/v1", "--use")
+	require.NoError(t, err)
+	_, err = run("", "profile", "add", "dev", "--base-url", "https://x.example")
+	require.ErrorContains(t, err, "уже существует")
+
+	out, err = run("", "profile", "list")
+	require.NoError(t, err)
+	require.Regexp(t, `\*\s+prod\s+https://prod.example/api/v1`, out)
+	require.Regexp(t, `\n\s+dev\s+https://dev.example/api/v1`, out)
+
+	_, err = run("", "profile", "use", "dev")
+	require.NoError(t, err)
+	out, err = run("", "cache", "stats")
+	require.NoError(t, err)
+	require.Contains(t, out, filepath.Join(dir, "profiles", "dev", "cache.db"))
+
+	out, err = run("", "--profile", "prod", "cache", "stats")
+	require.NoError(t, err)
+	require.Contains(t, out, filepath.Join(dir, "profiles", "prod", "cache.db"))
+
+	_, err = run("", "--profile", "staging", "profile", "list")
+	require.ErrorIs(t, err, config.ErrUnknownProfile)
+
+	_, err = run("", "profile", "remove", "dev")
+	require.NoError(t, err)
+	out, err = run("", "profile", "list")
+	require.NoError(t, err)
+	require.NotContains(t, out, "dev")
+	require.NotContains(t, out, "*")
+}
+
+func TestCLI_ProfilesDoNotShareAgent(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("peer credentials unsupported")
+	}
+	var devHits, prodHits int32
+	server := func(hits *int32) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(hits, 1)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"items":[],"total":0}`))
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	dev, prod := server(&devHits), server(&prodHits)
+
+	dir, _ := cacheCLI(t)
+	runtimeDir, err := os.MkdirTemp("", "kcp")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(runtimeDir) })
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+	t.Setenv("SUFIR_KEEPER_AGENT_DISABLED", "false")
+	cfgPath := filepath.Join(dir, "cfg.json")
+	f, err := config.ReadFile(cfgPath)
+	require.NoError(t, err)
+	f.SetProfile("dev", map[string]string{"server.base_url": dev.URL})
+	f.SetProfile("prod", map[string]string{"server.base_url": prod.URL})
+	require.NoError(t, f.Write())
+
+	run := func(ctx context.Context, args ...string) (string, error) {
+		cmd := NewRootCmd("dev", "none", "2025-01-01")
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs(append([]string{"--config", cfgPath, "--ca-cert-path=", "--log-level", "error"}, args...))
+		err := cmd.ExecuteContext(ctx)
+		return buf.String(), err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := run(ctx, "--profile", "dev", "agent", "start", "--foreground")
+		done <- err
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	require.Eventually(t, func() bool {
+		out, _ := run(context.Background(), "--profile", "dev", "agent", "status")
+		return strings.Contains(out, "running")
+	}, 5*time.Second, 50*time.Millisecond)
+
+	out, err := run(context.Background(), "--profile", "prod", "agent", "status")
+	require.NoError(t, err)
+	require.Contains(t, out, "not running", "у профиля prod свой сокет агента")
+	require.Contains(t, out, filepath.Join(runtimeDir, "keepcli-agent-prod.sock"))
+
+	_, err = run(context.Background(), "--profile", "prod", "list")
+	require.NoError(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&prodHits))
+	require.Zero(t, atomic.LoadInt32(&devHits), "команды prod не идут через агент dev")
+
+	_, err = run(context.Background(), "--profile", "dev", "list")
+	require.NoError(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&devHits))
+}
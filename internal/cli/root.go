@@ -1,14 +1,18 @@
 package cli
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
 
+	"github.com/GoLessons/sufir-keeper-client/internal/agentd"
 	"github.com/GoLessons/sufir-keeper-client/internal/config"
 	"github.com/GoLessons/sufir-keeper-client/internal/logging"
 )
@@ -16,10 +20,39 @@ import (
 type contextKey string
 
 const (
-	cfgContextKey contextKey = "config"
-	logContextKey contextKey = "logger"
+	cfgContextKey    contextKey = "config"
+	cfgErrContextKey contextKey = "config-error"
+	logContextKey    contextKey = "logger"
 )
 
+var flagKeys = map[string]string{
+	"config.file":         "config",
+	"profile":             "profile",
+	"server.base_url":     "server",
+	"log.level":           "log-level",
+	"tls.ca_cert_path":    "ca-cert-path",
+	"sync.offline":        "offline",
+	"cache.read_policy":   "read-policy",
+	"http.timeout":        "http-timeout",
+	"http.retry_max":      "http-retry-max",
+	"http.retry_wait_min": "http-retry-wait-min",
+	"http.retry_wait_max": "http-retry-wait-max",
+	"http.max_idle_conns": "http-max-idle-conns",
+	"http.user_agent":     "http-user-agent",
+}
+
+// Эти команды работают и с ошибочной конфигурацией, чтобы её исправить.
+const tolerateConfigErrors = "tolerate-config-errors"
+
+func toleratesConfigErrors(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		if c.Annotations[tolerateConfigErrors] == "true" {
+			return true
+		}
+	}
+	return false
+}
+
 func NewRootCmd(version, commit, date string) *cobra.Command {
 	v := viper.New()
 	v.SetEnvPrefix("SUFIR_KEEPER")
@@ -32,33 +65,45 @@ func NewRootCmd(version, commit, date string) *cobra.Command {
 		SilenceUsage:  true,
 		SilenceErrors: false,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-			executablePath, err := os.Executable()
-			if err != nil {
-				return err
-			}
-			execDir := filepath.Dir(executablePath)
-			if !v.IsSet("config.file") || v.GetString("config.file") == "" {
-				v.Set("config.file", filepath.Join(execDir, "config.json"))
-			}
-			v.SetConfigFile(v.GetString("config.file"))
 			v.SetDefault("server.base_url", "https://localhost:8443/api/v1")
 			v.SetDefault("log.level", "info")
 			v.SetDefault("tls.ca_cert_path", "./var/ca.crt")
 			v.SetDefault("auth.token_store_service", "sufir-keeper-client")
 			v.SetDefault("auth.backend", "")
-			v.SetDefault("auth.file_dir", "")
-			v.SetDefault("cache.path", "~/.local/share/sufir-keeper-client/cache.db")
+			v.SetDefault("auth.file_dir", config.StatePath("keyring"))
+			v.SetDefault("cache.backend", "sqlite")
+			v.SetDefault("cache.path", config.DataPath("cache.db"))
 			v.SetDefault("cache.ttl_minutes", 180)
 			v.SetDefault("cache.enabled", true)
+			v.SetDefault("cache.max_entries", 10000)
+			v.SetDefault("cache.max_bytes", 64<<20)
+			v.SetDefault("cache.blob_max_bytes", 256<<20)
+			v.SetDefault("cache.stale_minutes", 1440)
+			v.SetDefault("cache.read_policy", "network-first")
+			v.SetDefault("sync.conflict_strategy", "lww")
+			v.SetDefault("agent.socket", agentd.DefaultSocket())
+			v.SetDefault("http.timeout", "30s")
+			v.SetDefault("http.retry_max", 3)
+			v.SetDefault("http.retry_wait_min", "200ms")
+			v.SetDefault("http.retry_wait_max", "2s")
+			v.SetDefault("http.max_idle_conns", 100)
+			v.SetDefault("http.user_agent", "keepcli/"+cmp.Or(version, "dev"))
 			var cfg config.Config
-			if err := config.Load(v, &cfg); err != nil {
-				return err
+			cfgErr := config.Load(v, &cfg)
+			tolerate := toleratesConfigErrors(cmd)
+			if cfgErr != nil && !tolerate {
+				return cfgErr
 			}
 			l, err := logging.NewLogger(cfg.Log.Level)
+			if err != nil && tolerate {
+				l, err = logging.NewLogger("info")
+			}
 			if err != nil {
 				return err
 			}
+			warnLegacyConfig(l, cfg)
 			ctx := context.WithValue(cmd.Context(), cfgContextKey, cfg)
+			ctx = context.WithValue(ctx, cfgErrContextKey, cfgErr)
 			ctx = context.WithValue(ctx, logContextKey, l)
 			cmd.SetContext(ctx)
 			return nil
@@ -73,14 +118,22 @@ func NewRootCmd(version, commit, date string) *cobra.Command {
 	}
 
 	cmd.PersistentFlags().String("config", "", "Путь к файлу конфигурации")
+	cmd.PersistentFlags().String("profile", "", "Профиль из файла конфигурации")
 	cmd.PersistentFlags().String("server", "", "Адрес сервера API")
 	cmd.PersistentFlags().String("log-level", "", "Уровень логирования")
 	cmd.PersistentFlags().String("ca-cert-path", "", "Путь к dev CA сертификату")
+	cmd.PersistentFlags().Bool("offline", false, "Работать с локальной репликой без обращения к серверу")
+	cmd.PersistentFlags().String("read-policy", "", "Режим чтения записей: network-first|cache-first|cache-only")
+	cmd.PersistentFlags().String("http-timeout", "", "Таймаут запроса к серверу, например 30s")
+	cmd.PersistentFlags().Int("http-retry-max", 0, "Число повторов запроса при сетевых ошибках, 429 и 5xx (0 — без повторов)")
+	cmd.PersistentFlags().String("http-retry-wait-min", "", "Минимальная пауза перед повтором, например 200ms")
+	cmd.PersistentFlags().String("http-retry-wait-max", "", "Максимальная пауза перед повтором, например 2s")
+	cmd.PersistentFlags().Int("http-max-idle-conns", 0, "Число простаивающих соединений в пуле")
+	cmd.PersistentFlags().String("http-user-agent", "", "Заголовок User-Agent запросов")
 
-	_ = v.BindPFlag("config.file", cmd.PersistentFlags().Lookup("config"))
-	_ = v.BindPFlag("server.base_url", cmd.PersistentFlags().Lookup("server"))
-	_ = v.BindPFlag("log.level", cmd.PersistentFlags().Lookup("log-level"))
-	_ = v.BindPFlag("tls.ca_cert_path", cmd.PersistentFlags().Lookup("ca-cert-path"))
+	for key, flag := range flagKeys {
+		_ = v.BindPFlag(key, cmd.PersistentFlags().Lookup(flag))
+	}
 	_ = v.BindEnv("auth.token_store_service", "SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE")
 	_ = v.BindEnv("auth.backend", "SUFIR_KEEPER_AUTH_BACKEND")
 	_ = v.BindEnv("auth.file_dir", "SUFIR_KEEPER_AUTH_FILE_DIR")
@@ -101,11 +154,36 @@ func NewRootCmd(version, commit, date string) *cobra.Command {
 	AttachAuthCommands(cmd)
 	AttachItemsCommands(cmd)
 	AttachFilesCommands(cmd)
+	AttachSSHCommands(cmd)
+	AttachGitCommands(cmd)
+	AttachDockerCommands(cmd)
+	AttachCredentialProcessCommands(cmd)
+	AttachServeCommands(cmd)
+	AttachAgentCommands(cmd)
+	AttachE2ECommands(cmd)
+	AttachSyncCommands(cmd)
+	AttachOutboxCommands(cmd)
+	AttachCacheCommands(cmd)
+	AttachProfileCommands(cmd)
+	AttachConfigCommands(cmd)
 	AttachCompletion(cmd)
 
 	return cmd
 }
 
+// Прежние версии читали config.json рядом с бинарником по умолчанию.
+func warnLegacyConfig(l logging.Logger, cfg config.Config) {
+	exe, err := os.Executable()
+	if err != nil {
+		return
+	}
+	p := filepath.Join(filepath.Dir(exe), "config.json")
+	if _, err := os.Stat(p); err != nil || slices.Contains(cfg.ConfigFiles, p) {
+		return
+	}
+	l.Warn("config.json next to the executable is no longer read", zap.String("path", p), zap.String("move_to", config.DefaultPath()))
+}
+
 func nonEmpty(value, fallback string) string {
 	if value == "" {
 		return fallback
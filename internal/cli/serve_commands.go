@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/logging"
+	"github.com/GoLessons/sufir-keeper-client/internal/vaultcompat"
+)
+
+func AttachServeCommands(root *cobra.Command) {
+	root.AddCommand(newServeCmd())
+}
+
+func newServeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Запустить локальный HTTP-сервер для внешних инструментов",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vaultCompat, _ := cmd.Flags().GetBool("vault-compat")
+			if !vaultCompat {
+				return errors.New("укажите режим: --vault-compat")
+			}
+			listen, _ := cmd.Flags().GetString("listen")
+			if err := requireLoopback(listen); err != nil {
+				return err
+			}
+			tokenFile, _ := cmd.Flags().GetString("token-file")
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			log := ctx.Value(logContextKey).(logging.Logger)
+			svc, _, closeFn, err := newItemsService(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeFn()
+			token, err := vaultcompat.GenerateToken()
+			if err != nil {
+				return err
+			}
+			if tokenFile != "" {
+				if err := os.WriteFile(tokenFile, []byte(token+"\n"), 0o600); err != nil {
+					return err
+				}
+				defer func() { _ = os.Remove(tokenFile) }()
+			}
+			ln, err := net.Listen("tcp", listen)
+			if err != nil {
+				return err
+			}
+			srv := &http.Server{
+				Handler:           vaultcompat.New(vaultcompat.Options{Items: svc, Token: token}),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			go func() {
+				<-ctx.Done()
+				sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				_ = srv.Shutdown(sctx)
+			}()
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "VAULT_ADDR=http://%s; export VAULT_ADDR;\nVAULT_TOKEN=%s; export VAULT_TOKEN;\n", ln.Addr().String(), token)
+			log.Info("vault-compatible server started", zap.String("addr", ln.Addr().String()))
+			if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		},
+	}
+	cmd.Flags().Bool("vault-compat", false, "Совместимый с Vault KV v2 API (/v1/secret/data/...)")
+	cmd.Flags().String("listen", "127.0.0.1:8200", "Адрес для прослушивания (только loopback)")
+	cmd.Flags().String("token-file", "", "Записать сгенерированный токен в файл (0600)")
+	return cmd
+}
+
+func requireLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("некорректный адрес %q: %w", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("адрес %q не является loopback", addr)
+	}
+	return nil
+}
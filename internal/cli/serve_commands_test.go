@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeRequiresModeAndLoopback(t *testing.T) {
+	for _, args := range [][]string{
+		{"--ca-cert-path=", "serve"},
+		{"--ca-cert-path=", "serve", "--vault-compat", "--listen", "0.0.0.0:8200"},
+	} {
+		cmd := NewRootCmd("dev", "none", "2025-01-01")
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs(args)
+		require.Error(t, cmd.Execute())
+	}
+}
+
+func TestRequireLoopback(t *testing.T) {
+	require.NoError(t, requireLoopback("127.0.0.1:8200"))
+	require.NoError(t, requireLoopback("[::1]:8200"))
+	require.NoError(t, requireLoopback("localhost:8200"))
+	require.Error(t, requireLoopback("10.0.0.1:8200"))
+	require.Error(t, requireLoopback(":8200"))
+	require.Error(t, requireLoopback("nope"))
+}
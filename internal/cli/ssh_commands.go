@@ -0,0 +1,210 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+
+	openapi_types "github.com/oapi-codegen/runtime/types"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/agentd"
+	"github.com/GoLessons/sufir-keeper-client/internal/api"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/logging"
+	"github.com/GoLessons/sufir-keeper-client/internal/sshagent"
+)
+
+func AttachSSHCommands(root *cobra.Command) {
+	root.AddCommand(newSSHAgentCmd())
+	root.AddCommand(newSSHAddCmd())
+}
+
+func newSSHAgentCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ssh-agent",
+		Short: "Запустить ssh-agent с ключами из хранилища",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			socket, _ := cmd.Flags().GetString("socket")
+			if socket == "" {
+				socket = defaultSSHAgentSocket()
+			}
+			confirm, _ := cmd.Flags().GetBool("confirm")
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			log := ctx.Value(logContextKey).(logging.Logger)
+			svc, w, closeFn, err := newItemsService(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeFn()
+			var mu sync.Mutex
+			in := bufio.NewReader(cmd.InOrStdin())
+			opts := sshagent.Options{
+				Vault: svc,
+				Files: w,
+				Log:   log,
+				Passphrase: func(comment string) ([]byte, error) {
+					mu.Lock()
+					defer mu.Unlock()
+					pw, err := readSecret(cmd, in, fmt.Sprintf("Введите пароль ключа %s: ", comment))
+					return []byte(pw), err
+				},
+			}
+			if confirm {
+				opts.Confirm = func(comment string) bool {
+					mu.Lock()
+					defer mu.Unlock()
+					return askYes(cmd, in, fmt.Sprintf("Разрешить использование ключа %s?", comment))
+				}
+			}
+			ln, err := agentd.Listen(socket)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = os.Remove(socket) }()
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "SSH_AUTH_SOCK=%s; export SSH_AUTH_SOCK;\n", socket)
+			return sshagent.New(ctx, opts).Serve(ctx, ln)
+		},
+	}
+	cmd.Flags().String("socket", "", "Путь к unix-сокету агента")
+	cmd.Flags().Bool("confirm", false, "Запрашивать подтверждение на каждое использование ключа")
+	return cmd
+}
+
+func newSSHAddCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ssh-add [id]",
+		Short: "Добавить SSH-ключ в хранилище для ssh-agent",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, _ := cmd.Flags().GetString("file")
+			if (len(args) == 0) == (file == "") {
+				return errors.New("укажите id записи или --file")
+			}
+			ctx := cmd.Context()
+			svc, w, closeFn, err := newItemsService(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeFn()
+			if file != "" {
+				pemBytes, err := os.ReadFile(file)
+				if err != nil {
+					return err
+				}
+				pub, err := sshagent.ParseKey(pemBytes)
+				if err != nil {
+					return fmt.Errorf("некорректный приватный ключ: %w", err)
+				}
+				title, _ := cmd.Flags().GetString("title")
+				if strings.TrimSpace(title) == "" {
+					title = filepath.Base(file)
+				}
+				var data apigen.ItemCreate_Data
+				if err := data.FromTextData(apigen.TextData{Type: ItemTypeText, Value: string(pemBytes)}); err != nil {
+					return err
+				}
+				meta := map[string]string{sshagent.MetaKind: sshagent.KindSSHKey}
+				resp, err := svc.Create(ctx, apigen.ItemCreate{Title: title, Data: data, Meta: &meta})
+				if err != nil {
+					return err
+				}
+				if resp.JSON201 != nil && resp.JSON201.Id != nil {
+					_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s %s\n", resp.JSON201.Id.String(), ssh.FingerprintSHA256(pub))
+					return nil
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s\n", ssh.FingerprintSHA256(pub))
+				return nil
+			}
+			idv, err := uuid.Parse(args[0])
+			if err != nil {
+				return errors.New("некорректный UUID")
+			}
+			var id openapi_types.UUID
+			if err := id.UnmarshalText([]byte(idv.String())); err != nil {
+				return err
+			}
+			resp, err := svc.Get(ctx, id)
+			if err != nil {
+				return err
+			}
+			if resp.JSON200 == nil || resp.JSON200.Data == nil {
+				return errors.New("запись не найдена")
+			}
+			pemBytes, err := sshKeyBytes(ctx, w, resp.JSON200.Data)
+			if err != nil {
+				return err
+			}
+			pub, err := sshagent.ParseKey(pemBytes)
+			if err != nil {
+				return fmt.Errorf("некорректный приватный ключ: %w", err)
+			}
+			meta := map[string]string{}
+			if resp.JSON200.Meta != nil {
+				for k, v := range *resp.JSON200.Meta {
+					meta[k] = v
+				}
+			}
+			meta[sshagent.MetaKind] = sshagent.KindSSHKey
+			if _, err := svc.Update(ctx, id, apigen.ItemUpdate{Meta: &meta}); err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s\n", ssh.FingerprintSHA256(pub))
+			return nil
+		},
+	}
+	cmd.Flags().String("file", "", "Импортировать приватный ключ из файла")
+	cmd.Flags().String("title", "", "Заголовок записи при импорте из файла")
+	return cmd
+}
+
+func sshKeyBytes(ctx context.Context, w *api.Wrapper, data *apigen.ItemResponse_Data) ([]byte, error) {
+	typeText, fields := detectItemTypeAndFields(data)
+	switch typeText {
+	case ItemTypeText:
+		return []byte(fields["value"]), nil
+	case ItemTypeBinary:
+		bd, err := data.AsBinaryData()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := w.DownloadFile(ctx, bd.Id)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Body, nil
+	default:
+		return nil, errors.New("SSH-ключ должен храниться в записи TEXT или BINARY")
+	}
+}
+
+func readSecret(cmd *cobra.Command, in *bufio.Reader, prompt string) (string, error) {
+	_, _ = cmd.ErrOrStderr().Write([]byte(prompt))
+	if f, ok := cmd.InOrStdin().(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		b, err := term.ReadPassword(int(f.Fd()))
+		_, _ = cmd.ErrOrStderr().Write([]byte("\n"))
+		return string(b), err
+	}
+	line, err := in.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func defaultSSHAgentSocket() string {
+	return agentd.RuntimePath("keepcli-ssh-agent.sock")
+}
@@ -0,0 +1,27 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttachSSHCommands(t *testing.T) {
+	root := NewRootCmd("", "", "")
+	names := make([]string, 0, len(root.Commands()))
+	for _, c := range root.Commands() {
+		names = append(names, c.Name())
+	}
+	require.Contains(t, names, "ssh-agent")
+	require.Contains(t, names, "ssh-add")
+}
+
+func TestSSHAddRequiresIDOrFile(t *testing.T) {
+	cmd := NewRootCmd("dev", "none", "2025-01-01")
+	var buf bytes.Buffer
+	cmd.SetOut(&buf)
+	cmd.SetErr(&buf)
+	cmd.SetArgs([]string{"--ca-cert-path=", "ssh-add"})
+	require.Error(t, cmd.Execute())
+}
@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/config"
+	"github.com/GoLessons/sufir-keeper-client/internal/replica"
+)
+
+const (
+	StrategyLWW         = "lww"
+	StrategyKeepBoth    = "keep-both"
+	StrategyInteractive = "interactive"
+)
+
+func AttachSyncCommands(root *cobra.Command) {
+	c := &cobra.Command{
+		Use:   "sync",
+		Short: "Синхронизировать локальную реплику с сервером",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := cmd.Context().Value(cfgContextKey).(config.Config)
+			if cfg.Sync.Offline {
+				return errors.New("синхронизация недоступна в режиме --offline")
+			}
+			strategy, _ := cmd.Flags().GetString("strategy")
+			if strategy == "" {
+				strategy = cfg.Sync.ConflictStrategy
+			}
+			resolve, err := conflictResolver(cmd, strategy)
+			if err != nil {
+				return err
+			}
+			w, cm, err := newWrapperAndCache(cmd)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = cm.Close() }()
+			rep, err := replica.New(cm).Sync(cmd.Context(), w, resolve)
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "получено: %d, отправлено: %d, удалено: %d, конфликтов: %d\n", rep.Pulled, rep.Pushed, rep.Removed, rep.Conflicts)
+			return err
+		},
+	}
+	c.Flags().String("strategy", "", "Разрешение конфликтов: lww|keep-both|interactive")
+	c.AddCommand(newSyncStatusCmd())
+	root.AddCommand(c)
+}
+
+func newSyncStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Показать состояние локальной реплики",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := cmd.Context().Value(cfgContextKey).(config.Config)
+			cm, err := newCache(cfg)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = cm.Close() }()
+			r := replica.New(cm)
+			st, err := r.State()
+			if err != nil {
+				return err
+			}
+			records, err := r.Records()
+			if err != nil {
+				return err
+			}
+			pending, err := r.Pending()
+			if err != nil {
+				return err
+			}
+			last := "never"
+			if !st.LastSync.IsZero() {
+				last = st.LastSync.Local().Format(time.RFC3339)
+			}
+			out := cmd.OutOrStdout()
+			_, _ = fmt.Fprintf(out, "last sync: %s\nitems: %d\npending: %d\n", last, len(records), len(pending))
+			for _, rec := range pending {
+				title := ""
+				if rec.Item.Title != nil {
+					title = *rec.Item.Title
+				}
+				_, _ = fmt.Fprintf(out, "  %s\t%s\t%s\n", rec.Op, rec.Item.Id.String(), title)
+			}
+			return nil
+		},
+	}
+}
+
+func conflictResolver(cmd *cobra.Command, strategy string) (replica.Resolver, error) {
+	switch strategy {
+	case StrategyLWW, "":
+		return replica.LastWriterWins, nil
+	case StrategyKeepBoth:
+		return replica.KeepBothVersions, nil
+	case StrategyInteractive:
+		return promptResolver(bufio.NewReader(cmd.InOrStdin()), cmd.ErrOrStderr()), nil
+	}
+	return nil, fmt.Errorf("неизвестная стратегия %q, используйте lww|keep-both|interactive", strategy)
+}
+
+func promptResolver(in *bufio.Reader, out io.Writer) replica.Resolver {
+	return func(c replica.Conflict) (replica.Resolution, error) {
+		local, remote := "удалена", "удалена"
+		if c.Local != nil {
+			local = c.LocalAt.Local().Format(time.RFC3339)
+		}
+		if c.Remote != nil {
+			remote = c.RemoteAt.Local().Format(time.RFC3339)
+		}
+		_, _ = fmt.Fprintf(out, "Конфликт: %s (%s)\n  локально: %s\n  на сервере: %s\n", c.Title(), c.ID.String(), local, remote)
+		for {
+			_, _ = fmt.Fprint(out, "[l] оставить локальную, [r] оставить серверную, [b] сохранить обе: ")
+			line, err := in.ReadString('\n')
+			switch strings.ToLower(strings.TrimSpace(line)) {
+			case "l":
+				return replica.KeepLocal, nil
+			case "r":
+				return replica.KeepRemote, nil
+			case "b":
+				return replica.KeepBoth, nil
+			}
+			if err != nil {
+				return 0, fmt.Errorf("конфликт %s не разрешён: %w", c.ID.String(), err)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCLI_OfflineCreateIsPendingUntilSync(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SUFIR_KEEPER_AUTH_BACKEND", "file")
+	t.Setenv("SUFIR_KEEPER_AUTH_FILE_DIR", dir)
+	t.Setenv("SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", "sufir-keeper-client")
+	t.Setenv("SUFIR_KEEPER_CACHE_PATH", filepath.Join(dir, "cache.db"))
+	t.Setenv("SUFIR_KEEPER_AGENT_DISABLED", "true")
+	cfgPath := filepath.Join(dir, "cfg.json")
+	require.NoError(t, os.WriteFile(cfgPath, []byte("{}"), 0o600))
+
+	run := func(args ...string) (string, error) {
+		cmd := NewRootCmd("dev", "none", "2025-01-01")
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs(append([]string{"--config", cfgPath, "--server", "http://127.0.0.1:1", "--ca-cert-path=", "--log-level", "info"}, args...))
+		err := cmd.ExecuteContext(context.Background())
+		return buf.String(), err
+	}
+
+	out, err := run("--offline", "create", "--title", "offline-note", "--value", "v")
+	require.NoError(t, err)
+	require.NotEmpty(t, out)
+
+	out, err = run("--offline", "list")
+	require.NoError(t, err)
+	require.Contains(t, out, "offline-note")
+
+	out, err = run("sync", "status")
+	require.NoError(t, err)
+	require.Contains(t, out, "pending: 1")
+	require.Contains(t, out, "create")
+
+	_, err = run("sync", "--strategy", "bogus")
+	require.Error(t, err)
+	_, err = run("--offline", "sync")
+	require.Error(t, err)
+}
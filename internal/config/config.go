@@ -2,17 +2,30 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"strings"
+	"time"
 )
 
 type Config struct {
-	Auth       AuthConfig
-	Server     ServerConfig
-	TLS        TLSConfig
-	Log        LogConfig
+	// Profile — выбранный профиль; пусто, если профили не используются.
+	Profile string
+	Auth    AuthConfig
+	Server  ServerConfig
+	TLS     TLSConfig
+	Log     LogConfig
+	// ConfigFile — файл, который правят команды config и profile: явно
+	// указанный или пользовательский.
 	ConfigFile string
-	Cache      CacheConfig
+	// ConfigFiles — прочитанные файлы от менее к более важным.
+	ConfigFiles []string
+	Cache       CacheConfig
+	Agent       AgentConfig
+	E2E         E2EConfig
+	Sync        SyncConfig
+	Outbox      OutboxConfig
+	HTTP        HTTPConfig
 }
 
 type ServerConfig struct {
@@ -34,9 +47,49 @@ type AuthConfig struct {
 }
 
 type CacheConfig struct {
-	Path       string
-	TTLMinutes int
-	Enabled    bool
+	// Backend — хранилище кеша: sqlite, bbolt или memory.
+	Backend string
+	Path    string
+	// ReadPolicy — порядок чтения записей: network-first, cache-first или
+	// cache-only.
+	ReadPolicy   string
+	TTLMinutes   int
+	StaleMinutes int
+	MaxEntries   int
+	MaxBytes     int
+	// BlobMaxBytes ограничивает суммарный размер скачанных файлов в кеше.
+	BlobMaxBytes int
+	Enabled      bool
+}
+
+type AgentConfig struct {
+	Socket   string
+	Disabled bool
+}
+
+type E2EConfig struct {
+	Enabled bool
+}
+
+type OutboxConfig struct {
+	Enabled bool
+}
+
+type SyncConfig struct {
+	ConflictStrategy string
+	Offline          bool
+}
+
+// HTTPConfig — таймаут, повторы и транспорт запросов к серверу. Нулевые
+// значения, кроме RetryMax, оставляют умолчания httpclient.
+type HTTPConfig struct {
+	UserAgent    string
+	Timeout      time.Duration
+	RetryWaitMin time.Duration
+	RetryWaitMax time.Duration
+	// RetryMax — число повторов; 0 отключает повторы.
+	RetryMax     int
+	MaxIdleConns int
 }
 
 type Reader interface {
@@ -47,30 +100,76 @@ type Reader interface {
 	SetEnvPrefix(string)
 	SetEnvKeyReplacer(*strings.Replacer)
 	ReadInConfig() error
+	MergeInConfig() error
 	BindEnv(...string) error
 	GetString(string) string
+	Get(string) any
 	IsSet(string) bool
+	MergeConfigMap(map[string]any) error
 }
 
 func EnvKeyReplacer() *strings.Replacer {
 	return strings.NewReplacer(".", "_")
 }
 
+// Load собирает конфигурацию: флаги → ENV → профиль → файлы (см. Discover) →
+// значения по умолчанию. Ошибки настроек не прерывают загрузку: out
+// заполняется целиком, чтобы команды config могли исправить конфигурацию.
 func Load(v Reader, out *Config) error {
 	if out == nil {
 		return errors.New("nil config output")
 	}
 	_ = v.BindEnv("config.file", "SUFIR_KEEPER_CONFIG")
-	_ = v.BindEnv("server.base_url", "SUFIR_KEEPER_SERVER")
-	_ = v.BindEnv("tls.ca_cert_path", "SUFIR_KEEPER_CA_CERT")
-	_ = v.BindEnv("log.level", "SUFIR_KEEPER_LOG_LEVEL")
-	_ = v.BindEnv("auth.token_store_service", "SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE")
-	_ = v.BindEnv("auth.backend", "SUFIR_KEEPER_AUTH_BACKEND")
-	_ = v.BindEnv("auth.file_dir", "SUFIR_KEEPER_AUTH_FILE_DIR")
-	_ = v.BindEnv("cache.path", "SUFIR_KEEPER_CACHE_PATH")
-	_ = v.BindEnv("cache.ttl_minutes", "SUFIR_KEEPER_CACHE_TTL")
-	_ = v.BindEnv("cache.enabled", "SUFIR_KEEPER_CACHE_ENABLED")
-	out.ConfigFile = v.GetString("config.file")
+	_ = v.BindEnv("profile", "SUFIR_KEEPER_PROFILE")
+	for _, k := range Keys {
+		_ = v.BindEnv(k.Name, k.Env)
+	}
+	var errs []error
+	explicit := v.GetString("config.file")
+	if explicit == "" {
+		explicit = os.Getenv("SUFIR_KEEPER_CONFIG")
+	}
+	out.ConfigFile = explicit
+	if out.ConfigFile == "" {
+		out.ConfigFile = DefaultPath()
+	}
+	out.ConfigFiles = Discover(explicit)
+	for i, p := range out.ConfigFiles {
+		v.SetConfigFile(p)
+		read := v.MergeInConfig
+		if i == 0 {
+			read = v.ReadInConfig
+		}
+		if err := read(); err != nil {
+			errs = append(errs, fmt.Errorf("файл конфигурации %s: %w", p, err))
+		}
+	}
+	profile, err := applyProfile(v, out)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	count := func(key string) int {
+		s := v.GetString(key)
+		if s == "" {
+			return 0
+		}
+		n, err := parseCount(s)
+		if err != nil {
+			errs = append(errs, &FieldError{Key: key, Value: s, Reason: "ожидается целое неотрицательное число"})
+		}
+		return n
+	}
+	duration := func(key string) time.Duration {
+		s := v.GetString(key)
+		if s == "" {
+			return 0
+		}
+		d, err := parseDuration(s)
+		if err != nil {
+			errs = append(errs, &FieldError{Key: key, Value: s, Reason: durationReason})
+		}
+		return d
+	}
 	out.Server.BaseURL = v.GetString("server.base_url")
 	out.TLS.CACertPath = v.GetString("tls.ca_cert_path")
 	out.Log.Level = v.GetString("log.level")
@@ -78,19 +177,26 @@ func Load(v Reader, out *Config) error {
 	out.Auth.Backend = v.GetString("auth.backend")
 	out.Auth.FileDir = v.GetString("auth.file_dir")
 	out.Cache.Path = v.GetString("cache.path")
-	out.Cache.TTLMinutes = atoiSafe(v.GetString("cache.ttl_minutes"))
+	out.Cache.Backend = v.GetString("cache.backend")
+	out.Cache.TTLMinutes = count("cache.ttl_minutes")
 	out.Cache.Enabled = v.GetString("cache.enabled") == "true"
-	if out.ConfigFile == "" {
-		out.ConfigFile = os.Getenv("SUFIR_KEEPER_CONFIG")
-	}
-	if out.ConfigFile != "" {
-		v.SetConfigFile(out.ConfigFile)
-		if _, err := os.Stat(out.ConfigFile); err == nil {
-			if err := v.ReadInConfig(); err != nil {
-				return err
-			}
-		}
-	}
+	out.Cache.MaxEntries = count("cache.max_entries")
+	out.Cache.MaxBytes = count("cache.max_bytes")
+	out.Cache.BlobMaxBytes = count("cache.blob_max_bytes")
+	out.Cache.StaleMinutes = count("cache.stale_minutes")
+	out.Cache.ReadPolicy = v.GetString("cache.read_policy")
+	out.Agent.Socket = v.GetString("agent.socket")
+	out.Agent.Disabled = v.GetString("agent.disabled") == "true"
+	out.E2E.Enabled = v.GetString("e2e.enabled") == "true"
+	out.Sync.Offline = v.GetString("sync.offline") == "true"
+	out.Sync.ConflictStrategy = v.GetString("sync.conflict_strategy")
+	out.Outbox.Enabled = v.GetString("outbox.enabled") == "true"
+	out.HTTP.Timeout = duration("http.timeout")
+	out.HTTP.RetryMax = count("http.retry_max")
+	out.HTTP.RetryWaitMin = duration("http.retry_wait_min")
+	out.HTTP.RetryWaitMax = duration("http.retry_wait_max")
+	out.HTTP.MaxIdleConns = count("http.max_idle_conns")
+	out.HTTP.UserAgent = v.GetString("http.user_agent")
 	if out.Server.BaseURL == "" {
 		out.Server.BaseURL = os.Getenv("SUFIR_KEEPER_SERVER")
 	}
@@ -112,30 +218,33 @@ func Load(v Reader, out *Config) error {
 	if out.Cache.Path == "" {
 		out.Cache.Path = os.Getenv("SUFIR_KEEPER_CACHE_PATH")
 	}
-	if out.Cache.TTLMinutes == 0 {
-		if v := os.Getenv("SUFIR_KEEPER_CACHE_TTL"); v != "" {
-			out.Cache.TTLMinutes = atoiSafe(v)
-		}
+	if out.Cache.Backend == "" {
+		out.Cache.Backend = os.Getenv("SUFIR_KEEPER_CACHE_BACKEND")
+	}
+	if out.Cache.ReadPolicy == "" {
+		out.Cache.ReadPolicy = os.Getenv("SUFIR_KEEPER_CACHE_READ_POLICY")
 	}
 	if !out.Cache.Enabled {
 		out.Cache.Enabled = os.Getenv("SUFIR_KEEPER_CACHE_ENABLED") == "true"
 	}
-	return nil
-}
-
-func atoiSafe(s string) int {
-	if s == "" {
-		return 0
-	}
-	var n int
-	for i := 0; i < len(s); i++ {
-		c := s[i]
-		if c < '0' || c > '9' {
-			return 0
-		}
+	if out.Agent.Socket == "" {
+		out.Agent.Socket = os.Getenv("SUFIR_KEEPER_AGENT_SOCKET")
+	}
+	if !out.Agent.Disabled {
+		out.Agent.Disabled = os.Getenv("SUFIR_KEEPER_AGENT_DISABLED") == "true"
+	}
+	if !out.E2E.Enabled {
+		out.E2E.Enabled = os.Getenv("SUFIR_KEEPER_E2E_ENABLED") == "true"
+	}
+	if !out.Sync.Offline {
+		out.Sync.Offline = os.Getenv("SUFIR_KEEPER_OFFLINE") == "true"
+	}
+	if !out.Outbox.Enabled {
+		out.Outbox.Enabled = os.Getenv("SUFIR_KEEPER_OUTBOX_ENABLED") == "true"
 	}
-	for _, c := range s {
-		n = n*10 + int(c-'0')
+	if out.Sync.ConflictStrategy == "" {
+		out.Sync.ConflictStrategy = os.Getenv("SUFIR_KEEPER_SYNC_CONFLICT_STRATEGY")
 	}
-	return n
+	isolateProfile(out, profile)
+	return errors.Join(errs...)
 }
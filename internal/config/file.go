@@ -0,0 +1,119 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// File — содержимое файла конфигурации для правки командами keepcli.
+type File struct {
+	data map[string]any
+	path string
+}
+
+// ReadFile читает файл конфигурации; отсутствующий файл считается пустым.
+func ReadFile(path string) (*File, error) {
+	f := &File{path: path, data: map[string]any{}}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("прочитать %s: %w", path, err)
+	}
+	f.data = v.AllSettings()
+	return f, nil
+}
+
+func (f *File) Path() string {
+	return f.path
+}
+
+func (f *File) Write() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o700); err != nil {
+		return err
+	}
+	v := viper.New()
+	v.SetConfigPermissions(0o600)
+	if err := v.MergeConfigMap(f.data); err != nil {
+		return err
+	}
+	return v.WriteConfigAs(f.path)
+}
+
+// Get возвращает значение ключа вида «cache.ttl_minutes», заданное в файле.
+func (f *File) Get(key string) (string, bool) {
+	m := f.data
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		sub, ok := m[part].(map[string]any)
+		if !ok {
+			return "", false
+		}
+		m = sub
+	}
+	v, ok := m[parts[len(parts)-1]]
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprint(v), true
+}
+
+// Set записывает значение; значения известных ключей сохраняются с их типом.
+func (f *File) Set(key, value string) {
+	var v any = value
+	if k, ok := LookupKey(key); ok {
+		v = k.encode(value)
+	}
+	setPath(f.data, key, v)
+}
+
+// Unset удаляет ключ и опустевшие разделы.
+func (f *File) Unset(key string) bool {
+	return unsetPath(f.data, strings.Split(key, "."))
+}
+
+func setPath(m map[string]any, key string, value any) {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		sub, ok := m[part].(map[string]any)
+		if !ok {
+			sub = map[string]any{}
+			m[part] = sub
+		}
+		m = sub
+	}
+	m[parts[len(parts)-1]] = value
+}
+
+func unsetPath(m map[string]any, parts []string) bool {
+	if len(parts) == 1 {
+		_, ok := m[parts[0]]
+		delete(m, parts[0])
+		return ok
+	}
+	sub, ok := m[parts[0]].(map[string]any)
+	if !ok || !unsetPath(sub, parts[1:]) {
+		return false
+	}
+	if len(sub) == 0 {
+		delete(m, parts[0])
+	}
+	return true
+}
+
+func flatten(prefix string, m map[string]any, out map[string]string) {
+	for k, v := range m {
+		if sub, ok := v.(map[string]any); ok {
+			flatten(prefix+k+".", sub, out)
+			continue
+		}
+		out[prefix+k] = fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldError — недопустимое значение настройки.
+type FieldError struct {
+	Key    string
+	Value  string
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s, получено %q", e.Key, e.Reason, e.Value)
+}
+
+type keyKind int
+
+const (
+	kindString keyKind = iota
+	kindInt
+	kindBool
+	kindDuration
+)
+
+// Key — настройка, которую читает Load и правят команды config.
+type Key struct {
+	get   func(Config) string
+	check func(string) string
+	Name  string
+	Env   string
+	kind  keyKind
+}
+
+// Keys — все настройки в порядке вывода `config list`.
+var Keys = []Key{
+	{Name: "server.base_url", Env: "SUFIR_KEEPER_SERVER", check: checkURL, get: func(c Config) string { return c.Server.BaseURL }},
+	{Name: "tls.ca_cert_path", Env: "SUFIR_KEEPER_CA_CERT", get: func(c Config) string { return c.TLS.CACertPath }},
+	{Name: "log.level", Env: "SUFIR_KEEPER_LOG_LEVEL", check: oneOf("debug", "info", "warn", "error"), get: func(c Config) string { return c.Log.Level }},
+	{Name: "auth.token_store_service", Env: "SUFIR_KEEPER_AUTH_TOKEN_STORE_SERVICE", get: func(c Config) string { return c.Auth.TokenStoreService }},
+	{Name: "auth.backend", Env: "SUFIR_KEEPER_AUTH_BACKEND", get: func(c Config) string { return c.Auth.Backend }},
+	{Name: "auth.file_dir", Env: "SUFIR_KEEPER_AUTH_FILE_DIR", get: func(c Config) string { return c.Auth.FileDir }},
+	{Name: "cache.enabled", Env: "SUFIR_KEEPER_CACHE_ENABLED", kind: kindBool, get: func(c Config) string { return strconv.FormatBool(c.Cache.Enabled) }},
+	{Name: "cache.backend", Env: "SUFIR_KEEPER_CACHE_BACKEND", check: oneOf("sqlite", "bbolt", "memory"), get: func(c Config) string { return c.Cache.Backend }},
+	{Name: "cache.path", Env: "SUFIR_KEEPER_CACHE_PATH", get: func(c Config) string { return c.Cache.Path }},
+	{Name: "cache.ttl_minutes", Env: "SUFIR_KEEPER_CACHE_TTL", kind: kindInt, get: func(c Config) string { return strconv.Itoa(c.Cache.TTLMinutes) }},
+	{Name: "cache.stale_minutes", Env: "SUFIR_KEEPER_CACHE_STALE_MINUTES", kind: kindInt, get: func(c Config) string { return strconv.Itoa(c.Cache.StaleMinutes) }},
+	{Name: "cache.max_entries", Env: "SUFIR_KEEPER_CACHE_MAX_ENTRIES", kind: kindInt, get: func(c Config) string { return strconv.Itoa(c.Cache.MaxEntries) }},
+	{Name: "cache.max_bytes", Env: "SUFIR_KEEPER_CACHE_MAX_BYTES", kind: kindInt, get: func(c Config) string { return strconv.Itoa(c.Cache.MaxBytes) }},
+	{Name: "cache.blob_max_bytes", Env: "SUFIR_KEEPER_CACHE_BLOB_MAX_BYTES", kind: kindInt, get: func(c Config) string { return strconv.Itoa(c.Cache.BlobMaxBytes) }},
+	{Name: "cache.read_policy", Env: "SUFIR_KEEPER_CACHE_READ_POLICY", check: oneOf("network-first", "cache-first", "cache-only"), get: func(c Config) string { return c.Cache.ReadPolicy }},
+	{Name: "agent.socket", Env: "SUFIR_KEEPER_AGENT_SOCKET", get: func(c Config) string { return c.Agent.Socket }},
+	{Name: "agent.disabled", Env: "SUFIR_KEEPER_AGENT_DISABLED", kind: kindBool, get: func(c Config) string { return strconv.FormatBool(c.Agent.Disabled) }},
+	{Name: "e2e.enabled", Env: "SUFIR_KEEPER_E2E_ENABLED", kind: kindBool, get: func(c Config) string { return strconv.FormatBool(c.E2E.Enabled) }},
+	{Name: "sync.offline", Env: "SUFIR_KEEPER_OFFLINE", kind: kindBool, get: func(c Config) string { return strconv.FormatBool(c.Sync.Offline) }},
+	{Name: "sync.conflict_strategy", Env: "SUFIR_KEEPER_SYNC_CONFLICT_STRATEGY", check: oneOf("lww", "keep-both", "interactive"), get: func(c Config) string { return c.Sync.ConflictStrategy }},
+	{Name: "http.timeout", Env: "SUFIR_KEEPER_HTTP_TIMEOUT", kind: kindDuration, get: func(c Config) string { return c.HTTP.Timeout.String() }},
+	{Name: "http.retry_max", Env: "SUFIR_KEEPER_HTTP_RETRY_MAX", kind: kindInt, get: func(c Config) string { return strconv.Itoa(c.HTTP.RetryMax) }},
+	{Name: "http.retry_wait_min", Env: "SUFIR_KEEPER_HTTP_RETRY_WAIT_MIN", kind: kindDuration, get: func(c Config) string { return c.HTTP.RetryWaitMin.String() }},
+	{Name: "http.retry_wait_max", Env: "SUFIR_KEEPER_HTTP_RETRY_WAIT_MAX", kind: kindDuration, get: func(c Config) string { return c.HTTP.RetryWaitMax.String() }},
+	{Name: "http.max_idle_conns", Env: "SUFIR_KEEPER_HTTP_MAX_IDLE_CONNS", kind: kindInt, get: func(c Config) string { return strconv.Itoa(c.HTTP.MaxIdleConns) }},
+	{Name: "http.user_agent", Env: "SUFIR_KEEPER_HTTP_USER_AGENT", get: func(c Config) string { return c.HTTP.UserAgent }},
+	{Name: "outbox.enabled", Env: "SUFIR_KEEPER_OUTBOX_ENABLED", kind: kindBool, get: func(c Config) string { return strconv.FormatBool(c.Outbox.Enabled) }},
+}
+
+func LookupKey(name string) (Key, bool) {
+	name = strings.ToLower(name)
+	for _, k := range Keys {
+		if k.Name == name {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
+
+func (k Key) Value(c Config) string {
+	return k.get(c)
+}
+
+// Check проверяет значение ключа; пустое значение означает «по умолчанию».
+func (k Key) Check(value string) error {
+	check := k.check
+	switch k.kind {
+	case kindInt:
+		check = checkCount
+	case kindBool:
+		check = checkBool
+	case kindDuration:
+		check = checkDuration
+	}
+	if check == nil || value == "" {
+		return nil
+	}
+	if reason := check(value); reason != "" {
+		return &FieldError{Key: k.Name, Value: value, Reason: reason}
+	}
+	return nil
+}
+
+// Validate проверяет итоговую конфигурацию. Числа проверяет ещё Load.
+func Validate(c Config) error {
+	var errs []error
+	for _, k := range Keys {
+		if err := k.Check(k.Value(c)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if h := c.HTTP; h.RetryWaitMax > 0 && h.RetryWaitMin > h.RetryWaitMax {
+		errs = append(errs, &FieldError{Key: "http.retry_wait_min", Value: h.RetryWaitMin.String(),
+			Reason: "должно быть не больше http.retry_wait_max (" + h.RetryWaitMax.String() + ")"})
+	}
+	return errors.Join(errs...)
+}
+
+func (k Key) encode(value string) any {
+	switch k.kind {
+	case kindInt:
+		if n, err := parseCount(value); err == nil {
+			return n
+		}
+	case kindBool:
+		return value == "true"
+	}
+	return value
+}
+
+func checkURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "ожидается абсолютный URL вида https://хост/путь"
+	}
+	return ""
+}
+
+func checkBool(s string) string {
+	if s != "true" && s != "false" {
+		return "ожидается true или false"
+	}
+	return ""
+}
+
+func checkCount(s string) string {
+	if _, err := parseCount(s); err != nil {
+		return "ожидается целое неотрицательное число"
+	}
+	return ""
+}
+
+const durationReason = "ожидается неотрицательная длительность вида 500ms, 30s или 1m"
+
+func checkDuration(s string) string {
+	if _, err := parseDuration(s); err != nil {
+		return durationReason
+	}
+	return ""
+}
+
+func oneOf(values ...string) func(string) string {
+	return func(s string) string {
+		for _, v := range values {
+			if s == v {
+				return ""
+			}
+		}
+		return "ожидается одно из: " + strings.Join(values, ", ")
+	}
+}
+
+func parseCount(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err == nil && n < 0 {
+		err = strconv.ErrRange
+	}
+	return n, err
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(s))
+	if err == nil && d < 0 {
+		err = strconv.ErrRange
+	}
+	return d, err
+}
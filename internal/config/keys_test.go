@@ -0,0 +1,94 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadReadsFileAndReportsBadNumbers(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(cfgPath, []byte(`{"log":{"level":"debug"},"cache":{"ttl_minutes":"ten","max_entries":50}}`), 0o600))
+	t.Setenv("SUFIR_KEEPER_CACHE_MAX_ENTRIES", "70")
+	v := viper.New()
+	v.Set("config.file", cfgPath)
+	v.SetDefault("log.level", "info")
+	var cfg Config
+	err := Load(v, &cfg)
+	var fe *FieldError
+	require.ErrorAs(t, err, &fe)
+	require.Equal(t, "cache.ttl_minutes", fe.Key)
+	require.EqualError(t, fe, `cache.ttl_minutes: ожидается целое неотрицательное число, получено "ten"`)
+	require.Equal(t, "debug", cfg.Log.Level, "значение из файла важнее значения по умолчанию")
+	require.Equal(t, 70, cfg.Cache.MaxEntries, "ENV важнее файла")
+}
+
+func TestValidate(t *testing.T) {
+	var cfg Config
+	cfg.Server.BaseURL = "localhost:8443/api"
+	cfg.Log.Level = "verbose"
+	cfg.Cache.ReadPolicy = "cache-first"
+	err := Validate(cfg)
+	require.ErrorContains(t, err, `server.base_url: ожидается абсолютный URL`)
+	require.ErrorContains(t, err, `log.level: ожидается одно из: debug, info, warn, error, получено "verbose"`)
+	require.NotContains(t, err.Error(), "read_policy")
+
+	cfg.Server.BaseURL = "https://localhost:8443/api/v1"
+	cfg.Log.Level = "warn"
+	require.NoError(t, Validate(cfg))
+
+	cfg.HTTP.RetryWaitMin = 3 * time.Second
+	cfg.HTTP.RetryWaitMax = time.Second
+	require.EqualError(t, Validate(cfg), `http.retry_wait_min: должно быть не больше http.retry_wait_max (1s), получено "3s"`)
+}
+
+func TestLoadHTTP(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("SUFIR_KEEPER_HTTP_TIMEOUT", "45s")
+	t.Setenv("SUFIR_KEEPER_HTTP_RETRY_WAIT_MAX", "-1s")
+	v := viper.New()
+	v.Set("http.retry_max", 0)
+	v.SetDefault("http.retry_wait_min", "200ms")
+	v.SetDefault("http.user_agent", "keepcli/dev")
+	var cfg Config
+	err := Load(v, &cfg)
+	require.EqualError(t, err, `http.retry_wait_max: ожидается неотрицательная длительность вида 500ms, 30s или 1m, получено "-1s"`)
+	require.Equal(t, 45*time.Second, cfg.HTTP.Timeout)
+	require.Equal(t, 200*time.Millisecond, cfg.HTTP.RetryWaitMin)
+	require.Equal(t, 0, cfg.HTTP.RetryMax)
+	require.Equal(t, "keepcli/dev", cfg.HTTP.UserAgent)
+
+	k, _ := LookupKey("http.timeout")
+	require.Equal(t, "45s", k.Value(cfg))
+	require.Error(t, k.Check("soon"))
+	require.NoError(t, k.Check("1m30s"))
+}
+
+func TestFileSetUnset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "config.json")
+	f, err := ReadFile(path)
+	require.NoError(t, err)
+	f.Set("cache.ttl_minutes", "30")
+	f.Set("cache.enabled", "false")
+	f.Set("server.base_url", "https://x.example/api/v1")
+	require.NoError(t, f.Write())
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(raw), `"ttl_minutes": 30`)
+	require.Contains(t, string(raw), `"enabled": false`)
+
+	f, err = ReadFile(path)
+	require.NoError(t, err)
+	got, ok := f.Get("cache.ttl_minutes")
+	require.True(t, ok)
+	require.Equal(t, "30", got)
+	require.True(t, f.Unset("server.base_url"))
+	require.False(t, f.Unset("server.base_url"))
+	_, ok = f.Get("server")
+	require.False(t, ok, "пустой раздел удаляется")
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// SystemDir — общесистемный каталог конфигурации.
+var SystemDir = "/etc/sufir-keeper"
+
+var configNames = []string{"config.yaml", "config.toml", "config.json"}
+
+// Имя прежнее, чтобы по умолчанию кеш остался на месте.
+const dataDir = "sufir-keeper-client"
+
+func xdgDir(env, fallback string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, fallback)
+}
+
+// UserDir — $XDG_CONFIG_HOME/sufir-keeper (по умолчанию ~/.config).
+func UserDir() string {
+	return filepath.Join(xdgDir("XDG_CONFIG_HOME", ".config"), "sufir-keeper")
+}
+
+// DataPath — файл в $XDG_DATA_HOME/sufir-keeper-client (по умолчанию
+// ~/.local/share).
+func DataPath(name string) string {
+	return filepath.Join(xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share")), dataDir, name)
+}
+
+// StatePath — файл в $XDG_STATE_HOME/sufir-keeper-client (по умолчанию
+// ~/.local/state).
+func StatePath(name string) string {
+	return filepath.Join(xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state")), dataDir, name)
+}
+
+func findIn(dir string) string {
+	for _, name := range configNames {
+		p := filepath.Join(dir, name)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return ""
+}
+
+// DefaultPath — пользовательский файл конфигурации: найденный в UserDir или
+// UserDir/config.json.
+func DefaultPath() string {
+	if p := findIn(UserDir()); p != "" {
+		return p
+	}
+	return filepath.Join(UserDir(), "config.json")
+}
+
+// Discover возвращает существующие файлы конфигурации от менее к более
+// важным: общесистемный, пользовательский и явно указанный.
+func Discover(explicit string) []string {
+	var files []string
+	for _, p := range []string{findIn(SystemDir), findIn(UserDir())} {
+		if p != "" && p != explicit {
+			files = append(files, p)
+		}
+	}
+	if explicit != "" {
+		if _, err := os.Stat(explicit); err == nil {
+			files = append(files, explicit)
+		}
+	}
+	return files
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXDGPaths(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/xdg/config")
+	t.Setenv("XDG_DATA_HOME", "/xdg/data")
+	t.Setenv("XDG_STATE_HOME", "relative")
+	require.Equal(t, "/xdg/config/sufir-keeper", UserDir())
+	require.Equal(t, "/xdg/data/sufir-keeper-client/cache.db", DataPath("cache.db"))
+
+	home, err := os.UserHomeDir()
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(home, ".local", "state", "sufir-keeper-client", "keyring"), StatePath("keyring"),
+		"относительный путь в XDG_STATE_HOME игнорируется")
+}
+
+func TestDiscoverLayersFiles(t *testing.T) {
+	dir := t.TempDir()
+	sys := filepath.Join(dir, "etc")
+	user := filepath.Join(dir, "xdg", "sufir-keeper")
+	require.NoError(t, os.MkdirAll(sys, 0o700))
+	require.NoError(t, os.MkdirAll(user, 0o700))
+	old := SystemDir
+	SystemDir = sys
+	t.Cleanup(func() { SystemDir = old })
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "xdg"))
+
+	require.Empty(t, Discover(""))
+	require.Equal(t, filepath.Join(user, "config.json"), DefaultPath())
+
+	sysFile := filepath.Join(sys, "config.toml")
+	require.NoError(t, os.WriteFile(sysFile, []byte("[log]\nlevel = \"warn\"\n[cache]\nttl_minutes = 30\nmax_entries = 10\n"), 0o600))
+	userFile := filepath.Join(user, "config.yaml")
+	require.NoError(t, os.WriteFile(userFile, []byte("cache:\n  ttl_minutes: 60\n"), 0o600))
+	explicit := filepath.Join(dir, "extra.json")
+	require.NoError(t, os.WriteFile(explicit, []byte(`{"cache":{"max_entries":99}}`), 0o600))
+
+	require.Equal(t, userFile, DefaultPath())
+	require.Equal(t, []string{sysFile, userFile, explicit}, Discover(explicit))
+	require.Equal(t, []string{sysFile, userFile}, Discover(filepath.Join(dir, "missing.json")))
+
+	v := viper.New()
+	v.Set("config.file", explicit)
+	var cfg Config
+	require.NoError(t, Load(v, &cfg))
+	require.Equal(t, "warn", cfg.Log.Level, "ключ только из общесистемного файла")
+	require.Equal(t, 60, cfg.Cache.TTLMinutes, "пользовательский файл важнее общесистемного")
+	require.Equal(t, 99, cfg.Cache.MaxEntries, "явный файл важнее остальных")
+	require.Equal(t, explicit, cfg.ConfigFile)
+	require.Equal(t, []string{sysFile, userFile, explicit}, cfg.ConfigFiles)
+
+	v = viper.New()
+	cfg = Config{}
+	require.NoError(t, Load(v, &cfg))
+	require.Equal(t, userFile, cfg.ConfigFile, "без явного файла правится пользовательский")
+}
+
+func TestFileWriteKeepsFormat(t *testing.T) {
+	for _, name := range []string{"config.yaml", "config.toml"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			f, err := ReadFile(path)
+			require.NoError(t, err)
+			f.Set("cache.ttl_minutes", "15")
+			f.Set("server.base_url", "https://example.com/api/v1")
+			require.NoError(t, f.Write())
+
+			f, err = ReadFile(path)
+			require.NoError(t, err)
+			got, ok := f.Get("cache.ttl_minutes")
+			require.True(t, ok)
+			require.Equal(t, "15", got)
+			got, _ = f.Get("server.base_url")
+			require.Equal(t, "https://example.com/api/v1", got)
+		})
+	}
+}
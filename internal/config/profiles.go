@@ -0,0 +1,140 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Профили — именованные наборы настроек в файле конфигурации:
+//
+//	{"current_profile": "dev", "profiles": {"dev": {"server": {"base_url": "…"}}}}
+//
+// Настройки профиля важнее остального файла, но не флагов и переменных
+// окружения.
+
+var ErrUnknownProfile = errors.New("профиль не найден")
+
+var profileNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Имя входит в путь кеша и имя сервиса keyring, а ключи файла конфигурации
+// не различают регистр.
+func ValidateProfileName(name string) error {
+	if !profileNameRe.MatchString(name) {
+		return fmt.Errorf("недопустимое имя профиля %q: только строчные латинские буквы, цифры, «-» и «_»", name)
+	}
+	return nil
+}
+
+func (f *File) CurrentProfile() string {
+	s, _ := f.data["current_profile"].(string)
+	return s
+}
+
+func (f *File) SetCurrentProfile(name string) {
+	if name == "" {
+		delete(f.data, "current_profile")
+		return
+	}
+	f.data["current_profile"] = name
+}
+
+func (f *File) profiles() map[string]any {
+	p, _ := f.data["profiles"].(map[string]any)
+	return p
+}
+
+// Profiles возвращает имена профилей по алфавиту.
+func (f *File) Profiles() []string {
+	var names []string
+	for name := range f.profiles() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Profile возвращает настройки профиля в виде «server.base_url» → значение.
+func (f *File) Profile(name string) (map[string]string, bool) {
+	p, ok := f.profiles()[name].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	out := map[string]string{}
+	flatten("", p, out)
+	return out, true
+}
+
+func (f *File) SetProfile(name string, settings map[string]string) {
+	p := map[string]any{}
+	for key, val := range settings {
+		if val != "" {
+			setPath(p, key, val)
+		}
+	}
+	all := f.profiles()
+	if all == nil {
+		all = map[string]any{}
+		f.data["profiles"] = all
+	}
+	all[name] = p
+}
+
+// RemoveProfile удаляет профиль и снимает его выбор.
+func (f *File) RemoveProfile(name string) bool {
+	all := f.profiles()
+	if _, ok := all[name]; !ok {
+		return false
+	}
+	delete(all, name)
+	if f.CurrentProfile() == name {
+		f.SetCurrentProfile("")
+	}
+	return true
+}
+
+func applyProfile(v Reader, out *Config) (map[string]string, error) {
+	name := v.GetString("profile")
+	if name == "" {
+		name = v.GetString("current_profile")
+	}
+	if name == "" {
+		return nil, nil
+	}
+	all, _ := v.Get("profiles").(map[string]any)
+	p, ok := all[name].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProfile, name)
+	}
+	if err := v.MergeConfigMap(p); err != nil {
+		return nil, err
+	}
+	settings := map[string]string{}
+	flatten("", p, settings)
+	out.Profile = name
+	return settings, nil
+}
+
+// Файловый keyring не учитывает имя сервиса, поэтому его каталог тоже
+// получает суффикс профиля.
+func isolateProfile(out *Config, settings map[string]string) {
+	if out.Profile == "" {
+		return
+	}
+	if _, ok := settings["auth.token_store_service"]; !ok && out.Auth.TokenStoreService != "" {
+		out.Auth.TokenStoreService += "-" + out.Profile
+	}
+	if _, ok := settings["cache.path"]; !ok && out.Cache.Path != "" {
+		out.Cache.Path = filepath.Join(filepath.Dir(out.Cache.Path), "profiles", out.Profile, filepath.Base(out.Cache.Path))
+	}
+	if _, ok := settings["auth.file_dir"]; !ok && out.Auth.FileDir != "" {
+		out.Auth.FileDir = filepath.Join(out.Auth.FileDir, "profiles", out.Profile)
+	}
+	if _, ok := settings["agent.socket"]; !ok && out.Agent.Socket != "" {
+		ext := filepath.Ext(out.Agent.Socket)
+		out.Agent.Socket = strings.TrimSuffix(out.Agent.Socket, ext) + "-" + out.Profile + ext
+	}
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadProfile(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	f, err := ReadFile(cfgPath)
+	require.NoError(t, err)
+	f.SetProfile("dev", map[string]string{"server.base_url": "https://dev.example/api/v1"})
+	f.SetProfile("prod", map[string]string{"server.base_url": "https://prod.example/api/v1", "cache.path": "/var/prod.db"})
+	f.SetCurrentProfile("dev")
+	require.NoError(t, f.Write())
+	fi, err := os.Stat(cfgPath)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	load := func(profile string) (Config, error) {
+		v := viper.New()
+		v.Set("config.file", cfgPath)
+		v.SetDefault("server.base_url", "https://localhost:8443/api/v1")
+		v.SetDefault("auth.token_store_service", "sufir-keeper-client")
+		v.SetDefault("auth.file_dir", "/keys")
+		v.SetDefault("cache.path", "/data/cache.db")
+		v.SetDefault("agent.socket", "/run/keepcli-agent.sock")
+		if profile != "" {
+			v.Set("profile", profile)
+		}
+		var cfg Config
+		return cfg, Load(v, &cfg)
+	}
+
+	cfg, err := load("")
+	require.NoError(t, err)
+	require.Equal(t, "dev", cfg.Profile)
+	require.Equal(t, "https://dev.example/api/v1", cfg.Server.BaseURL)
+	require.Equal(t, "sufir-keeper-client-dev", cfg.Auth.TokenStoreService)
+	require.Equal(t, filepath.Join("/keys", "profiles", "dev"), cfg.Auth.FileDir)
+	require.Equal(t, filepath.Join("/data", "profiles", "dev", "cache.db"), cfg.Cache.Path)
+	require.Equal(t, "/run/keepcli-agent-dev.sock", cfg.Agent.Socket)
+
+	cfg, err = load("prod")
+	require.NoError(t, err)
+	require.Equal(t, "https://prod.example/api/v1", cfg.Server.BaseURL)
+	require.Equal(t, "/var/prod.db", cfg.Cache.Path, "путь из профиля не меняется")
+
+	t.Setenv("SUFIR_KEEPER_PROFILE", "prod")
+	cfg, err = load("")
+	require.NoError(t, err)
+	require.Equal(t, "prod", cfg.Profile)
+
+	_, err = load("staging")
+	require.ErrorIs(t, err, ErrUnknownProfile)
+
+	require.True(t, f.RemoveProfile("dev"))
+	require.Empty(t, f.CurrentProfile())
+	require.Equal(t, []string{"prod"}, f.Profiles())
+}
+
+func TestValidateProfileName(t *testing.T) {
+	require.NoError(t, ValidateProfileName("dev-2"))
+	for _, name := range []string{"", "Dev", "a/b", "-x", "прод"} {
+		require.Error(t, ValidateProfileName(name), name)
+	}
+}
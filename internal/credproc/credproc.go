@@ -0,0 +1,159 @@
+package credproc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	openapi_types "github.com/oapi-codegen/runtime/types"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/service"
+)
+
+const (
+	MetaExpiration   = "expiration"
+	MetaSessionToken = "session_token"
+
+	K8sAPIVersionV1      = "client.authentication.k8s.io/v1"
+	K8sAPIVersionV1beta1 = "client.authentication.k8s.io/v1beta1"
+)
+
+type Items interface {
+	GetCacheFirst(ctx context.Context, id openapi_types.UUID) (*apigen.GetItemResponse, error)
+	Get(ctx context.Context, id openapi_types.UUID) (*apigen.GetItemResponse, error)
+}
+
+type AWSCredentials struct {
+	Version         int    `json:"Version"`
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"SessionToken,omitempty"`
+	Expiration      string `json:"Expiration,omitempty"`
+}
+
+type ExecCredentialStatus struct {
+	ExpirationTimestamp string `json:"expirationTimestamp,omitempty"`
+	Token               string `json:"token"`
+}
+
+type ExecCredential struct {
+	Status     ExecCredentialStatus `json:"status"`
+	APIVersion string               `json:"apiVersion"`
+	Kind       string               `json:"kind"`
+}
+
+// Load читает запись из кеша и идёт в сеть только если кеш пуст, устарел
+// или срок действия учётных данных из meta уже истёк.
+func Load(ctx context.Context, items Items, id openapi_types.UUID, now time.Time) (apigen.ItemResponse, error) {
+	resp, err := items.GetCacheFirst(ctx, id)
+	if err != nil {
+		return apigen.ItemResponse{}, err
+	}
+	if resp.JSON200 == nil {
+		return apigen.ItemResponse{}, errors.New("item not found")
+	}
+	exp, err := Expiration(*resp.JSON200)
+	if err != nil || exp == nil || exp.After(now) || !service.SourceOf(resp.HTTPResponse).Cached {
+		return *resp.JSON200, err
+	}
+	fresh, ferr := items.Get(ctx, id)
+	if ferr != nil || fresh.JSON200 == nil {
+		return *resp.JSON200, nil
+	}
+	return *fresh.JSON200, nil
+}
+
+func Expiration(item apigen.ItemResponse) (*time.Time, error) {
+	if item.Meta == nil {
+		return nil, nil
+	}
+	v := strings.TrimSpace((*item.Meta)[MetaExpiration])
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s meta: %w", MetaExpiration, err)
+	}
+	t = t.UTC()
+	return &t, nil
+}
+
+func AWS(item apigen.ItemResponse) (AWSCredentials, error) {
+	if item.Data == nil {
+		return AWSCredentials{}, errors.New("item has no data")
+	}
+	out := AWSCredentials{Version: 1}
+	if c, err := item.Data.AsCredentialData(); err == nil && c.Type == apigen.CREDENTIAL {
+		out.AccessKeyID = c.Login
+		out.SecretAccessKey = c.Password
+		if item.Meta != nil {
+			out.SessionToken = (*item.Meta)[MetaSessionToken]
+		}
+	} else if t, err := item.Data.AsTextData(); err == nil && t.Type == apigen.TEXT {
+		if err := json.Unmarshal([]byte(t.Value), &out); err != nil {
+			return AWSCredentials{}, fmt.Errorf("TEXT value must be credential_process JSON: %w", err)
+		}
+		out.Version = 1
+	} else {
+		return AWSCredentials{}, errors.New("unsupported item type, use CREDENTIAL or TEXT")
+	}
+	if out.AccessKeyID == "" || out.SecretAccessKey == "" {
+		return AWSCredentials{}, errors.New("access key id and secret access key required")
+	}
+	exp, err := Expiration(item)
+	if err != nil {
+		return AWSCredentials{}, err
+	}
+	if exp != nil {
+		out.Expiration = exp.Format(time.RFC3339)
+	}
+	return out, nil
+}
+
+func K8s(item apigen.ItemResponse, apiVersion string) (ExecCredential, error) {
+	if item.Data == nil {
+		return ExecCredential{}, errors.New("item has no data")
+	}
+	if apiVersion == "" {
+		apiVersion = K8sAPIVersionV1
+	}
+	out := ExecCredential{APIVersion: apiVersion, Kind: "ExecCredential"}
+	if c, err := item.Data.AsCredentialData(); err == nil && c.Type == apigen.CREDENTIAL {
+		out.Status.Token = c.Password
+	} else if t, err := item.Data.AsTextData(); err == nil && t.Type == apigen.TEXT {
+		out.Status.Token = strings.TrimSpace(t.Value)
+	} else {
+		return ExecCredential{}, errors.New("unsupported item type, use CREDENTIAL or TEXT")
+	}
+	if out.Status.Token == "" {
+		return ExecCredential{}, errors.New("empty token")
+	}
+	exp, err := Expiration(item)
+	if err != nil {
+		return ExecCredential{}, err
+	}
+	if exp != nil {
+		out.Status.ExpirationTimestamp = exp.Format(time.RFC3339)
+	}
+	return out, nil
+}
+
+// K8sAPIVersion берёт apiVersion из KUBERNETES_EXEC_INFO, который kubectl
+// передаёт exec-плагину.
+func K8sAPIVersion(execInfo string) string {
+	if strings.TrimSpace(execInfo) == "" {
+		return K8sAPIVersionV1
+	}
+	var info struct {
+		APIVersion string `json:"apiVersion"`
+	}
+	if err := json.Unmarshal([]byte(execInfo), &info); err != nil || info.APIVersion == "" {
+		return K8sAPIVersionV1
+	}
+	return info.APIVersion
+}
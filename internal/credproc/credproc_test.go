@@ -0,0 +1,129 @@
+package credproc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/99designs/keyring"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/cache"
+	"github.com/GoLessons/sufir-keeper-client/internal/config"
+	"github.com/GoLessons/sufir-keeper-client/internal/service"
+)
+
+func itemFromJSON(t *testing.T, s string) apigen.ItemResponse {
+	t.Helper()
+	var it apigen.ItemResponse
+	require.NoError(t, json.Unmarshal([]byte(s), &it))
+	return it
+}
+
+func TestAWSFromCredential(t *testing.T) {
+	it := itemFromJSON(t, `{"data":{"type":"CREDENTIAL","login":"AKIA","password":"secret"},"meta":{"session_token":"st","expiration":"2030-01-02T03:04:05+03:00"}}`)
+	out, err := AWS(it)
+	require.NoError(t, err)
+	require.Equal(t, AWSCredentials{Version: 1, AccessKeyID: "AKIA", SecretAccessKey: "secret", SessionToken: "st", Expiration: "2030-01-02T00:04:05Z"}, out)
+}
+
+func TestAWSFromText(t *testing.T) {
+	it := itemFromJSON(t, `{"data":{"type":"TEXT","value":"{\"AccessKeyId\":\"A\",\"SecretAccessKey\":\"S\"}"}}`)
+	out, err := AWS(it)
+	require.NoError(t, err)
+	require.Equal(t, "A", out.AccessKeyID)
+	require.Empty(t, out.Expiration)
+
+	_, err = AWS(itemFromJSON(t, `{"data":{"type":"TEXT","value":"plain"}}`))
+	require.Error(t, err)
+	_, err = AWS(itemFromJSON(t, `{"data":{"type":"CARD","card_number":"1","card_holder":"h","expiry_date":"01/30","cvv":"1"}}`))
+	require.Error(t, err)
+}
+
+func TestK8s(t *testing.T) {
+	it := itemFromJSON(t, `{"data":{"type":"TEXT","value":" tok \n"},"meta":{"expiration":"2030-01-01T00:00:00Z"}}`)
+	out, err := K8s(it, K8sAPIVersionV1beta1)
+	require.NoError(t, err)
+	b, err := json.Marshal(out)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"apiVersion":"client.authentication.k8s.io/v1beta1","kind":"ExecCredential","status":{"token":"tok","expirationTimestamp":"2030-01-01T00:00:00Z"}}`, string(b))
+
+	out, err = K8s(itemFromJSON(t, `{"data":{"type":"CREDENTIAL","login":"u","password":"p"}}`), "")
+	require.NoError(t, err)
+	require.Equal(t, "p", out.Status.Token)
+	require.Equal(t, K8sAPIVersionV1, out.APIVersion)
+
+	_, err = K8s(itemFromJSON(t, `{"data":{"type":"TEXT","value":"x"},"meta":{"expiration":"tomorrow"}}`), "")
+	require.Error(t, err)
+}
+
+func TestK8sAPIVersion(t *testing.T) {
+	require.Equal(t, K8sAPIVersionV1, K8sAPIVersion(""))
+	require.Equal(t, K8sAPIVersionV1beta1, K8sAPIVersion(`{"apiVersion":"client.authentication.k8s.io/v1beta1","kind":"ExecCredential"}`))
+	require.Equal(t, K8sAPIVersionV1, K8sAPIVersion("{"))
+}
+
+func newCountingService(t *testing.T, body string, hits *int32) *service.ItemsService {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/items/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	dir := t.TempDir()
+	cm, err := cache.New(cache.Options{
+		Path:       filepath.Join(dir, "cache.db"),
+		TTLMinutes: 5,
+		KeyringConfig: keyring.Config{
+			AllowedBackends:  []keyring.BackendType{keyring.FileBackend},
+			FileDir:          dir,
+			FilePasswordFunc: func(string) (string, error) { return "pw", nil },
+			ServiceName:      "sufir-keeper-client",
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = cm.Close() })
+	apiClient, err := apigen.NewClientWithResponses(srv.URL, apigen.WithHTTPClient(srv.Client()))
+	require.NoError(t, err)
+	cfg := config.Config{}
+	cfg.Cache.Enabled = true
+	return service.NewItemsService(api.NewWrapperFromAPI(apiClient), cm, cfg)
+}
+
+func TestLoadUsesCacheWithinTTL(t *testing.T) {
+	var hits int32
+	svc := newCountingService(t, `{"data":{"type":"TEXT","value":"tok"},"meta":{"expiration":"2030-01-01T00:00:00Z"}}`, &hits)
+	id := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	it, err := Load(context.Background(), svc, id, now)
+	require.NoError(t, err)
+	require.NotNil(t, it.Data)
+	_, err = Load(context.Background(), svc, id, now)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
+
+func TestLoadRefetchesExpired(t *testing.T) {
+	var hits int32
+	svc := newCountingService(t, `{"data":{"type":"TEXT","value":"tok"},"meta":{"expiration":"2020-01-01T00:00:00Z"}}`, &hits)
+	id := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := Load(context.Background(), svc, id, now)
+	require.NoError(t, err)
+	_, err = Load(context.Background(), svc, id, now)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&hits))
+}
@@ -0,0 +1,206 @@
+package dockercred
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	openapi_types "github.com/oapi-codegen/runtime/types"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apiutil"
+)
+
+const (
+	MetaServer = "docker_server"
+	BinaryName = "docker-credential-keepcli"
+)
+
+// Текст ошибки проверяется docker CLI, менять нельзя.
+var ErrNotFound = errors.New("credentials not found in native keychain")
+
+type Items interface {
+	Find(ctx context.Context, itemType *apigen.ItemType, match func(apigen.ItemListResponse) bool) ([]apigen.ItemResponse, error)
+	Create(ctx context.Context, body apigen.ItemCreate) (*apigen.CreateItemResponse, error)
+	Update(ctx context.Context, id openapi_types.UUID, body apigen.UpdateItemJSONRequestBody) (*apigen.UpdateItemResponse, error)
+	Delete(ctx context.Context, id openapi_types.UUID) (*apigen.DeleteItemResponse, error)
+}
+
+type Credentials struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+type Helper struct {
+	items Items
+}
+
+func NewHelper(items Items) *Helper {
+	return &Helper{items: items}
+}
+
+func (h *Helper) Serve(ctx context.Context, action string, in io.Reader, out io.Writer) error {
+	switch action {
+	case "store":
+		var c Credentials
+		if err := json.NewDecoder(in).Decode(&c); err != nil {
+			return err
+		}
+		return h.Store(ctx, c)
+	case "get":
+		server, err := readServerURL(in)
+		if err != nil {
+			return err
+		}
+		c, err := h.Get(ctx, server)
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(out).Encode(c)
+	case "erase":
+		server, err := readServerURL(in)
+		if err != nil {
+			return err
+		}
+		return h.Erase(ctx, server)
+	case "list":
+		l, err := h.List(ctx)
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(out).Encode(l)
+	default:
+		return fmt.Errorf("unknown credential action %q", action)
+	}
+}
+
+func (h *Helper) Get(ctx context.Context, serverURL string) (Credentials, error) {
+	found, err := h.find(ctx, serverURL)
+	if err != nil {
+		return Credentials{}, err
+	}
+	for _, it := range found {
+		if c, ok := apiutil.Credential(it); ok {
+			return Credentials{ServerURL: serverURL, Username: c.Login, Secret: c.Password}, nil
+		}
+	}
+	return Credentials{}, ErrNotFound
+}
+
+func (h *Helper) Store(ctx context.Context, c Credentials) error {
+	if strings.TrimSpace(c.ServerURL) == "" {
+		return errors.New("missing server url")
+	}
+	data := apigen.CredentialData{Type: apigen.CREDENTIAL, Login: c.Username, Password: c.Secret}
+	found, err := h.find(ctx, c.ServerURL)
+	if err != nil {
+		return err
+	}
+	for _, it := range found {
+		if it.Id == nil {
+			continue
+		}
+		var d apigen.ItemUpdate_Data
+		if err := d.FromCredentialData(data); err != nil {
+			return err
+		}
+		_, err := h.items.Update(ctx, *it.Id, apigen.ItemUpdate{Data: &d})
+		return err
+	}
+	var d apigen.ItemCreate_Data
+	if err := d.FromCredentialData(data); err != nil {
+		return err
+	}
+	meta := map[string]string{MetaServer: c.ServerURL}
+	_, err = h.items.Create(ctx, apigen.ItemCreate{Title: c.ServerURL, Data: d, Meta: &meta})
+	return err
+}
+
+func (h *Helper) Erase(ctx context.Context, serverURL string) error {
+	found, err := h.find(ctx, serverURL)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return ErrNotFound
+	}
+	for _, it := range found {
+		if it.Id == nil {
+			continue
+		}
+		if _, err := h.items.Delete(ctx, *it.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Helper) List(ctx context.Context) (map[string]string, error) {
+	t := apigen.ItemTypeCREDENTIAL
+	found, err := h.items.Find(ctx, &t, func(it apigen.ItemListResponse) bool {
+		return serverOf(it.Meta) != ""
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]string, len(found))
+	for _, it := range found {
+		if c, ok := apiutil.Credential(it); ok {
+			out[serverOf(it.Meta)] = c.Login
+		}
+	}
+	return out, nil
+}
+
+func (h *Helper) find(ctx context.Context, serverURL string) ([]apigen.ItemResponse, error) {
+	want := Normalize(serverURL)
+	t := apigen.ItemTypeCREDENTIAL
+	return h.items.Find(ctx, &t, func(it apigen.ItemListResponse) bool {
+		s := serverOf(it.Meta)
+		return s != "" && Normalize(s) == want
+	})
+}
+
+func IsHelperName(argv0 string) bool {
+	base := argv0
+	if i := strings.LastIndexAny(base, `/\`); i >= 0 {
+		base = base[i+1:]
+	}
+	base = strings.TrimSuffix(base, ".exe")
+	return base == BinaryName
+}
+
+func Normalize(serverURL string) string {
+	s := strings.TrimSpace(serverURL)
+	s = strings.TrimPrefix(s, "https://")
+	s = strings.TrimPrefix(s, "http://")
+	s = strings.TrimRight(s, "/")
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		return strings.ToLower(s[:i]) + s[i:]
+	}
+	return strings.ToLower(s)
+}
+
+func readServerURL(in io.Reader) (string, error) {
+	b, err := io.ReadAll(in)
+	if err != nil {
+		return "", err
+	}
+	s := string(bytes.TrimSpace(b))
+	if s == "" {
+		return "", errors.New("missing server url")
+	}
+	return s, nil
+}
+
+func serverOf(meta *map[string]string) string {
+	if meta == nil {
+		return ""
+	}
+	return (*meta)[MetaServer]
+}
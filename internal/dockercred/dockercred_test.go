@@ -0,0 +1,155 @@
+package dockercred
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/99designs/keyring"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/cache"
+	"github.com/GoLessons/sufir-keeper-client/internal/config"
+	"github.com/GoLessons/sufir-keeper-client/internal/service"
+)
+
+type fakeVault struct {
+	items   map[string]map[string]any
+	created []apigen.ItemCreate
+	updated []string
+	deleted []string
+	mu      sync.Mutex
+}
+
+func (f *fakeVault) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/items", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			var body apigen.ItemCreate
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			f.created = append(f.created, body)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":"00000000-0000-0000-0000-0000000000ff"}`))
+			return
+		}
+		list := make([]map[string]any, 0, len(f.items))
+		for id, it := range f.items {
+			list = append(list, map[string]any{"id": id, "meta": it["meta"]})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"items": list, "total": len(list)})
+	})
+	mux.HandleFunc("/items/", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		id := strings.TrimPrefix(r.URL.Path, "/items/")
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodDelete:
+			f.deleted = append(f.deleted, id)
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodPut:
+			f.updated = append(f.updated, id)
+			_ = json.NewEncoder(w).Encode(f.items[id])
+		default:
+			_ = json.NewEncoder(w).Encode(f.items[id])
+		}
+	})
+	return mux
+}
+
+func newTestHelper(t *testing.T, v *fakeVault) *Helper {
+	t.Helper()
+	srv := httptest.NewServer(v.handler())
+	t.Cleanup(srv.Close)
+	dir := t.TempDir()
+	cm, err := cache.New(cache.Options{
+		Path:       filepath.Join(dir, "cache.db"),
+		TTLMinutes: 5,
+		KeyringConfig: keyring.Config{
+			AllowedBackends:  []keyring.BackendType{keyring.FileBackend},
+			FileDir:          dir,
+			FilePasswordFunc: func(string) (string, error) { return "pw", nil },
+			ServiceName:      "sufir-keeper-client",
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = cm.Close() })
+	apiClient, err := apigen.NewClientWithResponses(srv.URL, apigen.WithHTTPClient(srv.Client()))
+	require.NoError(t, err)
+	cfg := config.Config{}
+	cfg.Cache.Enabled = true
+	return NewHelper(service.NewItemsService(api.NewWrapperFromAPI(apiClient), cm, cfg))
+}
+
+func registryItem(id, server, login, secret string) map[string]any {
+	return map[string]any{
+		"id":   id,
+		"meta": map[string]string{MetaServer: server},
+		"data": map[string]string{"type": "CREDENTIAL", "login": login, "password": secret},
+	}
+}
+
+func TestHelper_GetListProtocol(t *testing.T) {
+	v := &fakeVault{items: map[string]map[string]any{
+		"00000000-0000-0000-0000-000000000001": registryItem("00000000-0000-0000-0000-000000000001", "https://registry.example.com", "bob", "s3cret"),
+		"00000000-0000-0000-0000-000000000002": registryItem("00000000-0000-0000-0000-000000000002", "ghcr.io", "alice", "tok"),
+	}}
+	h := newTestHelper(t, v)
+
+	var out bytes.Buffer
+	require.NoError(t, h.Serve(context.Background(), "get", strings.NewReader("registry.example.com/\n"), &out))
+	var c Credentials
+	require.NoError(t, json.Unmarshal(out.Bytes(), &c))
+	require.Equal(t, Credentials{ServerURL: "registry.example.com/", Username: "bob", Secret: "s3cret"}, c)
+
+	out.Reset()
+	require.NoError(t, h.Serve(context.Background(), "list", strings.NewReader(""), &out))
+	var l map[string]string
+	require.NoError(t, json.Unmarshal(out.Bytes(), &l))
+	require.Equal(t, map[string]string{"https://registry.example.com": "bob", "ghcr.io": "alice"}, l)
+
+	out.Reset()
+	err := h.Serve(context.Background(), "get", strings.NewReader("unknown.example.com"), &out)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Empty(t, out.String())
+}
+
+func TestHelper_StoreErase(t *testing.T) {
+	v := &fakeVault{items: map[string]map[string]any{
+		"00000000-0000-0000-0000-000000000001": registryItem("00000000-0000-0000-0000-000000000001", "ghcr.io", "alice", "old"),
+	}}
+	h := newTestHelper(t, v)
+
+	in := `{"ServerURL":"https://ghcr.io","Username":"alice","Secret":"new"}`
+	require.NoError(t, h.Serve(context.Background(), "store", strings.NewReader(in), &bytes.Buffer{}))
+	require.Equal(t, []string{"00000000-0000-0000-0000-000000000001"}, v.updated)
+	require.Empty(t, v.created)
+
+	in = `{"ServerURL":"quay.io","Username":"eve","Secret":"x"}`
+	require.NoError(t, h.Serve(context.Background(), "store", strings.NewReader(in), &bytes.Buffer{}))
+	require.Len(t, v.created, 1)
+	require.Equal(t, "quay.io", (*v.created[0].Meta)[MetaServer])
+
+	require.NoError(t, h.Serve(context.Background(), "erase", strings.NewReader("ghcr.io"), &bytes.Buffer{}))
+	require.Equal(t, []string{"00000000-0000-0000-0000-000000000001"}, v.deleted)
+	require.ErrorIs(t, h.Erase(context.Background(), "nothing.example.com"), ErrNotFound)
+}
+
+func TestIsHelperNameAndNormalize(t *testing.T) {
+	require.True(t, IsHelperName("/usr/local/bin/docker-credential-keepcli"))
+	require.True(t, IsHelperName(`C:\bin\docker-credential-keepcli.exe`))
+	require.False(t, IsHelperName("keepcli"))
+	require.Equal(t, "registry.example.com/v1", Normalize("https://Registry.Example.com/v1/"))
+	require.Equal(t, Normalize("ghcr.io"), Normalize("https://ghcr.io/"))
+}
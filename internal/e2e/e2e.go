@@ -0,0 +1,193 @@
+package e2e
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// Данные лежат в TEXT-конверте; MetaType — исходный тип для фильтров.
+	MetaMarker = "e2e"
+	MetaType   = "e2e_type"
+	MarkerV1   = "v1"
+
+	KDFArgon2id = "argon2id"
+
+	keySize  = chacha20poly1305.KeySize
+	checkMsg = "keepcli-e2e-check"
+)
+
+var (
+	ErrWrongPassword = errors.New("неверный мастер-пароль")
+	ErrLocked        = errors.New("запись зашифрована, выполните keepcli e2e unlock")
+	ErrUnknownKey    = errors.New("запись зашифрована другим ключом, выполните keepcli e2e unlock")
+	ErrMalformed     = errors.New("повреждённый e2e-конверт")
+
+	aadDataKey = []byte("keepcli-e2e/v1/dek")
+	aadPayload = []byte("keepcli-e2e/v1/data")
+	aadCheck   = []byte("keepcli-e2e/v1/check")
+)
+
+// Params не секретны и хранятся на сервере рядом с данными.
+type Params struct {
+	KDF       string `json:"kdf"`
+	Salt      []byte `json:"salt"`
+	Check     string `json:"check"`
+	Time      uint32 `json:"t"`
+	MemoryKiB uint32 `json:"m"`
+	Version   int    `json:"v"`
+	Threads   uint8  `json:"p"`
+}
+
+func NewParams() (Params, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return Params{}, err
+	}
+	return Params{Version: 1, KDF: KDFArgon2id, Salt: salt, Time: 3, MemoryKiB: 64 * 1024, Threads: 4}, nil
+}
+
+func (p Params) KeyID() string {
+	sum := sha256.Sum256(p.Salt)
+	return hex.EncodeToString(sum[:8])
+}
+
+type Key struct {
+	ID    string
+	Bytes []byte
+}
+
+func Derive(password []byte, p Params) (Key, error) {
+	if p.KDF != KDFArgon2id {
+		return Key{}, fmt.Errorf("unsupported kdf %q", p.KDF)
+	}
+	if len(p.Salt) == 0 || p.Time == 0 || p.MemoryKiB == 0 || p.Threads == 0 {
+		return Key{}, errors.New("invalid kdf parameters")
+	}
+	k := Key{ID: p.KeyID(), Bytes: argon2.IDKey(password, p.Salt, p.Time, p.MemoryKiB, p.Threads, keySize)}
+	if p.Check != "" {
+		raw, err := base64.StdEncoding.DecodeString(p.Check)
+		if err != nil {
+			return Key{}, ErrMalformed
+		}
+		pt, err := open(k.Bytes, raw, aadCheck)
+		if err != nil || string(pt) != checkMsg {
+			return Key{}, ErrWrongPassword
+		}
+	}
+	return k, nil
+}
+
+func (p Params) WithCheck(k Key) (Params, error) {
+	ct, err := seal(k.Bytes, []byte(checkMsg), aadCheck)
+	if err != nil {
+		return Params{}, err
+	}
+	p.Check = base64.StdEncoding.EncodeToString(ct)
+	return p, nil
+}
+
+type envelope struct {
+	KeyID      string `json:"kid"`
+	WrappedKey []byte `json:"wk"`
+	Ciphertext []byte `json:"ct"`
+	Version    int    `json:"v"`
+}
+
+// Sealer открывает конверты любым из известных ему ключей.
+type Sealer struct {
+	keys    map[string][]byte
+	current string
+}
+
+func NewSealer(current Key, others ...Key) *Sealer {
+	s := &Sealer{keys: map[string][]byte{current.ID: current.Bytes}, current: current.ID}
+	for _, k := range others {
+		s.keys[k.ID] = k.Bytes
+	}
+	return s
+}
+
+func (s *Sealer) KeyID() string {
+	return s.current
+}
+
+// Ключ данных новый для каждого конверта и оборачивается мастер-ключом.
+func (s *Sealer) Seal(plaintext []byte) (string, error) {
+	dek := make([]byte, keySize)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	wk, err := seal(s.keys[s.current], dek, aadDataKey)
+	if err != nil {
+		return "", err
+	}
+	ct, err := seal(dek, plaintext, aadPayload)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(envelope{Version: 1, KeyID: s.current, WrappedKey: wk, Ciphertext: ct})
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (s *Sealer) Open(sealed string) ([]byte, error) {
+	var env envelope
+	if err := json.Unmarshal([]byte(sealed), &env); err != nil || env.Version != 1 {
+		return nil, ErrMalformed
+	}
+	kek, ok := s.keys[env.KeyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	dek, err := open(kek, env.WrappedKey, aadDataKey)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	pt, err := open(dek, env.Ciphertext, aadPayload)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	return pt, nil
+}
+
+func SealedWith(sealed string) (string, error) {
+	var env envelope
+	if err := json.Unmarshal([]byte(sealed), &env); err != nil || env.Version != 1 {
+		return "", ErrMalformed
+	}
+	return env.KeyID, nil
+}
+
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(key, data, aad []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], aad)
+}
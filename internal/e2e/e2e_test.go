@@ -0,0 +1,180 @@
+package e2e
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	openapi_types "github.com/oapi-codegen/runtime/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+)
+
+func testParams(t *testing.T) Params {
+	t.Helper()
+	p, err := NewParams()
+	require.NoError(t, err)
+	p.Time, p.MemoryKiB, p.Threads = 1, 64, 1
+	return p
+}
+
+func TestDeriveChecksPassword(t *testing.T) {
+	p := testParams(t)
+	k, err := Derive([]byte("pw"), p)
+	require.NoError(t, err)
+	p, err = p.WithCheck(k)
+	require.NoError(t, err)
+
+	again, err := Derive([]byte("pw"), p)
+	require.NoError(t, err)
+	require.Equal(t, k, again)
+	_, err = Derive([]byte("other"), p)
+	require.ErrorIs(t, err, ErrWrongPassword)
+}
+
+func TestSealOpen(t *testing.T) {
+	p := testParams(t)
+	k, err := Derive([]byte("pw"), p)
+	require.NoError(t, err)
+	s := NewSealer(k)
+
+	sealed, err := s.Seal([]byte(`{"type":"TEXT","value":"secret"}`))
+	require.NoError(t, err)
+	require.NotContains(t, sealed, "secret")
+	kid, err := SealedWith(sealed)
+	require.NoError(t, err)
+	require.Equal(t, k.ID, kid)
+
+	pt, err := s.Open(sealed)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"type":"TEXT","value":"secret"}`, string(pt))
+
+	other, err := Derive([]byte("pw"), testParams(t))
+	require.NoError(t, err)
+	_, err = NewSealer(other).Open(sealed)
+	require.ErrorIs(t, err, ErrUnknownKey)
+	pt, err = NewSealer(other, k).Open(sealed)
+	require.NoError(t, err)
+	require.NotEmpty(t, pt)
+
+	tampered := []byte(sealed)
+	tampered[len(tampered)/2] ^= 1
+	_, err = s.Open(string(tampered))
+	require.Error(t, err)
+}
+
+type fakeRaw struct {
+	items   map[openapi_types.UUID]apigen.ItemResponse
+	order   []openapi_types.UUID
+	failAt  int
+	updates int
+}
+
+func (f *fakeRaw) GetItems(_ context.Context, params *apigen.GetItemsParams) (*apigen.GetItemsResponse, error) {
+	var list []apigen.ItemListResponse
+	for _, id := range f.order {
+		it := f.items[id]
+		list = append(list, apigen.ItemListResponse{Id: it.Id, Title: it.Title, Meta: it.Meta})
+	}
+	off := *params.Offset
+	if off > len(list) {
+		off = len(list)
+	}
+	page := list[off:min(off+*params.Limit, len(list))]
+	total := len(list)
+	resp := &apigen.GetItemsResponse{}
+	resp.JSON200 = &struct {
+		Items  *[]apigen.ItemListResponse `json:"items,omitempty"`
+		Limit  *int                       `json:"limit,omitempty"`
+		Offset *int                       `json:"offset,omitempty"`
+		Total  *int                       `json:"total,omitempty"`
+	}{Items: &page, Total: &total}
+	return resp, nil
+}
+
+func (f *fakeRaw) GetItem(_ context.Context, id openapi_types.UUID) (*apigen.GetItemResponse, error) {
+	it := f.items[id]
+	return &apigen.GetItemResponse{JSON200: &it}, nil
+}
+
+func (f *fakeRaw) CreateItem(_ context.Context, body apigen.CreateItemJSONRequestBody) (*apigen.CreateItemResponse, error) {
+	id := uuid.New()
+	raw, _ := body.Data.MarshalJSON()
+	var d apigen.ItemResponse_Data
+	_ = d.UnmarshalJSON(raw)
+	title := body.Title
+	f.items[id] = apigen.ItemResponse{Id: &id, Title: &title, Data: &d, Meta: body.Meta}
+	f.order = append(f.order, id)
+	return &apigen.CreateItemResponse{}, nil
+}
+
+func (f *fakeRaw) UpdateItem(_ context.Context, id openapi_types.UUID, body apigen.UpdateItemJSONRequestBody) (*apigen.UpdateItemResponse, error) {
+	f.updates++
+	if f.failAt > 0 && f.updates == f.failAt {
+		return nil, errors.New("connection reset")
+	}
+	it := f.items[id]
+	if body.Data != nil {
+		raw, _ := body.Data.MarshalJSON()
+		var d apigen.ItemResponse_Data
+		_ = d.UnmarshalJSON(raw)
+		it.Data = &d
+	}
+	if body.Meta != nil {
+		it.Meta = body.Meta
+	}
+	f.items[id] = it
+	return &apigen.UpdateItemResponse{}, nil
+}
+
+func TestStateAndRotate(t *testing.T) {
+	ctx := context.Background()
+	raw := &fakeRaw{items: map[openapi_types.UUID]apigen.ItemResponse{}}
+	_, _, err := LoadState(ctx, raw)
+	require.ErrorIs(t, err, ErrNotInitialized)
+
+	p := testParams(t)
+	oldKey, err := Derive([]byte("old"), p)
+	require.NoError(t, err)
+	require.NoError(t, SaveState(ctx, raw, nil, State{Current: p}))
+	st, id, err := LoadState(ctx, raw)
+	require.NoError(t, err)
+	require.NotNil(t, id)
+	require.Equal(t, p.KeyID(), st.Current.KeyID())
+
+	from := NewSealer(oldKey)
+	for range 3 {
+		sealed, err := from.Seal([]byte(`{"type":"TEXT","value":"x"}`))
+		require.NoError(t, err)
+		var d apigen.ItemCreate_Data
+		require.NoError(t, d.FromTextData(apigen.TextData{Type: apigen.TEXT, Value: sealed}))
+		meta := map[string]string{MetaMarker: MarkerV1, MetaType: "TEXT"}
+		_, err = raw.CreateItem(ctx, apigen.ItemCreate{Title: "t", Data: d, Meta: &meta})
+		require.NoError(t, err)
+	}
+
+	newKey, err := Derive([]byte("new"), testParams(t))
+	require.NoError(t, err)
+	to := NewSealer(newKey)
+	raw.failAt = 2
+	n, err := Rotate(ctx, raw, from, to)
+	require.Error(t, err)
+	require.Equal(t, 1, n)
+
+	raw.failAt = 0
+	n, err = Rotate(ctx, raw, from, to)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	for _, it := range raw.items {
+		if (*it.Meta)[MetaMarker] == "" {
+			continue
+		}
+		text, err := it.Data.AsTextData()
+		require.NoError(t, err)
+		_, err = to.Open(text.Value)
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,197 @@
+package e2e
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/99designs/keyring"
+	openapi_types "github.com/oapi-codegen/runtime/types"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apiutil"
+)
+
+const (
+	MetaParams  = "e2e_params"
+	ParamsTitle = "keepcli-e2e"
+
+	localKeyName = "e2e_key"
+)
+
+var ErrNotInitialized = errors.New("e2e-шифрование не настроено, выполните keepcli e2e init")
+
+// RawItems — записи без прозрачного шифрования (api.Wrapper).
+type RawItems interface {
+	GetItems(ctx context.Context, params *apigen.GetItemsParams) (*apigen.GetItemsResponse, error)
+	GetItem(ctx context.Context, id openapi_types.UUID) (*apigen.GetItemResponse, error)
+	CreateItem(ctx context.Context, body apigen.CreateItemJSONRequestBody) (*apigen.CreateItemResponse, error)
+	UpdateItem(ctx context.Context, id openapi_types.UUID, body apigen.UpdateItemJSONRequestBody) (*apigen.UpdateItemResponse, error)
+}
+
+// State хранится в служебной TEXT-записи; Pending заполнен на время смены
+// ключа, чтобы прерванную ротацию можно было продолжить.
+type State struct {
+	Pending *Params `json:"pending,omitempty"`
+	Current Params  `json:"current"`
+}
+
+func LoadState(ctx context.Context, raw RawItems) (State, *openapi_types.UUID, error) {
+	id, err := findParamsItem(ctx, raw)
+	if err != nil {
+		return State{}, nil, err
+	}
+	if id == nil {
+		return State{}, nil, ErrNotInitialized
+	}
+	resp, err := raw.GetItem(ctx, *id)
+	if err != nil {
+		return State{}, nil, err
+	}
+	if resp.JSON200 == nil || resp.JSON200.Data == nil {
+		return State{}, nil, ErrNotInitialized
+	}
+	t, err := resp.JSON200.Data.AsTextData()
+	if err != nil {
+		return State{}, nil, err
+	}
+	var st State
+	if err := json.Unmarshal([]byte(t.Value), &st); err != nil {
+		return State{}, nil, fmt.Errorf("invalid e2e params: %w", err)
+	}
+	return st, id, nil
+}
+
+func SaveState(ctx context.Context, raw RawItems, id *openapi_types.UUID, st State) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	text := apigen.TextData{Type: apigen.TEXT, Value: string(b)}
+	if id == nil {
+		var d apigen.ItemCreate_Data
+		if err := d.FromTextData(text); err != nil {
+			return err
+		}
+		meta := map[string]string{MetaParams: MarkerV1}
+		_, err := raw.CreateItem(ctx, apigen.ItemCreate{Title: ParamsTitle, Data: d, Meta: &meta})
+		return err
+	}
+	var d apigen.ItemUpdate_Data
+	if err := d.FromTextData(text); err != nil {
+		return err
+	}
+	_, err = raw.UpdateItem(ctx, *id, apigen.ItemUpdate{Data: &d})
+	return err
+}
+
+func findParamsItem(ctx context.Context, raw RawItems) (*openapi_types.UUID, error) {
+	var found *openapi_types.UUID
+	err := eachItem(ctx, raw, func(it apigen.ItemListResponse) error {
+		if found == nil && it.Id != nil && it.Meta != nil && (*it.Meta)[MetaParams] != "" {
+			id := *it.Id
+			found = &id
+		}
+		return nil
+	})
+	return found, err
+}
+
+// Записи, уже зашифрованные ключом to, пропускаются: повторный запуск
+// продолжает прерванную ротацию.
+func Rotate(ctx context.Context, raw RawItems, from, to *Sealer) (int, error) {
+	n := 0
+	err := eachItem(ctx, raw, func(it apigen.ItemListResponse) error {
+		if it.Id == nil || it.Meta == nil || (*it.Meta)[MetaMarker] == "" {
+			return nil
+		}
+		resp, err := raw.GetItem(ctx, *it.Id)
+		if err != nil {
+			return err
+		}
+		if resp.JSON200 == nil || resp.JSON200.Data == nil {
+			return nil
+		}
+		t, err := resp.JSON200.Data.AsTextData()
+		if err != nil {
+			return err
+		}
+		kid, err := SealedWith(t.Value)
+		if err != nil {
+			return fmt.Errorf("item %s: %w", it.Id.String(), err)
+		}
+		if kid == to.KeyID() {
+			return nil
+		}
+		pt, err := from.Open(t.Value)
+		if err != nil {
+			return fmt.Errorf("item %s: %w", it.Id.String(), err)
+		}
+		sealed, err := to.Seal(pt)
+		if err != nil {
+			return err
+		}
+		var d apigen.ItemUpdate_Data
+		if err := d.FromTextData(apigen.TextData{Type: apigen.TEXT, Value: sealed}); err != nil {
+			return err
+		}
+		if _, err := raw.UpdateItem(ctx, *it.Id, apigen.ItemUpdate{Data: &d}); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+func eachItem(ctx context.Context, raw RawItems, fn func(apigen.ItemListResponse) error) error {
+	all, err := apiutil.ListAll(ctx, raw.GetItems, apigen.GetItemsParams{})
+	if err != nil {
+		return err
+	}
+	for _, it := range all {
+		if err := fn(it); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type localKey struct {
+	ID  string `json:"kid"`
+	Key string `json:"key"`
+}
+
+func SaveLocalKey(kr keyring.Keyring, k Key) error {
+	b, err := json.Marshal(localKey{ID: k.ID, Key: base64.StdEncoding.EncodeToString(k.Bytes)})
+	if err != nil {
+		return err
+	}
+	return kr.Set(keyring.Item{Key: localKeyName, Data: b})
+}
+
+func LoadLocalKey(kr keyring.Keyring) (Key, error) {
+	it, err := kr.Get(localKeyName)
+	if err != nil {
+		return Key{}, err
+	}
+	var lk localKey
+	if err := json.Unmarshal(it.Data, &lk); err != nil {
+		return Key{}, err
+	}
+	b, err := base64.StdEncoding.DecodeString(lk.Key)
+	if err != nil || len(b) != keySize {
+		return Key{}, errors.New("invalid local e2e key")
+	}
+	return Key{ID: lk.ID, Bytes: b}, nil
+}
+
+func ForgetLocalKey(kr keyring.Keyring) error {
+	err := kr.Remove(localKeyName)
+	if errors.Is(err, keyring.ErrKeyNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,227 @@
+package gitcred
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	openapi_types "github.com/oapi-codegen/runtime/types"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apiutil"
+)
+
+const MetaURL = "url"
+
+type Items interface {
+	Find(ctx context.Context, itemType *apigen.ItemType, match func(apigen.ItemListResponse) bool) ([]apigen.ItemResponse, error)
+	Create(ctx context.Context, body apigen.ItemCreate) (*apigen.CreateItemResponse, error)
+	Update(ctx context.Context, id openapi_types.UUID, body apigen.UpdateItemJSONRequestBody) (*apigen.UpdateItemResponse, error)
+	Delete(ctx context.Context, id openapi_types.UUID) (*apigen.DeleteItemResponse, error)
+}
+
+type Request struct {
+	Protocol string
+	Host     string
+	Path     string
+	Username string
+	Password string
+}
+
+func ParseRequest(r io.Reader) (Request, error) {
+	var req Request
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if line == "" {
+			break
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return Request{}, fmt.Errorf("malformed line %q", line)
+		}
+		switch kv[0] {
+		case "protocol":
+			req.Protocol = kv[1]
+		case "host":
+			req.Host = kv[1]
+		case "path":
+			req.Path = kv[1]
+		case "username":
+			req.Username = kv[1]
+		case "password":
+			req.Password = kv[1]
+		case "url":
+			u, err := url.Parse(kv[1])
+			if err != nil {
+				return Request{}, err
+			}
+			req.Protocol = u.Scheme
+			req.Host = u.Host
+			req.Path = strings.TrimPrefix(u.Path, "/")
+			if u.User != nil {
+				req.Username = u.User.Username()
+				if pw, ok := u.User.Password(); ok {
+					req.Password = pw
+				}
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return Request{}, err
+	}
+	if req.Protocol == "" || req.Host == "" {
+		return Request{}, errors.New("protocol and host required")
+	}
+	return req, nil
+}
+
+func (r Request) URL() string {
+	u := r.Protocol + "://" + r.Host
+	if r.Path != "" {
+		u += "/" + strings.TrimPrefix(r.Path, "/")
+	}
+	return u
+}
+
+type Helper struct {
+	items Items
+}
+
+func NewHelper(items Items) *Helper {
+	return &Helper{items: items}
+}
+
+func (h *Helper) Get(ctx context.Context, req Request, w io.Writer) error {
+	found, err := h.find(ctx, req)
+	if err != nil {
+		return err
+	}
+	var best *apigen.ItemResponse
+	var bestLen int
+	for i := range found {
+		c, ok := apiutil.Credential(found[i])
+		if !ok {
+			continue
+		}
+		if req.Username != "" && c.Login != req.Username {
+			continue
+		}
+		l := len(metaURL(found[i].Meta))
+		if best == nil || l > bestLen {
+			best = &found[i]
+			bestLen = l
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	c, _ := apiutil.Credential(*best)
+	_, err = fmt.Fprintf(w, "username=%s\npassword=%s\n", c.Login, c.Password)
+	return err
+}
+
+func (h *Helper) Store(ctx context.Context, req Request) error {
+	if req.Username == "" || req.Password == "" {
+		return nil
+	}
+	found, err := h.find(ctx, req)
+	if err != nil {
+		return err
+	}
+	target := req.URL()
+	for _, it := range found {
+		c, ok := apiutil.Credential(it)
+		if !ok || it.Id == nil || c.Login != req.Username || metaURL(it.Meta) != target {
+			continue
+		}
+		if c.Password == req.Password {
+			return nil
+		}
+		var d apigen.ItemUpdate_Data
+		if err := d.FromCredentialData(apigen.CredentialData{Type: apigen.CREDENTIAL, Login: req.Username, Password: req.Password}); err != nil {
+			return err
+		}
+		_, err := h.items.Update(ctx, *it.Id, apigen.ItemUpdate{Data: &d})
+		return err
+	}
+	var data apigen.ItemCreate_Data
+	if err := data.FromCredentialData(apigen.CredentialData{Type: apigen.CREDENTIAL, Login: req.Username, Password: req.Password}); err != nil {
+		return err
+	}
+	meta := map[string]string{MetaURL: target}
+	_, err = h.items.Create(ctx, apigen.ItemCreate{Title: strings.TrimPrefix(target, req.Protocol+"://"), Data: data, Meta: &meta})
+	return err
+}
+
+// Erase без имени пользователя удаляет запись, только если она одна для
+// адреса: иначе git стёр бы все учётные данные хоста.
+func (h *Helper) Erase(ctx context.Context, req Request) error {
+	found, err := h.find(ctx, req)
+	if err != nil {
+		return err
+	}
+	var ids []openapi_types.UUID
+	for _, it := range found {
+		c, ok := apiutil.Credential(it)
+		if !ok || it.Id == nil {
+			continue
+		}
+		if req.Username != "" && c.Login != req.Username {
+			continue
+		}
+		if req.Password != "" && c.Password != req.Password {
+			continue
+		}
+		ids = append(ids, *it.Id)
+	}
+	if req.Username == "" && len(ids) > 1 {
+		return nil
+	}
+	for _, id := range ids {
+		if _, err := h.items.Delete(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Helper) find(ctx context.Context, req Request) ([]apigen.ItemResponse, error) {
+	t := apigen.ItemTypeCREDENTIAL
+	return h.items.Find(ctx, &t, func(it apigen.ItemListResponse) bool {
+		return Matches(metaURL(it.Meta), req)
+	})
+}
+
+func Matches(itemURL string, req Request) bool {
+	if itemURL == "" {
+		return false
+	}
+	u, err := url.Parse(itemURL)
+	if err != nil {
+		return false
+	}
+	if !strings.EqualFold(u.Scheme, req.Protocol) || !strings.EqualFold(u.Host, req.Host) {
+		return false
+	}
+	if u.User != nil && req.Username != "" && u.User.Username() != req.Username {
+		return false
+	}
+	itemPath := strings.Trim(u.Path, "/")
+	reqPath := strings.Trim(req.Path, "/")
+	if itemPath == "" || reqPath == "" {
+		return true
+	}
+	return reqPath == itemPath || strings.HasPrefix(reqPath, itemPath+"/")
+}
+
+func metaURL(meta *map[string]string) string {
+	if meta == nil {
+		return ""
+	}
+	return (*meta)[MetaURL]
+}
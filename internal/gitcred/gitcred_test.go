@@ -0,0 +1,180 @@
+package gitcred
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/99designs/keyring"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/cache"
+	"github.com/GoLessons/sufir-keeper-client/internal/config"
+	"github.com/GoLessons/sufir-keeper-client/internal/service"
+)
+
+type fakeVault struct {
+	items   map[string]map[string]any
+	created []apigen.ItemCreate
+	deleted []string
+	mu      sync.Mutex
+}
+
+func (f *fakeVault) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/items", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			var body apigen.ItemCreate
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			f.created = append(f.created, body)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":"00000000-0000-0000-0000-0000000000ff"}`))
+			return
+		}
+		list := make([]map[string]any, 0, len(f.items))
+		for id, it := range f.items {
+			list = append(list, map[string]any{"id": id, "meta": it["meta"]})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"items": list, "total": len(list)})
+	})
+	mux.HandleFunc("/items/", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		id := strings.TrimPrefix(r.URL.Path, "/items/")
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodDelete:
+			f.deleted = append(f.deleted, id)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			_ = json.NewEncoder(w).Encode(f.items[id])
+		}
+	})
+	return mux
+}
+
+func newTestHelper(t *testing.T, srv *httptest.Server) *Helper {
+	t.Helper()
+	dir := t.TempDir()
+	cm, err := cache.New(cache.Options{
+		Path:       filepath.Join(dir, "cache.db"),
+		TTLMinutes: 5,
+		KeyringConfig: keyring.Config{
+			AllowedBackends:  []keyring.BackendType{keyring.FileBackend},
+			FileDir:          dir,
+			FilePasswordFunc: func(string) (string, error) { return "pw", nil },
+			ServiceName:      "sufir-keeper-client",
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = cm.Close() })
+	apiClient, err := apigen.NewClientWithResponses(srv.URL, apigen.WithHTTPClient(srv.Client()))
+	require.NoError(t, err)
+	cfg := config.Config{}
+	cfg.Cache.Enabled = true
+	return NewHelper(service.NewItemsService(api.NewWrapperFromAPI(apiClient), cm, cfg))
+}
+
+func credentialItem(id, u, login, password string) map[string]any {
+	return map[string]any{
+		"id":   id,
+		"meta": map[string]string{MetaURL: u},
+		"data": map[string]string{"type": "CREDENTIAL", "login": login, "password": password},
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	req, err := ParseRequest(strings.NewReader("protocol=https\nhost=git.example.com\npath=org/repo.git\nusername=bob\n\nignored=1\n"))
+	require.NoError(t, err)
+	require.Equal(t, Request{Protocol: "https", Host: "git.example.com", Path: "org/repo.git", Username: "bob"}, req)
+	require.Equal(t, "https://git.example.com/org/repo.git", req.URL())
+
+	req, err = ParseRequest(strings.NewReader("url=https://alice:pw@git.example.com/x\n"))
+	require.NoError(t, err)
+	require.Equal(t, "alice", req.Username)
+	require.Equal(t, "pw", req.Password)
+	require.Equal(t, "x", req.Path)
+
+	_, err = ParseRequest(strings.NewReader("host=only\n"))
+	require.Error(t, err)
+}
+
+func TestMatches(t *testing.T) {
+	req := Request{Protocol: "https", Host: "git.example.com", Path: "org/repo.git"}
+	require.True(t, Matches("https://git.example.com", req))
+	require.True(t, Matches("https://git.example.com/org", req))
+	require.True(t, Matches("https://git.example.com/org/repo.git", req))
+	require.False(t, Matches("https://git.example.com/other", req))
+	require.False(t, Matches("http://git.example.com", req))
+	require.False(t, Matches("https://example.com", req))
+	require.False(t, Matches("", req))
+}
+
+func TestHelper_GetPrefersMostSpecificAndWorksOffline(t *testing.T) {
+	v := &fakeVault{items: map[string]map[string]any{
+		"00000000-0000-0000-0000-000000000001": credentialItem("00000000-0000-0000-0000-000000000001", "https://git.example.com", "bob", "generic"),
+		"00000000-0000-0000-0000-000000000002": credentialItem("00000000-0000-0000-0000-000000000002", "https://git.example.com/org", "bob", "org-token"),
+		"00000000-0000-0000-0000-000000000003": credentialItem("00000000-0000-0000-0000-000000000003", "https://other.example.com", "eve", "nope"),
+	}}
+	srv := httptest.NewServer(v.handler())
+	h := newTestHelper(t, srv)
+	req := Request{Protocol: "https", Host: "git.example.com", Path: "org/repo.git"}
+
+	var out bytes.Buffer
+	require.NoError(t, h.Get(context.Background(), req, &out))
+	require.Equal(t, "username=bob\npassword=org-token\n", out.String())
+
+	srv.Close()
+	out.Reset()
+	require.NoError(t, h.Get(context.Background(), req, &out))
+	require.Equal(t, "username=bob\npassword=org-token\n", out.String())
+}
+
+func TestHelper_StoreAndErase(t *testing.T) {
+	v := &fakeVault{items: map[string]map[string]any{
+		"00000000-0000-0000-0000-000000000001": credentialItem("00000000-0000-0000-0000-000000000001", "https://git.example.com", "bob", "old"),
+	}}
+	srv := httptest.NewServer(v.handler())
+	defer srv.Close()
+	h := newTestHelper(t, srv)
+
+	require.NoError(t, h.Store(context.Background(), Request{Protocol: "https", Host: "new.example.com", Username: "alice", Password: "tok"}))
+	require.Len(t, v.created, 1)
+	require.Equal(t, "new.example.com", v.created[0].Title)
+	require.Equal(t, "https://new.example.com", (*v.created[0].Meta)[MetaURL])
+	c, err := v.created[0].Data.AsCredentialData()
+	require.NoError(t, err)
+	require.Equal(t, "alice", c.Login)
+
+	require.NoError(t, h.Erase(context.Background(), Request{Protocol: "https", Host: "git.example.com", Username: "bob", Password: "other"}))
+	require.Empty(t, v.deleted)
+	require.NoError(t, h.Erase(context.Background(), Request{Protocol: "https", Host: "git.example.com", Username: "bob", Password: "old"}))
+	require.Equal(t, []string{"00000000-0000-0000-0000-000000000001"}, v.deleted)
+}
+
+func TestHelper_EraseWithoutUsernameNeedsSingleMatch(t *testing.T) {
+	v := &fakeVault{items: map[string]map[string]any{
+		"00000000-0000-0000-0000-000000000001": credentialItem("00000000-0000-0000-0000-000000000001", "https://git.example.com", "bob", "b"),
+		"00000000-0000-0000-0000-000000000002": credentialItem("00000000-0000-0000-0000-000000000002", "https://git.example.com", "carol", "c"),
+		"00000000-0000-0000-0000-000000000003": credentialItem("00000000-0000-0000-0000-000000000003", "https://other.example.com", "dave", "d"),
+	}}
+	srv := httptest.NewServer(v.handler())
+	defer srv.Close()
+	h := newTestHelper(t, srv)
+
+	require.NoError(t, h.Erase(context.Background(), Request{Protocol: "https", Host: "git.example.com"}))
+	require.Empty(t, v.deleted, "без имени пользователя несколько записей хоста не удаляются")
+	require.NoError(t, h.Erase(context.Background(), Request{Protocol: "https", Host: "other.example.com"}))
+	require.Equal(t, []string{"00000000-0000-0000-0000-000000000003"}, v.deleted)
+}
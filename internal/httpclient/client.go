@@ -31,6 +31,7 @@ type settings struct {
 	transportMaxResponseHeaderBytes int64
 	transportReadBufferSize         int
 	transportWriteBufferSize        int
+	userAgent                       string
 }
 
 type Option func(*settings)
@@ -102,6 +103,27 @@ func WithTransportWriteBufferSize(n int) Option {
 	}
 }
 
+// WithUserAgent задаёт заголовок User-Agent запросов, в которых он не указан.
+func WithUserAgent(ua string) Option {
+	return func(s *settings) {
+		s.userAgent = ua
+	}
+}
+
+type userAgentTransport struct {
+	next http.RoundTripper
+	ua   string
+}
+
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") != "" {
+		return t.next.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.ua)
+	return t.next.RoundTrip(req)
+}
+
 type loggerAdapter struct {
 	log logging.Logger
 }
@@ -180,6 +202,9 @@ func New(cfg config.Config, log logging.Logger, opts ...Option) (*retryablehttp.
 	}
 
 	base.Timeout = s.timeout
+	if s.userAgent != "" {
+		base.Transport = userAgentTransport{next: transport, ua: s.userAgent}
+	}
 	rc := retryablehttp.NewClient()
 	rc.RetryMax = s.retryMax
 	rc.RetryWaitMin = s.retryWaitMin
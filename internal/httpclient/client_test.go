@@ -171,3 +171,31 @@ func TestInvalidCACert(t *testing.T) {
 	_, err = New(cfg, log)
 	require.Error(t, err)
 }
+
+func TestUserAgent(t *testing.T) {
+	agents := make(chan string, 2)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents <- r.UserAgent()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	caPath := writeServerCertToFile(t, srv)
+	t.Cleanup(func() { _ = os.Remove(caPath) })
+	log, err := logging.NewLogger("error")
+	require.NoError(t, err)
+	client, err := New(config.Config{TLS: config.TLSConfig{CACertPath: caPath}}, log, WithUserAgent("keepcli/test"))
+	require.NoError(t, err)
+
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, "keepcli/test", <-agents)
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("User-Agent", "custom")
+	resp, err = client.HTTPClient.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, "custom", <-agents, "заданный в запросе заголовок не заменяется")
+}
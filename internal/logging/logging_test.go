@@ -1,6 +1,8 @@
 package logging
 
 import (
+	"io"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -40,3 +42,22 @@ func TestLoggerWrappers(t *testing.T) {
 	l.Warn("warn message")
 	l.Error("error message")
 }
+
+func TestLoggerNeverWritesToStdout(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	orig := os.Stdout
+	os.Stdout = w
+	l, err := NewLogger("debug")
+	if err == nil {
+		l.Info("info message")
+		l.Error("error message")
+		_ = l.Sync()
+	}
+	os.Stdout = orig
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Empty(t, out)
+}
@@ -0,0 +1,331 @@
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	openapi_types "github.com/oapi-codegen/runtime/types"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apiutil"
+	"github.com/GoLessons/sufir-keeper-client/internal/cache"
+)
+
+const (
+	itemPrefix = "replica:item:"
+	stateKey   = "replica:state"
+)
+
+var ErrNotFound = apiutil.Error{Status: http.StatusNotFound, Message: "запись не найдена в локальной реплике"}
+
+type Op string
+
+const (
+	OpNone   Op = ""
+	OpCreate Op = "create"
+	OpUpdate Op = "update"
+	OpDelete Op = "delete"
+)
+
+// Record хранится в том виде, в каком её отдал сервер (для e2e —
+// зашифрованной). Base — updated_at на момент последней синхронизации.
+type Record struct {
+	Modified time.Time           `json:"modified"`
+	Base     *time.Time          `json:"base,omitempty"`
+	Op       Op                  `json:"op,omitempty"`
+	Item     apigen.ItemResponse `json:"item"`
+}
+
+type State struct {
+	LastSync time.Time `json:"last_sync"`
+}
+
+// Replica повторяет методы api.Wrapper, чтобы ItemsService работал с ней
+// вместо сервера.
+type Replica struct {
+	c   *cache.Manager
+	now func() time.Time
+}
+
+func New(c *cache.Manager) *Replica {
+	return &Replica{c: c, now: time.Now}
+}
+
+func (r *Replica) State() (State, error) {
+	var st State
+	_, b, _, _, err := r.c.Get(stateKey)
+	if errors.Is(err, cache.ErrNotFound) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	return st, json.Unmarshal(b, &st)
+}
+
+func (r *Replica) saveState(st State) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return r.c.Put(stateKey, nil, b, "")
+}
+
+func (r *Replica) load(id string) (*Record, error) {
+	_, b, _, _, err := r.c.Get(itemPrefix + id)
+	if errors.Is(err, cache.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rec Record
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (r *Replica) save(rec *Record) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return r.c.Put(itemPrefix+rec.Item.Id.String(), nil, b, string(rec.Op))
+}
+
+func (r *Replica) remove(id string) error {
+	return r.c.Delete(itemPrefix + id)
+}
+
+// Records включает удалённые локально записи.
+func (r *Replica) Records() ([]Record, error) {
+	keys, err := r.c.Keys(itemPrefix)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Record, 0, len(keys))
+	for _, k := range keys {
+		rec, err := r.load(strings.TrimPrefix(k, itemPrefix))
+		if err != nil {
+			return nil, err
+		}
+		if rec != nil && rec.Item.Id != nil {
+			out = append(out, *rec)
+		}
+	}
+	return out, nil
+}
+
+func (r *Replica) Pending() ([]Record, error) {
+	all, err := r.Records()
+	if err != nil {
+		return nil, err
+	}
+	var out []Record
+	for _, rec := range all {
+		if rec.Op != OpNone {
+			out = append(out, rec)
+		}
+	}
+	return out, nil
+}
+
+type listPage struct {
+	Items  *[]apigen.ItemListResponse `json:"items,omitempty"`
+	Limit  *int                       `json:"limit,omitempty"`
+	Offset *int                       `json:"offset,omitempty"`
+	Total  *int                       `json:"total,omitempty"`
+}
+
+func (r *Replica) GetItems(_ context.Context, params *apigen.GetItemsParams) (*apigen.GetItemsResponse, error) {
+	all, err := r.Records()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]apigen.ItemResponse, 0, len(all))
+	for _, rec := range all {
+		if rec.Op != OpDelete {
+			items = append(items, rec.Item)
+		}
+	}
+	return listResponse(items, params)
+}
+
+func listResponse(all []apigen.ItemResponse, params *apigen.GetItemsParams) (*apigen.GetItemsResponse, error) {
+	var items []apigen.ItemListResponse
+	for _, it := range all {
+		if matches(it, params) {
+			items = append(items, apigen.ItemListResponse{Id: it.Id, Title: it.Title, Meta: it.Meta, CreatedAt: it.CreatedAt, UpdatedAt: it.UpdatedAt})
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i].CreatedAt, items[j].CreatedAt
+		if a != nil && b != nil && !a.Equal(*b) {
+			return a.Before(*b)
+		}
+		return items[i].Id.String() < items[j].Id.String()
+	})
+	total := len(items)
+	if params != nil && params.Offset != nil {
+		items = items[min(max(*params.Offset, 0), len(items)):]
+	}
+	if params != nil && params.Limit != nil && *params.Limit > 0 && *params.Limit < len(items) {
+		items = items[:*params.Limit]
+	}
+	page := listPage{Items: &items, Total: &total}
+	if params != nil {
+		page.Limit, page.Offset = params.Limit, params.Offset
+	}
+	body, err := json.Marshal(page)
+	if err != nil {
+		return nil, err
+	}
+	resp := &apigen.GetItemsResponse{Body: body}
+	return resp, json.Unmarshal(body, &resp.JSON200)
+}
+
+func matches(it apigen.ItemResponse, params *apigen.GetItemsParams) bool {
+	if params == nil {
+		return true
+	}
+	if params.Type != nil && it.Data != nil && dataType(it.Data) != *params.Type {
+		return false
+	}
+	if params.S != nil && *params.S != "" {
+		title := ""
+		if it.Title != nil {
+			title = *it.Title
+		}
+		return strings.Contains(strings.ToLower(title), strings.ToLower(*params.S))
+	}
+	return true
+}
+
+func (r *Replica) GetItem(_ context.Context, id openapi_types.UUID) (*apigen.GetItemResponse, error) {
+	rec, err := r.load(id.String())
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil || rec.Op == OpDelete {
+		return nil, ErrNotFound
+	}
+	body, err := json.Marshal(rec.Item)
+	if err != nil {
+		return nil, err
+	}
+	item := rec.Item
+	return &apigen.GetItemResponse{Body: body, JSON200: &item}, nil
+}
+
+// Идентификатор клиентский; постоянный выдаст сервер при синхронизации.
+func (r *Replica) CreateItem(_ context.Context, body apigen.CreateItemJSONRequestBody) (*apigen.CreateItemResponse, error) {
+	raw, err := body.Data.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var d apigen.ItemResponse_Data
+	if err := d.UnmarshalJSON(raw); err != nil {
+		return nil, err
+	}
+	id := uuid.New()
+	now := r.now().UTC()
+	title := body.Title
+	rec := &Record{
+		Op:       OpCreate,
+		Modified: now,
+		Item:     apigen.ItemResponse{Id: &id, Title: &title, Data: &d, Meta: cloneMeta(body.Meta), CreatedAt: &now, UpdatedAt: &now},
+	}
+	if err := r.save(rec); err != nil {
+		return nil, err
+	}
+	b, _ := json.Marshal(rec.Item)
+	return &apigen.CreateItemResponse{Body: b, JSON201: &rec.Item}, nil
+}
+
+func (r *Replica) UpdateItem(_ context.Context, id openapi_types.UUID, body apigen.UpdateItemJSONRequestBody) (*apigen.UpdateItemResponse, error) {
+	rec, err := r.load(id.String())
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil || rec.Op == OpDelete {
+		return nil, ErrNotFound
+	}
+	if body.Title != nil {
+		title := *body.Title
+		rec.Item.Title = &title
+	}
+	if body.Meta != nil {
+		rec.Item.Meta = cloneMeta(body.Meta)
+	}
+	if body.Data != nil {
+		raw, err := body.Data.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		if rec.Item.Data != nil && apiutil.DataType(raw) == dataType(rec.Item.Data) {
+			cur, err := rec.Item.Data.MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+			if raw, err = apiutil.MergeData(cur, raw); err != nil {
+				return nil, err
+			}
+		}
+		var d apigen.ItemResponse_Data
+		if err := d.UnmarshalJSON(raw); err != nil {
+			return nil, err
+		}
+		rec.Item.Data = &d
+	}
+	now := r.now().UTC()
+	rec.Item.UpdatedAt = &now
+	rec.Modified = now
+	if rec.Op != OpCreate {
+		rec.Op = OpUpdate
+	}
+	if err := r.save(rec); err != nil {
+		return nil, err
+	}
+	b, _ := json.Marshal(rec.Item)
+	return &apigen.UpdateItemResponse{Body: b, JSON200: &rec.Item}, nil
+}
+
+func (r *Replica) DeleteItem(_ context.Context, id openapi_types.UUID) (*apigen.DeleteItemResponse, error) {
+	rec, err := r.load(id.String())
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil || rec.Op == OpDelete {
+		return nil, ErrNotFound
+	}
+	if rec.Op == OpCreate {
+		return &apigen.DeleteItemResponse{}, r.remove(id.String())
+	}
+	rec.Op = OpDelete
+	rec.Modified = r.now().UTC()
+	return &apigen.DeleteItemResponse{}, r.save(rec)
+}
+
+func dataType(d *apigen.ItemResponse_Data) apigen.ItemType {
+	raw, err := d.MarshalJSON()
+	if err != nil {
+		return ""
+	}
+	return apiutil.DataType(raw)
+}
+
+func cloneMeta(meta *map[string]string) *map[string]string {
+	if meta == nil {
+		return nil
+	}
+	m := maps.Clone(*meta)
+	return &m
+}
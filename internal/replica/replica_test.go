@@ -0,0 +1,298 @@
+package replica
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/99designs/keyring"
+	"github.com/google/uuid"
+	openapi_types "github.com/oapi-codegen/runtime/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apiutil"
+	"github.com/GoLessons/sufir-keeper-client/internal/cache"
+)
+
+type fakeRemote struct {
+	items map[openapi_types.UUID]apigen.ItemResponse
+	clock time.Time
+}
+
+func newFakeRemote() *fakeRemote {
+	return &fakeRemote{items: map[openapi_types.UUID]apigen.ItemResponse{}, clock: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (f *fakeRemote) tick() *time.Time {
+	f.clock = f.clock.Add(time.Minute)
+	t := f.clock
+	return &t
+}
+
+func (f *fakeRemote) GetItems(_ context.Context, params *apigen.GetItemsParams) (*apigen.GetItemsResponse, error) {
+	items := make([]apigen.ItemResponse, 0, len(f.items))
+	for _, it := range f.items {
+		items = append(items, it)
+	}
+	return listResponse(items, params)
+}
+
+func (f *fakeRemote) GetItem(_ context.Context, id openapi_types.UUID) (*apigen.GetItemResponse, error) {
+	it, ok := f.items[id]
+	if !ok {
+		return nil, apiutil.Error{Status: 404, Message: "not found"}
+	}
+	return &apigen.GetItemResponse{JSON200: &it}, nil
+}
+
+func (f *fakeRemote) CreateItem(_ context.Context, body apigen.CreateItemJSONRequestBody) (*apigen.CreateItemResponse, error) {
+	id := uuid.New()
+	raw, _ := body.Data.MarshalJSON()
+	var d apigen.ItemResponse_Data
+	_ = d.UnmarshalJSON(raw)
+	title := body.Title
+	now := f.tick()
+	it := apigen.ItemResponse{Id: &id, Title: &title, Data: &d, Meta: body.Meta, CreatedAt: now, UpdatedAt: now}
+	f.items[id] = it
+	return &apigen.CreateItemResponse{JSON201: &it}, nil
+}
+
+func (f *fakeRemote) UpdateItem(_ context.Context, id openapi_types.UUID, body apigen.UpdateItemJSONRequestBody) (*apigen.UpdateItemResponse, error) {
+	it, ok := f.items[id]
+	if !ok {
+		return nil, apiutil.Error{Status: 404, Message: "not found"}
+	}
+	if body.Title != nil {
+		it.Title = body.Title
+	}
+	if body.Meta != nil {
+		it.Meta = body.Meta
+	}
+	if body.Data != nil {
+		raw, _ := body.Data.MarshalJSON()
+		var d apigen.ItemResponse_Data
+		_ = d.UnmarshalJSON(raw)
+		it.Data = &d
+	}
+	it.UpdatedAt = f.tick()
+	f.items[id] = it
+	return &apigen.UpdateItemResponse{JSON200: &it}, nil
+}
+
+func (f *fakeRemote) DeleteItem(_ context.Context, id openapi_types.UUID) (*apigen.DeleteItemResponse, error) {
+	if _, ok := f.items[id]; !ok {
+		return nil, apiutil.Error{Status: 404, Message: "not found"}
+	}
+	delete(f.items, id)
+	return &apigen.DeleteItemResponse{}, nil
+}
+
+func newTestReplica(t *testing.T) *Replica {
+	t.Helper()
+	dir := t.TempDir()
+	c, err := cache.New(cache.Options{
+		Path:       filepath.Join(dir, "cache.db"),
+		TTLMinutes: 5,
+		KeyringConfig: keyring.Config{
+			AllowedBackends:  []keyring.BackendType{keyring.FileBackend},
+			FileDir:          dir,
+			FilePasswordFunc: func(string) (string, error) { return "pw", nil },
+			ServiceName:      "sufir-keeper-client",
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return New(c)
+}
+
+func textBody(title, value string) apigen.ItemCreate {
+	var d apigen.ItemCreate_Data
+	_ = d.FromTextData(apigen.TextData{Type: apigen.TEXT, Value: value})
+	return apigen.ItemCreate{Title: title, Data: d}
+}
+
+func textUpdate(value string) apigen.ItemUpdate {
+	var d apigen.ItemUpdate_Data
+	_ = d.FromTextData(apigen.TextData{Type: apigen.TEXT, Value: value})
+	return apigen.ItemUpdate{Data: &d}
+}
+
+func valueOf(t *testing.T, it apigen.ItemResponse) string {
+	t.Helper()
+	v, err := it.Data.AsTextData()
+	require.NoError(t, err)
+	return v.Value
+}
+
+func TestSyncPullsAndPushes(t *testing.T) {
+	ctx := context.Background()
+	remote := newFakeRemote()
+	r := newTestReplica(t)
+	created, err := remote.CreateItem(ctx, textBody("a", "1"))
+	require.NoError(t, err)
+	aID := *created.JSON201.Id
+	_, err = remote.CreateItem(ctx, textBody("b", "2"))
+	require.NoError(t, err)
+
+	rep, err := r.Sync(ctx, remote, LastWriterWins)
+	require.NoError(t, err)
+	require.Equal(t, 2, rep.Pulled)
+
+	list, err := r.GetItems(ctx, &apigen.GetItemsParams{})
+	require.NoError(t, err)
+	require.Len(t, *list.JSON200.Items, 2)
+
+	newResp, err := r.CreateItem(ctx, textBody("c", "3"))
+	require.NoError(t, err)
+	_, err = r.UpdateItem(ctx, aID, textUpdate("1b"))
+	require.NoError(t, err)
+	pending, err := r.Pending()
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	require.Len(t, remote.items, 2)
+
+	rep, err = r.Sync(ctx, remote, LastWriterWins)
+	require.NoError(t, err)
+	require.Equal(t, 2, rep.Pushed)
+	require.Zero(t, rep.Conflicts)
+	require.Len(t, remote.items, 3)
+	require.Equal(t, "1b", valueOf(t, remote.items[aID]))
+	_, err = r.GetItem(ctx, *newResp.JSON201.Id)
+	require.ErrorIs(t, err, ErrNotFound)
+	pending, err = r.Pending()
+	require.NoError(t, err)
+	require.Empty(t, pending)
+
+	_, err = r.DeleteItem(ctx, aID)
+	require.NoError(t, err)
+	_, err = r.Sync(ctx, remote, LastWriterWins)
+	require.NoError(t, err)
+	require.Len(t, remote.items, 2)
+	_, ok := remote.items[aID]
+	require.False(t, ok)
+	st, err := r.State()
+	require.NoError(t, err)
+	require.False(t, st.LastSync.IsZero())
+}
+
+func TestSyncRemovesRemotelyDeleted(t *testing.T) {
+	ctx := context.Background()
+	remote := newFakeRemote()
+	r := newTestReplica(t)
+	created, err := remote.CreateItem(ctx, textBody("a", "1"))
+	require.NoError(t, err)
+	_, err = r.Sync(ctx, remote, LastWriterWins)
+	require.NoError(t, err)
+
+	delete(remote.items, *created.JSON201.Id)
+	rep, err := r.Sync(ctx, remote, LastWriterWins)
+	require.NoError(t, err)
+	require.Equal(t, 1, rep.Removed)
+	records, err := r.Records()
+	require.NoError(t, err)
+	require.Empty(t, records)
+}
+
+func TestSyncConflicts(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name        string
+		resolve     Resolver
+		localLater  bool
+		wantRemote  string
+		wantItems   int
+		wantReplica string
+	}{
+		{name: "lww remote newer", resolve: LastWriterWins, wantRemote: "server", wantItems: 1, wantReplica: "server"},
+		{name: "lww local newer", resolve: LastWriterWins, localLater: true, wantRemote: "local", wantItems: 1, wantReplica: "local"},
+		{name: "keep both", resolve: KeepBothVersions, wantRemote: "server", wantItems: 2, wantReplica: "server"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			remote := newFakeRemote()
+			r := newTestReplica(t)
+			created, err := remote.CreateItem(ctx, textBody("a", "1"))
+			require.NoError(t, err)
+			id := *created.JSON201.Id
+			_, err = r.Sync(ctx, remote, tc.resolve)
+			require.NoError(t, err)
+
+			_, err = remote.UpdateItem(ctx, id, textUpdate("server"))
+			require.NoError(t, err)
+			r.now = func() time.Time {
+				if tc.localLater {
+					return remote.clock.Add(time.Hour)
+				}
+				return remote.clock.Add(-time.Hour)
+			}
+			_, err = r.UpdateItem(ctx, id, textUpdate("local"))
+			require.NoError(t, err)
+
+			var seen []Conflict
+			rep, err := r.Sync(ctx, remote, func(c Conflict) (Resolution, error) {
+				seen = append(seen, c)
+				return tc.resolve(c)
+			})
+			require.NoError(t, err)
+			require.Equal(t, 1, rep.Conflicts)
+			require.Len(t, seen, 1)
+			require.Equal(t, "local", valueOf(t, *seen[0].Local))
+			require.Equal(t, "server", valueOf(t, *seen[0].Remote))
+
+			require.Len(t, remote.items, tc.wantItems)
+			require.Equal(t, tc.wantRemote, valueOf(t, remote.items[id]))
+			got, err := r.GetItem(ctx, id)
+			require.NoError(t, err)
+			require.Equal(t, tc.wantReplica, valueOf(t, *got.JSON200))
+			pending, err := r.Pending()
+			require.NoError(t, err)
+			require.Empty(t, pending)
+			if tc.wantItems == 2 {
+				for iid, it := range remote.items {
+					if iid != id {
+						require.Equal(t, "local", valueOf(t, it))
+						require.Equal(t, "a"+keepBothSuffix, *it.Title)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReplicaListFiltersAndMergesUpdates(t *testing.T) {
+	ctx := context.Background()
+	r := newTestReplica(t)
+	_, err := r.CreateItem(ctx, textBody("GitHub", "x"))
+	require.NoError(t, err)
+	var d apigen.ItemCreate_Data
+	require.NoError(t, d.FromCredentialData(apigen.CredentialData{Type: apigen.CREDENTIAL, Login: "bob", Password: "old"}))
+	cred, err := r.CreateItem(ctx, apigen.ItemCreate{Title: "gitlab", Data: d})
+	require.NoError(t, err)
+
+	s := "git"
+	list, err := r.GetItems(ctx, &apigen.GetItemsParams{S: &s})
+	require.NoError(t, err)
+	require.Len(t, *list.JSON200.Items, 2)
+	ct := apigen.ItemTypeCREDENTIAL
+	list, err = r.GetItems(ctx, &apigen.GetItemsParams{Type: &ct})
+	require.NoError(t, err)
+	require.Len(t, *list.JSON200.Items, 1)
+
+	var ud apigen.ItemUpdate_Data
+	require.NoError(t, ud.UnmarshalJSON([]byte(`{"type":"CREDENTIAL","password":"new"}`)))
+	_, err = r.UpdateItem(ctx, *cred.JSON201.Id, apigen.ItemUpdate{Data: &ud})
+	require.NoError(t, err)
+	got, err := r.GetItem(ctx, *cred.JSON201.Id)
+	require.NoError(t, err)
+	c, err := got.JSON200.Data.AsCredentialData()
+	require.NoError(t, err)
+	require.Equal(t, "bob", c.Login)
+	require.Equal(t, "new", c.Password)
+
+	_, err = r.DeleteItem(ctx, *cred.JSON201.Id)
+	require.NoError(t, err)
+	pending, err := r.Pending()
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+}
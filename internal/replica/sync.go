@@ -0,0 +1,265 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	openapi_types "github.com/oapi-codegen/runtime/types"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apiutil"
+)
+
+const (
+	keepBothSuffix = " (конфликт)"
+)
+
+type Remote interface {
+	GetItems(ctx context.Context, params *apigen.GetItemsParams) (*apigen.GetItemsResponse, error)
+	GetItem(ctx context.Context, id openapi_types.UUID) (*apigen.GetItemResponse, error)
+	CreateItem(ctx context.Context, body apigen.CreateItemJSONRequestBody) (*apigen.CreateItemResponse, error)
+	UpdateItem(ctx context.Context, id openapi_types.UUID, body apigen.UpdateItemJSONRequestBody) (*apigen.UpdateItemResponse, error)
+	DeleteItem(ctx context.Context, id openapi_types.UUID) (*apigen.DeleteItemResponse, error)
+}
+
+// Local или Remote равен nil, если запись удалена на этой стороне.
+type Conflict struct {
+	LocalAt  time.Time
+	RemoteAt time.Time
+	Local    *apigen.ItemResponse
+	Remote   *apigen.ItemResponse
+	ID       openapi_types.UUID
+}
+
+func (c Conflict) Title() string {
+	for _, it := range []*apigen.ItemResponse{c.Local, c.Remote} {
+		if it != nil && it.Title != nil {
+			return *it.Title
+		}
+	}
+	return c.ID.String()
+}
+
+type Resolution int
+
+const (
+	KeepLocal Resolution = iota
+	KeepRemote
+	KeepBoth
+)
+
+type Resolver func(Conflict) (Resolution, error)
+
+func LastWriterWins(c Conflict) (Resolution, error) {
+	if c.LocalAt.After(c.RemoteAt) {
+		return KeepLocal, nil
+	}
+	return KeepRemote, nil
+}
+
+// KeepBothVersions отправляет локальную версию отдельной записью.
+func KeepBothVersions(Conflict) (Resolution, error) {
+	return KeepBoth, nil
+}
+
+type Report struct {
+	Pulled    int
+	Pushed    int
+	Removed   int
+	Conflicts int
+}
+
+// Каждая запись сохраняется сразу: прерванную синхронизацию можно повторить.
+func (r *Replica) Sync(ctx context.Context, remote Remote, resolve Resolver) (Report, error) {
+	var rep Report
+	listed, err := listRemote(ctx, remote)
+	if err != nil {
+		return rep, err
+	}
+	records, err := r.Records()
+	if err != nil {
+		return rep, err
+	}
+	local := make(map[string]Record, len(records))
+	for _, rec := range records {
+		local[rec.Item.Id.String()] = rec
+	}
+	seen := make(map[string]bool, len(listed))
+	for _, it := range listed {
+		if it.Id == nil {
+			continue
+		}
+		id := it.Id.String()
+		seen[id] = true
+		rec, ok := local[id]
+		switch {
+		case !ok, rec.Op == OpNone && !sameTime(rec.Base, it.UpdatedAt):
+			if err := r.pull(ctx, remote, *it.Id); err != nil {
+				return rep, err
+			}
+			rep.Pulled++
+		case rec.Op == OpNone:
+		case sameTime(rec.Base, it.UpdatedAt):
+			if err := r.push(ctx, remote, rec); err != nil {
+				return rep, err
+			}
+			rep.Pushed++
+		default:
+			cur, err := remote.GetItem(ctx, *it.Id)
+			if err != nil {
+				return rep, err
+			}
+			rep.Conflicts++
+			if err := r.resolve(ctx, remote, rec, cur.JSON200, resolve, &rep); err != nil {
+				return rep, err
+			}
+		}
+	}
+	for _, rec := range records {
+		id := rec.Item.Id.String()
+		if seen[id] {
+			continue
+		}
+		switch rec.Op {
+		case OpNone, OpDelete:
+			if err := r.remove(id); err != nil {
+				return rep, err
+			}
+			rep.Removed++
+		case OpCreate:
+			if err := r.push(ctx, remote, rec); err != nil {
+				return rep, err
+			}
+			rep.Pushed++
+		case OpUpdate:
+			rep.Conflicts++
+			if err := r.resolve(ctx, remote, rec, nil, resolve, &rep); err != nil {
+				return rep, err
+			}
+		}
+	}
+	return rep, r.saveState(State{LastSync: r.now().UTC()})
+}
+
+func (r *Replica) resolve(ctx context.Context, remote Remote, rec Record, cur *apigen.ItemResponse, resolve Resolver, rep *Report) error {
+	c := Conflict{ID: *rec.Item.Id, LocalAt: rec.Modified, Remote: cur}
+	if rec.Op != OpDelete {
+		item := rec.Item
+		c.Local = &item
+	}
+	if cur != nil && cur.UpdatedAt != nil {
+		c.RemoteAt = *cur.UpdatedAt
+	}
+	res, err := resolve(c)
+	if err != nil {
+		return err
+	}
+	switch {
+	case res == KeepRemote && cur == nil:
+		rep.Removed++
+		return r.remove(c.ID.String())
+	case res == KeepRemote, res == KeepBoth && c.Local == nil:
+		rep.Pulled++
+		return r.pull(ctx, remote, c.ID)
+	case cur == nil:
+		rec.Op = OpCreate
+	case res == KeepBoth:
+		if err := r.pull(ctx, remote, c.ID); err != nil {
+			return err
+		}
+		title := c.Title() + keepBothSuffix
+		localID := uuid.New()
+		rec.Item.Title = &title
+		rec.Item.Id = &localID
+		rec.Op = OpCreate
+	default:
+		rec.Base = cur.UpdatedAt
+	}
+	rep.Pushed++
+	return r.push(ctx, remote, rec)
+}
+
+func (r *Replica) push(ctx context.Context, remote Remote, rec Record) error {
+	id := *rec.Item.Id
+	switch rec.Op {
+	case OpCreate:
+		body := apigen.ItemCreate{Meta: rec.Item.Meta}
+		if rec.Item.Title != nil {
+			body.Title = *rec.Item.Title
+		}
+		if rec.Item.Data != nil {
+			raw, err := rec.Item.Data.MarshalJSON()
+			if err != nil {
+				return err
+			}
+			if err := body.Data.UnmarshalJSON(raw); err != nil {
+				return err
+			}
+		}
+		resp, err := remote.CreateItem(ctx, body)
+		if err != nil {
+			return fmt.Errorf("создание %s: %w", id, err)
+		}
+		if err := r.remove(id.String()); err != nil {
+			return err
+		}
+		if resp.JSON201 != nil && resp.JSON201.Id != nil {
+			return r.pull(ctx, remote, *resp.JSON201.Id)
+		}
+		return nil
+	case OpUpdate:
+		body := apigen.ItemUpdate{Title: rec.Item.Title, Meta: rec.Item.Meta}
+		if body.Meta == nil {
+			body.Meta = &map[string]string{}
+		}
+		if rec.Item.Data != nil {
+			raw, err := rec.Item.Data.MarshalJSON()
+			if err != nil {
+				return err
+			}
+			var d apigen.ItemUpdate_Data
+			if err := d.UnmarshalJSON(raw); err != nil {
+				return err
+			}
+			body.Data = &d
+		}
+		if _, err := remote.UpdateItem(ctx, id, body); err != nil {
+			return fmt.Errorf("обновление %s: %w", id, err)
+		}
+		return r.pull(ctx, remote, id)
+	case OpDelete:
+		_, err := remote.DeleteItem(ctx, id)
+		var apiErr apiutil.Error
+		if err != nil && (!errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound) {
+			return fmt.Errorf("удаление %s: %w", id, err)
+		}
+		return r.remove(id.String())
+	}
+	return nil
+}
+
+func (r *Replica) pull(ctx context.Context, remote Remote, id openapi_types.UUID) error {
+	resp, err := remote.GetItem(ctx, id)
+	if err != nil {
+		return err
+	}
+	if resp.JSON200 == nil {
+		return nil
+	}
+	return r.save(&Record{Item: *resp.JSON200, Base: resp.JSON200.UpdatedAt})
+}
+
+func listRemote(ctx context.Context, remote Remote) ([]apigen.ItemListResponse, error) {
+	return apiutil.ListAll(ctx, remote.GetItems, apigen.GetItemsParams{})
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
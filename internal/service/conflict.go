@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	openapi_types "github.com/oapi-codegen/runtime/types"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apiutil"
+)
+
+// Local — Base с изменениями клиента; Remote равен nil, если запись удалена.
+type ConflictError struct {
+	Base    *apigen.ItemResponse
+	Local   *apigen.ItemResponse
+	Remote  *apigen.ItemResponse
+	Current *apigen.GetItemResponse
+}
+
+func (e *ConflictError) Error() string {
+	return "запись изменена на сервере после чтения"
+}
+
+type FieldDiff struct {
+	Field  string
+	Base   string
+	Local  string
+	Remote string
+}
+
+func (e *ConflictError) Diff() []FieldDiff {
+	base, local, remote := itemFields(e.Base), itemFields(e.Local), itemFields(e.Remote)
+	names := map[string]struct{}{}
+	for _, m := range []map[string]string{base, local, remote} {
+		for k := range m {
+			names[k] = struct{}{}
+		}
+	}
+	var out []FieldDiff
+	for k := range names {
+		if base[k] == local[k] && base[k] == remote[k] {
+			continue
+		}
+		out = append(out, FieldDiff{Field: k, Base: base[k], Local: local[k], Remote: remote[k]})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Field < out[j].Field })
+	return out
+}
+
+func itemFields(it *apigen.ItemResponse) map[string]string {
+	out := map[string]string{}
+	if it == nil {
+		return out
+	}
+	if it.Title != nil {
+		out["title"] = *it.Title
+	}
+	if it.Meta != nil {
+		for k, v := range *it.Meta {
+			out["meta."+k] = v
+		}
+	}
+	if it.Data != nil {
+		raw, err := it.Data.MarshalJSON()
+		if err != nil {
+			return out
+		}
+		var fields map[string]any
+		if json.Unmarshal(raw, &fields) != nil {
+			return out
+		}
+		for k, v := range fields {
+			if s, ok := v.(string); ok {
+				out["data."+k] = s
+			} else if v != nil {
+				b, _ := json.Marshal(v)
+				out["data."+k] = string(b)
+			}
+		}
+	}
+	return out
+}
+
+func VersionOf(resp *apigen.GetItemResponse) api.Precondition {
+	var p api.Precondition
+	if resp == nil {
+		return p
+	}
+	if resp.HTTPResponse != nil {
+		p.ETag = resp.HTTPResponse.Header.Get("ETag")
+	}
+	if resp.JSON200 != nil && resp.JSON200.UpdatedAt != nil {
+		p.UpdatedAt = *resp.JSON200.UpdatedAt
+	}
+	return p
+}
+
+// Сервер без ETag может не проверять предусловия, поэтому без ETag запись
+// перед отправкой перечитывается и сравнивается с base.
+func (s *ItemsService) UpdateFrom(ctx context.Context, id openapi_types.UUID, base *apigen.GetItemResponse, body apigen.ItemUpdate) (*apigen.UpdateItemResponse, error) {
+	pre := VersionOf(base)
+	if pre.IsZero() {
+		return s.Update(ctx, id, body)
+	}
+	if pre.ETag == "" {
+		cur, err := s.Get(ctx, id)
+		switch {
+		case err == nil && changedSince(pre, VersionOf(cur)):
+			return nil, s.conflict(base, body, cur)
+		case isNotFound(err):
+			return nil, s.conflict(base, body, nil)
+		}
+	}
+	resp, err := s.Update(api.WithPrecondition(ctx, pre), id, body)
+	var apiErr apiutil.Error
+	if errors.As(err, &apiErr) && (apiErr.Status == http.StatusPreconditionFailed || apiErr.Status == http.StatusConflict) {
+		cur, gerr := s.Get(ctx, id)
+		if gerr != nil && !isNotFound(gerr) {
+			return nil, fmt.Errorf("%w: %v", err, gerr)
+		}
+		return nil, s.conflict(base, body, cur)
+	}
+	return resp, err
+}
+
+func (s *ItemsService) conflict(base *apigen.GetItemResponse, body apigen.ItemUpdate, cur *apigen.GetItemResponse) error {
+	var b apigen.ItemResponse
+	if base.JSON200 != nil {
+		b = *base.JSON200
+	}
+	local := b
+	if err := applyUpdate(&local, body); err != nil {
+		return err
+	}
+	ce := &ConflictError{Base: &b, Local: &local, Current: cur}
+	if cur != nil {
+		ce.Remote = cur.JSON200
+	}
+	return ce
+}
+
+func changedSince(base, cur api.Precondition) bool {
+	if base.ETag != "" && cur.ETag != "" {
+		return base.ETag != cur.ETag
+	}
+	if base.UpdatedAt.IsZero() {
+		return false
+	}
+	if base.UpdatedAt.Nanosecond() == 0 {
+		// Версия, введённая вручную из вывода get, точна до секунды.
+		return !base.UpdatedAt.Equal(cur.UpdatedAt.Truncate(time.Second))
+	}
+	return !base.UpdatedAt.Equal(cur.UpdatedAt)
+}
+
+func isNotFound(err error) bool {
+	var apiErr apiutil.Error
+	return errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound
+}
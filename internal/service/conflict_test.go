@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/99designs/keyring"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/cache"
+	"github.com/GoLessons/sufir-keeper-client/internal/config"
+)
+
+const conflictItemID = "00000000-0000-0000-0000-000000000001"
+
+// versionedServer хранит одну запись с версией.
+type versionedServer struct {
+	item      map[string]any
+	version   int
+	ignore    bool
+	ifMatch   []string
+	updatedAt time.Time
+	mu        sync.Mutex
+}
+
+func (v *versionedServer) etag() string {
+	return `"v` + string(rune('0'+v.version)) + `"`
+}
+
+func (v *versionedServer) edit(field, value string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.version++
+	v.updatedAt = v.updatedAt.Add(time.Minute)
+	data := map[string]any{}
+	for k, val := range v.item["data"].(map[string]any) {
+		data[k] = val
+	}
+	data[field] = value
+	v.item["data"] = data
+	v.item["updated_at"] = v.updatedAt.Format(time.RFC3339Nano)
+}
+
+func (v *versionedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("ETag", v.etag())
+		_ = json.NewEncoder(w).Encode(v.item)
+	case http.MethodPut:
+		v.ifMatch = append(v.ifMatch, r.Header.Get("If-Match"))
+		if !v.ignore && r.Header.Get("If-Match") != "" && r.Header.Get("If-Match") != v.etag() {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			_ = json.NewEncoder(w).Encode(map[string]any{"message": "version mismatch"})
+			return
+		}
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if t, ok := body["title"]; ok {
+			v.item["title"] = t
+		}
+		v.version++
+		_ = json.NewEncoder(w).Encode(v.item)
+	}
+}
+
+func newVersionedService(t *testing.T) (*ItemsService, *versionedServer) {
+	t.Helper()
+	start := time.Date(2026, 1, 1, 10, 0, 0, 123, time.UTC)
+	srv := &versionedServer{
+		version:   1,
+		updatedAt: start,
+		item: map[string]any{
+			"id":         conflictItemID,
+			"title":      "db",
+			"data":       map[string]any{"type": "CREDENTIAL", "login": "bob", "password": "p1"},
+			"updated_at": start.Format(time.RFC3339Nano),
+		},
+	}
+	hs := httptest.NewServer(srv)
+	t.Cleanup(hs.Close)
+	dir := t.TempDir()
+	cm, err := cache.New(cache.Options{
+		Path:       filepath.Join(dir, "cache.db"),
+		TTLMinutes: 5,
+		KeyringConfig: keyring.Config{
+			AllowedBackends:  []keyring.BackendType{keyring.FileBackend},
+			FileDir:          dir,
+			FilePasswordFunc: func(string) (string, error) { return "pw", nil },
+			ServiceName:      "sufir-keeper-client",
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = cm.Close() })
+	apiClient, err := apigen.NewClientWithResponses(hs.URL, apigen.WithHTTPClient(hs.Client()))
+	require.NoError(t, err)
+	return NewItemsService(api.NewWrapperFromAPI(apiClient), cm, config.Config{}), srv
+}
+
+func TestItemsService_UpdateFromSendsVersion(t *testing.T) {
+	ctx := context.Background()
+	svc, srv := newVersionedService(t)
+	id := uuid.MustParse(conflictItemID)
+	base, err := svc.Get(ctx, id)
+	require.NoError(t, err)
+
+	title := "db-2"
+	_, err = svc.UpdateFrom(ctx, id, base, apigen.ItemUpdate{Title: &title})
+	require.NoError(t, err)
+	require.Equal(t, []string{`"v1"`}, srv.ifMatch)
+}
+
+func TestItemsService_UpdateFromDetectsServerConflict(t *testing.T) {
+	ctx := context.Background()
+	svc, srv := newVersionedService(t)
+	id := uuid.MustParse(conflictItemID)
+	base, err := svc.Get(ctx, id)
+	require.NoError(t, err)
+	srv.edit("password", "p-remote")
+
+	title := "db-local"
+	_, err = svc.UpdateFrom(ctx, id, base, apigen.ItemUpdate{Title: &title})
+	var ce *ConflictError
+	require.ErrorAs(t, err, &ce)
+	require.Equal(t, []string{`"v1"`}, srv.ifMatch, "запрос с устаревшей версией должен дойти до сервера")
+	require.Equal(t, "db", srv.item["title"])
+
+	diff := map[string]FieldDiff{}
+	for _, d := range ce.Diff() {
+		diff[d.Field] = d
+	}
+	require.Equal(t, FieldDiff{Field: "title", Base: "db", Local: "db-local", Remote: "db"}, diff["title"])
+	require.Equal(t, FieldDiff{Field: "data.password", Base: "p1", Local: "p1", Remote: "p-remote"}, diff["data.password"])
+	require.NotContains(t, diff, "data.login")
+}
+
+func TestItemsService_UpdateFromRereadsWhenServerIgnoresHeaders(t *testing.T) {
+	ctx := context.Background()
+	svc, srv := newVersionedService(t)
+	srv.ignore = true
+	id := uuid.MustParse(conflictItemID)
+	base, err := svc.Get(ctx, id)
+	require.NoError(t, err)
+	base.HTTPResponse.Header.Del("ETag")
+	srv.edit("password", "p-remote")
+
+	title := "db-local"
+	_, err = svc.UpdateFrom(ctx, id, base, apigen.ItemUpdate{Title: &title})
+	var ce *ConflictError
+	require.ErrorAs(t, err, &ce)
+	require.Empty(t, srv.ifMatch)
+	require.NotNil(t, ce.Current)
+
+	_, err = svc.UpdateFrom(ctx, id, ce.Current, apigen.ItemUpdate{Title: &title})
+	require.NoError(t, err)
+	require.Equal(t, "db-local", srv.item["title"])
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"maps"
+
+	openapi_types "github.com/oapi-codegen/runtime/types"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apiutil"
+	"github.com/GoLessons/sufir-keeper-client/internal/e2e"
+)
+
+// SetSealer включает прозрачное e2e-шифрование: данные TEXT, CREDENTIAL и
+// CARD уходят на сервер TEXT-конвертом и расшифровываются при чтении.
+func (s *ItemsService) SetSealer(sealer *e2e.Sealer) {
+	s.sealer = sealer
+}
+
+func (s *ItemsService) openItem(item *apigen.ItemResponse) error {
+	if item == nil || item.Meta == nil || (*item.Meta)[e2e.MetaMarker] == "" || item.Data == nil {
+		return nil
+	}
+	if s.sealer == nil {
+		return e2e.ErrLocked
+	}
+	t, err := item.Data.AsTextData()
+	if err != nil {
+		return err
+	}
+	pt, err := s.sealer.Open(t.Value)
+	if err != nil {
+		return err
+	}
+	var d apigen.ItemResponse_Data
+	if err := d.UnmarshalJSON(pt); err != nil {
+		return err
+	}
+	item.Data = &d
+	meta := stripMarkers(*item.Meta)
+	item.Meta = &meta
+	return nil
+}
+
+// withSealed добавляет к списку записей типа params.Type зашифрованные
+// записи этого типа: на сервере они хранятся как TEXT.
+func (s *ItemsService) withSealed(ctx context.Context, params apigen.GetItemsParams, out []apigen.ItemListResponse) ([]apigen.ItemListResponse, error) {
+	t := *params.Type
+	if t == apigen.ItemTypeTEXT {
+		kept := out[:0]
+		for _, it := range out {
+			if it.Meta == nil || (*it.Meta)[e2e.MetaMarker] == "" || (*it.Meta)[e2e.MetaType] == string(t) {
+				kept = append(kept, it)
+			}
+		}
+		return kept, nil
+	}
+	text := apigen.ItemTypeTEXT
+	sealed, err := apiutil.ListAll(ctx, s.listPage, apigen.GetItemsParams{Type: &text, S: params.S})
+	if err != nil {
+		return nil, err
+	}
+	for _, it := range sealed {
+		if it.Meta != nil && (*it.Meta)[e2e.MetaMarker] != "" && (*it.Meta)[e2e.MetaType] == string(t) {
+			out = append(out, it)
+		}
+	}
+	return out, nil
+}
+
+func (s *ItemsService) sealCreate(body apigen.ItemCreate) (apigen.ItemCreate, error) {
+	raw, err := body.Data.MarshalJSON()
+	if err != nil {
+		return body, err
+	}
+	t := apiutil.DataType(raw)
+	if t == apigen.ItemTypeBINARY {
+		return body, nil
+	}
+	value, err := s.sealer.Seal(raw)
+	if err != nil {
+		return body, err
+	}
+	var d apigen.ItemCreate_Data
+	if err := d.FromTextData(apigen.TextData{Type: apigen.TEXT, Value: value}); err != nil {
+		return body, err
+	}
+	meta := map[string]string{}
+	if body.Meta != nil {
+		meta = stripMarkers(*body.Meta)
+	}
+	meta[e2e.MetaMarker] = e2e.MarkerV1
+	meta[e2e.MetaType] = string(t)
+	body.Data = d
+	body.Meta = &meta
+	return body, nil
+}
+
+// sealUpdate шифрует обновляемые данные. Частичное обновление сливается с
+// текущими расшифрованными полями на клиенте, так как сервер видит только
+// конверт. Метки e2e в meta сохраняются, пока данные остаются зашифрованными.
+func (s *ItemsService) sealUpdate(ctx context.Context, id openapi_types.UUID, body apigen.ItemUpdate) (apigen.ItemUpdate, error) {
+	cur, err := s.getRaw(ctx, id)
+	if err != nil {
+		return body, err
+	}
+	curMeta := map[string]string{}
+	var curRaw []byte
+	var curType apigen.ItemType
+	if cur.JSON200 != nil {
+		if cur.JSON200.Meta != nil {
+			curMeta = maps.Clone(*cur.JSON200.Meta)
+		}
+		if cur.JSON200.Data != nil {
+			if curMeta[e2e.MetaMarker] != "" {
+				t, err := cur.JSON200.Data.AsTextData()
+				if err != nil {
+					return body, err
+				}
+				if curRaw, err = s.sealer.Open(t.Value); err != nil {
+					return body, err
+				}
+			} else if curRaw, err = cur.JSON200.Data.MarshalJSON(); err != nil {
+				return body, err
+			}
+			curType = apiutil.DataType(curRaw)
+		}
+	}
+	base := stripMarkers(curMeta)
+	if body.Meta != nil {
+		base = stripMarkers(*body.Meta)
+	}
+	if body.Data == nil {
+		if curMeta[e2e.MetaMarker] != "" {
+			base[e2e.MetaMarker] = curMeta[e2e.MetaMarker]
+			base[e2e.MetaType] = curMeta[e2e.MetaType]
+		}
+		body.Meta = &base
+		return body, nil
+	}
+	upd, err := body.Data.MarshalJSON()
+	if err != nil {
+		return body, err
+	}
+	t := apiutil.DataType(upd)
+	if t == apigen.ItemTypeBINARY {
+		body.Meta = &base
+		return body, nil
+	}
+	if t == curType {
+		if upd, err = apiutil.MergeData(curRaw, upd); err != nil {
+			return body, err
+		}
+	}
+	value, err := s.sealer.Seal(upd)
+	if err != nil {
+		return body, err
+	}
+	var d apigen.ItemUpdate_Data
+	if err := d.FromTextData(apigen.TextData{Type: apigen.TEXT, Value: value}); err != nil {
+		return body, err
+	}
+	base[e2e.MetaMarker] = e2e.MarkerV1
+	base[e2e.MetaType] = string(t)
+	body.Data = &d
+	body.Meta = &base
+	return body, nil
+}
+
+func stripMarkers(meta map[string]string) map[string]string {
+	out := maps.Clone(meta)
+	if out == nil {
+		out = map[string]string{}
+	}
+	delete(out, e2e.MetaMarker)
+	delete(out, e2e.MetaType)
+	return out
+}
+
+// InvalidateCache удаляет все закешированные записи, например после смены
+// ключа шифрования.
+func (s *ItemsService) InvalidateCache() {
+	_ = s.c.DeletePrefix("items:")
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/99designs/keyring"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/cache"
+	"github.com/GoLessons/sufir-keeper-client/internal/config"
+	"github.com/GoLessons/sufir-keeper-client/internal/e2e"
+)
+
+type memServer struct {
+	items    map[string]map[string]any
+	bodies   []string
+	next     int
+	requests int
+	down     bool
+	mu       sync.Mutex
+}
+
+func (m *memServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests++
+	if m.down {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		_ = conn.Close()
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/items"), "/")
+	var body map[string]any
+	if r.Body != nil && (r.Method == http.MethodPost || r.Method == http.MethodPut) {
+		var raw json.RawMessage
+		_ = json.NewDecoder(r.Body).Decode(&raw)
+		m.bodies = append(m.bodies, string(raw))
+		_ = json.Unmarshal(raw, &body)
+	}
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		m.next++
+		id = fmt.Sprintf("00000000-0000-0000-0000-%012d", m.next)
+		body["id"] = id
+		m.items[id] = body
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": id})
+	case id == "":
+		want := r.URL.Query().Get("type")
+		list := []map[string]any{}
+		for iid, it := range m.items {
+			if want != "" && it["data"].(map[string]any)["type"] != want {
+				continue
+			}
+			list = append(list, map[string]any{"id": iid, "title": it["title"], "meta": it["meta"]})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"items": list, "total": len(list)})
+	case m.items[id] == nil:
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(map[string]any{"message": "not found"})
+	case r.Method == http.MethodPut:
+		for k, v := range body {
+			m.items[id][k] = v
+		}
+		_ = json.NewEncoder(w).Encode(m.items[id])
+	default:
+		_ = json.NewEncoder(w).Encode(m.items[id])
+	}
+}
+
+func newSealedService(t *testing.T, srv *memServer, sealer *e2e.Sealer) *ItemsService {
+	t.Helper()
+	hs := httptest.NewServer(srv)
+	t.Cleanup(hs.Close)
+	dir := t.TempDir()
+	cm, err := cache.New(cache.Options{
+		Path:       filepath.Join(dir, "cache.db"),
+		TTLMinutes: 5,
+		KeyringConfig: keyring.Config{
+			AllowedBackends:  []keyring.BackendType{keyring.FileBackend},
+			FileDir:          dir,
+			FilePasswordFunc: func(string) (string, error) { return "pw", nil },
+			ServiceName:      "sufir-keeper-client",
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = cm.Close() })
+	apiClient, err := apigen.NewClientWithResponses(hs.URL, apigen.WithHTTPClient(hs.Client()))
+	require.NoError(t, err)
+	cfg := config.Config{}
+	cfg.Cache.Enabled = true
+	svc := NewItemsService(api.NewWrapperFromAPI(apiClient), cm, cfg)
+	if sealer != nil {
+		svc.SetSealer(sealer)
+	}
+	return svc
+}
+
+func testKey(b byte) e2e.Key {
+	return e2e.Key{ID: fmt.Sprintf("k%d", b), Bytes: []byte(strings.Repeat(string(rune('a'+b)), 32))}
+}
+
+func TestItemsService_E2ESealsAndOpens(t *testing.T) {
+	srv := &memServer{items: map[string]map[string]any{}}
+	svc := newSealedService(t, srv, e2e.NewSealer(testKey(1)))
+	ctx := context.Background()
+
+	var d apigen.ItemCreate_Data
+	require.NoError(t, d.FromCredentialData(apigen.CredentialData{Type: apigen.CREDENTIAL, Login: "bob", Password: "hunter2"}))
+	meta := map[string]string{"url": "https://git.example.com"}
+	resp, err := svc.Create(ctx, apigen.ItemCreate{Title: "git", Data: d, Meta: &meta})
+	require.NoError(t, err)
+	require.NotNil(t, resp.JSON201)
+	id := *resp.JSON201.Id
+	require.NotContains(t, srv.bodies[0], "hunter2")
+	require.NotContains(t, srv.bodies[0], "bob")
+	stored := srv.items[id.String()]
+	require.Equal(t, "TEXT", stored["data"].(map[string]any)["type"])
+	require.Equal(t, "CREDENTIAL", stored["meta"].(map[string]any)[e2e.MetaType])
+
+	got, err := svc.Get(ctx, id)
+	require.NoError(t, err)
+	c, err := got.JSON200.Data.AsCredentialData()
+	require.NoError(t, err)
+	require.Equal(t, "hunter2", c.Password)
+	require.Equal(t, map[string]string{"url": "https://git.example.com"}, *got.JSON200.Meta)
+
+	var ud apigen.ItemUpdate_Data
+	require.NoError(t, ud.UnmarshalJSON([]byte(`{"type":"CREDENTIAL","password":"rotated"}`)))
+	_, err = svc.Update(ctx, id, apigen.ItemUpdate{Data: &ud})
+	require.NoError(t, err)
+	require.NotContains(t, srv.bodies[1], "rotated")
+	got, err = svc.Get(ctx, id)
+	require.NoError(t, err)
+	c, err = got.JSON200.Data.AsCredentialData()
+	require.NoError(t, err)
+	require.Equal(t, "bob", c.Login)
+	require.Equal(t, "rotated", c.Password)
+
+	newMeta := map[string]string{"url": "https://other.example.com"}
+	_, err = svc.Update(ctx, id, apigen.ItemUpdate{Meta: &newMeta})
+	require.NoError(t, err)
+	require.Equal(t, e2e.MarkerV1, srv.items[id.String()]["meta"].(map[string]any)[e2e.MetaMarker])
+
+	cred := apigen.ItemTypeCREDENTIAL
+	list, err := svc.ListAll(ctx, &cred)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	text := apigen.ItemTypeTEXT
+	list, err = svc.ListAll(ctx, &text)
+	require.NoError(t, err)
+	require.Empty(t, list)
+
+	locked := newSealedService(t, srv, nil)
+	_, err = locked.Get(ctx, id)
+	require.ErrorIs(t, err, e2e.ErrLocked)
+	other := newSealedService(t, srv, e2e.NewSealer(testKey(2)))
+	_, err = other.Get(ctx, id)
+	require.ErrorIs(t, err, e2e.ErrUnknownKey)
+}
+
+func TestItemsService_E2EListIncludesSealed(t *testing.T) {
+	srv := &memServer{items: map[string]map[string]any{}}
+	svc := newSealedService(t, srv, e2e.NewSealer(testKey(1)))
+	ctx := context.Background()
+
+	for _, login := range []string{"alice", "bob"} {
+		var d apigen.ItemCreate_Data
+		require.NoError(t, d.FromCredentialData(apigen.CredentialData{Type: apigen.CREDENTIAL, Login: login, Password: "pw"}))
+		_, err := svc.Create(ctx, apigen.ItemCreate{Title: login, Data: d})
+		require.NoError(t, err)
+	}
+	srv.items["00000000-0000-0000-0000-000000000099"] = map[string]any{"title": "plain", "data": map[string]any{"type": "TEXT", "value": "note"}}
+
+	cred := apigen.ItemTypeCREDENTIAL
+	resp, err := svc.List(ctx, &apigen.GetItemsParams{Type: &cred})
+	require.NoError(t, err)
+	require.Len(t, *resp.JSON200.Items, 2)
+	require.Equal(t, 2, *resp.JSON200.Total)
+
+	limit, offset := 1, 1
+	resp, err = svc.List(ctx, &apigen.GetItemsParams{Type: &cred, Limit: &limit, Offset: &offset})
+	require.NoError(t, err)
+	require.Len(t, *resp.JSON200.Items, 1)
+	require.Equal(t, 2, *resp.JSON200.Total)
+
+	text := apigen.ItemTypeTEXT
+	resp, err = svc.List(ctx, &apigen.GetItemsParams{Type: &text})
+	require.NoError(t, err)
+	require.Len(t, *resp.JSON200.Items, 1)
+	require.Equal(t, "plain", *(*resp.JSON200.Items)[0].Title)
+}
+
+func TestItemsService_E2ELeavesBinaryPlain(t *testing.T) {
+	srv := &memServer{items: map[string]map[string]any{}}
+	svc := newSealedService(t, srv, e2e.NewSealer(testKey(1)))
+	var d apigen.ItemCreate_Data
+	require.NoError(t, d.FromBinaryData(apigen.BinaryData{Type: apigen.BinaryDataTypeBINARY, Filename: "f.bin", Id: openapiUUIDFromString(t, "00000000-0000-0000-0000-0000000000aa")}))
+	_, err := svc.Create(context.Background(), apigen.ItemCreate{Title: "file", Data: d})
+	require.NoError(t, err)
+	require.Contains(t, srv.bodies[0], "f.bin")
+	require.NotContains(t, srv.bodies[0], e2e.MetaMarker)
+}
@@ -2,84 +2,226 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
-	"time"
+	"net/http"
+	"sync"
 
 	openapi_types "github.com/oapi-codegen/runtime/types"
 
-	"github.com/GoLessons/sufir-keeper-client/internal/api"
 	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apiutil"
 	"github.com/GoLessons/sufir-keeper-client/internal/cache"
 	"github.com/GoLessons/sufir-keeper-client/internal/config"
+	"github.com/GoLessons/sufir-keeper-client/internal/e2e"
 )
 
+// Backend — источник записей: сервер (api.Wrapper) или локальная реплика.
+type Backend interface {
+	GetItems(ctx context.Context, params *apigen.GetItemsParams) (*apigen.GetItemsResponse, error)
+	GetItem(ctx context.Context, id openapi_types.UUID) (*apigen.GetItemResponse, error)
+	CreateItem(ctx context.Context, body apigen.CreateItemJSONRequestBody) (*apigen.CreateItemResponse, error)
+	UpdateItem(ctx context.Context, id openapi_types.UUID, body apigen.UpdateItemJSONRequestBody) (*apigen.UpdateItemResponse, error)
+	DeleteItem(ctx context.Context, id openapi_types.UUID) (*apigen.DeleteItemResponse, error)
+}
+
 type ItemsService struct {
-	w   *api.Wrapper
-	c   *cache.Manager
-	cfg config.Config
+	w      Backend
+	c      *cache.Manager
+	sealer *e2e.Sealer
+	policy ReadPolicy
+	cfg    config.Config
+	bg     sync.WaitGroup
 }
 
-func NewItemsService(w *api.Wrapper, c *cache.Manager, cfg config.Config) *ItemsService {
-	return &ItemsService{w: w, c: c, cfg: cfg}
+// NewItemsService берёт режим чтения из cfg.Cache.ReadPolicy; неизвестное
+// значение означает network-first — проверять его должен вызывающий.
+func NewItemsService(w Backend, c *cache.Manager, cfg config.Config) *ItemsService {
+	p, err := ParseReadPolicy(cfg.Cache.ReadPolicy)
+	if err != nil {
+		p = NetworkFirst
+	}
+	return &ItemsService{w: w, c: c, cfg: cfg, policy: p}
 }
 
 func (s *ItemsService) List(ctx context.Context, params *apigen.GetItemsParams) (*apigen.GetItemsResponse, error) {
-	key := s.keyForList(params)
-	resp, err := s.w.GetItems(ctx, params)
-	if err == nil {
-		if s.cfg.Cache.Enabled {
-			pj := resp.Body
-			_ = s.c.Put(key, pj, nil, "")
+	if s.sealer != nil && params != nil && params.Type != nil {
+		return s.listSealed(ctx, *params)
+	}
+	return s.listPage(ctx, params)
+}
+
+func (s *ItemsService) listPage(ctx context.Context, params *apigen.GetItemsParams) (*apigen.GetItemsResponse, error) {
+	resp, err := s.list(ctx, params)
+	return s.overlayList(params, resp, err)
+}
+
+// listSealed собирает все записи типа вместе с зашифрованными (на сервере
+// они хранятся как TEXT) и отдаёт запрошенную страницу.
+func (s *ItemsService) listSealed(ctx context.Context, params apigen.GetItemsParams) (*apigen.GetItemsResponse, error) {
+	var hr *http.Response
+	first := func(ctx context.Context, p *apigen.GetItemsParams) (*apigen.GetItemsResponse, error) {
+		resp, err := s.listPage(ctx, p)
+		if err == nil && hr == nil {
+			hr = resp.HTTPResponse
 		}
-		return resp, nil
+		return resp, err
 	}
-	if !s.cfg.Cache.Enabled {
+	all, err := apiutil.ListAll(ctx, first, apigen.GetItemsParams{Type: params.Type, S: params.S})
+	if err != nil {
 		return nil, err
 	}
-	if !isNetworkError(err) {
+	if all, err = s.withSealed(ctx, params, all); err != nil {
 		return nil, err
 	}
-	pj, _, ts, _, gerr := s.c.Get(key)
-	if gerr != nil || !s.c.IsFresh(ts) {
+	if hr == nil {
+		hr = &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Header: http.Header{}}
+	}
+	body, err := json.Marshal(map[string]any{"items": paginate(all, &params), "total": len(all)})
+	if err != nil {
 		return nil, err
 	}
-	var parsed apigen.GetItemsResponse
-	parsed.Body = pj
-	parsed.HTTPResponse = nil
-	return &parsed, nil
+	resp := &apigen.GetItemsResponse{Body: body, HTTPResponse: hr}
+	return resp, json.Unmarshal(body, &resp.JSON200)
 }
 
-func (s *ItemsService) Get(ctx context.Context, id openapi_types.UUID) (*apigen.GetItemResponse, error) {
-	key := s.keyForGet(id)
-	resp, err := s.w.GetItem(ctx, id)
+func paginate[T any](items []T, params *apigen.GetItemsParams) []T {
+	if params.Offset != nil {
+		items = items[min(max(*params.Offset, 0), len(items)):]
+	}
+	if params.Limit != nil && *params.Limit > 0 && *params.Limit < len(items) {
+		items = items[:*params.Limit]
+	}
+	return items
+}
+
+func (s *ItemsService) list(ctx context.Context, params *apigen.GetItemsParams) (*apigen.GetItemsResponse, error) {
+	resp, err := s.listThrough(ctx, params)
 	if err == nil {
-		if s.cfg.Cache.Enabled {
-			pj := resp.Body
-			_ = s.c.Put(key, pj, nil, "")
-		}
+		s.indexList(params, resp)
 		return resp, nil
 	}
-	if !s.cfg.Cache.Enabled {
-		return nil, err
+	if params != nil && params.S != nil && (errors.Is(err, ErrNotCached) || isNetworkError(err)) {
+		if local, lerr := s.searchLocal(params); lerr == nil {
+			return local, nil
+		}
 	}
-	if !isNetworkError(err) {
+	return nil, err
+}
+
+func (s *ItemsService) listThrough(ctx context.Context, params *apigen.GetItemsParams) (*apigen.GetItemsResponse, error) {
+	return readThrough(s, ctx, s.keyForList(params),
+		func(ctx context.Context) (*apigen.GetItemsResponse, []byte, *http.Response, error) {
+			resp, err := s.w.GetItems(ctx, params)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			return resp, resp.Body, resp.HTTPResponse, nil
+		},
+		func(pj []byte, hr *http.Response) (*apigen.GetItemsResponse, error) {
+			parsed := apigen.GetItemsResponse{Body: pj, HTTPResponse: hr}
+			return &parsed, json.Unmarshal(pj, &parsed.JSON200)
+		})
+}
+
+func (s *ItemsService) Get(ctx context.Context, id openapi_types.UUID) (*apigen.GetItemResponse, error) {
+	resp, err := s.getRaw(ctx, id)
+	if err != nil {
 		return nil, err
 	}
-	pj, _, ts, _, gerr := s.c.Get(key)
-	if gerr != nil || !s.c.IsFresh(ts) {
+	if err := s.openItem(resp.JSON200); err != nil {
+		return resp, err
+	}
+	if !SourceOf(resp.HTTPResponse).Cached {
+		s.indexItem(resp.JSON200)
+	}
+	return resp, nil
+}
+
+// getRaw возвращает запись в том виде, в каком её хранит сервер (без
+// расшифровки e2e), с учётом кеша и очереди отложенных операций.
+func (s *ItemsService) getRaw(ctx context.Context, id openapi_types.UUID) (*apigen.GetItemResponse, error) {
+	resp, err := s.fetch(ctx, id)
+	return s.overlayGet(id, resp, err)
+}
+
+func (s *ItemsService) fetch(ctx context.Context, id openapi_types.UUID) (*apigen.GetItemResponse, error) {
+	return readThrough(s, ctx, s.keyForGet(id),
+		func(ctx context.Context) (*apigen.GetItemResponse, []byte, *http.Response, error) {
+			resp, err := s.w.GetItem(ctx, id)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			return resp, resp.Body, resp.HTTPResponse, nil
+		},
+		func(pj []byte, hr *http.Response) (*apigen.GetItemResponse, error) {
+			parsed := apigen.GetItemResponse{Body: pj, HTTPResponse: hr}
+			return &parsed, json.Unmarshal(pj, &parsed.JSON200)
+		})
+}
+
+// GetCacheFirst отдаёт свежую запись из кеша без обращения к серверу;
+// устаревшую запись, в отличие от режима cache-first, перечитывает сразу.
+func (s *ItemsService) GetCacheFirst(ctx context.Context, id openapi_types.UUID) (*apigen.GetItemResponse, error) {
+	if s.cfg.Cache.Enabled {
+		pj, _, ts, _, err := s.c.Get(s.keyForGet(id))
+		if err == nil && s.c.IsFresh(ts) {
+			parsed := apigen.GetItemResponse{Body: pj, HTTPResponse: fromCache(ts, false)}
+			if json.Unmarshal(pj, &parsed.JSON200) == nil {
+				resp, err := s.overlayGet(id, &parsed, nil)
+				if err != nil {
+					return nil, err
+				}
+				return resp, s.openItem(resp.JSON200)
+			}
+		}
+	}
+	return s.Get(ctx, id)
+}
+
+func (s *ItemsService) ListAll(ctx context.Context, itemType *apigen.ItemType) ([]apigen.ItemListResponse, error) {
+	params := apigen.GetItemsParams{Type: itemType}
+	out, err := apiutil.ListAll(ctx, s.listPage, params)
+	if err != nil || s.sealer == nil || itemType == nil {
+		return out, err
+	}
+	return s.withSealed(ctx, params, out)
+}
+
+func (s *ItemsService) Find(ctx context.Context, itemType *apigen.ItemType, match func(apigen.ItemListResponse) bool) ([]apigen.ItemResponse, error) {
+	list, err := s.ListAll(ctx, itemType)
+	if err != nil {
 		return nil, err
 	}
-	var parsed apigen.GetItemResponse
-	parsed.Body = pj
-	parsed.HTTPResponse = nil
-	return &parsed, nil
+	var out []apigen.ItemResponse
+	for _, it := range list {
+		if it.Id == nil || !match(it) {
+			continue
+		}
+		resp, err := s.Get(ctx, *it.Id)
+		if err != nil {
+			return nil, err
+		}
+		if resp.JSON200 != nil {
+			out = append(out, *resp.JSON200)
+		}
+	}
+	return out, nil
+}
+
+func (s *ItemsService) FindByMeta(ctx context.Context, itemType *apigen.ItemType, key, value string) ([]apigen.ItemResponse, error) {
+	return s.Find(ctx, itemType, func(it apigen.ItemListResponse) bool {
+		if it.Meta == nil {
+			return false
+		}
+		v, ok := (*it.Meta)[key]
+		return ok && v == value
+	})
 }
 
 func (s *ItemsService) keyForList(params *apigen.GetItemsParams) string {
-	t := time.Now().UnixNano()
-	_ = t
 	if params == nil {
 		return "items:list:"
 	}
@@ -110,6 +252,31 @@ func isNetworkError(err error) bool {
 }
 
 func (s *ItemsService) Create(ctx context.Context, body apigen.ItemCreate) (*apigen.CreateItemResponse, error) {
+	resp, err := s.createOrQueue(ctx, body)
+	// Отложенная запись получит идентификатор сервера только при отправке.
+	if err == nil && !Queued(resp) && resp.JSON201 != nil && resp.JSON201.Id != nil {
+		raw, _ := body.Data.MarshalJSON()
+		s.indexUpdate(*resp.JSON201.Id, &body.Title, body.Meta, raw)
+	}
+	return resp, err
+}
+
+func (s *ItemsService) createOrQueue(ctx context.Context, body apigen.ItemCreate) (*apigen.CreateItemResponse, error) {
+	if s.sealer != nil {
+		sealed, err := s.sealCreate(body)
+		if err != nil {
+			return nil, err
+		}
+		body = sealed
+	}
+	resp, err := s.create(ctx, body)
+	if s.outboxEnabled() && isNetworkError(err) {
+		return s.enqueueCreate(body)
+	}
+	return resp, err
+}
+
+func (s *ItemsService) create(ctx context.Context, body apigen.ItemCreate) (*apigen.CreateItemResponse, error) {
 	resp, err := s.w.CreateItem(ctx, body)
 	if err != nil {
 		return nil, err
@@ -119,6 +286,39 @@ func (s *ItemsService) Create(ctx context.Context, body apigen.ItemCreate) (*api
 }
 
 func (s *ItemsService) Update(ctx context.Context, id openapi_types.UUID, body apigen.UpdateItemJSONRequestBody) (*apigen.UpdateItemResponse, error) {
+	resp, err := s.updateOrQueue(ctx, id, body)
+	if err == nil {
+		var raw []byte
+		if body.Data != nil {
+			raw, _ = body.Data.MarshalJSON()
+		}
+		s.indexUpdate(id, body.Title, body.Meta, raw)
+	}
+	return resp, err
+}
+
+func (s *ItemsService) updateOrQueue(ctx context.Context, id openapi_types.UUID, body apigen.UpdateItemJSONRequestBody) (*apigen.UpdateItemResponse, error) {
+	if s.sealer != nil && (body.Data != nil || body.Meta != nil) {
+		sealed, err := s.sealUpdate(ctx, id, body)
+		if err != nil {
+			return nil, err
+		}
+		body = sealed
+	}
+	if s.outboxEnabled() {
+		if s.waiting(ctx, id.String()) {
+			return s.enqueueUpdate(ctx, id, body)
+		}
+		resp, err := s.update(ctx, id, body)
+		if isNetworkError(err) {
+			return s.enqueueUpdate(ctx, id, body)
+		}
+		return resp, err
+	}
+	return s.update(ctx, id, body)
+}
+
+func (s *ItemsService) update(ctx context.Context, id openapi_types.UUID, body apigen.UpdateItemJSONRequestBody) (*apigen.UpdateItemResponse, error) {
 	resp, err := s.w.UpdateItem(ctx, id, body)
 	if err != nil {
 		return nil, err
@@ -129,6 +329,28 @@ func (s *ItemsService) Update(ctx context.Context, id openapi_types.UUID, body a
 }
 
 func (s *ItemsService) Delete(ctx context.Context, id openapi_types.UUID) (*apigen.DeleteItemResponse, error) {
+	resp, err := s.deleteOrQueue(ctx, id)
+	if err == nil {
+		s.unindex(id)
+	}
+	return resp, err
+}
+
+func (s *ItemsService) deleteOrQueue(ctx context.Context, id openapi_types.UUID) (*apigen.DeleteItemResponse, error) {
+	if s.outboxEnabled() {
+		if s.waiting(ctx, id.String()) {
+			return s.enqueueDelete(id)
+		}
+		resp, err := s.delete(ctx, id)
+		if isNetworkError(err) {
+			return s.enqueueDelete(id)
+		}
+		return resp, err
+	}
+	return s.delete(ctx, id)
+}
+
+func (s *ItemsService) delete(ctx context.Context, id openapi_types.UUID) (*apigen.DeleteItemResponse, error) {
 	resp, err := s.w.DeleteItem(ctx, id)
 	if err != nil {
 		return nil, err
@@ -4,10 +4,8 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
-	"path/filepath"
 	"testing"
 
-	"github.com/99designs/keyring"
 	"github.com/stretchr/testify/require"
 
 	openapi_types "github.com/oapi-codegen/runtime/types"
@@ -19,16 +17,9 @@ import (
 )
 
 func TestInvalidation_Create_Update_Delete(t *testing.T) {
-	dir := t.TempDir()
 	opts := cache.Options{
-		Path:       filepath.Join(dir, "cache.db"),
+		Backend:    cache.BackendMemory,
 		TTLMinutes: 10,
-		KeyringConfig: keyring.Config{
-			AllowedBackends:  []keyring.BackendType{keyring.FileBackend},
-			FileDir:          dir,
-			FilePasswordFunc: func(string) (string, error) { return "pw", nil },
-			ServiceName:      "sufir-keeper-client",
-		},
 	}
 	cm, err := cache.New(opts)
 	require.NoError(t, err)
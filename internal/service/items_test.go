@@ -4,11 +4,9 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
-	"path/filepath"
 	"testing"
 	"time"
 
-	"github.com/99designs/keyring"
 	"github.com/stretchr/testify/require"
 
 	openapi_types "github.com/oapi-codegen/runtime/types"
@@ -32,16 +30,9 @@ func (timeoutError) Timeout() bool   { return true }
 func (timeoutError) Temporary() bool { return true }
 
 func TestItemsService_List_FallbackToCache(t *testing.T) {
-	dir := t.TempDir()
 	opts := cache.Options{
-		Path:       filepath.Join(dir, "cache.db"),
+		Backend:    cache.BackendMemory,
 		TTLMinutes: 5,
-		KeyringConfig: keyring.Config{
-			AllowedBackends:  []keyring.BackendType{keyring.FileBackend},
-			FileDir:          dir,
-			FilePasswordFunc: func(string) (string, error) { return "pw", nil },
-			ServiceName:      "sufir-keeper-client",
-		},
 	}
 	cm, err := cache.New(opts)
 	require.NoError(t, err)
@@ -65,16 +56,9 @@ func TestItemsService_List_FallbackToCache(t *testing.T) {
 }
 
 func TestItemsService_Get_FallbackToCache(t *testing.T) {
-	dir := t.TempDir()
 	opts := cache.Options{
-		Path:       filepath.Join(dir, "cache.db"),
+		Backend:    cache.BackendMemory,
 		TTLMinutes: 5,
-		KeyringConfig: keyring.Config{
-			AllowedBackends:  []keyring.BackendType{keyring.FileBackend},
-			FileDir:          dir,
-			FilePasswordFunc: func(string) (string, error) { return "pw", nil },
-			ServiceName:      "sufir-keeper-client",
-		},
 	}
 	cm, err := cache.New(opts)
 	require.NoError(t, err)
@@ -99,16 +83,9 @@ func TestItemsService_Get_FallbackToCache(t *testing.T) {
 }
 
 func TestItemsService_List_SuccessUpdatesCache(t *testing.T) {
-	dir := t.TempDir()
 	opts := cache.Options{
-		Path:       filepath.Join(dir, "cache.db"),
+		Backend:    cache.BackendMemory,
 		TTLMinutes: 5,
-		KeyringConfig: keyring.Config{
-			AllowedBackends:  []keyring.BackendType{keyring.FileBackend},
-			FileDir:          dir,
-			FilePasswordFunc: func(string) (string, error) { return "pw", nil },
-			ServiceName:      "sufir-keeper-client",
-		},
 	}
 	cm, err := cache.New(opts)
 	require.NoError(t, err)
@@ -134,16 +111,9 @@ func TestItemsService_List_SuccessUpdatesCache(t *testing.T) {
 }
 
 func TestItemsService_List_NoFallbackOnStatusError(t *testing.T) {
-	dir := t.TempDir()
 	opts := cache.Options{
-		Path:       filepath.Join(dir, "cache.db"),
+		Backend:    cache.BackendMemory,
 		TTLMinutes: 5,
-		KeyringConfig: keyring.Config{
-			AllowedBackends:  []keyring.BackendType{keyring.FileBackend},
-			FileDir:          dir,
-			FilePasswordFunc: func(string) (string, error) { return "pw", nil },
-			ServiceName:      "sufir-keeper-client",
-		},
 	}
 	cm, err := cache.New(opts)
 	require.NoError(t, err)
@@ -168,16 +138,9 @@ func TestItemsService_List_NoFallbackOnStatusError(t *testing.T) {
 }
 
 func TestItemsService_List_NoFallbackOn500(t *testing.T) {
-	dir := t.TempDir()
 	opts := cache.Options{
-		Path:       filepath.Join(dir, "cache.db"),
+		Backend:    cache.BackendMemory,
 		TTLMinutes: 5,
-		KeyringConfig: keyring.Config{
-			AllowedBackends:  []keyring.BackendType{keyring.FileBackend},
-			FileDir:          dir,
-			FilePasswordFunc: func(string) (string, error) { return "pw", nil },
-			ServiceName:      "sufir-keeper-client",
-		},
 	}
 	cm, err := cache.New(opts)
 	require.NoError(t, err)
@@ -199,16 +162,9 @@ func TestItemsService_List_NoFallbackOn500(t *testing.T) {
 }
 
 func TestItemsService_List_TTLExpired_NoFallback(t *testing.T) {
-	dir := t.TempDir()
 	opts := cache.Options{
-		Path:       filepath.Join(dir, "cache.db"),
+		Backend:    cache.BackendMemory,
 		TTLMinutes: 1,
-		KeyringConfig: keyring.Config{
-			AllowedBackends:  []keyring.BackendType{keyring.FileBackend},
-			FileDir:          dir,
-			FilePasswordFunc: func(string) (string, error) { return "pw", nil },
-			ServiceName:      "sufir-keeper-client",
-		},
 	}
 	cm, err := cache.New(opts)
 	require.NoError(t, err)
@@ -240,3 +196,66 @@ func openapiUUIDFromString(t *testing.T, s string) openapi_types.UUID {
 	}
 	return u
 }
+
+func TestItemsService_Get_FallbackParsesCachedBody(t *testing.T) {
+	opts := cache.Options{
+		Backend:    cache.BackendMemory,
+		TTLMinutes: 5,
+	}
+	cm, err := cache.New(opts)
+	require.NoError(t, err)
+	defer func() { _ = cm.Close() }()
+
+	apiClient, err := apigen.NewClientWithResponses("http://127.0.0.1:1", apigen.WithHTTPClient(failingDoer{}))
+	require.NoError(t, err)
+	w := api.NewWrapperFromAPI(apiClient)
+	cfg := config.Config{}
+	cfg.Cache.Enabled = true
+	svc := NewItemsService(w, cm, cfg)
+
+	id := openapiUUIDFromString(t, "00000000-0000-0000-0000-000000000001")
+	require.NoError(t, cm.Put("items:get:00000000-0000-0000-0000-000000000001", []byte(`{"title":"x"}`), nil, ""))
+	resp, err := svc.Get(context.Background(), id)
+	require.NoError(t, err)
+	require.NotNil(t, resp.JSON200)
+	require.Equal(t, "x", *resp.JSON200.Title)
+}
+
+func TestItemsService_ListAllAndFindByMeta(t *testing.T) {
+	opts := cache.Options{
+		Backend:    cache.BackendMemory,
+		TTLMinutes: 5,
+	}
+	cm, err := cache.New(opts)
+	require.NoError(t, err)
+	defer func() { _ = cm.Close() }()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/items", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("offset") == "0" {
+			_, _ = w.Write([]byte(`{"items":[{"id":"00000000-0000-0000-0000-000000000001","meta":{"kind":"a"}}],"total":2}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"items":[{"id":"00000000-0000-0000-0000-000000000002","meta":{"kind":"b"}}],"total":2}`))
+	})
+	mux.HandleFunc("/items/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"00000000-0000-0000-0000-000000000002","title":"found"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	apiClient, err := apigen.NewClientWithResponses(srv.URL, apigen.WithHTTPClient(srv.Client()))
+	require.NoError(t, err)
+	cfg := config.Config{}
+	cfg.Cache.Enabled = true
+	svc := NewItemsService(api.NewWrapperFromAPI(apiClient), cm, cfg)
+
+	all, err := svc.ListAll(context.Background(), nil)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+
+	found, err := svc.FindByMeta(context.Background(), nil, "kind", "b")
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, "found", *found[0].Title)
+}
@@ -0,0 +1,572 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	openapi_types "github.com/oapi-codegen/runtime/types"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apiutil"
+)
+
+// Снимается с записи, когда сервер подтвердил создание.
+const MetaClientID = "client_id"
+
+const (
+	outboxFlushTask     = "outbox:flush"
+	outboxFlushInterval = time.Minute
+	outboxFlushTimeout  = 2 * time.Second
+)
+
+type OutboxKind string
+
+const (
+	OutboxCreate OutboxKind = "create"
+	OutboxUpdate OutboxKind = "update"
+	OutboxDelete OutboxKind = "delete"
+)
+
+var errQueuedDelete = apiutil.Error{Status: http.StatusNotFound, Message: "запись удалена, удаление ожидает отправки"}
+
+// Отвергнутые операции остаются в очереди для разбора (keepcli outbox list).
+var ErrOutboxRejected = errors.New("сервер отклонил отложенные операции")
+
+// Для create ItemID совпадает с идентификатором операции.
+type OutboxOp struct {
+	Create *apigen.ItemCreate `json:"create,omitempty"`
+	Update *apigen.ItemUpdate `json:"update,omitempty"`
+	// Base — версия, поверх которой сделано изменение (см. UpdateFrom).
+	Base     *api.Precondition `json:"base,omitempty"`
+	Kind     OutboxKind        `json:"kind"`
+	ItemID   string            `json:"item_id"`
+	Rejected string            `json:"rejected,omitempty"`
+}
+
+type QueuedOp struct {
+	CreatedAt time.Time
+	ID        string
+	LastError string
+	Op        OutboxOp
+	Attempts  int
+}
+
+func Queued(resp interface{ StatusCode() int }) bool {
+	return resp != nil && resp.StatusCode() == http.StatusAccepted
+}
+
+func (s *ItemsService) outboxEnabled() bool {
+	return s.cfg.Outbox.Enabled && s.cfg.Cache.Enabled
+}
+
+func (s *ItemsService) Outbox() ([]QueuedOp, error) {
+	entries, err := s.c.OutboxList()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]QueuedOp, 0, len(entries))
+	for _, e := range entries {
+		q := QueuedOp{ID: e.ID, CreatedAt: e.CreatedAt, Attempts: e.Attempts, LastError: e.LastError}
+		if err := json.Unmarshal(e.Payload, &q.Op); err != nil {
+			return nil, err
+		}
+		out = append(out, q)
+	}
+	return out, nil
+}
+
+func (s *ItemsService) DropOutbox(id string) error {
+	return s.c.OutboxDelete(id)
+}
+
+// Ошибки чтения очереди не мешают работе с сервером.
+func (s *ItemsService) pending() []QueuedOp {
+	if !s.outboxEnabled() {
+		return nil
+	}
+	ops, _ := s.Outbox()
+	out := ops[:0]
+	for _, q := range ops {
+		if q.Op.Rejected == "" {
+			out = append(out, q)
+		}
+	}
+	return out
+}
+
+// Новая операция над записью встаёт за неотправленными.
+func (s *ItemsService) waiting(ctx context.Context, id string) bool {
+	touches := func() bool {
+		for _, q := range s.pending() {
+			if q.Op.ItemID == id {
+				return true
+			}
+		}
+		return false
+	}
+	if !touches() {
+		return false
+	}
+	_, _ = s.FlushOutbox(ctx)
+	return touches()
+}
+
+func (s *ItemsService) enqueue(op OutboxOp) error {
+	id := op.ItemID
+	if op.Kind != OutboxCreate {
+		id = uuid.NewString()
+	}
+	b, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	return s.c.OutboxAdd(id, b)
+}
+
+func (s *ItemsService) queuedCreate(id string) *QueuedOp {
+	for _, q := range s.pending() {
+		if q.Op.Kind == OutboxCreate && q.Op.ItemID == id {
+			return &q
+		}
+	}
+	return nil
+}
+
+func accepted() *http.Response {
+	return &http.Response{StatusCode: http.StatusAccepted, Status: "202 Accepted"}
+}
+
+func (s *ItemsService) enqueueCreate(body apigen.ItemCreate) (*apigen.CreateItemResponse, error) {
+	id := uuid.NewString()
+	meta := map[string]string{}
+	if body.Meta != nil {
+		meta = maps.Clone(*body.Meta)
+	}
+	meta[MetaClientID] = id
+	body.Meta = &meta
+	if err := s.enqueue(OutboxOp{Kind: OutboxCreate, ItemID: id, Create: &body}); err != nil {
+		return nil, err
+	}
+	_ = s.c.DeletePrefix("items:list:")
+	item, err := itemFromCreate(id, body)
+	if err != nil {
+		return nil, err
+	}
+	return &apigen.CreateItemResponse{HTTPResponse: accepted(), JSON201: &item}, nil
+}
+
+func (s *ItemsService) enqueueUpdate(ctx context.Context, id openapi_types.UUID, body apigen.ItemUpdate) (*apigen.UpdateItemResponse, error) {
+	if q := s.queuedCreate(id.String()); q != nil {
+		create := *q.Op.Create
+		if err := applyUpdateToCreate(&create, body); err != nil {
+			return nil, err
+		}
+		q.Op.Create = &create
+		b, err := json.Marshal(q.Op)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.c.OutboxUpdate(q.ID, b); err != nil {
+			return nil, err
+		}
+	} else {
+		op := OutboxOp{Kind: OutboxUpdate, ItemID: id.String(), Update: &body}
+		if pre, ok := api.PreconditionFrom(ctx); ok {
+			op.Base = &pre
+		}
+		if err := s.enqueue(op); err != nil {
+			return nil, err
+		}
+	}
+	_ = s.c.DeletePrefix("items:list:")
+	return &apigen.UpdateItemResponse{HTTPResponse: accepted()}, nil
+}
+
+func (s *ItemsService) enqueueDelete(id openapi_types.UUID) (*apigen.DeleteItemResponse, error) {
+	if q := s.queuedCreate(id.String()); q != nil {
+		if err := s.c.OutboxDelete(q.ID); err != nil {
+			return nil, err
+		}
+	} else if err := s.enqueue(OutboxOp{Kind: OutboxDelete, ItemID: id.String()}); err != nil {
+		return nil, err
+	}
+	_ = s.c.DeletePrefix("items:list:")
+	return &apigen.DeleteItemResponse{HTTPResponse: accepted()}, nil
+}
+
+// Без связи отправка останавливается, чтобы не нарушить порядок операций.
+func (s *ItemsService) FlushOutbox(ctx context.Context) (int, error) {
+	ops, err := s.Outbox()
+	if err != nil {
+		return 0, err
+	}
+	n, rejected := 0, 0
+	defer func() {
+		if n+rejected > 0 {
+			s.InvalidateCache()
+		}
+	}()
+	for _, q := range ops {
+		if q.Op.Rejected != "" {
+			continue
+		}
+		if err := s.replay(ctx, q); err != nil {
+			_ = s.c.OutboxFail(q.ID, err.Error())
+			if transient(ctx, err) {
+				return n, err
+			}
+			if err := s.reject(q, err); err != nil {
+				return n, err
+			}
+			rejected++
+			continue
+		}
+		if err := s.c.OutboxDelete(q.ID); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if rejected > 0 {
+		return n, fmt.Errorf("%w: %d", ErrOutboxRejected, rejected)
+	}
+	return n, nil
+}
+
+// Попутно с другой командой: не чаще outboxFlushInterval, не дольше outboxFlushTimeout.
+func (s *ItemsService) TryFlushOutbox(ctx context.Context) (int, error) {
+	if len(s.pending()) == 0 {
+		return 0, nil
+	}
+	if ok, err := s.c.Claim(outboxFlushTask, outboxFlushInterval); err != nil || !ok {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, outboxFlushTimeout)
+	defer cancel()
+	return s.FlushOutbox(ctx)
+}
+
+func (s *ItemsService) reject(q QueuedOp, cause error) error {
+	q.Op.Rejected = cause.Error()
+	b, err := json.Marshal(q.Op)
+	if err != nil {
+		return err
+	}
+	return s.c.OutboxUpdate(q.ID, b)
+}
+
+// transient: сервер недоступен, и операцию стоит повторить.
+func transient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || isNetworkError(err) {
+		return true
+	}
+	var apiErr apiutil.Error
+	return errors.As(err, &apiErr) && apiErr.Status >= http.StatusInternalServerError
+}
+
+func (s *ItemsService) replay(ctx context.Context, q QueuedOp) error {
+	op := q.Op
+	switch op.Kind {
+	case OutboxCreate:
+		id, err := s.createdRemotely(ctx, *op.Create)
+		if err != nil {
+			return err
+		}
+		if id == nil {
+			resp, err := s.w.CreateItem(ctx, *op.Create)
+			if err != nil {
+				return err
+			}
+			if resp.JSON201 == nil || resp.JSON201.Id == nil {
+				return nil
+			}
+			id = resp.JSON201.Id
+		}
+		return s.forgetClientID(ctx, q, *id)
+	case OutboxUpdate:
+		id, err := uuid.Parse(op.ItemID)
+		if err != nil {
+			return err
+		}
+		if op.Base != nil {
+			ctx = api.WithPrecondition(ctx, *op.Base)
+		}
+		_, err = s.w.UpdateItem(ctx, id, *op.Update)
+		return err
+	case OutboxDelete:
+		id, err := uuid.Parse(op.ItemID)
+		if err != nil {
+			return err
+		}
+		_, err = s.w.DeleteItem(ctx, id)
+		var apiErr apiutil.Error
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+	return errors.New("unknown outbox operation " + string(op.Kind))
+}
+
+// При сбое повторяется только правка meta, а не создание.
+func (s *ItemsService) forgetClientID(ctx context.Context, q QueuedOp, id openapi_types.UUID) error {
+	meta := maps.Clone(*q.Op.Create.Meta)
+	delete(meta, MetaClientID)
+	q.Op = OutboxOp{Kind: OutboxUpdate, ItemID: id.String(), Update: &apigen.ItemUpdate{Meta: &meta}}
+	b, err := json.Marshal(q.Op)
+	if err != nil {
+		return err
+	}
+	if err := s.c.OutboxUpdate(q.ID, b); err != nil {
+		return err
+	}
+	return s.replay(ctx, q)
+}
+
+// Прошлое создание могло дойти до сервера, хотя ответ потерялся.
+func (s *ItemsService) createdRemotely(ctx context.Context, body apigen.ItemCreate) (*openapi_types.UUID, error) {
+	raw, err := body.Data.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	clientID := (*body.Meta)[MetaClientID]
+	t := apiutil.DataType(raw)
+	var found *openapi_types.UUID
+	err = apiutil.EachPage(ctx, s.w.GetItems, apigen.GetItemsParams{Type: &t}, func(page []apigen.ItemListResponse) bool {
+		for _, it := range page {
+			if it.Id != nil && it.Meta != nil && (*it.Meta)[MetaClientID] == clientID {
+				found = it.Id
+			}
+		}
+		return found == nil
+	})
+	return found, err
+}
+
+func (s *ItemsService) overlayGet(id openapi_types.UUID, resp *apigen.GetItemResponse, err error) (*apigen.GetItemResponse, error) {
+	var item *apigen.ItemResponse
+	if err == nil && resp.JSON200 != nil {
+		it := *resp.JSON200
+		item = &it
+	}
+	touched := false
+	for _, q := range s.pending() {
+		if q.Op.ItemID != id.String() {
+			continue
+		}
+		touched = true
+		switch q.Op.Kind {
+		case OutboxCreate:
+			it, cerr := itemFromCreate(q.Op.ItemID, *q.Op.Create)
+			if cerr != nil {
+				return nil, cerr
+			}
+			item = &it
+		case OutboxUpdate:
+			if item == nil {
+				return resp, err
+			}
+			if uerr := applyUpdate(item, *q.Op.Update); uerr != nil {
+				return nil, uerr
+			}
+		case OutboxDelete:
+			return nil, errQueuedDelete
+		}
+	}
+	if !touched || item == nil {
+		return resp, err
+	}
+	body, merr := json.Marshal(item)
+	if merr != nil {
+		return nil, merr
+	}
+	return &apigen.GetItemResponse{Body: body, JSON200: item}, nil
+}
+
+// Созданные записи добавляются на первую страницу.
+func (s *ItemsService) overlayList(params *apigen.GetItemsParams, resp *apigen.GetItemsResponse, err error) (*apigen.GetItemsResponse, error) {
+	ops := s.pending()
+	if len(ops) == 0 {
+		return resp, err
+	}
+	if err != nil {
+		// Без сети и кеша показываем хотя бы то, что ждёт отправки.
+		if !isNetworkError(err) {
+			return nil, err
+		}
+		resp = &apigen.GetItemsResponse{}
+		if jerr := json.Unmarshal([]byte(`{"items":[],"total":0}`), &resp.JSON200); jerr != nil {
+			return nil, jerr
+		}
+	}
+	if resp.JSON200 == nil {
+		return resp, nil
+	}
+	var items []apigen.ItemListResponse
+	if resp.JSON200.Items != nil {
+		items = *resp.JSON200.Items
+	}
+	index := map[string]int{}
+	for i, it := range items {
+		if it.Id != nil {
+			index[it.Id.String()] = i
+		}
+	}
+	deleted := map[string]bool{}
+	firstPage := params == nil || params.Offset == nil || *params.Offset == 0
+	for _, q := range ops {
+		switch q.Op.Kind {
+		case OutboxCreate:
+			it, err := itemFromCreate(q.Op.ItemID, *q.Op.Create)
+			if err != nil {
+				return nil, err
+			}
+			if firstPage && listMatches(it, params) {
+				index[q.Op.ItemID] = len(items)
+				items = append(items, apigen.ItemListResponse{Id: it.Id, Title: it.Title, Meta: it.Meta, CreatedAt: it.CreatedAt, UpdatedAt: it.UpdatedAt})
+			}
+		case OutboxUpdate:
+			if i, ok := index[q.Op.ItemID]; ok {
+				if q.Op.Update.Title != nil {
+					items[i].Title = q.Op.Update.Title
+				}
+				if q.Op.Update.Meta != nil {
+					m := maps.Clone(*q.Op.Update.Meta)
+					items[i].Meta = &m
+				}
+			}
+		case OutboxDelete:
+			deleted[q.Op.ItemID] = true
+		}
+	}
+	kept := make([]apigen.ItemListResponse, 0, len(items))
+	for _, it := range items {
+		if it.Id == nil || !deleted[it.Id.String()] {
+			kept = append(kept, it)
+		}
+	}
+	out := *resp
+	page := *resp.JSON200
+	page.Items = &kept
+	if page.Total != nil {
+		total := max(*page.Total+len(kept)-len(*orEmpty(resp.JSON200.Items)), 0)
+		page.Total = &total
+	}
+	out.JSON200 = &page
+	body, err := json.Marshal(page)
+	if err != nil {
+		return nil, err
+	}
+	out.Body = body
+	return &out, nil
+}
+
+func orEmpty(items *[]apigen.ItemListResponse) *[]apigen.ItemListResponse {
+	if items == nil {
+		return &[]apigen.ItemListResponse{}
+	}
+	return items
+}
+
+func listMatches(it apigen.ItemResponse, params *apigen.GetItemsParams) bool {
+	if params == nil {
+		return true
+	}
+	if params.Type != nil && it.Data != nil {
+		raw, _ := it.Data.MarshalJSON()
+		if apiutil.DataType(raw) != *params.Type {
+			return false
+		}
+	}
+	if params.S != nil && *params.S != "" && it.Title != nil {
+		return strings.Contains(strings.ToLower(*it.Title), strings.ToLower(*params.S))
+	}
+	return true
+}
+
+func itemFromCreate(clientID string, body apigen.ItemCreate) (apigen.ItemResponse, error) {
+	id, err := uuid.Parse(clientID)
+	if err != nil {
+		return apigen.ItemResponse{}, err
+	}
+	raw, err := body.Data.MarshalJSON()
+	if err != nil {
+		return apigen.ItemResponse{}, err
+	}
+	var d apigen.ItemResponse_Data
+	if err := d.UnmarshalJSON(raw); err != nil {
+		return apigen.ItemResponse{}, err
+	}
+	title := body.Title
+	it := apigen.ItemResponse{Id: &id, Title: &title, Data: &d}
+	if body.Meta != nil {
+		m := maps.Clone(*body.Meta)
+		it.Meta = &m
+	}
+	return it, nil
+}
+
+func applyUpdate(item *apigen.ItemResponse, body apigen.ItemUpdate) error {
+	if body.Title != nil {
+		title := *body.Title
+		item.Title = &title
+	}
+	if body.Meta != nil {
+		m := maps.Clone(*body.Meta)
+		item.Meta = &m
+	}
+	if body.Data == nil {
+		return nil
+	}
+	raw, err := body.Data.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	if item.Data != nil {
+		cur, err := item.Data.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		if apiutil.DataType(cur) == apiutil.DataType(raw) {
+			if raw, err = apiutil.MergeData(cur, raw); err != nil {
+				return err
+			}
+		}
+	}
+	var d apigen.ItemResponse_Data
+	if err := d.UnmarshalJSON(raw); err != nil {
+		return err
+	}
+	item.Data = &d
+	return nil
+}
+
+func applyUpdateToCreate(create *apigen.ItemCreate, body apigen.ItemUpdate) error {
+	clientID := (*create.Meta)[MetaClientID]
+	item, err := itemFromCreate(clientID, *create)
+	if err != nil {
+		return err
+	}
+	if err := applyUpdate(&item, body); err != nil {
+		return err
+	}
+	create.Title = *item.Title
+	meta := map[string]string{}
+	if item.Meta != nil {
+		meta = maps.Clone(*item.Meta)
+	}
+	meta[MetaClientID] = clientID
+	create.Meta = &meta
+	raw, err := item.Data.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	return create.Data.UnmarshalJSON(raw)
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+)
+
+func newOutboxService(t *testing.T, srv *memServer) *ItemsService {
+	t.Helper()
+	svc := newSealedService(t, srv, nil)
+	svc.cfg.Outbox.Enabled = true
+	return svc
+}
+
+func textItem(t *testing.T, title, value string) apigen.ItemCreate {
+	t.Helper()
+	var d apigen.ItemCreate_Data
+	require.NoError(t, d.FromTextData(apigen.TextData{Type: apigen.TEXT, Value: value}))
+	return apigen.ItemCreate{Title: title, Data: d}
+}
+
+func TestItemsService_OutboxQueuesAndReplays(t *testing.T) {
+	ctx := context.Background()
+	srv := &memServer{items: map[string]map[string]any{}, down: true}
+	svc := newOutboxService(t, srv)
+
+	created, err := svc.Create(ctx, textItem(t, "offline", "v1"))
+	require.NoError(t, err)
+	require.True(t, Queued(created))
+	id := *created.JSON201.Id
+
+	title := "offline-2"
+	upd, err := svc.Update(ctx, id, apigen.ItemUpdate{Title: &title})
+	require.NoError(t, err)
+	require.True(t, Queued(upd))
+	ops, err := svc.Outbox()
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	require.Equal(t, OutboxCreate, ops[0].Op.Kind)
+
+	got, err := svc.Get(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, "offline-2", *got.JSON200.Title)
+	list, err := svc.List(ctx, &apigen.GetItemsParams{})
+	require.NoError(t, err)
+	require.Len(t, *list.JSON200.Items, 1)
+
+	n, err := svc.FlushOutbox(ctx)
+	require.Error(t, err)
+	require.Zero(t, n)
+	ops, err = svc.Outbox()
+	require.NoError(t, err)
+	require.Equal(t, 2, ops[0].Attempts, "изменение тоже пробовало отправить очередь")
+	require.NotEmpty(t, ops[0].LastError)
+
+	srv.mu.Lock()
+	srv.down = false
+	srv.mu.Unlock()
+	n, err = svc.FlushOutbox(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Len(t, srv.items, 1)
+	for _, it := range srv.items {
+		require.Equal(t, "offline-2", it["title"])
+		require.NotContains(t, it["meta"], MetaClientID, "после подтверждения client_id убирается с сервера")
+	}
+	ops, err = svc.Outbox()
+	require.NoError(t, err)
+	require.Empty(t, ops)
+}
+
+func TestItemsService_OutboxReplayDoesNotDuplicate(t *testing.T) {
+	ctx := context.Background()
+	srv := &memServer{items: map[string]map[string]any{}, down: true}
+	svc := newOutboxService(t, srv)
+
+	created, err := svc.Create(ctx, textItem(t, "a", "v"))
+	require.NoError(t, err)
+	require.True(t, Queued(created))
+	// Первая попытка дошла до сервера, но ответ потерялся.
+	srv.items["00000000-0000-0000-0000-000000000099"] = map[string]any{
+		"title": "a",
+		"data":  map[string]any{"type": "TEXT", "value": "v"},
+		"meta":  map[string]any{MetaClientID: created.JSON201.Id.String()},
+	}
+	srv.down = false
+
+	n, err := svc.FlushOutbox(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Len(t, srv.items, 1)
+	require.Empty(t, srv.items["00000000-0000-0000-0000-000000000099"]["meta"])
+}
+
+func TestItemsService_OutboxRetriesOnlyClientIDCleanup(t *testing.T) {
+	ctx := context.Background()
+	srv := &memServer{items: map[string]map[string]any{}, down: true}
+	svc := newOutboxService(t, srv)
+	created, err := svc.Create(ctx, textItem(t, "a", "v"))
+	require.NoError(t, err)
+	require.True(t, Queued(created))
+	ops, err := svc.Outbox()
+	require.NoError(t, err)
+
+	// Создание дошло, а правка meta — нет.
+	id := "00000000-0000-0000-0000-000000000099"
+	srv.items[id] = map[string]any{
+		"title": "a",
+		"data":  map[string]any{"type": "TEXT", "value": "v"},
+		"meta":  map[string]any{MetaClientID: created.JSON201.Id.String()},
+	}
+	require.Error(t, svc.forgetClientID(ctx, ops[0], uuid.MustParse(id)))
+	ops, err = svc.Outbox()
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	require.Equal(t, OutboxUpdate, ops[0].Op.Kind)
+	require.Equal(t, id, ops[0].Op.ItemID)
+
+	srv.down = false
+	n, err := svc.FlushOutbox(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Len(t, srv.items, 1)
+	require.Empty(t, srv.items[id]["meta"])
+}
+
+func TestItemsService_TryFlushOutboxIsThrottled(t *testing.T) {
+	ctx := context.Background()
+	srv := &memServer{items: map[string]map[string]any{}, down: true}
+	svc := newOutboxService(t, srv)
+	n, err := svc.TryFlushOutbox(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+	require.Zero(t, srv.requests, "пустая очередь не обращается к серверу")
+
+	_, err = svc.Create(ctx, textItem(t, "a", "v"))
+	require.NoError(t, err)
+	_, err = svc.TryFlushOutbox(ctx)
+	require.Error(t, err)
+	tried := srv.requests
+
+	srv.down = false
+	n, err = svc.TryFlushOutbox(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+	require.Equal(t, tried, srv.requests, "повтор не чаще раза в outboxFlushInterval")
+	n, err = svc.FlushOutbox(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+}
+
+func TestItemsService_OutboxDoesNotHoldUnrelatedWrites(t *testing.T) {
+	ctx := context.Background()
+	srv := &memServer{items: map[string]map[string]any{}}
+	svc := newOutboxService(t, srv)
+	first, err := svc.Create(ctx, textItem(t, "first", "v"))
+	require.NoError(t, err)
+	require.False(t, Queued(first))
+	require.NotContains(t, srv.bodies[0], MetaClientID)
+
+	srv.down = true
+	second, err := svc.Create(ctx, textItem(t, "second", "v"))
+	require.NoError(t, err)
+	require.True(t, Queued(second))
+	srv.down = false
+	title := "renamed"
+	upd, err := svc.Update(ctx, *first.JSON201.Id, apigen.ItemUpdate{Title: &title})
+	require.NoError(t, err)
+	require.False(t, Queued(upd))
+	require.Equal(t, "renamed", srv.items[first.JSON201.Id.String()]["title"])
+
+	srv.down = true
+	title = "offline"
+	upd, err = svc.Update(ctx, *second.JSON201.Id, apigen.ItemUpdate{Title: &title})
+	require.NoError(t, err)
+	require.True(t, Queued(upd), "изменение записи из очереди встаёт за ней")
+	srv.down = false
+
+	n, err := svc.FlushOutbox(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Len(t, srv.items, 2)
+}
+
+func TestItemsService_OutboxParksRejectedOps(t *testing.T) {
+	ctx := context.Background()
+	srv := &memServer{items: map[string]map[string]any{}}
+	svc := newOutboxService(t, srv)
+	gone, err := svc.Create(ctx, textItem(t, "gone", "v"))
+	require.NoError(t, err)
+	id := *gone.JSON201.Id
+
+	srv.down = true
+	title := "late"
+	_, err = svc.Update(ctx, id, apigen.ItemUpdate{Title: &title})
+	require.NoError(t, err)
+	_, err = svc.Create(ctx, textItem(t, "after", "v"))
+	require.NoError(t, err)
+	delete(srv.items, id.String())
+	srv.down = false
+
+	n, err := svc.FlushOutbox(ctx)
+	require.ErrorIs(t, err, ErrOutboxRejected)
+	require.Equal(t, 1, n, "отказ сервера не останавливает очередь")
+	require.Len(t, srv.items, 1)
+	ops, err := svc.Outbox()
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	require.Equal(t, OutboxUpdate, ops[0].Op.Kind)
+	require.NotEmpty(t, ops[0].Op.Rejected)
+
+	n, err = svc.FlushOutbox(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
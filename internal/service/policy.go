@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api"
+)
+
+// ReadPolicy — порядок, в котором List и Get обращаются к серверу и кешу.
+type ReadPolicy string
+
+const (
+	// NetworkFirst читает с сервера и обращается к свежему кешу, только если
+	// сервер недоступен.
+	NetworkFirst ReadPolicy = "network-first"
+	// CacheFirst отдаёт запись из кеша сразу; устаревшую запись обновляет с
+	// сервера в фоне.
+	CacheFirst ReadPolicy = "cache-first"
+	// CacheOnly не обращается к серверу.
+	CacheOnly ReadPolicy = "cache-only"
+)
+
+// ErrNotCached — в режиме cache-only запрошенной записи нет в кеше.
+var ErrNotCached = errors.New("запись отсутствует в кеше")
+
+// Команда CLI ждёт фоновое обновление перед выходом; без сети backoff
+// избавляет от этого ожидания.
+const (
+	revalidateTimeout   = time.Second
+	revalidateBackoff   = time.Minute
+	revalidateFailedKey = "revalidate:failed"
+)
+
+func ParseReadPolicy(s string) (ReadPolicy, error) {
+	switch p := ReadPolicy(s); p {
+	case "":
+		return NetworkFirst, nil
+	case NetworkFirst, CacheFirst, CacheOnly:
+		return p, nil
+	}
+	return "", fmt.Errorf("неизвестный режим чтения %q: ожидается %s, %s или %s", s, NetworkFirst, CacheFirst, CacheOnly)
+}
+
+const (
+	headerSource = "X-Keepcli-Source"
+	sourceCache  = "cache"
+	sourceStale  = "cache; stale"
+)
+
+// Source описывает, откуда получен ответ List/Get.
+type Source struct {
+	Age    time.Duration
+	Cached bool
+	// Stale — срок жизни записи в кеше истёк.
+	Stale bool
+	// Index — результаты локального поиска; возраст у них не один, Age
+	// не заполняется.
+	Index bool
+}
+
+// SourceOf читает пометку, которую ItemsService ставит на ответы из кеша.
+func SourceOf(resp *http.Response) Source {
+	if resp == nil {
+		return Source{}
+	}
+	v := resp.Header.Get(headerSource)
+	if v == sourceIndex {
+		return Source{Cached: true, Index: true}
+	}
+	if v != sourceCache && v != sourceStale {
+		return Source{}
+	}
+	age, _ := strconv.Atoi(resp.Header.Get("Age"))
+	return Source{Cached: true, Stale: v == sourceStale, Age: time.Duration(age) * time.Second}
+}
+
+func fromCache(updatedAt time.Time, stale bool) *http.Response {
+	h := http.Header{}
+	h.Set(headerSource, sourceCache)
+	if stale {
+		h.Set(headerSource, sourceStale)
+	}
+	h.Set("Age", strconv.Itoa(int(max(time.Since(updatedAt), 0).Seconds())))
+	return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Header: h}
+}
+
+func (s *ItemsService) SetReadPolicy(p ReadPolicy) {
+	s.policy = p
+}
+
+type policyKey struct{}
+
+// WithReadPolicy задаёт режим чтения для одного запроса вместо режима
+// сервиса.
+func WithReadPolicy(ctx context.Context, p ReadPolicy) context.Context {
+	return context.WithValue(ctx, policyKey{}, p)
+}
+
+func (s *ItemsService) policyFor(ctx context.Context) ReadPolicy {
+	if p, ok := ctx.Value(policyKey{}).(ReadPolicy); ok {
+		return p
+	}
+	return s.policy
+}
+
+func (s *ItemsService) revalidate(ctx context.Context, fn func(context.Context) error) {
+	if at, err := s.c.MarkedAt(revalidateFailedKey); err == nil && time.Since(at) < revalidateBackoff {
+		return
+	}
+	s.bg.Add(1)
+	go func() {
+		defer s.bg.Done()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), revalidateTimeout)
+		defer cancel()
+		if err := fn(ctx); err != nil && (isNetworkError(err) || ctx.Err() != nil) {
+			_ = s.c.Mark(revalidateFailedKey)
+		}
+	}()
+}
+
+// Wait дожидается фоновых обновлений кеша; вызывается перед закрытием кеша.
+func (s *ItemsService) Wait() {
+	s.bg.Wait()
+}
+
+// Сервер подтвердил тело из кеша, поэтому ответ не помечается как кешевый.
+func confirmed(hr *http.Response) *http.Response {
+	c := *hr
+	c.StatusCode, c.Status = http.StatusOK, "200 OK"
+	return &c
+}
+
+// decode собирает ответ из тела, сохранённого в кеше; в meta записи лежат
+// валидаторы для условного запроса.
+func readThrough[R any](s *ItemsService, ctx context.Context, key string,
+	fetch func(context.Context) (*R, []byte, *http.Response, error),
+	decode func(body []byte, hr *http.Response) (*R, error),
+) (*R, error) {
+	policy := s.policyFor(ctx)
+	fetchCond := func(ctx context.Context) (*R, error) {
+		var old []byte
+		if s.cfg.Cache.Enabled {
+			if pj, _, meta, err := s.c.Peek(key); err == nil {
+				var v api.Validators
+				if json.Unmarshal([]byte(meta), &v) == nil && !v.IsZero() {
+					ctx, old = api.WithValidators(ctx, v), pj
+				}
+			}
+		}
+		resp, body, hr, err := fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if api.NotModified(hr) {
+			_ = s.c.Refresh(key)
+			return decode(old, confirmed(hr))
+		}
+		if s.cfg.Cache.Enabled {
+			var meta []byte
+			if v := api.ValidatorsOf(hr); !v.IsZero() {
+				meta, _ = json.Marshal(v)
+			}
+			_ = s.c.Put(key, body, nil, string(meta))
+		}
+		return resp, nil
+	}
+	cached := func(usable func(time.Time) bool) (*R, bool) {
+		if !s.cfg.Cache.Enabled {
+			return nil, false
+		}
+		pj, _, ts, _, err := s.c.Get(key)
+		if err != nil || !usable(ts) {
+			return nil, false
+		}
+		stale := !s.c.IsFresh(ts)
+		resp, err := decode(pj, fromCache(ts, stale))
+		if err != nil {
+			return nil, false
+		}
+		if stale && policy == CacheFirst {
+			s.revalidate(ctx, func(ctx context.Context) error {
+				_, err := fetchCond(ctx)
+				return err
+			})
+		}
+		return resp, true
+	}
+	switch policy {
+	case CacheOnly:
+		if resp, ok := cached(s.c.IsUsable); ok {
+			return resp, nil
+		}
+		return nil, ErrNotCached
+	case CacheFirst:
+		if resp, ok := cached(s.c.IsUsable); ok {
+			return resp, nil
+		}
+	}
+	resp, err := fetchCond(ctx)
+	if err == nil {
+		return resp, nil
+	}
+	if !isNetworkError(err) {
+		return nil, err
+	}
+	if resp, ok := cached(s.c.IsFresh); ok {
+		return resp, nil
+	}
+	return nil, err
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/cache"
+	"github.com/GoLessons/sufir-keeper-client/internal/config"
+)
+
+const policyItemID = "00000000-0000-0000-0000-000000000001"
+
+func newPolicyService(t *testing.T, srv http.Handler, policy ReadPolicy) (*ItemsService, *cache.Manager) {
+	t.Helper()
+	hs := httptest.NewServer(srv)
+	t.Cleanup(hs.Close)
+	cm, err := cache.New(cache.Options{
+		Backend:      cache.BackendMemory,
+		TTLMinutes:   5,
+		StaleMinutes: 60,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = cm.Close() })
+	apiClient, err := apigen.NewClientWithResponses(hs.URL, apigen.WithHTTPClient(hs.Client()))
+	require.NoError(t, err)
+	cfg := config.Config{}
+	cfg.Cache.Enabled = true
+	cfg.Cache.ReadPolicy = string(policy)
+	return NewItemsService(api.NewWrapperFromAPI(apiClient), cm, cfg), cm
+}
+
+func TestParseReadPolicy(t *testing.T) {
+	p, err := ParseReadPolicy("")
+	require.NoError(t, err)
+	require.Equal(t, NetworkFirst, p)
+	p, err = ParseReadPolicy("cache-only")
+	require.NoError(t, err)
+	require.Equal(t, CacheOnly, p)
+	_, err = ParseReadPolicy("offline")
+	require.Error(t, err)
+}
+
+func TestItemsService_CacheOnlyNeverCallsServer(t *testing.T) {
+	srv := &memServer{items: map[string]map[string]any{}}
+	svc, cm := newPolicyService(t, srv, CacheOnly)
+	ctx := context.Background()
+	id := openapiUUIDFromString(t, policyItemID)
+
+	_, err := svc.Get(ctx, id)
+	require.ErrorIs(t, err, ErrNotCached)
+
+	ts := time.Now().Add(-30 * time.Minute)
+	require.NoError(t, cm.PutWithTimestamp("items:get:"+policyItemID, []byte(`{"title":"cached"}`), nil, "", ts))
+	resp, err := svc.Get(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, "cached", *resp.JSON200.Title)
+	src := SourceOf(resp.HTTPResponse)
+	require.True(t, src.Cached)
+	require.True(t, src.Stale)
+	require.InDelta(t, (30 * time.Minute).Seconds(), src.Age.Seconds(), 5)
+
+	svc.Wait()
+	require.Zero(t, srv.requests)
+}
+
+func TestItemsService_ReadPolicyPerRequest(t *testing.T) {
+	srv := &memServer{items: map[string]map[string]any{
+		policyItemID: {"title": "server"},
+	}}
+	svc, cm := newPolicyService(t, srv, CacheOnly)
+	id := openapiUUIDFromString(t, policyItemID)
+	require.NoError(t, cm.Put("items:get:"+policyItemID, []byte(`{"title":"cached"}`), nil, ""))
+
+	resp, err := svc.Get(WithReadPolicy(context.Background(), NetworkFirst), id)
+	require.NoError(t, err)
+	require.Equal(t, "server", *resp.JSON200.Title)
+	require.Equal(t, 1, srv.requests)
+}
+
+func TestItemsService_CacheFirstRevalidatesStale(t *testing.T) {
+	srv := &memServer{items: map[string]map[string]any{
+		policyItemID: {"title": "server"},
+	}}
+	svc, cm := newPolicyService(t, srv, CacheFirst)
+	ctx := context.Background()
+	id := openapiUUIDFromString(t, policyItemID)
+	key := "items:get:" + policyItemID
+
+	require.NoError(t, cm.Put(key, []byte(`{"title":"fresh"}`), nil, ""))
+	resp, err := svc.Get(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, "fresh", *resp.JSON200.Title)
+	require.False(t, SourceOf(resp.HTTPResponse).Stale)
+	svc.Wait()
+	require.Zero(t, srv.requests, "свежая запись не перечитывается")
+
+	require.NoError(t, cm.PutWithTimestamp(key, []byte(`{"title":"stale"}`), nil, "", time.Now().Add(-10*time.Minute)))
+	resp, err = svc.Get(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, "stale", *resp.JSON200.Title)
+	require.True(t, SourceOf(resp.HTTPResponse).Stale)
+	svc.Wait()
+	require.Equal(t, 1, srv.requests)
+
+	pj, _, ts, _, err := cm.Get(key)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"title":"server"}`, string(pj))
+	require.True(t, cm.IsFresh(ts))
+}
+
+func TestItemsService_CacheFirstSkipsRevalidationAfterFailure(t *testing.T) {
+	srv := &memServer{items: map[string]map[string]any{}, down: true}
+	svc, cm := newPolicyService(t, srv, CacheFirst)
+	ctx := context.Background()
+	id := openapiUUIDFromString(t, policyItemID)
+	key := "items:get:" + policyItemID
+
+	require.NoError(t, cm.PutWithTimestamp(key, []byte(`{"title":"stale"}`), nil, "", time.Now().Add(-10*time.Minute)))
+	_, err := svc.Get(ctx, id)
+	require.NoError(t, err)
+	start := time.Now()
+	svc.Wait()
+	require.Less(t, time.Since(start), 2*revalidateTimeout)
+	tried := srv.requests
+	require.NotZero(t, tried)
+	keys, err := cm.Keys("")
+	require.NoError(t, err)
+	require.Equal(t, []string{key}, keys, "метка неудачи не хранится среди записей кеша")
+
+	_, err = svc.Get(ctx, id)
+	require.NoError(t, err)
+	svc.Wait()
+	require.Equal(t, tried, srv.requests, "после неудачи фоновое обновление не повторяется")
+}
+
+func TestItemsService_CacheFirstFallsBackToNetwork(t *testing.T) {
+	srv := &memServer{items: map[string]map[string]any{
+		policyItemID: {"title": "server"},
+	}}
+	svc, _ := newPolicyService(t, srv, CacheFirst)
+	resp, err := svc.Get(context.Background(), openapiUUIDFromString(t, policyItemID))
+	require.NoError(t, err)
+	require.Equal(t, "server", *resp.JSON200.Title)
+	require.False(t, SourceOf(resp.HTTPResponse).Cached)
+}
+
+func TestItemsService_NetworkFirstMarksFallback(t *testing.T) {
+	srv := &memServer{items: map[string]map[string]any{}, down: true}
+	svc, cm := newPolicyService(t, srv, NetworkFirst)
+	ctx := context.Background()
+	id := openapiUUIDFromString(t, policyItemID)
+	key := "items:get:" + policyItemID
+
+	require.NoError(t, cm.PutWithTimestamp(key, []byte(`{"title":"stale"}`), nil, "", time.Now().Add(-10*time.Minute)))
+	_, err := svc.Get(ctx, id)
+	require.Error(t, err, "network-first не отдаёт устаревшие записи")
+
+	require.NoError(t, cm.Put(key, []byte(`{"title":"cached"}`), nil, ""))
+	resp, err := svc.Get(ctx, id)
+	require.NoError(t, err)
+	src := SourceOf(resp.HTTPResponse)
+	require.True(t, src.Cached)
+	require.False(t, src.Stale)
+}
+
+// etagServer отдаёт одну запись с ETag и отвечает 304 на совпавший
+// If-None-Match.
+type etagServer struct {
+	mu          sync.Mutex
+	etag, title string
+	full        int
+	notModified int
+}
+
+func (e *etagServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if r.Header.Get("If-None-Match") == e.etag {
+		e.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	e.full++
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", e.etag)
+	w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+	_ = json.NewEncoder(w).Encode(map[string]any{"id": policyItemID, "title": e.title})
+}
+
+func cachedETag(t *testing.T, meta string) string {
+	t.Helper()
+	var v api.Validators
+	require.NoError(t, json.Unmarshal([]byte(meta), &v))
+	return v.ETag
+}
+
+func TestItemsService_RevalidatesWithETag(t *testing.T) {
+	srv := &etagServer{etag: `"v1"`, title: "first"}
+	svc, cm := newPolicyService(t, srv, NetworkFirst)
+	ctx := context.Background()
+	id := openapiUUIDFromString(t, policyItemID)
+	key := "items:get:" + policyItemID
+
+	_, err := svc.Get(ctx, id)
+	require.NoError(t, err)
+	pj, _, meta, err := cm.Peek(key)
+	require.NoError(t, err)
+	require.Equal(t, `"v1"`, cachedETag(t, meta))
+
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, cm.PutWithTimestamp(key, pj, nil, meta, old))
+	resp, err := svc.Get(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, "first", *resp.JSON200.Title)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+	require.False(t, SourceOf(resp.HTTPResponse).Cached, "ответ подтверждён сервером")
+	require.Equal(t, 1, srv.full)
+	require.Equal(t, 1, srv.notModified)
+	_, ts, _, err := cm.Peek(key)
+	require.NoError(t, err)
+	require.True(t, cm.IsFresh(ts), "304 продлевает запись")
+
+	srv.etag, srv.title = `"v2"`, "second"
+	resp, err = svc.Get(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, "second", *resp.JSON200.Title)
+	require.Equal(t, 2, srv.full)
+	_, _, meta, err = cm.Peek(key)
+	require.NoError(t, err)
+	require.Equal(t, `"v2"`, cachedETag(t, meta))
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"strings"
+
+	openapi_types "github.com/oapi-codegen/runtime/types"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/cache"
+	"github.com/GoLessons/sufir-keeper-client/internal/e2e"
+)
+
+// ErrSearchRequired — локальный индекс отвечает только на поисковые запросы.
+var ErrSearchRequired = errors.New("локальный поиск требует строку поиска")
+
+const sourceIndex = "index"
+
+// Ключи meta, похожие на секреты, не индексируются.
+var secretMeta = []string{"token", "password", "passwd", "secret", "private"}
+
+func searchMeta(meta *map[string]string) map[string]string {
+	if meta == nil {
+		return nil
+	}
+	out := map[string]string{}
+	for k, v := range *meta {
+		lk := strings.ToLower(k)
+		if k == MetaClientID || strings.HasPrefix(lk, e2e.MetaMarker) {
+			continue
+		}
+		secret := false
+		for _, s := range secretMeta {
+			secret = secret || strings.Contains(lk, s)
+		}
+		if !secret {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Только открытые поля: секреты в индекс не попадают.
+func searchFields(raw []byte) (string, map[string]string) {
+	var d struct {
+		Type       string `json:"type"`
+		Login      string `json:"login"`
+		CardHolder string `json:"card_holder"`
+		Filename   string `json:"filename"`
+	}
+	if json.Unmarshal(raw, &d) != nil {
+		return "", nil
+	}
+	switch apigen.ItemType(d.Type) {
+	case apigen.ItemTypeCREDENTIAL:
+		return d.Type, map[string]string{"login": d.Login}
+	case apigen.ItemTypeCARD:
+		return d.Type, map[string]string{"card_holder": d.CardHolder}
+	case apigen.ItemTypeBINARY:
+		return d.Type, map[string]string{"filename": d.Filename}
+	case apigen.ItemTypeTEXT:
+		return d.Type, map[string]string{}
+	}
+	return "", nil
+}
+
+func (s *ItemsService) indexing() bool {
+	return s.cfg.Cache.Enabled && s.c != nil
+}
+
+func (s *ItemsService) indexItem(item *apigen.ItemResponse) {
+	if !s.indexing() || item == nil || item.Id == nil {
+		return
+	}
+	doc := cache.SearchDoc{ID: item.Id.String(), Meta: searchMeta(item.Meta), CreatedAt: item.CreatedAt, UpdatedAt: item.UpdatedAt}
+	if item.Title != nil {
+		doc.Title = *item.Title
+	}
+	if item.Data != nil {
+		if raw, err := item.Data.MarshalJSON(); err == nil {
+			doc.Type, doc.Fields = searchFields(raw)
+		}
+	}
+	_ = s.c.Index(doc)
+}
+
+func (s *ItemsService) indexList(params *apigen.GetItemsParams, resp *apigen.GetItemsResponse) {
+	if !s.indexing() || resp == nil || resp.JSON200 == nil || resp.JSON200.Items == nil || SourceOf(resp.HTTPResponse).Cached {
+		return
+	}
+	for _, it := range *resp.JSON200.Items {
+		if it.Id == nil {
+			continue
+		}
+		doc := cache.SearchDoc{ID: it.Id.String(), Meta: searchMeta(it.Meta), CreatedAt: it.CreatedAt, UpdatedAt: it.UpdatedAt}
+		if it.Title != nil {
+			doc.Title = *it.Title
+		}
+		if params != nil && params.Type != nil {
+			doc.Type = string(*params.Type)
+		}
+		if it.Meta != nil && (*it.Meta)[e2e.MetaMarker] != "" {
+			// Зашифрованные записи хранятся на сервере как TEXT.
+			doc.Type = (*it.Meta)[e2e.MetaType]
+		}
+		_ = s.c.Index(doc)
+	}
+}
+
+func (s *ItemsService) indexUpdate(id openapi_types.UUID, title *string, meta *map[string]string, data []byte) {
+	if !s.indexing() {
+		return
+	}
+	doc := cache.SearchDoc{ID: id.String(), Meta: searchMeta(meta)}
+	if title != nil {
+		doc.Title = *title
+	}
+	if data != nil {
+		doc.Type, doc.Fields = searchFields(data)
+	}
+	_ = s.c.Index(doc)
+}
+
+func (s *ItemsService) unindex(id openapi_types.UUID) {
+	if s.indexing() {
+		_ = s.c.Unindex(id.String())
+	}
+}
+
+// SearchLocal ищет по локальному индексу без обращения к серверу.
+func (s *ItemsService) SearchLocal(params *apigen.GetItemsParams) (*apigen.GetItemsResponse, error) {
+	resp, err := s.searchLocal(params)
+	return s.overlayList(params, resp, err)
+}
+
+func (s *ItemsService) searchLocal(params *apigen.GetItemsParams) (*apigen.GetItemsResponse, error) {
+	if params == nil || params.S == nil || strings.TrimSpace(*params.S) == "" {
+		return nil, ErrSearchRequired
+	}
+	if !s.indexing() {
+		return nil, ErrNotCached
+	}
+	var itemType string
+	if params.Type != nil {
+		itemType = string(*params.Type)
+	}
+	hits, err := s.c.Search(*params.S, itemType)
+	if err != nil {
+		return nil, err
+	}
+	total := len(hits)
+	hits = paginate(hits, params)
+	items := make([]apigen.ItemListResponse, 0, len(hits))
+	for _, h := range hits {
+		var id openapi_types.UUID
+		if id.UnmarshalText([]byte(h.ID)) != nil {
+			continue
+		}
+		it := apigen.ItemListResponse{Id: &id, CreatedAt: h.CreatedAt, UpdatedAt: h.UpdatedAt}
+		if h.Title != "" {
+			title := h.Title
+			it.Title = &title
+		}
+		if len(h.Meta) > 0 {
+			meta := maps.Clone(h.Meta)
+			it.Meta = &meta
+		}
+		items = append(items, it)
+	}
+	body, err := json.Marshal(map[string]any{"items": items, "total": total})
+	if err != nil {
+		return nil, err
+	}
+	h := http.Header{}
+	h.Set(headerSource, sourceIndex)
+	resp := &apigen.GetItemsResponse{Body: body, HTTPResponse: &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Header: h}}
+	return resp, json.Unmarshal(body, &resp.JSON200)
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+)
+
+func credentialItem(t *testing.T, title, login, password string, meta map[string]string) apigen.ItemCreate {
+	t.Helper()
+	var d apigen.ItemCreate_Data
+	require.NoError(t, d.FromCredentialData(apigen.CredentialData{Type: apigen.CREDENTIAL, Login: login, Password: password}))
+	return apigen.ItemCreate{Title: title, Data: d, Meta: &meta}
+}
+
+func listTitles(t *testing.T, resp *apigen.GetItemsResponse) []string {
+	t.Helper()
+	require.NotNil(t, resp.JSON200)
+	out := []string{}
+	for _, it := range *resp.JSON200.Items {
+		out = append(out, *it.Title)
+	}
+	return out
+}
+
+func TestItemsService_SearchLocalNeverIndexesSecrets(t *testing.T) {
+	srv := &memServer{items: map[string]map[string]any{}}
+	svc, _ := newPolicyService(t, srv, NetworkFirst)
+	ctx := context.Background()
+
+	created, err := svc.Create(ctx, credentialItem(t, "GitHub", "octocat", "hunter2secret", map[string]string{"url": "github.com", "session_token": "tok123"}))
+	require.NoError(t, err)
+	_, err = svc.Create(ctx, textItem(t, "Рецепт", "мука сахар"))
+	require.NoError(t, err)
+
+	search := func(q string, typ *apigen.ItemType) []string {
+		resp, err := svc.SearchLocal(&apigen.GetItemsParams{S: &q, Type: typ})
+		require.NoError(t, err)
+		require.True(t, SourceOf(resp.HTTPResponse).Index)
+		return listTitles(t, resp)
+	}
+	require.Equal(t, []string{"GitHub"}, search("git", nil))
+	require.Equal(t, []string{"GitHub"}, search("octo", nil))
+	require.Equal(t, []string{"GitHub"}, search("github.com", nil))
+	require.Equal(t, []string{"Рецепт"}, search("рец", nil))
+	for _, secret := range []string{"hunter2secret", "tok123", "мука"} {
+		require.Empty(t, search(secret, nil), secret)
+	}
+	text := apigen.ItemTypeTEXT
+	require.Empty(t, search("git", &text))
+
+	_, err = svc.SearchLocal(&apigen.GetItemsParams{})
+	require.ErrorIs(t, err, ErrSearchRequired)
+
+	_, err = svc.Delete(ctx, *created.JSON201.Id)
+	require.NoError(t, err)
+	require.Empty(t, search("git", nil))
+}
+
+func TestItemsService_ListSearchFallsBackToIndex(t *testing.T) {
+	srv := &memServer{items: map[string]map[string]any{}}
+	svc, _ := newPolicyService(t, srv, NetworkFirst)
+	ctx := context.Background()
+	srv.items["00000000-0000-0000-0000-000000000001"] = map[string]any{"title": "Deploy key", "meta": map[string]any{"host": "prod"}}
+	srv.items["00000000-0000-0000-0000-000000000002"] = map[string]any{"title": "Почта"}
+
+	_, err := svc.List(ctx, &apigen.GetItemsParams{})
+	require.NoError(t, err)
+
+	srv.mu.Lock()
+	srv.down = true
+	srv.mu.Unlock()
+	q := "prod"
+	resp, err := svc.List(ctx, &apigen.GetItemsParams{S: &q})
+	require.NoError(t, err)
+	require.True(t, SourceOf(resp.HTTPResponse).Index)
+	require.Equal(t, []string{"Deploy key"}, listTitles(t, resp))
+}
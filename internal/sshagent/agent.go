@@ -0,0 +1,411 @@
+package sshagent
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/sync/singleflight"
+
+	openapi_types "github.com/oapi-codegen/runtime/types"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apiutil"
+	"github.com/GoLessons/sufir-keeper-client/internal/logging"
+)
+
+const (
+	MetaKind   = "kind"
+	KindSSHKey = "ssh-key"
+)
+
+var errNotKey = errors.New("not a private key")
+
+var (
+	ErrLocked       = errors.New("agent locked")
+	ErrKeyNotFound  = errors.New("key not found")
+	ErrDenied       = errors.New("use of key denied")
+	ErrNotSupported = errors.New("operation not supported, keys are managed in the vault")
+)
+
+type Vault interface {
+	FindByMeta(ctx context.Context, itemType *apigen.ItemType, key, value string) ([]apigen.ItemResponse, error)
+	Find(ctx context.Context, itemType *apigen.ItemType, match func(apigen.ItemListResponse) bool) ([]apigen.ItemResponse, error)
+}
+
+type FileDownloader interface {
+	DownloadFile(ctx context.Context, fileID openapi_types.UUID) (*apigen.DownloadFileResponse, error)
+}
+
+type ConfirmFunc func(comment string) bool
+
+type PassphraseFunc func(comment string) ([]byte, error)
+
+type Options struct {
+	Vault      Vault
+	Files      FileDownloader
+	Log        logging.Logger
+	Confirm    ConfirmFunc
+	Passphrase PassphraseFunc
+}
+
+type loadedKey struct {
+	signer    ssh.Signer
+	comment   string
+	updatedAt int64
+}
+
+type Agent struct {
+	ctx        context.Context
+	vault      Vault
+	files      FileDownloader
+	log        logging.Logger
+	confirm    ConfirmFunc
+	passphrase PassphraseFunc
+	keys       map[string]loadedKey
+	notKeys    map[string]int64
+	lockPass   []byte
+	reloads    singleflight.Group
+	mu         sync.Mutex
+	locked     bool
+}
+
+var _ agent.ExtendedAgent = (*Agent)(nil)
+
+func New(ctx context.Context, opts Options) *Agent {
+	return &Agent{
+		ctx:        ctx,
+		vault:      opts.Vault,
+		files:      opts.Files,
+		log:        opts.Log,
+		confirm:    opts.Confirm,
+		passphrase: opts.Passphrase,
+		keys:       make(map[string]loadedKey),
+		notKeys:    make(map[string]int64),
+	}
+}
+
+func (a *Agent) List() ([]*agent.Key, error) {
+	if err := a.reload(); err != nil {
+		if errors.Is(err, ErrLocked) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.locked {
+		return nil, nil
+	}
+	out := make([]*agent.Key, 0, len(a.keys))
+	for _, k := range a.sortedKeys() {
+		pub := k.signer.PublicKey()
+		out = append(out, &agent.Key{Format: pub.Type(), Blob: pub.Marshal(), Comment: k.comment})
+	}
+	return out, nil
+}
+
+func (a *Agent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	return a.SignWithFlags(key, data, 0)
+}
+
+func (a *Agent) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	k, ok, err := a.find(key)
+	if err == nil && !ok {
+		if err = a.reload(); err == nil {
+			k, ok, err = a.find(key)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	if a.confirm != nil && !a.confirm(k.comment) {
+		return nil, ErrDenied
+	}
+	algo := ""
+	switch {
+	case flags&agent.SignatureFlagRsaSha256 != 0:
+		algo = ssh.KeyAlgoRSASHA256
+	case flags&agent.SignatureFlagRsaSha512 != 0:
+		algo = ssh.KeyAlgoRSASHA512
+	}
+	if algo != "" {
+		as, ok := k.signer.(ssh.AlgorithmSigner)
+		if !ok {
+			return nil, fmt.Errorf("key %s does not support %s", k.comment, algo)
+		}
+		return as.SignWithAlgorithm(nil, data, algo)
+	}
+	return k.signer.Sign(nil, data)
+}
+
+func (a *Agent) Signers() ([]ssh.Signer, error) {
+	if err := a.reload(); err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.locked {
+		return nil, ErrLocked
+	}
+	keys := a.sortedKeys()
+	out := make([]ssh.Signer, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, k.signer)
+	}
+	return out, nil
+}
+
+func (a *Agent) Add(agent.AddedKey) error { return ErrNotSupported }
+
+func (a *Agent) Remove(ssh.PublicKey) error { return ErrNotSupported }
+
+func (a *Agent) RemoveAll() error { return ErrNotSupported }
+
+func (a *Agent) Lock(passphrase []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.locked {
+		return ErrLocked
+	}
+	a.locked = true
+	a.lockPass = append([]byte(nil), passphrase...)
+	a.keys = make(map[string]loadedKey)
+	return nil
+}
+
+func (a *Agent) Unlock(passphrase []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.locked {
+		return errors.New("agent not locked")
+	}
+	if subtle.ConstantTimeCompare(passphrase, a.lockPass) != 1 {
+		return errors.New("incorrect passphrase")
+	}
+	a.locked = false
+	a.lockPass = nil
+	return nil
+}
+
+func (a *Agent) Extension(string, []byte) ([]byte, error) {
+	return nil, agent.ErrExtensionUnsupported
+}
+
+func (a *Agent) Serve(ctx context.Context, ln net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+	}()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer func() { _ = conn.Close() }()
+			_ = agent.ServeAgent(a, conn)
+		}()
+	}
+}
+
+func ParseKey(pemBytes []byte) (ssh.PublicKey, error) {
+	raw, err := ssh.ParseRawPrivateKey(pemBytes)
+	if err != nil {
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) && missing.PublicKey != nil {
+			return missing.PublicKey, nil
+		}
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(raw)
+	if err != nil {
+		return nil, err
+	}
+	return signer.PublicKey(), nil
+}
+
+func (a *Agent) find(key ssh.PublicKey) (loadedKey, bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.locked {
+		return loadedKey{}, false, ErrLocked
+	}
+	k, ok := a.lookup(key)
+	return k, ok, nil
+}
+
+func (a *Agent) lookup(key ssh.PublicKey) (loadedKey, bool) {
+	blob := key.Marshal()
+	for _, k := range a.keys {
+		if bytes.Equal(k.signer.PublicKey().Marshal(), blob) {
+			return k, true
+		}
+	}
+	return loadedKey{}, false
+}
+
+func (a *Agent) sortedKeys() []loadedKey {
+	ids := make([]string, 0, len(a.keys))
+	for id := range a.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	out := make([]loadedKey, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, a.keys[id])
+	}
+	return out
+}
+
+// reload загружает ключи из хранилища без блокировки: запрос к серверу и
+// ввод пароля не задерживают других клиентов. Одновременные вызовы
+// объединяются.
+func (a *Agent) reload() error {
+	_, err, _ := a.reloads.Do("", func() (any, error) {
+		return nil, a.loadKeys()
+	})
+	return err
+}
+
+func (a *Agent) loadKeys() error {
+	a.mu.Lock()
+	locked, prevKeys, prevNotKeys := a.locked, a.keys, a.notKeys
+	a.mu.Unlock()
+	if locked {
+		return ErrLocked
+	}
+	tagged, err := a.vault.FindByMeta(a.ctx, nil, MetaKind, KindSSHKey)
+	if err != nil {
+		return err
+	}
+	// Файлы без метки kind проверяются по содержимому; те, что не оказались
+	// ключами, не скачиваются снова, пока не изменятся.
+	var files []apigen.ItemResponse
+	if a.files != nil {
+		binary := apigen.ItemTypeBINARY
+		files, err = a.vault.Find(a.ctx, &binary, func(it apigen.ItemListResponse) bool {
+			if it.Id == nil || (it.Meta != nil && (*it.Meta)[MetaKind] != "") {
+				return false
+			}
+			at, ok := prevNotKeys[it.Id.String()]
+			return !ok || at != unixNano(it.UpdatedAt)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	next := make(map[string]loadedKey, len(tagged)+len(files))
+	notKeys := make(map[string]int64)
+	for i, it := range append(tagged, files...) {
+		if it.Id == nil {
+			continue
+		}
+		id, updatedAt := it.Id.String(), unixNano(it.UpdatedAt)
+		if prev, ok := prevKeys[id]; ok && prev.updatedAt == updatedAt {
+			next[id] = prev
+			continue
+		}
+		comment := id
+		if it.Title != nil && *it.Title != "" {
+			comment = *it.Title
+		}
+		signer, err := a.loadSigner(it, comment)
+		if err != nil {
+			if i >= len(tagged) && errors.Is(err, errNotKey) {
+				notKeys[id] = updatedAt
+				continue
+			}
+			a.warn("skip ssh key", id, err)
+			continue
+		}
+		next[id] = loadedKey{signer: signer, comment: comment, updatedAt: updatedAt}
+	}
+	for id, at := range prevNotKeys {
+		if _, ok := next[id]; !ok {
+			if _, ok := notKeys[id]; !ok {
+				notKeys[id] = at
+			}
+		}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.locked {
+		return ErrLocked
+	}
+	a.keys, a.notKeys = next, notKeys
+	return nil
+}
+
+func unixNano(t *time.Time) int64 {
+	if t == nil {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func (a *Agent) loadSigner(it apigen.ItemResponse, comment string) (ssh.Signer, error) {
+	if it.Data == nil {
+		return nil, errors.New("item has no data")
+	}
+	var pemBytes []byte
+	if v, err := it.Data.AsTextData(); err == nil && v.Type == apigen.TEXT {
+		pemBytes = []byte(v.Value)
+	} else if b, err := it.Data.AsBinaryData(); err == nil && b.Type == apigen.BinaryDataTypeBINARY {
+		if a.files == nil {
+			return nil, errors.New("file downloads unavailable")
+		}
+		resp, err := a.files.DownloadFile(a.ctx, b.Id)
+		if err != nil {
+			return nil, err
+		}
+		if code := resp.StatusCode(); code < 200 || code >= 300 {
+			return nil, apiutil.Error{Status: code, Message: http.StatusText(code)}
+		}
+		pemBytes = resp.Body
+	} else {
+		return nil, errors.New("unsupported item type")
+	}
+	raw, err := ssh.ParseRawPrivateKey(pemBytes)
+	if err != nil {
+		var missing *ssh.PassphraseMissingError
+		if !errors.As(err, &missing) {
+			return nil, fmt.Errorf("%w: %v", errNotKey, err)
+		}
+		if a.passphrase == nil {
+			return nil, err
+		}
+		pass, perr := a.passphrase(comment)
+		if perr != nil {
+			return nil, perr
+		}
+		raw, err = ssh.ParseRawPrivateKeyWithPassphrase(pemBytes, pass)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ssh.NewSignerFromKey(raw)
+}
+
+func (a *Agent) warn(msg, id string, err error) {
+	if a.log == nil {
+		return
+	}
+	a.log.Warn(msg, zap.String("id", id), zap.Error(err))
+}
@@ -0,0 +1,321 @@
+package sshagent
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/99designs/keyring"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	openapi_types "github.com/oapi-codegen/runtime/types"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/agentd"
+	"github.com/GoLessons/sufir-keeper-client/internal/api"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apiutil"
+	"github.com/GoLessons/sufir-keeper-client/internal/cache"
+	"github.com/GoLessons/sufir-keeper-client/internal/config"
+	"github.com/GoLessons/sufir-keeper-client/internal/service"
+)
+
+const keyItemID = "00000000-0000-0000-0000-0000000000aa"
+
+func newKeyServer(t *testing.T, pemText string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/items", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"items":[` +
+			`{"id":"` + keyItemID + `","title":"deploy","meta":{"kind":"ssh-key"}},` +
+			`{"id":"00000000-0000-0000-0000-0000000000bb","title":"note","meta":{"kind":"note"}}` +
+			`],"limit":100,"offset":0,"total":2}`))
+	})
+	mux.HandleFunc("/items/"+keyItemID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":    keyItemID,
+			"title": "deploy",
+			"meta":  map[string]string{"kind": "ssh-key"},
+			"data":  map[string]string{"type": "TEXT", "value": pemText},
+		})
+	})
+	return httptest.NewServer(mux)
+}
+
+func newTestService(t *testing.T, srv *httptest.Server) *service.ItemsService {
+	t.Helper()
+	dir := t.TempDir()
+	cm, err := cache.New(cache.Options{
+		Path:       filepath.Join(dir, "cache.db"),
+		TTLMinutes: 5,
+		KeyringConfig: keyring.Config{
+			AllowedBackends:  []keyring.BackendType{keyring.FileBackend},
+			FileDir:          dir,
+			FilePasswordFunc: func(string) (string, error) { return "pw", nil },
+			ServiceName:      "sufir-keeper-client",
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = cm.Close() })
+	apiClient, err := apigen.NewClientWithResponses(srv.URL, apigen.WithHTTPClient(srv.Client()))
+	require.NoError(t, err)
+	cfg := config.Config{}
+	cfg.Cache.Enabled = true
+	return service.NewItemsService(api.NewWrapperFromAPI(apiClient), cm, cfg)
+}
+
+func newTestKey(t *testing.T) (ed25519.PublicKey, string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	require.NoError(t, err)
+	return pub, string(pem.EncodeToMemory(block))
+}
+
+func startAgent(t *testing.T, opts Options) agent.ExtendedAgent {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "ska")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	sock := filepath.Join(dir, "agent.sock")
+	ln, err := agentd.Listen(sock)
+	require.NoError(t, err)
+	fi, err := os.Stat(sock)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	a := New(ctx, opts)
+	go func() { _ = a.Serve(ctx, ln) }()
+	conn, err := net.Dial("unix", sock)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return agent.NewClient(conn)
+}
+
+func TestAgent_ListAndSignOverSocket(t *testing.T) {
+	pub, pemText := newTestKey(t)
+	srv := newKeyServer(t, pemText)
+	defer srv.Close()
+	svc := newTestService(t, srv)
+
+	client := startAgent(t, Options{Vault: svc})
+	keys, err := client.List()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.Equal(t, "deploy", keys[0].Comment)
+
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	require.Equal(t, sshPub.Marshal(), keys[0].Blob)
+
+	data := []byte("challenge")
+	sig, err := client.Sign(keys[0], data)
+	require.NoError(t, err)
+	require.NoError(t, sshPub.Verify(data, sig))
+
+	require.Error(t, client.Add(agent.AddedKey{PrivateKey: ed25519.NewKeyFromSeed(make([]byte, 32))}))
+}
+
+func TestAgent_ConfirmDeniesSign(t *testing.T) {
+	_, pemText := newTestKey(t)
+	srv := newKeyServer(t, pemText)
+	defer srv.Close()
+	svc := newTestService(t, srv)
+
+	var asked string
+	client := startAgent(t, Options{Vault: svc, Confirm: func(comment string) bool {
+		asked = comment
+		return false
+	}})
+	keys, err := client.List()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	_, err = client.Sign(keys[0], []byte("x"))
+	require.Error(t, err)
+	require.Equal(t, "deploy", asked)
+}
+
+func TestAgent_LockHidesKeys(t *testing.T) {
+	_, pemText := newTestKey(t)
+	srv := newKeyServer(t, pemText)
+	defer srv.Close()
+	svc := newTestService(t, srv)
+
+	client := startAgent(t, Options{Vault: svc})
+	require.NoError(t, client.Lock([]byte("pw")))
+	keys, err := client.List()
+	require.NoError(t, err)
+	require.Empty(t, keys)
+	require.Error(t, client.Unlock([]byte("wrong")))
+	require.NoError(t, client.Unlock([]byte("pw")))
+	keys, err = client.List()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+}
+
+func TestParseKeyEncrypted(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte("secret"))
+	require.NoError(t, err)
+	got, err := ParseKey(pem.EncodeToMemory(block))
+	require.NoError(t, err)
+	want, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	require.Equal(t, want.Marshal(), got.Marshal())
+
+	_, err = ParseKey([]byte("not a key"))
+	require.Error(t, err)
+}
+
+type gatedVault struct {
+	item apigen.ItemResponse
+	gate chan struct{}
+}
+
+func (v *gatedVault) FindByMeta(ctx context.Context, _ *apigen.ItemType, _, _ string) ([]apigen.ItemResponse, error) {
+	select {
+	case <-v.gate:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return []apigen.ItemResponse{v.item}, nil
+}
+
+func (v *gatedVault) Find(context.Context, *apigen.ItemType, func(apigen.ItemListResponse) bool) ([]apigen.ItemResponse, error) {
+	return nil, nil
+}
+
+type fileVault struct {
+	files []apigen.ItemResponse
+}
+
+func (v *fileVault) FindByMeta(context.Context, *apigen.ItemType, string, string) ([]apigen.ItemResponse, error) {
+	return nil, nil
+}
+
+func (v *fileVault) Find(_ context.Context, itemType *apigen.ItemType, match func(apigen.ItemListResponse) bool) ([]apigen.ItemResponse, error) {
+	if itemType == nil || *itemType != apigen.ItemTypeBINARY {
+		return nil, nil
+	}
+	var out []apigen.ItemResponse
+	for _, it := range v.files {
+		if match(apigen.ItemListResponse{Id: it.Id, Meta: it.Meta, Title: it.Title, UpdatedAt: it.UpdatedAt}) {
+			out = append(out, it)
+		}
+	}
+	return out, nil
+}
+
+type fakeFiles struct {
+	bodies    map[openapi_types.UUID][]byte
+	downloads map[openapi_types.UUID]int
+}
+
+func (f *fakeFiles) DownloadFile(_ context.Context, id openapi_types.UUID) (*apigen.DownloadFileResponse, error) {
+	f.downloads[id]++
+	body, ok := f.bodies[id]
+	if !ok {
+		return &apigen.DownloadFileResponse{Body: []byte(`{"message":"not found"}`), HTTPResponse: &http.Response{StatusCode: http.StatusNotFound}}, nil
+	}
+	return &apigen.DownloadFileResponse{Body: body, HTTPResponse: &http.Response{StatusCode: http.StatusOK}}, nil
+}
+
+func binaryItem(t *testing.T, title string, fileID openapi_types.UUID) apigen.ItemResponse {
+	t.Helper()
+	var data apigen.ItemResponse_Data
+	require.NoError(t, data.FromBinaryData(apigen.BinaryData{Type: apigen.BinaryDataTypeBINARY, Id: fileID, Filename: title}))
+	id := uuid.New()
+	return apigen.ItemResponse{Id: &id, Title: &title, Data: &data}
+}
+
+func TestAgent_LoadsUntaggedBinaryKeys(t *testing.T) {
+	pub, pemText := newTestKey(t)
+	keyFile, noteFile, goneFile := uuid.New(), uuid.New(), uuid.New()
+	files := &fakeFiles{
+		bodies:    map[openapi_types.UUID][]byte{keyFile: []byte(pemText), noteFile: []byte("just a note")},
+		downloads: map[openapi_types.UUID]int{},
+	}
+	v := &fileVault{files: []apigen.ItemResponse{
+		binaryItem(t, "id_ed25519", keyFile),
+		binaryItem(t, "notes.txt", noteFile),
+		binaryItem(t, "gone", goneFile),
+	}}
+	a := New(context.Background(), Options{Vault: v, Files: files})
+
+	keys, err := a.List()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.Equal(t, "id_ed25519", keys[0].Comment)
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	require.Equal(t, sshPub.Marshal(), keys[0].Blob)
+
+	_, err = a.List()
+	require.NoError(t, err)
+	require.Equal(t, 1, files.downloads[keyFile])
+	require.Equal(t, 1, files.downloads[noteFile], "файл, не оказавшийся ключом, не скачивается снова")
+	require.Equal(t, 2, files.downloads[goneFile], "ошибка скачивания не запоминается")
+}
+
+func TestAgent_DownloadErrorIsAPIError(t *testing.T) {
+	files := &fakeFiles{bodies: map[openapi_types.UUID][]byte{}, downloads: map[openapi_types.UUID]int{}}
+	a := New(context.Background(), Options{Files: files})
+	it := binaryItem(t, "gone", uuid.New())
+	_, err := a.loadSigner(it, "gone")
+	var apiErr apiutil.Error
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusNotFound, apiErr.Status)
+}
+
+func TestAgent_SlowReloadDoesNotBlockSign(t *testing.T) {
+	pub, pemText := newTestKey(t)
+	var data apigen.ItemResponse_Data
+	require.NoError(t, data.FromTextData(apigen.TextData{Type: apigen.TEXT, Value: pemText}))
+	id := uuid.MustParse(keyItemID)
+	title := "deploy"
+	v := &gatedVault{item: apigen.ItemResponse{Id: &id, Title: &title, Data: &data}, gate: make(chan struct{}, 1)}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	a := New(ctx, Options{Vault: v})
+
+	v.gate <- struct{}{}
+	_, err := a.List()
+	require.NoError(t, err)
+
+	listed := make(chan error, 1)
+	go func() {
+		_, err := a.List()
+		listed <- err
+	}()
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	signed := make(chan error, 1)
+	go func() {
+		_, err := a.Sign(sshPub, []byte("challenge"))
+		signed <- err
+	}()
+	select {
+	case err := <-signed:
+		require.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("подпись ждёт перезагрузки ключей")
+	}
+	v.gate <- struct{}{}
+	require.NoError(t, <-listed)
+}
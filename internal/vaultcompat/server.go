@@ -0,0 +1,427 @@
+package vaultcompat
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	openapi_types "github.com/oapi-codegen/runtime/types"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+)
+
+const (
+	MetaFolder   = "folder"
+	DefaultMount = "secret"
+	TokenHeader  = "X-Vault-Token"
+)
+
+var (
+	errNotFound   = errors.New("secret not found")
+	errReadOnly   = errors.New("BINARY items are read-only")
+	errBadPath    = errors.New("invalid secret path")
+	errNoTypeHint = errors.New("cannot infer item type, set \"type\" or use value/login+password/card_number fields")
+)
+
+type Items interface {
+	ListAll(ctx context.Context, itemType *apigen.ItemType) ([]apigen.ItemListResponse, error)
+	Get(ctx context.Context, id openapi_types.UUID) (*apigen.GetItemResponse, error)
+	Create(ctx context.Context, body apigen.ItemCreate) (*apigen.CreateItemResponse, error)
+	Update(ctx context.Context, id openapi_types.UUID, body apigen.UpdateItemJSONRequestBody) (*apigen.UpdateItemResponse, error)
+}
+
+type Options struct {
+	Items Items
+	Token string
+	Mount string
+}
+
+// Server отдаёт подмножество API Vault KV v2 поверх записей хранилища:
+// путь secret/data/<folder>/<title> соответствует meta folder и заголовку.
+type Server struct {
+	items Items
+	token string
+	mount string
+}
+
+func New(opts Options) *Server {
+	mount := strings.Trim(opts.Mount, "/")
+	if mount == "" {
+		mount = DefaultMount
+	}
+	return &Server{items: opts.Items, token: opts.Token, mount: mount}
+}
+
+func GenerateToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "kc." + hex.EncodeToString(b), nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		writeErrors(w, http.StatusForbidden, "permission denied")
+		return
+	}
+	prefix := "/v1/" + s.mount + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		writeErrors(w, http.StatusNotFound, "no handler for route")
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.Path, prefix)
+	kind, p, _ := strings.Cut(rest, "/")
+	if kind != "data" && kind != "metadata" {
+		writeErrors(w, http.StatusNotFound, "no handler for route")
+		return
+	}
+	p, err := cleanPath(p)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	isList := r.Method == "LIST" || (r.Method == http.MethodGet && r.URL.Query().Get("list") == "true")
+	switch {
+	case isList:
+		s.list(w, r, p)
+	case kind != "data":
+		writeErrors(w, http.StatusMethodNotAllowed, "unsupported operation")
+	case r.Method == http.MethodGet:
+		s.read(w, r, p)
+	case r.Method == http.MethodPut || r.Method == http.MethodPost:
+		s.write(w, r, p)
+	default:
+		writeErrors(w, http.StatusMethodNotAllowed, "unsupported operation")
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	got := r.Header.Get(TokenHeader)
+	if got == "" {
+		got = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if s.token == "" || got == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) == 1
+}
+
+func (s *Server) read(w http.ResponseWriter, r *http.Request, p string) {
+	item, err := s.lookup(r.Context(), p)
+	if err != nil {
+		writeLookupError(w, err)
+		return
+	}
+	data, err := Fields(item.Data)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	custom := map[string]string{}
+	if item.Meta != nil {
+		for k, v := range *item.Meta {
+			if k != MetaFolder {
+				custom[k] = v
+			}
+		}
+	}
+	md := metadata(item.CreatedAt, item.UpdatedAt)
+	md["custom_metadata"] = custom
+	writeData(w, map[string]any{"data": data, "metadata": md})
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request, p string) {
+	all, err := s.items.ListAll(r.Context(), nil)
+	if err != nil {
+		writeErrors(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	seen := map[string]struct{}{}
+	for _, it := range all {
+		if it.Title == nil {
+			continue
+		}
+		folder := folderOf(it.Meta)
+		var key string
+		switch {
+		case folder == p:
+			key = *it.Title
+		case p == "" && folder != "":
+			key, _, _ = strings.Cut(folder, "/")
+			key += "/"
+		case strings.HasPrefix(folder, p+"/"):
+			key, _, _ = strings.Cut(strings.TrimPrefix(folder, p+"/"), "/")
+			key += "/"
+		default:
+			continue
+		}
+		seen[key] = struct{}{}
+	}
+	if len(seen) == 0 {
+		writeErrors(w, http.StatusNotFound)
+		return
+	}
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	writeData(w, map[string]any{"keys": keys})
+}
+
+func (s *Server) write(w http.ResponseWriter, r *http.Request, p string) {
+	if p == "" {
+		writeErrors(w, http.StatusBadRequest, errBadPath.Error())
+		return
+	}
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&body); err != nil || body.Data == nil {
+		writeErrors(w, http.StatusBadRequest, "request body must contain \"data\" object")
+		return
+	}
+	fields := make(map[string]string, len(body.Data))
+	for k, v := range body.Data {
+		sv, ok := v.(string)
+		if !ok {
+			writeErrors(w, http.StatusBadRequest, fmt.Sprintf("field %q must be a string", k))
+			return
+		}
+		fields[k] = sv
+	}
+	ctx := r.Context()
+	existing, err := s.lookup(ctx, p)
+	if err != nil && !errors.Is(err, errNotFound) {
+		writeLookupError(w, err)
+		return
+	}
+	var itemType apigen.ItemType
+	if existing != nil && existing.Data != nil {
+		itemType, err = typeOf(existing.Data)
+		if err != nil {
+			writeErrors(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	raw, err := buildData(itemType, fields)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if existing != nil && existing.Id != nil {
+		var d apigen.ItemUpdate_Data
+		if err := d.UnmarshalJSON(raw); err != nil {
+			writeErrors(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if _, err := s.items.Update(ctx, *existing.Id, apigen.ItemUpdate{Data: &d}); err != nil {
+			writeErrors(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		now := time.Now()
+		writeData(w, metadata(existing.CreatedAt, &now))
+		return
+	}
+	var d apigen.ItemCreate_Data
+	if err := d.UnmarshalJSON(raw); err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	folder, title := path.Split(p)
+	var meta map[string]string
+	if folder = strings.Trim(folder, "/"); folder != "" {
+		meta = map[string]string{MetaFolder: folder}
+	}
+	body2 := apigen.ItemCreate{Title: title, Data: d}
+	if meta != nil {
+		body2.Meta = &meta
+	}
+	if _, err := s.items.Create(ctx, body2); err != nil {
+		writeErrors(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	now := time.Now()
+	writeData(w, metadata(&now, &now))
+}
+
+func (s *Server) lookup(ctx context.Context, p string) (*apigen.ItemResponse, error) {
+	if p == "" {
+		return nil, errNotFound
+	}
+	folder, title := path.Split(p)
+	folder = strings.Trim(folder, "/")
+	all, err := s.items.ListAll(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, it := range all {
+		if it.Id == nil || it.Title == nil || *it.Title != title || folderOf(it.Meta) != folder {
+			continue
+		}
+		resp, err := s.items.Get(ctx, *it.Id)
+		if err != nil {
+			return nil, err
+		}
+		if resp.JSON200 == nil {
+			return nil, errNotFound
+		}
+		return resp.JSON200, nil
+	}
+	return nil, errNotFound
+}
+
+// Fields раскладывает типизированные данные записи в плоскую карту полей
+// без дискриминатора type.
+func Fields(data *apigen.ItemResponse_Data) (map[string]string, error) {
+	if data == nil {
+		return map[string]string{}, nil
+	}
+	raw, err := data.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		if k == "type" {
+			continue
+		}
+		out[k] = fmt.Sprint(v)
+	}
+	return out, nil
+}
+
+func typeOf(data *apigen.ItemResponse_Data) (apigen.ItemType, error) {
+	raw, err := data.MarshalJSON()
+	if err != nil {
+		return "", err
+	}
+	var t struct {
+		Type apigen.ItemType `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return "", err
+	}
+	return t.Type, nil
+}
+
+func buildData(itemType apigen.ItemType, fields map[string]string) ([]byte, error) {
+	if hint, ok := fields["type"]; ok {
+		if itemType != "" && apigen.ItemType(strings.ToUpper(hint)) != itemType {
+			return nil, fmt.Errorf("cannot change item type from %s", itemType)
+		}
+		itemType = apigen.ItemType(strings.ToUpper(hint))
+		delete(fields, "type")
+	}
+	if itemType == "" {
+		switch {
+		case fields["card_number"] != "":
+			itemType = apigen.ItemTypeCARD
+		case fields["login"] != "" || fields["password"] != "":
+			itemType = apigen.ItemTypeCREDENTIAL
+		case fields["value"] != "":
+			itemType = apigen.ItemTypeTEXT
+		default:
+			return nil, errNoTypeHint
+		}
+	}
+	var required []string
+	switch itemType {
+	case apigen.ItemTypeTEXT:
+		required = []string{"value"}
+	case apigen.ItemTypeCREDENTIAL:
+		required = []string{"login", "password"}
+	case apigen.ItemTypeCARD:
+		required = []string{"card_number", "card_holder", "expiry_date", "cvv"}
+	case apigen.ItemTypeBINARY:
+		return nil, errReadOnly
+	default:
+		return nil, fmt.Errorf("unsupported item type %q", itemType)
+	}
+	out := map[string]string{"type": string(itemType)}
+	for _, k := range required {
+		v := strings.TrimSpace(fields[k])
+		if v == "" {
+			return nil, fmt.Errorf("field %q is required for %s", k, itemType)
+		}
+		out[k] = fields[k]
+	}
+	return json.Marshal(out)
+}
+
+func cleanPath(p string) (string, error) {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return "", nil
+	}
+	for _, seg := range strings.Split(p, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return "", errBadPath
+		}
+	}
+	return p, nil
+}
+
+func folderOf(meta *map[string]string) string {
+	if meta == nil {
+		return ""
+	}
+	return strings.Trim((*meta)[MetaFolder], "/")
+}
+
+func metadata(created, updated *time.Time) map[string]any {
+	ts := time.Now()
+	if updated != nil {
+		ts = *updated
+	} else if created != nil {
+		ts = *created
+	}
+	return map[string]any{
+		"created_time":  ts.UTC().Format(time.RFC3339Nano),
+		"deletion_time": "",
+		"destroyed":     false,
+		"version":       1,
+	}
+}
+
+func writeData(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"request_id":     "",
+		"lease_id":       "",
+		"renewable":      false,
+		"lease_duration": 0,
+		"data":           data,
+	})
+}
+
+func writeErrors(w http.ResponseWriter, status int, msgs ...string) {
+	if msgs == nil {
+		msgs = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"errors": msgs})
+}
+
+func writeLookupError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errNotFound) {
+		writeErrors(w, http.StatusNotFound)
+		return
+	}
+	writeErrors(w, http.StatusBadGateway, err.Error())
+}
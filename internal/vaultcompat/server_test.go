@@ -0,0 +1,189 @@
+package vaultcompat
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/99designs/keyring"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GoLessons/sufir-keeper-client/internal/api"
+	"github.com/GoLessons/sufir-keeper-client/internal/api/apigen"
+	"github.com/GoLessons/sufir-keeper-client/internal/cache"
+	"github.com/GoLessons/sufir-keeper-client/internal/config"
+	"github.com/GoLessons/sufir-keeper-client/internal/service"
+)
+
+const testToken = "kc.test"
+
+type fakeBackend struct {
+	items map[string]map[string]any
+	next  int
+	mu    sync.Mutex
+}
+
+func (f *fakeBackend) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/items", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			var body map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			f.next++
+			id := fmt.Sprintf("00000000-0000-0000-0000-%012d", 100+f.next)
+			body["id"] = id
+			f.items[id] = body
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":"` + id + `"}`))
+			return
+		}
+		list := make([]map[string]any, 0, len(f.items))
+		for id, it := range f.items {
+			list = append(list, map[string]any{"id": id, "title": it["title"], "meta": it["meta"]})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"items": list, "total": len(list)})
+	})
+	mux.HandleFunc("/items/", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		id := strings.TrimPrefix(r.URL.Path, "/items/")
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPut || r.Method == http.MethodPatch {
+			var body map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if d, ok := body["data"]; ok {
+				f.items[id]["data"] = d
+			}
+		}
+		_ = json.NewEncoder(w).Encode(f.items[id])
+	})
+	return mux
+}
+
+func newTestServer(t *testing.T, f *fakeBackend) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewServer(f.handler())
+	t.Cleanup(backend.Close)
+	dir := t.TempDir()
+	cm, err := cache.New(cache.Options{
+		Path:       filepath.Join(dir, "cache.db"),
+		TTLMinutes: 5,
+		KeyringConfig: keyring.Config{
+			AllowedBackends:  []keyring.BackendType{keyring.FileBackend},
+			FileDir:          dir,
+			FilePasswordFunc: func(string) (string, error) { return "pw", nil },
+			ServiceName:      "sufir-keeper-client",
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = cm.Close() })
+	apiClient, err := apigen.NewClientWithResponses(backend.URL, apigen.WithHTTPClient(backend.Client()))
+	require.NoError(t, err)
+	cfg := config.Config{}
+	cfg.Cache.Enabled = true
+	svc := service.NewItemsService(api.NewWrapperFromAPI(apiClient), cm, cfg)
+	srv := httptest.NewServer(New(Options{Items: svc, Token: testToken}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func do(t *testing.T, srv *httptest.Server, method, p, token, body string) (int, map[string]any) {
+	t.Helper()
+	var rd io.Reader
+	if body != "" {
+		rd = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, srv.URL+p, rd)
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set(TokenHeader, token)
+	}
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	var out map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+func TestServer_RequiresToken(t *testing.T) {
+	srv := newTestServer(t, &fakeBackend{items: map[string]map[string]any{}})
+	code, body := do(t, srv, http.MethodGet, "/v1/secret/data/x", "", "")
+	require.Equal(t, http.StatusForbidden, code)
+	require.Equal(t, []any{"permission denied"}, body["errors"])
+	code, _ = do(t, srv, http.MethodGet, "/v1/secret/data/x", "wrong", "")
+	require.Equal(t, http.StatusForbidden, code)
+}
+
+func TestServer_ReadListWrite(t *testing.T) {
+	f := &fakeBackend{items: map[string]map[string]any{
+		"00000000-0000-0000-0000-000000000001": {
+			"id":    "00000000-0000-0000-0000-000000000001",
+			"title": "db",
+			"meta":  map[string]any{MetaFolder: "team/prod", "owner": "ops"},
+			"data":  map[string]any{"type": "CREDENTIAL", "login": "app", "password": "s3cr3t"},
+		},
+		"00000000-0000-0000-0000-000000000002": {
+			"id":    "00000000-0000-0000-0000-000000000002",
+			"title": "note",
+			"data":  map[string]any{"type": "TEXT", "value": "hello"},
+		},
+	}}
+	srv := newTestServer(t, f)
+
+	code, body := do(t, srv, http.MethodGet, "/v1/secret/data/team/prod/db", testToken, "")
+	require.Equal(t, http.StatusOK, code)
+	data := body["data"].(map[string]any)
+	require.Equal(t, map[string]any{"login": "app", "password": "s3cr3t"}, data["data"])
+	require.Equal(t, map[string]any{"owner": "ops"}, data["metadata"].(map[string]any)["custom_metadata"])
+
+	code, _ = do(t, srv, http.MethodGet, "/v1/secret/data/team/db", testToken, "")
+	require.Equal(t, http.StatusNotFound, code)
+
+	code, body = do(t, srv, "LIST", "/v1/secret/metadata/", testToken, "")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, []any{"note", "team/"}, body["data"].(map[string]any)["keys"])
+	code, body = do(t, srv, http.MethodGet, "/v1/secret/metadata/team?list=true", testToken, "")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, []any{"prod/"}, body["data"].(map[string]any)["keys"])
+	code, _ = do(t, srv, "LIST", "/v1/secret/metadata/missing", testToken, "")
+	require.Equal(t, http.StatusNotFound, code)
+
+	code, _ = do(t, srv, http.MethodPut, "/v1/secret/data/team/prod/db", testToken, `{"data":{"login":"app","password":"rotated"}}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "rotated", f.items["00000000-0000-0000-0000-000000000001"]["data"].(map[string]any)["password"])
+
+	code, _ = do(t, srv, http.MethodPost, "/v1/secret/data/apps/api-key", testToken, `{"data":{"value":"k"}}`)
+	require.Equal(t, http.StatusOK, code)
+	code, body = do(t, srv, http.MethodGet, "/v1/secret/data/apps/api-key", testToken, "")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, map[string]any{"value": "k"}, body["data"].(map[string]any)["data"])
+
+	code, _ = do(t, srv, http.MethodPut, "/v1/secret/data/apps/other", testToken, `{"data":{"foo":"bar"}}`)
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = do(t, srv, http.MethodPut, "/v1/secret/data/apps/../x", testToken, `{"data":{"value":"v"}}`)
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = do(t, srv, http.MethodDelete, "/v1/secret/data/apps/api-key", testToken, "")
+	require.Equal(t, http.StatusMethodNotAllowed, code)
+}
+
+func TestBuildData(t *testing.T) {
+	raw, err := buildData("", map[string]string{"card_number": "4111", "card_holder": "A", "expiry_date": "01/30", "cvv": "123"})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"type":"CARD","card_number":"4111","card_holder":"A","expiry_date":"01/30","cvv":"123"}`, string(raw))
+	_, err = buildData(apigen.ItemTypeTEXT, map[string]string{"type": "credential", "login": "a", "password": "b"})
+	require.Error(t, err)
+	_, err = buildData(apigen.ItemTypeBINARY, map[string]string{"value": "x"})
+	require.ErrorIs(t, err, errReadOnly)
+	_, err = buildData("", map[string]string{"login": "a"})
+	require.Error(t, err)
+}